@@ -0,0 +1,271 @@
+package options
+
+import (
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v2"
+
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"time"
+)
+
+const (
+	ConfigAPIVersion = "enn-policy/v1alpha1"
+	ConfigKind       = "EnnPolicyConfiguration"
+)
+
+// EnnPolicyConfiguration is the versioned format of the file passed by --config, e.g
+// apiVersion: enn-policy/v1alpha1
+// kind: EnnPolicyConfiguration
+// hostnameOverride: 192.168.1.10
+// kubeconfig: /etc/kubernetes/kubeconfig
+// ipRanges:
+// - 10.244.0.0/16
+// syncPeriod: 15m
+// logging:
+//   logLevel: 4
+type EnnPolicyConfiguration struct {
+	APIVersion          string                 `yaml:"apiVersion"`
+	Kind                string                 `yaml:"kind"`
+
+	Kubeconfig          string                 `yaml:"kubeconfig"`
+	Master              string                 `yaml:"master"`
+	HostnameOverride    string                 `yaml:"hostnameOverride"`
+
+	IPRanges            []string               `yaml:"ipRanges"`
+	ExcludeIPRanges     []string               `yaml:"excludeIPRanges"`
+
+	AcceptNodeGatewayIP *bool                  `yaml:"acceptNodeGatewayIP"`
+	AcceptLocalNode     *bool                  `yaml:"acceptLocalNode"`
+	HostNetworkPeers    *bool                  `yaml:"hostNetworkPeers"`
+	TerminatingPods     string                 `yaml:"terminatingPods"`
+	UnsupportedPolicyMode string               `yaml:"unsupportedPolicyMode"`
+	FlushConntrack      *bool                  `yaml:"flushConntrack"`
+	DenyAction          string                 `yaml:"denyAction"`
+	PolicyMode          string                 `yaml:"policyMode"`
+
+	ProxyMode           string                 `yaml:"proxyMode"`
+
+	HostEndpoint        HostEndpointConfiguration `yaml:"hostEndpoint"`
+
+	GlobalNetworkPolicy *bool                  `yaml:"globalNetworkPolicy"`
+	AdminNetworkPolicy  *bool                  `yaml:"adminNetworkPolicy"`
+	EgressServices      *bool                  `yaml:"egressServices"`
+
+	FlowLog             FlowLogConfiguration   `yaml:"flowLog"`
+	FQDN                FQDNConfiguration      `yaml:"fqdn"`
+	Exemptions          ExemptionsConfiguration `yaml:"exemptions"`
+
+	EventQPS            *float32               `yaml:"eventQPS"`
+	EventBurst          *int                   `yaml:"eventBurst"`
+	MetricsBindAddress  string                 `yaml:"metricsBindAddress"`
+
+	ConfigSyncPeriod    time.Duration          `yaml:"configSyncPeriod"`
+	SyncPeriod          time.Duration          `yaml:"syncPeriod"`
+	MinSyncPeriod       time.Duration          `yaml:"minSyncPeriod"`
+
+	Logging             LoggingConfiguration   `yaml:"logging"`
+}
+
+type HostEndpointConfiguration struct {
+	Namespace           string                 `yaml:"namespace"`
+	FailsafeInbound     []string               `yaml:"failsafeInbound"`
+	FailsafeOutbound    []string               `yaml:"failsafeOutbound"`
+}
+
+type FlowLogConfiguration struct {
+	Group               int                    `yaml:"group"`
+	File                string                 `yaml:"file"`
+	QPS                 *float32               `yaml:"qps"`
+	Burst               *int                   `yaml:"burst"`
+}
+
+type FQDNConfiguration struct {
+	MinTTL              time.Duration          `yaml:"minTTL"`
+	Nameservers         []string               `yaml:"nameservers"`
+}
+
+type ExemptionsConfiguration struct {
+	Namespaces          []string               `yaml:"namespaces"`
+	NamespaceLabels     []string               `yaml:"namespaceLabels"`
+	PodLabels           []string               `yaml:"podLabels"`
+	PriorityClasses     []string               `yaml:"priorityClasses"`
+}
+
+type LoggingConfiguration struct {
+	LogToStderr         *bool                  `yaml:"logToStderr"`
+	LogLevel            *int                   `yaml:"logLevel"`
+	LogDir              string                 `yaml:"logDir"`
+}
+
+// SetDefaultsEnnPolicyConfiguration fills every field which is not set in the file
+// with the same default value used by the command line flags
+func SetDefaultsEnnPolicyConfiguration(obj *EnnPolicyConfiguration){
+	defaults := NewEnnPolicyConfig()
+
+	if len(obj.IPRanges) == 0{
+		obj.IPRanges = defaults.IPRanges
+	}
+	if obj.AcceptNodeGatewayIP == nil{
+		obj.AcceptNodeGatewayIP = &defaults.AcceptNodeGatewayIP
+	}
+	if obj.AcceptLocalNode == nil{
+		obj.AcceptLocalNode = &defaults.AcceptLocalNode
+	}
+	if obj.HostNetworkPeers == nil{
+		obj.HostNetworkPeers = &defaults.HostNetworkPeers
+	}
+	if obj.FlushConntrack == nil{
+		obj.FlushConntrack = &defaults.FlushConntrack
+	}
+	if obj.ProxyMode == ""{
+		obj.ProxyMode = defaults.ProxyMode
+	}
+	if obj.TerminatingPods == ""{
+		obj.TerminatingPods = defaults.TerminatingPods
+	}
+	if obj.UnsupportedPolicyMode == ""{
+		obj.UnsupportedPolicyMode = defaults.UnsupportedPolicyMode
+	}
+	if obj.DenyAction == ""{
+		obj.DenyAction = defaults.DenyAction
+	}
+	if obj.PolicyMode == ""{
+		obj.PolicyMode = defaults.PolicyMode
+	}
+	if obj.HostEndpoint.FailsafeInbound == nil{
+		obj.HostEndpoint.FailsafeInbound = defaults.HostEndpointFailsafeInbound
+	}
+	if obj.HostEndpoint.FailsafeOutbound == nil{
+		obj.HostEndpoint.FailsafeOutbound = defaults.HostEndpointFailsafeOutbound
+	}
+	if obj.GlobalNetworkPolicy == nil{
+		obj.GlobalNetworkPolicy = &defaults.GlobalNetworkPolicy
+	}
+	if obj.AdminNetworkPolicy == nil{
+		obj.AdminNetworkPolicy = &defaults.AdminNetworkPolicy
+	}
+	if obj.EgressServices == nil{
+		obj.EgressServices = &defaults.EgressServices
+	}
+	if obj.FlowLog.QPS == nil{
+		obj.FlowLog.QPS = &defaults.FlowLogQPS
+	}
+	if obj.FlowLog.Burst == nil{
+		obj.FlowLog.Burst = &defaults.FlowLogBurst
+	}
+	if obj.FQDN.MinTTL == 0{
+		obj.FQDN.MinTTL = defaults.FQDNMinTTL
+	}
+	if obj.EventQPS == nil{
+		obj.EventQPS = &defaults.EventQPS
+	}
+	if obj.EventBurst == nil{
+		obj.EventBurst = &defaults.EventBurst
+	}
+	if obj.ConfigSyncPeriod == 0{
+		obj.ConfigSyncPeriod = defaults.ConfigSyncPeriod
+	}
+	if obj.SyncPeriod == 0{
+		obj.SyncPeriod = defaults.PolicyPeriod
+	}
+	if obj.Logging.LogToStderr == nil{
+		obj.Logging.LogToStderr = &defaults.GlogToStderr
+	}
+}
+
+// LoadConfigFile reads the EnnPolicyConfiguration file, unknown fields are treated as an error
+func LoadConfigFile(path string) (*EnnPolicyConfiguration, error){
+	data, err := ioutil.ReadFile(path)
+	if err != nil{
+		return nil, fmt.Errorf("read config file %s error: %v", path, err)
+	}
+
+	obj := &EnnPolicyConfiguration{}
+	if err := yaml.UnmarshalStrict(data, obj); err != nil{
+		return nil, fmt.Errorf("decode config file %s error: %v", path, err)
+	}
+	if obj.APIVersion != ConfigAPIVersion{
+		return nil, fmt.Errorf("config file %s has unsupported apiVersion %q, expected %q", path, obj.APIVersion, ConfigAPIVersion)
+	}
+	if obj.Kind != ConfigKind{
+		return nil, fmt.Errorf("config file %s has unsupported kind %q, expected %q", path, obj.Kind, ConfigKind)
+	}
+
+	SetDefaultsEnnPolicyConfiguration(obj)
+	return obj, nil
+}
+
+// ApplyTo copies the defaulted configuration into EnnPolicyConfig
+func (obj *EnnPolicyConfiguration) ApplyTo(s *EnnPolicyConfig){
+	s.Kubeconfig       = obj.Kubeconfig
+	s.Master           = obj.Master
+	s.HostnameOverride = obj.HostnameOverride
+	s.IPRanges         = obj.IPRanges
+	s.ExcludeIPRanges  = obj.ExcludeIPRanges
+	s.AcceptNodeGatewayIP = *obj.AcceptNodeGatewayIP
+	s.AcceptLocalNode  = *obj.AcceptLocalNode
+	s.HostNetworkPeers = *obj.HostNetworkPeers
+	s.TerminatingPods  = obj.TerminatingPods
+	s.UnsupportedPolicyMode = obj.UnsupportedPolicyMode
+	s.FlushConntrack   = *obj.FlushConntrack
+	s.DenyAction       = obj.DenyAction
+	s.PolicyMode       = obj.PolicyMode
+	s.ProxyMode        = obj.ProxyMode
+	s.HostEndpointNamespace        = obj.HostEndpoint.Namespace
+	s.HostEndpointFailsafeInbound  = obj.HostEndpoint.FailsafeInbound
+	s.HostEndpointFailsafeOutbound = obj.HostEndpoint.FailsafeOutbound
+	s.GlobalNetworkPolicy = *obj.GlobalNetworkPolicy
+	s.AdminNetworkPolicy  = *obj.AdminNetworkPolicy
+	s.EgressServices      = *obj.EgressServices
+	s.FlowLogGroup     = obj.FlowLog.Group
+	s.FlowLogFile      = obj.FlowLog.File
+	s.FlowLogQPS       = *obj.FlowLog.QPS
+	s.FlowLogBurst     = *obj.FlowLog.Burst
+	s.FQDNMinTTL       = obj.FQDN.MinTTL
+	s.FQDNNameservers  = obj.FQDN.Nameservers
+	s.ExemptNamespaces      = obj.Exemptions.Namespaces
+	s.ExemptNamespaceLabels = obj.Exemptions.NamespaceLabels
+	s.ExemptPodLabels       = obj.Exemptions.PodLabels
+	s.ExemptPriorityClasses = obj.Exemptions.PriorityClasses
+	s.EventQPS         = *obj.EventQPS
+	s.EventBurst       = *obj.EventBurst
+	s.MetricsBindAddress = obj.MetricsBindAddress
+	s.ConfigSyncPeriod = obj.ConfigSyncPeriod
+	s.PolicyPeriod     = obj.SyncPeriod
+	s.MinSyncPeriod    = obj.MinSyncPeriod
+	s.GlogToStderr     = *obj.Logging.LogToStderr
+	s.GlogDir          = obj.Logging.LogDir
+	if obj.Logging.LogLevel != nil{
+		s.GlogV = strconv.Itoa(*obj.Logging.LogLevel)
+	}
+}
+
+// LoadEnnPolicyConfig builds the complete EnnPolicyConfig from the config file and command line args,
+// value priority is: command line flag > config file > default value
+// the result is validated so it is safe to be used by enn-policy
+func LoadEnnPolicyConfig(configFile string, args []string) (*EnnPolicyConfig, error){
+	config := NewEnnPolicyConfig()
+
+	if configFile != ""{
+		obj, err := LoadConfigFile(configFile)
+		if err != nil{
+			return nil, err
+		}
+		obj.ApplyTo(config)
+	}
+
+	// parse the command line again so that flags override the config file
+	fs := pflag.NewFlagSet("enn-policy", pflag.ContinueOnError)
+	config.AddFlags(fs)
+	if err := fs.Parse(args); err != nil{
+		return nil, err
+	}
+	config.ConfigFile = configFile
+
+	if err := ValidateEnnPolicyConfig(config); err != nil{
+		return nil, err
+	}
+	return config, nil
+}
@@ -0,0 +1,224 @@
+package options
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func writeConfigFile(t *testing.T, content string) (string, func()){
+	dir, err := ioutil.TempDir("", "enn-policy-config")
+	if err != nil{
+		t.Fatalf("create temp dir error %v", err)
+	}
+	path := filepath.Join(dir, "config.yaml")
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil{
+		t.Fatalf("write config file error %v", err)
+	}
+	return path, func(){ os.RemoveAll(dir) }
+}
+
+func TestLoadConfigFileDefaults(t *testing.T){
+	path, cleanup := writeConfigFile(t, `
+apiVersion: enn-policy/v1alpha1
+kind: EnnPolicyConfiguration
+hostnameOverride: 192.168.1.10
+ipRanges:
+- 10.244.0.0/16
+- 192.168.10.0/24
+excludeIPRanges:
+- 10.244.255.0/24
+minSyncPeriod: 10s
+acceptNodeGatewayIP: true
+acceptLocalNode: true
+hostNetworkPeers: true
+terminatingPods: drop
+unsupportedPolicyMode: fail-closed
+flushConntrack: true
+denyAction: reject-tcp-reset
+policyMode: audit
+hostEndpoint:
+  namespace: host-endpoint
+  failsafeInbound: []
+globalNetworkPolicy: true
+adminNetworkPolicy: true
+egressServices: true
+flowLog:
+  group: 100
+  qps: 10
+fqdn:
+  nameservers: [10.96.0.10]
+exemptions:
+  namespaces: [kube-system]
+  podLabels: [k8s-app=kube-dns]
+  priorityClasses: [system-cluster-critical]
+eventQPS: 1
+logging:
+  logLevel: 4
+`)
+	defer cleanup()
+
+	config, err := LoadEnnPolicyConfig(path, []string{})
+	if err != nil{
+		t.Fatalf("load config error %v", err)
+	}
+	if config.HostnameOverride != "192.168.1.10"{
+		t.Errorf("expected hostname 192.168.1.10, get %s", config.HostnameOverride)
+	}
+	if !reflect.DeepEqual(config.IPRanges, []string{"10.244.0.0/16", "192.168.10.0/24"}){
+		t.Errorf("expected ip ranges [10.244.0.0/16 192.168.10.0/24], get %v", config.IPRanges)
+	}
+	if !reflect.DeepEqual(config.ExcludeIPRanges, []string{"10.244.255.0/24"}){
+		t.Errorf("expected exclude ip ranges [10.244.255.0/24], get %v", config.ExcludeIPRanges)
+	}
+	if config.MinSyncPeriod != 10 * time.Second{
+		t.Errorf("expected min sync period 10s, get %v", config.MinSyncPeriod)
+	}
+	if config.PolicyPeriod != 30 * time.Minute{
+		t.Errorf("expected default sync period 30m, get %v", config.PolicyPeriod)
+	}
+	if !config.AcceptNodeGatewayIP{
+		t.Errorf("expected accept node gateway ip true")
+	}
+	if !config.AcceptLocalNode{
+		t.Errorf("expected accept local node true")
+	}
+	if !config.HostNetworkPeers{
+		t.Errorf("expected host network peers true")
+	}
+	if config.TerminatingPods != "drop"{
+		t.Errorf("expected terminating pods drop, get %s", config.TerminatingPods)
+	}
+	if config.UnsupportedPolicyMode != "fail-closed"{
+		t.Errorf("expected unsupported policy mode fail-closed, get %s", config.UnsupportedPolicyMode)
+	}
+	if !config.FlushConntrack{
+		t.Errorf("expected flush conntrack true")
+	}
+	if config.DenyAction != "reject-tcp-reset"{
+		t.Errorf("expected deny action reject-tcp-reset, get %s", config.DenyAction)
+	}
+	if config.PolicyMode != "audit"{
+		t.Errorf("expected policy mode audit, get %s", config.PolicyMode)
+	}
+	if !config.GlobalNetworkPolicy{
+		t.Errorf("expected global network policy true")
+	}
+	if !config.AdminNetworkPolicy{
+		t.Errorf("expected admin network policy true")
+	}
+	if !config.EgressServices{
+		t.Errorf("expected egress services true")
+	}
+	if config.FlowLogGroup != 100 || config.FlowLogQPS != 10 || config.FlowLogBurst != 200{
+		t.Errorf("expected flow log group 100 qps 10 burst 200, get %d %v %d", config.FlowLogGroup, config.FlowLogQPS, config.FlowLogBurst)
+	}
+	if config.FQDNMinTTL != 30 * time.Second || !reflect.DeepEqual(config.FQDNNameservers, []string{"10.96.0.10"}){
+		t.Errorf("expected fqdn min ttl 30s and nameserver 10.96.0.10, get %v %v", config.FQDNMinTTL, config.FQDNNameservers)
+	}
+	if !reflect.DeepEqual(config.ExemptNamespaces, []string{"kube-system"}) || !reflect.DeepEqual(config.ExemptPodLabels, []string{"k8s-app=kube-dns"}) ||
+		!reflect.DeepEqual(config.ExemptPriorityClasses, []string{"system-cluster-critical"}) || len(config.ExemptNamespaceLabels) != 0{
+		t.Errorf("expected exemptions of kube-system, k8s-app=kube-dns and system-cluster-critical, get %v %v %v %v",
+			config.ExemptNamespaces, config.ExemptNamespaceLabels, config.ExemptPodLabels, config.ExemptPriorityClasses)
+	}
+	if config.HostEndpointNamespace != "host-endpoint"{
+		t.Errorf("expected host endpoint namespace host-endpoint, get %s", config.HostEndpointNamespace)
+	}
+	if len(config.HostEndpointFailsafeInbound) != 0{
+		t.Errorf("expected empty failsafe inbound ports, get %v", config.HostEndpointFailsafeInbound)
+	}
+	if !reflect.DeepEqual(config.HostEndpointFailsafeOutbound, NewEnnPolicyConfig().HostEndpointFailsafeOutbound){
+		t.Errorf("expected default failsafe outbound ports, get %v", config.HostEndpointFailsafeOutbound)
+	}
+	if config.EventQPS != 1 || config.EventBurst != 10{
+		t.Errorf("expected event qps 1 and default event burst 10, get %v and %d", config.EventQPS, config.EventBurst)
+	}
+	if config.GlogV != "4"{
+		t.Errorf("expected log level 4, get %q", config.GlogV)
+	}
+	if config.ConfigFile != path{
+		t.Errorf("expected config file %s, get %s", path, config.ConfigFile)
+	}
+}
+
+func TestLoadConfigFileFlagOverride(t *testing.T){
+	path, cleanup := writeConfigFile(t, `
+apiVersion: enn-policy/v1alpha1
+kind: EnnPolicyConfiguration
+ipRanges:
+- 10.244.0.0/16
+syncPeriod: 5m
+`)
+	defer cleanup()
+
+	config, err := LoadEnnPolicyConfig(path, []string{"--config", path, "--ip-range=10.0.0.0/8", "--ip-range=172.16.0.0/12"})
+	if err != nil{
+		t.Fatalf("load config error %v", err)
+	}
+	if !reflect.DeepEqual(config.IPRanges, []string{"10.0.0.0/8", "172.16.0.0/12"}){
+		t.Errorf("expected flag to override ip ranges, get %v", config.IPRanges)
+	}
+	if config.PolicyPeriod != 5 * time.Minute{
+		t.Errorf("expected sync period 5m from config file, get %v", config.PolicyPeriod)
+	}
+}
+
+func TestLoadConfigFileInvalid(t *testing.T){
+	testCases := []struct {
+		name    string
+		content string
+	}{
+		{
+			name: "unknown field",
+			content: `
+apiVersion: enn-policy/v1alpha1
+kind: EnnPolicyConfiguration
+ipRnages:
+- 10.244.0.0/16
+`,
+		},
+		{
+			name: "wrong apiVersion",
+			content: `
+apiVersion: enn-policy/v1
+kind: EnnPolicyConfiguration
+`,
+		},
+		{
+			name: "wrong kind",
+			content: `
+apiVersion: enn-policy/v1alpha1
+kind: KubeProxyConfiguration
+`,
+		},
+		{
+			name: "invalid duration",
+			content: `
+apiVersion: enn-policy/v1alpha1
+kind: EnnPolicyConfiguration
+syncPeriod: often
+`,
+		},
+		{
+			name: "failed validation",
+			content: `
+apiVersion: enn-policy/v1alpha1
+kind: EnnPolicyConfiguration
+ipRanges:
+- 10.244.1.0/16
+`,
+		},
+	}
+
+	for _, tc := range testCases{
+		path, cleanup := writeConfigFile(t, tc.content)
+		_, err := LoadEnnPolicyConfig(path, []string{})
+		if err == nil{
+			t.Errorf("case %s: expected error but get nil", tc.name)
+		}
+		cleanup()
+	}
+}
@@ -7,15 +7,53 @@ import (
 
 type EnnPolicyConfig struct {
 
+	ConfigFile          string
+
 	Kubeconfig          string
 	Master              string
 	HostnameOverride    string
 
-	IPRange             string
+	IPRanges            []string
+	ExcludeIPRanges     []string
 
-	AcceptFlannelIP     bool
+	AcceptNodeGatewayIP bool
+	AcceptLocalNode     bool
+	HostNetworkPeers    bool
+	TerminatingPods     string
+	UnsupportedPolicyMode string
+	FlushConntrack      bool
+	DenyAction          string
+	PolicyMode          string
+	FlowLogGroup        int
+	FlowLogFile         string
+	FlowLogQPS          float32
+	FlowLogBurst        int
+	// FlannelNetwork and FlannelLenBit are deprecated and not used any more,
+	// node gateway ips are read from node podCIDR
 	FlannelNetwork      string
-	FlannelLenBit       string
+	FlannelLenBit       int
+
+	ProxyMode           string
+
+	HostEndpointNamespace        string
+	HostEndpointFailsafeInbound  []string
+	HostEndpointFailsafeOutbound []string
+
+	GlobalNetworkPolicy bool
+	AdminNetworkPolicy  bool
+	EgressServices      bool
+
+	FQDNMinTTL          time.Duration
+	FQDNNameservers     []string
+
+	ExemptNamespaces      []string
+	ExemptNamespaceLabels []string
+	ExemptPodLabels       []string
+	ExemptPriorityClasses []string
+
+	EventQPS            float32
+	EventBurst          int
+	MetricsBindAddress  string
 
 	ConfigSyncPeriod    time.Duration
 	PolicyPeriod        time.Duration
@@ -26,29 +64,73 @@ type EnnPolicyConfig struct {
 	GlogDir             string
 
 	CleanupConfig       bool
+	IgnorePreflightErrors bool
 	Version             bool
 }
 
 func NewEnnPolicyConfig() *EnnPolicyConfig{
 
 	return &EnnPolicyConfig{
-		IPRange:            "0.0.0.0/0",
-		AcceptFlannelIP:    false,
-		FlannelNetwork:     "0.0.0.0/0",
-		FlannelLenBit:      "8",
+		IPRanges:           []string{"0.0.0.0/0"},
+		AcceptNodeGatewayIP: false,
+		ProxyMode:          "auto",
+		TerminatingPods:    "keep",
+		UnsupportedPolicyMode: "best-effort",
+		DenyAction:         "reject",
+		PolicyMode:         "enforce",
+		HostEndpointFailsafeInbound:  []string{"tcp:22", "udp:68", "tcp:2379", "tcp:2380", "tcp:6443"},
+		HostEndpointFailsafeOutbound: []string{"udp:53", "tcp:53", "udp:67", "tcp:2379", "tcp:2380", "tcp:6443"},
+		EventQPS:           0.2,
+		EventBurst:         10,
+		FlowLogQPS:         100,
+		FlowLogBurst:       200,
+		FQDNMinTTL:         30 * time.Second,
 		ConfigSyncPeriod:   30 * time.Minute,
 		PolicyPeriod:       30 * time.Minute,
 	}
 }
 
 func (s *EnnPolicyConfig) AddFlags(fs *pflag.FlagSet){
+	fs.StringVar(&s.ConfigFile, "config", s.ConfigFile, "The path to the EnnPolicyConfiguration file. Flags set on the command line override values in this file. Reloadable fields are applied again on SIGHUP.")
 	fs.StringVar(&s.Kubeconfig, "kubeconfig", s.Kubeconfig, "Path to kubeconfig file with authorization information (the master location is set by the master flag).")
 	fs.StringVar(&s.Master, "master", s.Master, "The address of the Kubernetes API server (overrides any value in kubeconfig)")
 	fs.StringVar(&s.HostnameOverride,"hostname-override",s.HostnameOverride,"If non-empty, will use this string as identification instead of the actual hostname.")
-	fs.StringVar(&s.IPRange,"ip-range",s.IPRange,"the ip-range will restrict the policy range, enn-policy is only effective within the ip-range (default value is 0.0.0.0/0)")
-	fs.BoolVar(&s.AcceptFlannelIP,"accept-flannel-ip",s.AcceptFlannelIP,"if true, will accept all machine flannel ip(end up with .0) and machine docker ip(end up with .1). default value is false")
-	fs.StringVar(&s.FlannelNetwork,"flannel-network",s.FlannelNetwork,"the network ip of flannel, e.g: 172.16.0.0/12, parameter is required when accept-flannel-ip is set to true.")
-	fs.StringVar(&s.FlannelLenBit,"flannel-len-bit",s.FlannelLenBit,"this parameter used to get all possible flannel ip, default value is 8, e.g flannel network:172.16.0.0/12, docker network 172.16.0.0/20. parameter is valided when accept-flannel-ip is set to true.")
+	fs.StringSliceVar(&s.IPRanges,"ip-range",s.IPRanges,"the ip-range will restrict the policy range, enn-policy is only effective within the ip-range, can be repeated or separated by comma to set several ranges (default value is 0.0.0.0/0)")
+	fs.StringSliceVar(&s.ExcludeIPRanges,"exclude-ip-range",s.ExcludeIPRanges,"traffic from/to the exclude-ip-range is always accepted even if it is within ip-range, can be repeated or separated by comma to set several ranges")
+	fs.BoolVar(&s.AcceptNodeGatewayIP,"accept-node-gateway-ip",s.AcceptNodeGatewayIP,"if true, will accept traffic from/to the gateway ips of every node: the network address (e.g flannel.1 10.244.1.0) and the first address (e.g cni0/docker0 10.244.1.1) of node podCIDR, and node InternalIPs. default value is false")
+	fs.BoolVar(&s.AcceptNodeGatewayIP,"accept-flannel-ip",s.AcceptNodeGatewayIP,"the same as accept-node-gateway-ip")
+	fs.MarkDeprecated("accept-flannel-ip", "use --accept-node-gateway-ip instead")
+	fs.BoolVar(&s.HostNetworkPeers,"host-network-peers",s.HostNetworkPeers,"if true, hostNetwork pods are matched by podSelector and namespaceSelector peers with the ip of the node they run on. WARNING: this allows every host-network process on that node, not only the selected pod. hostNetwork pods are never the target of a policy. default value is false")
+	fs.StringVar(&s.TerminatingPods,"terminating-pods",s.TerminatingPods,"how terminating pods (with deletionTimestamp) are handled in peer ipsets: 'keep' allows them until the grace period ends for connection draining, 'drop' removes them at once. namespace annotation enn-policy/terminating-pods overrides it")
+	fs.StringVar(&s.UnsupportedPolicyMode,"unsupported-policy-mode",s.UnsupportedPolicyMode,"how a NetworkPolicy which enn-policy can not fully enforce (e.g matchExpressions, named port, podSelector combined with namespaceSelector) is handled: 'best-effort' enforces the supported rules and ignores a policy whose spec.podSelector is unsupported, 'fail-closed' denies all traffic of the policy types to its targets. NetworkPolicy annotation enn-policy/unsupported-policy-mode overrides it")
+	fs.BoolVar(&s.FlushConntrack,"flush-conntrack",s.FlushConntrack,"if true, after each sync enn-policy deletes conntrack entries of connections which were allowed by NetworkPolicies before the sync but are not allowed any more, otherwise such connections keep working since RELATED,ESTABLISHED traffic is always accepted. default value is false")
+	fs.StringVar(&s.DenyAction,"deny-action",s.DenyAction,"how traffic denied by NetworkPolicies is handled: 'reject' (icmp-port-unreachable), 'reject-tcp-reset' (tcp-reset for tcp, so clients fail fast), 'reject-admin-prohibited' (icmp-admin-prohibited), 'drop' (silently drop), 'log-reject' or 'log-drop' (log with prefix ENN-POLICY-DENY, at most 10 per minute for each rule, then reject or drop). namespace annotation enn-policy/deny-action overrides it")
+	fs.StringVar(&s.PolicyMode,"policy-mode",s.PolicyMode,"'enforce' denies traffic which is not allowed by NetworkPolicies, 'audit' logs and accepts it instead (dry-run), so the effect of policies can be checked before they are enforced. hits are counted per policy in metric enn_policy_audit_hits_total if flow-log-group is set. namespace annotation enn-policy/policy-mode overrides it")
+	fs.IntVar(&s.FlowLogGroup,"flow-log-group",s.FlowLogGroup,"If > 0, traffic denied by NetworkPolicies is sent to this NFLOG group (1-65535) before it is denied, and enn-policy writes it as json lines with the namespace, policy and pods of the flow. 0 disables flow log")
+	fs.StringVar(&s.FlowLogFile,"flow-log-file",s.FlowLogFile,"The file denied flows are appended to, empty value writes them to standard output. Only used if flow-log-group > 0")
+	fs.Float32Var(&s.FlowLogQPS,"flow-log-qps",s.FlowLogQPS,"If > 0, limit the number of denied flows written per second, flows beyond the limit are counted in field suppressed of the next record. 0 means no limit")
+	fs.IntVar(&s.FlowLogBurst,"flow-log-burst",s.FlowLogBurst,"Maximum size of a burst of denied flows. Only used if flow-log-qps > 0")
+	fs.BoolVar(&s.AcceptLocalNode,"accept-local-node",s.AcceptLocalNode,"if true, will accept ingress traffic to pods from the node they run on: the node ip and the bridge gateway (e.g cni0/docker0 10.244.1.1) of node podCIDR, so kubelet health probes work with default-deny policy. traffic from other nodes is not accepted. default value is false")
+	fs.StringVar(&s.FlannelNetwork,"flannel-network",s.FlannelNetwork,"not used any more, node gateway ips are read from node podCIDR")
+	fs.MarkDeprecated("flannel-network", "node gateway ips are read from node podCIDR, this flag has no effect")
+	fs.IntVar(&s.FlannelLenBit,"flannel-len-bit",s.FlannelLenBit,"not used any more, node gateway ips are read from node podCIDR")
+	fs.MarkDeprecated("flannel-len-bit", "node gateway ips are read from node podCIDR, this flag has no effect")
+	fs.StringVar(&s.ProxyMode,"proxy-mode",s.ProxyMode,"proxy mode of kube-proxy: 'auto', 'iptables' or 'ipvs'. auto detects ipvs mode by interface kube-ipvs0 or ipset KUBE-CLUSTER-IP. in ipvs mode, service traffic is enforced in OUTPUT after ipvs DNAT")
+	fs.StringVar(&s.HostEndpointNamespace,"host-endpoint-namespace",s.HostEndpointNamespace,"NetworkPolicies in this namespace with annotation enn-policy/host-endpoint=true protect nodes selected by spec.podSelector (node labels) in INPUT and OUTPUT. empty value disables host endpoint policy")
+	fs.StringSliceVar(&s.HostEndpointFailsafeInbound,"host-endpoint-failsafe-inbound",s.HostEndpointFailsafeInbound,"protocol:port list which is always accepted to nodes even if host endpoint policy does not allow it")
+	fs.StringSliceVar(&s.HostEndpointFailsafeOutbound,"host-endpoint-failsafe-outbound",s.HostEndpointFailsafeOutbound,"protocol:port list which is always accepted from nodes even if host endpoint policy does not allow it")
+	fs.BoolVar(&s.GlobalNetworkPolicy,"global-network-policy",s.GlobalNetworkPolicy,"if true, watch the cluster-scoped GlobalNetworkPolicy (globalnetworkpolicies.networking.enn.cn), which is rendered in every namespace selected by spec.namespaceSelector ahead of namespaced NetworkPolicies. the CustomResourceDefinition must be created first. default value is false")
+	fs.BoolVar(&s.AdminNetworkPolicy,"admin-network-policy",s.AdminNetworkPolicy,"if true, watch AdminNetworkPolicy and BaselineAdminNetworkPolicy (policy.networking.k8s.io), which are rendered as tiers before and after namespaced NetworkPolicies. the CustomResourceDefinitions must be created first. default value is false")
+	fs.BoolVar(&s.EgressServices,"egress-services",s.EgressServices,"if true, watch Services and Endpoints of the cluster for NetworkPolicy annotation enn-policy/egress-services. if false, the annotation allows nothing. default value is false")
+	fs.DurationVar(&s.FQDNMinTTL,"fqdn-min-ttl",s.FQDNMinTTL,"names of NetworkPolicy annotation enn-policy/egress-fqdns are resolved again when their ttl expires, but not more often than this period. must be at least 1s")
+	fs.StringSliceVar(&s.FQDNNameservers,"fqdn-nameservers",s.FQDNNameservers,"ip or ip:port of nameservers which resolve names of NetworkPolicy annotation enn-policy/egress-fqdns, can be repeated or separated by comma. empty value uses the nameservers of /etc/resolv.conf")
+	fs.StringSliceVar(&s.ExemptNamespaces,"exempt-namespaces",s.ExemptNamespaces,"pods in these namespaces are never enforced by any policy, their traffic is accepted before policies are evaluated, can be repeated or separated by comma, e.g kube-system")
+	fs.StringSliceVar(&s.ExemptNamespaceLabels,"exempt-namespace-labels",s.ExemptNamespaceLabels,"key=value list, pods in namespaces with any of these labels are never enforced by any policy, can be repeated or separated by comma")
+	fs.StringSliceVar(&s.ExemptPodLabels,"exempt-pod-labels",s.ExemptPodLabels,"key=value list, pods with any of these labels are never enforced by any policy, can be repeated or separated by comma, e.g k8s-app=kube-dns")
+	fs.StringSliceVar(&s.ExemptPriorityClasses,"exempt-priority-classes",s.ExemptPriorityClasses,"pods with any of these priorityClassName are never enforced by any policy, can be repeated or separated by comma, e.g system-cluster-critical")
+	fs.Float32Var(&s.EventQPS,"event-qps",s.EventQPS,"If > 0, limit the number of events enn-policy records per second on NetworkPolicies and its node. 0 means no limit")
+	fs.IntVar(&s.EventBurst,"event-burst",s.EventBurst,"Maximum size of a burst of events, temporarily allows events to burst to this number while still not exceeding event-qps. Only used if event-qps > 0")
+	fs.StringVar(&s.MetricsBindAddress,"metrics-bind-address",s.MetricsBindAddress,"The ip:port to serve prometheus metrics on /metrics, e.g 127.0.0.1:10259. empty value disables metrics")
 	fs.DurationVar(&s.ConfigSyncPeriod,"config-sync-period",s.ConfigSyncPeriod,"How often configuration from the apiserver is refreshed.  Must be greater than 0.")
 	fs.DurationVar(&s.PolicyPeriod,"sync-period",s.PolicyPeriod,"The maximum interval of how often ipvs rules are refreshed (e.g. '5s', '1m', '2h22m').  Must be greater than 0.")
 	fs.DurationVar(&s.MinSyncPeriod,"min-sync-period",s.MinSyncPeriod,"The minimum interval of how often the iptables rules can be refreshed as endpoints and services change (e.g. '5s', '1m', '2h22m').")
@@ -56,5 +138,6 @@ func (s *EnnPolicyConfig) AddFlags(fs *pflag.FlagSet){
 	fs.StringVar(&s.GlogV, "v", s.GlogV, "Log level for V logs")
 	fs.StringVar(&s.GlogDir, "log-dir", s.GlogDir, "If none empty, write log files in this directory")
 	fs.BoolVar(&s.CleanupConfig,"cleanup-config",s.CleanupConfig,"If true cleanup all ipset/iptables rules and exit.")
+	fs.BoolVar(&s.IgnorePreflightErrors,"ignore-preflight-errors",s.IgnorePreflightErrors,"If true, errors of preflight checks at startup (e.g missing kernel module xt_set or ipset binary) are logged as warnings and enn-policy keeps running.")
 	fs.BoolVar(&s.Version,"version",s.Version,"If true will show enn-policy version number.")
 }
\ No newline at end of file
@@ -0,0 +1,135 @@
+package options
+
+import (
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	utilpolicy "enn-policy/pkg/policy/util"
+	utildns "enn-policy/pkg/util/dns"
+
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+)
+
+// ValidateEnnPolicyConfig checks all user input of EnnPolicyConfig
+// and returns an aggregate of every invalid field
+func ValidateEnnPolicyConfig(config *EnnPolicyConfig) error{
+	var errs []error
+
+	if len(config.IPRanges) == 0{
+		errs = append(errs, fmt.Errorf("at least one ip-range is required"))
+	}
+	for _, ipRange := range config.IPRanges{
+		if err := validateCIDR("ip-range", ipRange); err != nil{
+			errs = append(errs, err)
+		}
+	}
+	for _, ipRange := range config.ExcludeIPRanges{
+		if err := validateCIDR("exclude-ip-range", ipRange); err != nil{
+			errs = append(errs, err)
+		} else if ipRange == "0.0.0.0/0"{
+			errs = append(errs, fmt.Errorf("exclude-ip-range 0.0.0.0/0 would disable enn-policy"))
+		}
+	}
+
+	switch config.ProxyMode {
+	case "auto", "iptables", "ipvs":
+	default:
+		errs = append(errs, fmt.Errorf("proxy-mode %q must be one of auto, iptables or ipvs", config.ProxyMode))
+	}
+
+	if !utilpolicy.IsValidTerminatingPods(config.TerminatingPods){
+		errs = append(errs, fmt.Errorf("terminating-pods %q must be keep or drop", config.TerminatingPods))
+	}
+
+	if !utilpolicy.IsValidUnsupportedPolicyMode(config.UnsupportedPolicyMode){
+		errs = append(errs, fmt.Errorf("unsupported-policy-mode %q must be best-effort or fail-closed", config.UnsupportedPolicyMode))
+	}
+
+	if !utilpolicy.IsValidDenyAction(config.DenyAction){
+		errs = append(errs, fmt.Errorf("deny-action %q must be one of %s", config.DenyAction, utilpolicy.DenyActions()))
+	}
+
+	if _, err := utilpolicy.ParseProtocolPorts(config.HostEndpointFailsafeInbound); err != nil{
+		errs = append(errs, fmt.Errorf("host-endpoint-failsafe-inbound: %v", err))
+	}
+	if _, err := utilpolicy.ParseProtocolPorts(config.HostEndpointFailsafeOutbound); err != nil{
+		errs = append(errs, fmt.Errorf("host-endpoint-failsafe-outbound: %v", err))
+	}
+
+	if !utilpolicy.IsValidPolicyMode(config.PolicyMode){
+		errs = append(errs, fmt.Errorf("policy-mode %q must be enforce or audit", config.PolicyMode))
+	}
+
+	if config.FlowLogGroup < 0 || config.FlowLogGroup > 65535{
+		errs = append(errs, fmt.Errorf("flow-log-group %d must be between 0 and 65535", config.FlowLogGroup))
+	}
+	if config.FlowLogQPS < 0{
+		errs = append(errs, fmt.Errorf("flow-log-qps %v must not be negative", config.FlowLogQPS))
+	}
+	if config.FlowLogQPS > 0 && config.FlowLogBurst <= 0{
+		errs = append(errs, fmt.Errorf("flow-log-burst %d must be greater than 0 when flow-log-qps is set", config.FlowLogBurst))
+	}
+
+	if config.FQDNMinTTL < time.Second{
+		errs = append(errs, fmt.Errorf("fqdn-min-ttl %v must be at least 1s", config.FQDNMinTTL))
+	}
+	if _, err := utildns.ParseNameservers(config.FQDNNameservers); err != nil{
+		errs = append(errs, fmt.Errorf("fqdn-nameservers: %v", err))
+	}
+
+	if _, err := utilpolicy.ParseExemptions(config.ExemptNamespaces, config.ExemptNamespaceLabels,
+		config.ExemptPodLabels, config.ExemptPriorityClasses); err != nil{
+		errs = append(errs, fmt.Errorf("exemptions: %v", err))
+	}
+
+	if config.EventQPS < 0{
+		errs = append(errs, fmt.Errorf("event-qps %v must not be negative", config.EventQPS))
+	}
+	if config.EventQPS > 0 && config.EventBurst <= 0{
+		errs = append(errs, fmt.Errorf("event-burst %d must be greater than 0 when event-qps is set", config.EventBurst))
+	}
+
+	if config.MetricsBindAddress != ""{
+		if _, _, err := net.SplitHostPort(config.MetricsBindAddress); err != nil{
+			errs = append(errs, fmt.Errorf("metrics-bind-address %q must be ip:port: %v", config.MetricsBindAddress, err))
+		}
+	}
+
+	if config.ConfigSyncPeriod <= 0{
+		errs = append(errs, fmt.Errorf("config-sync-period %v must be greater than 0", config.ConfigSyncPeriod))
+	}
+	if config.PolicyPeriod <= 0{
+		errs = append(errs, fmt.Errorf("sync-period %v must be greater than 0", config.PolicyPeriod))
+	}
+	if config.MinSyncPeriod < 0{
+		errs = append(errs, fmt.Errorf("min-sync-period %v must not be negative", config.MinSyncPeriod))
+	} else if config.MinSyncPeriod > config.PolicyPeriod{
+		errs = append(errs, fmt.Errorf("min-sync-period %v must not be greater than sync-period %v", config.MinSyncPeriod, config.PolicyPeriod))
+	}
+
+	if config.GlogV != ""{
+		level, err := strconv.Atoi(config.GlogV)
+		if err != nil || level < 0{
+			errs = append(errs, fmt.Errorf("log level %q must be a non-negative integer", config.GlogV))
+		}
+	}
+
+	return utilerrors.NewAggregate(errs)
+}
+
+// validateCIDR only accepts ipv4 cidr which ip is the network address, e.g 10.244.0.0/16
+// since ipset stores the network address, 10.244.1.0/16 would never match the kernel entry
+func validateCIDR(field, cidr string) error{
+	ip, ipNet, err := net.ParseCIDR(cidr)
+	if err != nil{
+		return fmt.Errorf("%s %q is not a valid cidr: %v", field, cidr, err)
+	}
+	if ip.To4() == nil{
+		return fmt.Errorf("%s %q is not an ipv4 cidr", field, cidr)
+	}
+	if !ip.Equal(ipNet.IP){
+		return fmt.Errorf("%s %q is not a network address, do you mean %s", field, cidr, ipNet.String())
+	}
+	return nil
+}
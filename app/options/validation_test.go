@@ -0,0 +1,220 @@
+package options
+
+import (
+	"testing"
+	"time"
+)
+
+func TestValidateEnnPolicyConfig(t *testing.T){
+	testCases := []struct {
+		name    string
+		modify  func(*EnnPolicyConfig)
+		valid   bool
+	}{
+		{
+			name:   "default config",
+			modify: func(c *EnnPolicyConfig){},
+			valid:  true,
+		},
+		{
+			name:   "valid ip ranges",
+			modify: func(c *EnnPolicyConfig){ c.IPRanges = []string{"10.244.0.0/16", "0.0.0.0/0"} },
+			valid:  true,
+		},
+		{
+			name:   "ip range is not a cidr",
+			modify: func(c *EnnPolicyConfig){ c.IPRanges = []string{"10.244.0.0"} },
+			valid:  false,
+		},
+		{
+			name:   "ip range is not a network address",
+			modify: func(c *EnnPolicyConfig){ c.IPRanges = []string{"10.244.0.0/16", "10.244.1.0/16"} },
+			valid:  false,
+		},
+		{
+			name:   "ipv6 ip range",
+			modify: func(c *EnnPolicyConfig){ c.IPRanges = []string{"fd00::/64"} },
+			valid:  false,
+		},
+		{
+			name:   "no ip range",
+			modify: func(c *EnnPolicyConfig){ c.IPRanges = nil },
+			valid:  false,
+		},
+		{
+			name:   "valid exclude ip range",
+			modify: func(c *EnnPolicyConfig){ c.ExcludeIPRanges = []string{"10.244.255.0/24"} },
+			valid:  true,
+		},
+		{
+			name:   "exclude whole ip space",
+			modify: func(c *EnnPolicyConfig){ c.ExcludeIPRanges = []string{"0.0.0.0/0"} },
+			valid:  false,
+		},
+		{
+			name:   "ipvs proxy mode",
+			modify: func(c *EnnPolicyConfig){ c.ProxyMode = "ipvs" },
+			valid:  true,
+		},
+		{
+			name:   "unknown proxy mode",
+			modify: func(c *EnnPolicyConfig){ c.ProxyMode = "userspace" },
+			valid:  false,
+		},
+		{
+			name:   "drop terminating pods",
+			modify: func(c *EnnPolicyConfig){ c.TerminatingPods = "drop" },
+			valid:  true,
+		},
+		{
+			name:   "unknown terminating pods mode",
+			modify: func(c *EnnPolicyConfig){ c.TerminatingPods = "wait" },
+			valid:  false,
+		},
+		{
+			name:   "log then drop denied traffic",
+			modify: func(c *EnnPolicyConfig){ c.DenyAction = "log-drop" },
+			valid:  true,
+		},
+		{
+			name:   "unknown deny action",
+			modify: func(c *EnnPolicyConfig){ c.DenyAction = "accept" },
+			valid:  false,
+		},
+		{
+			name:   "audit mode",
+			modify: func(c *EnnPolicyConfig){ c.PolicyMode = "audit" },
+			valid:  true,
+		},
+		{
+			name:   "unknown policy mode",
+			modify: func(c *EnnPolicyConfig){ c.PolicyMode = "dry-run" },
+			valid:  false,
+		},
+		{
+			name:   "flow log",
+			modify: func(c *EnnPolicyConfig){ c.FlowLogGroup = 100; c.FlowLogFile = "/var/log/enn-policy/flow.log" },
+			valid:  true,
+		},
+		{
+			name:   "flow log group out of range",
+			modify: func(c *EnnPolicyConfig){ c.FlowLogGroup = 65536 },
+			valid:  false,
+		},
+		{
+			name:   "flow log qps without burst",
+			modify: func(c *EnnPolicyConfig){ c.FlowLogQPS = 10; c.FlowLogBurst = 0 },
+			valid:  false,
+		},
+		{
+			name:   "fqdn nameservers",
+			modify: func(c *EnnPolicyConfig){ c.FQDNNameservers = []string{"10.96.0.10", "127.0.0.1:5353"} },
+			valid:  true,
+		},
+		{
+			name:   "invalid fqdn nameserver",
+			modify: func(c *EnnPolicyConfig){ c.FQDNNameservers = []string{"dns.example"} },
+			valid:  false,
+		},
+		{
+			name:   "fqdn min ttl too small",
+			modify: func(c *EnnPolicyConfig){ c.FQDNMinTTL = 0 },
+			valid:  false,
+		},
+		{
+			name:   "exemptions",
+			modify: func(c *EnnPolicyConfig){
+				c.ExemptNamespaces = []string{"kube-system"}
+				c.ExemptNamespaceLabels = []string{"team=monitoring"}
+				c.ExemptPodLabels = []string{"k8s-app=kube-dns"}
+				c.ExemptPriorityClasses = []string{"system-node-critical"}
+			},
+			valid:  true,
+		},
+		{
+			name:   "invalid exempt pod label",
+			modify: func(c *EnnPolicyConfig){ c.ExemptPodLabels = []string{"k8s-app"} },
+			valid:  false,
+		},
+		{
+			name:   "invalid exempt namespace",
+			modify: func(c *EnnPolicyConfig){ c.ExemptNamespaces = []string{"Kube_System"} },
+			valid:  false,
+		},
+		{
+			name:   "unlimited events",
+			modify: func(c *EnnPolicyConfig){ c.EventQPS = 0; c.EventBurst = 0 },
+			valid:  true,
+		},
+		{
+			name:   "negative event qps",
+			modify: func(c *EnnPolicyConfig){ c.EventQPS = -1 },
+			valid:  false,
+		},
+		{
+			name:   "zero event burst with event qps",
+			modify: func(c *EnnPolicyConfig){ c.EventBurst = 0 },
+			valid:  false,
+		},
+		{
+			name:   "fail-closed unsupported policy mode",
+			modify: func(c *EnnPolicyConfig){ c.UnsupportedPolicyMode = "fail-closed" },
+			valid:  true,
+		},
+		{
+			name:   "unknown unsupported policy mode",
+			modify: func(c *EnnPolicyConfig){ c.UnsupportedPolicyMode = "ignore" },
+			valid:  false,
+		},
+		{
+			name:   "metrics bind address",
+			modify: func(c *EnnPolicyConfig){ c.MetricsBindAddress = "127.0.0.1:10259" },
+			valid:  true,
+		},
+		{
+			name:   "metrics bind address without port",
+			modify: func(c *EnnPolicyConfig){ c.MetricsBindAddress = "127.0.0.1" },
+			valid:  false,
+		},
+		{
+			name:   "invalid failsafe port",
+			modify: func(c *EnnPolicyConfig){ c.HostEndpointFailsafeInbound = []string{"tcp:22", "ssh"} },
+			valid:  false,
+		},
+		{
+			name:   "zero sync period",
+			modify: func(c *EnnPolicyConfig){ c.PolicyPeriod = 0 },
+			valid:  false,
+		},
+		{
+			name:   "min sync period greater than sync period",
+			modify: func(c *EnnPolicyConfig){
+				c.PolicyPeriod = time.Minute
+				c.MinSyncPeriod = time.Hour
+			},
+			valid:  false,
+		},
+		{
+			name:   "negative config sync period",
+			modify: func(c *EnnPolicyConfig){ c.ConfigSyncPeriod = -time.Second },
+			valid:  false,
+		},
+		{
+			name:   "invalid log level",
+			modify: func(c *EnnPolicyConfig){ c.GlogV = "debug" },
+			valid:  false,
+		},
+	}
+
+	for _, tc := range testCases{
+		config := NewEnnPolicyConfig()
+		tc.modify(config)
+		err := ValidateEnnPolicyConfig(config)
+		if tc.valid && err != nil{
+			t.Errorf("case %s: expected valid but get error %v", tc.name, err)
+		}
+		if !tc.valid && err == nil{
+			t.Errorf("case %s: expected error but get nil", tc.name)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package app
+
+import (
+	utilexec "k8s.io/utils/exec"
+	"github.com/golang/glog"
+	"enn-policy/pkg/preflight"
+
+	"fmt"
+)
+
+// RunPreflight runs preflight checks at startup, warnings are logged,
+// errors are returned unless ignoreErrors is true
+func RunPreflight(ignoreErrors bool) error{
+
+	results := preflight.RunChecks(preflight.DefaultChecks(utilexec.New(), ""))
+	for _, result := range results{
+		for _, warning := range result.Warnings{
+			glog.Warningf("preflight %s: %v", result.Name, warning)
+		}
+		for _, err := range result.Errors{
+			glog.Errorf("preflight %s: %v", result.Name, err)
+		}
+	}
+
+	err := preflight.Errors(results)
+	if err != nil && ignoreErrors{
+		glog.Warningf("preflight checks failed, keep running since --ignore-preflight-errors is set")
+		return nil
+	}
+	return err
+}
+
+// PrintPreflight prints results of all preflight checks for `enn-policy preflight`,
+// returns false if any check fails with error
+func PrintPreflight() bool{
+
+	results := preflight.RunChecks(preflight.DefaultChecks(utilexec.New(), ""))
+	warnings, errs := 0, 0
+	for _, result := range results{
+		status := "[OK]     "
+		if len(result.Errors) != 0{
+			status = "[ERROR]  "
+		} else if len(result.Warnings) != 0{
+			status = "[WARNING]"
+		}
+		fmt.Printf("%s %s\n", status, result.Name)
+		for _, err := range result.Errors{
+			fmt.Printf("          error: %v\n", err)
+		}
+		for _, warning := range result.Warnings{
+			fmt.Printf("          warning: %v\n", warning)
+		}
+		warnings += len(result.Warnings)
+		errs += len(result.Errors)
+	}
+	fmt.Printf("preflight finished with %d errors and %d warnings\n", errs, warnings)
+	return errs == 0
+}
@@ -9,20 +9,28 @@ import (
 	"enn-policy/pkg/util/iptables"
 	"github.com/golang/glog"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/scheme"
+	v1core "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+	api "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/util/wait"
 	utilexec "k8s.io/utils/exec"
 	utiliptables "enn-policy/pkg/util/k8siptables"
 	utildbus "enn-policy/pkg/util/dbus"
+	"enn-policy/pkg/util/metrics"
 
 	"time"
 	"sync"
 	"fmt"
+	"flag"
 	"os"
 	"os/signal"
 	"syscall"
 	"net"
+	"reflect"
 )
 
 const Version    = "0.67"
@@ -32,11 +40,22 @@ type EnnPolicyServer struct {
 	Policy                     *ennPolicy.EnnPolicy
 	Config                     *options.EnnPolicyConfig
 	Client                     *kubernetes.Clientset
+	Broadcaster                record.EventBroadcaster
 
 	ConfigSyncPeriod           time.Duration
 	NetworkPolicyEventHandler  policyConfig.NetworkPolicyHandler
 	PodEventHandler            policyConfig.PodHandler
 	NamespaceEventHandler      policyConfig.NamespaceHandler
+	NodeEventHandler           policyConfig.NodeHandler
+	GlobalNetworkPolicyEventHandler policyConfig.GlobalNetworkPolicyHandler
+	// GlobalNetworkPolicyClient is nil if GlobalNetworkPolicy is not watched
+	GlobalNetworkPolicyClient  rest.Interface
+	AdminNetworkPolicyEventHandler policyConfig.AdminNetworkPolicyHandler
+	BaselineAdminNetworkPolicyEventHandler policyConfig.BaselineAdminNetworkPolicyHandler
+	// AdminNetworkPolicyClient is nil if AdminNetworkPolicy and BaselineAdminNetworkPolicy are not watched
+	AdminNetworkPolicyClient   rest.Interface
+	ServiceEventHandler        policyConfig.ServiceHandler
+	EndpointsEventHandler      policyConfig.EndpointsHandler
 }
 
 func NewEnnPolicyServer(
@@ -46,14 +65,27 @@ func NewEnnPolicyServer(
     networkPolicyEventHandler  policyConfig.NetworkPolicyHandler,
     podEventHandler            policyConfig.PodHandler,
     namespaceEventHandler      policyConfig.NamespaceHandler,
+    nodeEventHandler           policyConfig.NodeHandler,
+    globalNetworkPolicyEventHandler policyConfig.GlobalNetworkPolicyHandler,
+    adminNetworkPolicyEventHandler policyConfig.AdminNetworkPolicyHandler,
+    baselineAdminNetworkPolicyEventHandler policyConfig.BaselineAdminNetworkPolicyHandler,
+    serviceEventHandler        policyConfig.ServiceHandler,
+    endpointsEventHandler      policyConfig.EndpointsHandler,
 )(*EnnPolicyServer, error){
 	return &EnnPolicyServer{
 		Policy:                     policy,
 		Config:                     config,
 		Client:                     client,
+		ConfigSyncPeriod:           config.ConfigSyncPeriod,
 		NetworkPolicyEventHandler:  networkPolicyEventHandler,
 		PodEventHandler:            podEventHandler,
 		NamespaceEventHandler:      namespaceEventHandler,
+		NodeEventHandler:           nodeEventHandler,
+		GlobalNetworkPolicyEventHandler: globalNetworkPolicyEventHandler,
+		AdminNetworkPolicyEventHandler: adminNetworkPolicyEventHandler,
+		BaselineAdminNetworkPolicyEventHandler: baselineAdminNetworkPolicyEventHandler,
+		ServiceEventHandler:        serviceEventHandler,
+		EndpointsEventHandler:      endpointsEventHandler,
 	},nil
 }
 
@@ -81,7 +113,8 @@ func NewEnnPolicyServerDefault(config *options.EnnPolicyConfig)(*EnnPolicyServer
 	node, err := policyUtil.GetNode(clientset,config.HostnameOverride)
 	if err != nil{
 		glog.Errorf("NewEnnPolicy failure: GetNode fall: %s", err.Error())
-		hostname = ""
+		// keep the hostname so that clusterCIDR and nodeIP can be refreshed by node informer later
+		hostname = policyUtil.GetHostname(config.HostnameOverride)
 		nodeIP = nil
 
 	} else {
@@ -104,6 +137,10 @@ func NewEnnPolicyServerDefault(config *options.EnnPolicyConfig)(*EnnPolicyServer
 	dbus = utildbus.New()
 	k8siptInterface = utiliptables.New(execerInterface, dbus, protocol)
 
+	// events are sent to apiserver after Run starts recording to sink
+	eventBroadcaster := record.NewBroadcaster()
+	recorder := eventBroadcaster.NewRecorder(scheme.Scheme, api.EventSource{Component: "enn-policy", Host: hostname})
+
 	policy, err := ennPolicy.NewEnnPolicy(
 		clientset,
 		config,
@@ -113,6 +150,7 @@ func NewEnnPolicyServerDefault(config *options.EnnPolicyConfig)(*EnnPolicyServer
 		ipsetInterface,
 		iptablesInterface,
 		k8siptInterface,
+		recorder,
 	)
 	if err != nil{
 		return nil, err
@@ -121,19 +159,54 @@ func NewEnnPolicyServerDefault(config *options.EnnPolicyConfig)(*EnnPolicyServer
 	var networkPolicyEventHandler policyConfig.NetworkPolicyHandler
 	var podEventHandler policyConfig.PodHandler
 	var namespaceEventHandler policyConfig.NamespaceHandler
+	var nodeEventHandler policyConfig.NodeHandler
+	var globalNetworkPolicyEventHandler policyConfig.GlobalNetworkPolicyHandler
+	var adminNetworkPolicyEventHandler policyConfig.AdminNetworkPolicyHandler
+	var baselineAdminNetworkPolicyEventHandler policyConfig.BaselineAdminNetworkPolicyHandler
+	var serviceEventHandler policyConfig.ServiceHandler
+	var endpointsEventHandler policyConfig.EndpointsHandler
 
 	networkPolicyEventHandler = policy
 	podEventHandler = policy
 	namespaceEventHandler = policy
-
-	return NewEnnPolicyServer(
+	nodeEventHandler = policy
+	globalNetworkPolicyEventHandler = policy
+	adminNetworkPolicyEventHandler = policy
+	baselineAdminNetworkPolicyEventHandler = policy
+	serviceEventHandler = policy
+	endpointsEventHandler = policy
+
+	server, err := NewEnnPolicyServer(
 		policy,
 		config,
 		clientset,
 		networkPolicyEventHandler,
 		podEventHandler,
 		namespaceEventHandler,
+		nodeEventHandler,
+		globalNetworkPolicyEventHandler,
+		adminNetworkPolicyEventHandler,
+		baselineAdminNetworkPolicyEventHandler,
+		serviceEventHandler,
+		endpointsEventHandler,
 	)
+	if err != nil{
+		return nil, err
+	}
+	server.Broadcaster = eventBroadcaster
+	if config.GlobalNetworkPolicy{
+		server.GlobalNetworkPolicyClient, err = policyConfig.NewGlobalNetworkPolicyClient(clientconfig)
+		if err != nil{
+			return nil, fmt.Errorf("create client of GlobalNetworkPolicy error %v", err)
+		}
+	}
+	if config.AdminNetworkPolicy{
+		server.AdminNetworkPolicyClient, err = policyConfig.NewAdminNetworkPolicyClient(clientconfig)
+		if err != nil{
+			return nil, fmt.Errorf("create client of AdminNetworkPolicy error %v", err)
+		}
+	}
+	return server, nil
 }
 
 func CleanUpAndExit() {
@@ -167,6 +240,74 @@ func ShowVersion() {
 	fmt.Printf("last update time: %s\n", LastUpdate)
 }
 
+// ReloadConfig reads config file and command line flags again,
+// reloadable fields are applied to the running policy, other changes need a restart
+func (s *EnnPolicyServer) ReloadConfig(){
+
+	if s.Config.ConfigFile == ""{
+		glog.Warningf("get SIGHUP but --config is not set, nothing to reload")
+		return
+	}
+	glog.V(0).Infof("get SIGHUP, reload config file %s", s.Config.ConfigFile)
+
+	config, err := options.LoadEnnPolicyConfig(s.Config.ConfigFile, os.Args[1:])
+	if err != nil{
+		glog.Errorf("reload config failed, keep running with current config: %v", err)
+		return
+	}
+
+	if config.Kubeconfig != s.Config.Kubeconfig ||
+		config.Master != s.Config.Master ||
+		config.HostnameOverride != s.Config.HostnameOverride ||
+		config.ConfigSyncPeriod != s.Config.ConfigSyncPeriod ||
+		config.ProxyMode != s.Config.ProxyMode ||
+		config.HostNetworkPeers != s.Config.HostNetworkPeers ||
+		config.EventQPS != s.Config.EventQPS ||
+		config.EventBurst != s.Config.EventBurst ||
+		config.MetricsBindAddress != s.Config.MetricsBindAddress ||
+		config.FlowLogGroup != s.Config.FlowLogGroup ||
+		config.FlowLogFile != s.Config.FlowLogFile ||
+		config.FlowLogQPS != s.Config.FlowLogQPS ||
+		config.FlowLogBurst != s.Config.FlowLogBurst ||
+		config.GlobalNetworkPolicy != s.Config.GlobalNetworkPolicy ||
+		config.AdminNetworkPolicy != s.Config.AdminNetworkPolicy ||
+		config.EgressServices != s.Config.EgressServices ||
+		!reflect.DeepEqual(config.FQDNNameservers, s.Config.FQDNNameservers) ||
+		config.GlogToStderr != s.Config.GlogToStderr ||
+		config.GlogDir != s.Config.GlogDir{
+		glog.Warningf("kubeconfig, master, hostname-override, config-sync-period, proxy-mode, host-network-peers, event-qps, event-burst, metrics-bind-address, flow log, global-network-policy, admin-network-policy, egress-services, fqdn-nameservers and log destination can not be reloaded, restart enn-policy to apply them")
+	}
+
+	if config.GlogV != s.Config.GlogV && config.GlogV != ""{
+		glog.V(0).Infof("change log level from %q to %q", s.Config.GlogV, config.GlogV)
+		flag.Set("v", config.GlogV)
+	}
+
+	s.Policy.ReloadConfig(config)
+
+	// fields which can not be reloaded keep the value enn-policy is running with
+	config.Kubeconfig       = s.Config.Kubeconfig
+	config.Master           = s.Config.Master
+	config.HostnameOverride = s.Config.HostnameOverride
+	config.ConfigSyncPeriod = s.Config.ConfigSyncPeriod
+	config.ProxyMode        = s.Config.ProxyMode
+	config.HostNetworkPeers = s.Config.HostNetworkPeers
+	config.EventQPS         = s.Config.EventQPS
+	config.EventBurst       = s.Config.EventBurst
+	config.MetricsBindAddress = s.Config.MetricsBindAddress
+	config.FlowLogGroup     = s.Config.FlowLogGroup
+	config.FlowLogFile      = s.Config.FlowLogFile
+	config.FlowLogQPS       = s.Config.FlowLogQPS
+	config.FlowLogBurst     = s.Config.FlowLogBurst
+	config.GlobalNetworkPolicy = s.Config.GlobalNetworkPolicy
+	config.AdminNetworkPolicy = s.Config.AdminNetworkPolicy
+	config.EgressServices   = s.Config.EgressServices
+	config.FQDNNameservers  = s.Config.FQDNNameservers
+	config.GlogToStderr     = s.Config.GlogToStderr
+	config.GlogDir          = s.Config.GlogDir
+	s.Config = config
+}
+
 func (s *EnnPolicyServer) Run() error{
 
 	glog.V(0).Infof("start to run enn policy")
@@ -177,6 +318,14 @@ func (s *EnnPolicyServer) Run() error{
 
 	informerFactory := informers.NewSharedInformerFactory(s.Client, s.ConfigSyncPeriod)
 
+	if s.Broadcaster != nil{
+		s.Broadcaster.StartRecordingToSink(&v1core.EventSinkImpl{Interface: s.Client.CoreV1().Events("")})
+	}
+	if s.Config.MetricsBindAddress != ""{
+		ennPolicy.RegisterMetrics()
+		metrics.ListenAndServe(s.Config.MetricsBindAddress)
+	}
+
 
 	// Create configs (i.e. Watches for Services and Endpoints)
 	// Note: RegisterHandler() calls need to happen before creation of Sources because sources
@@ -194,22 +343,74 @@ func (s *EnnPolicyServer) Run() error{
 	namespaceConfig.RegisterEventHandler(s.NamespaceEventHandler)
 	go namespaceConfig.Run(wait.NeverStop)
 
+	nodeConfig := policyConfig.NewNodeConfig(informerFactory.Core().V1().Nodes(), s.ConfigSyncPeriod)
+	nodeConfig.RegisterEventHandler(s.NodeEventHandler)
+	go nodeConfig.Run(wait.NeverStop)
+
+	// services and endpoints are only watched for EgressServices of networkPolicies if --egress-services is set,
+	// since every node would cache every Endpoints of the cluster
+	if s.Config.EgressServices{
+		serviceConfig := policyConfig.NewServiceConfig(informerFactory.Core().V1().Services(), s.ConfigSyncPeriod)
+		serviceConfig.RegisterEventHandler(s.ServiceEventHandler)
+		go serviceConfig.Run(wait.NeverStop)
+
+		endpointsConfig := policyConfig.NewEndpointsConfig(informerFactory.Core().V1().Endpoints(), s.ConfigSyncPeriod)
+		endpointsConfig.RegisterEventHandler(s.EndpointsEventHandler)
+		go endpointsConfig.Run(wait.NeverStop)
+	}
+
 	// This has to start after the calls to NewServiceConfig and NewEndpointsConfig because those
 	// functions must configure their shared informer event handlers first.
 	go informerFactory.Start(wait.NeverStop)
 
+	// GlobalNetworkPolicy is a custom resource which is not in informerFactory, so its informer is started here
+	if s.GlobalNetworkPolicyClient != nil{
+		globalNetworkPolicyInformer := policyConfig.NewGlobalNetworkPolicyInformer(s.GlobalNetworkPolicyClient, s.ConfigSyncPeriod)
+		globalNetworkPolicyConfig := policyConfig.NewGlobalNetworkPolicyConfig(globalNetworkPolicyInformer, s.ConfigSyncPeriod)
+		globalNetworkPolicyConfig.RegisterEventHandler(s.GlobalNetworkPolicyEventHandler)
+		go globalNetworkPolicyConfig.Run(wait.NeverStop)
+		go globalNetworkPolicyInformer.Run(wait.NeverStop)
+	}
+	if s.AdminNetworkPolicyClient != nil{
+		adminNetworkPolicyInformer := policyConfig.NewAdminNetworkPolicyInformer(s.AdminNetworkPolicyClient, s.ConfigSyncPeriod)
+		adminNetworkPolicyConfig := policyConfig.NewAdminNetworkPolicyConfig(adminNetworkPolicyInformer, s.ConfigSyncPeriod)
+		adminNetworkPolicyConfig.RegisterEventHandler(s.AdminNetworkPolicyEventHandler)
+		go adminNetworkPolicyConfig.Run(wait.NeverStop)
+		go adminNetworkPolicyInformer.Run(wait.NeverStop)
+
+		baselineAdminNetworkPolicyInformer := policyConfig.NewBaselineAdminNetworkPolicyInformer(s.AdminNetworkPolicyClient, s.ConfigSyncPeriod)
+		baselineAdminNetworkPolicyConfig := policyConfig.NewBaselineAdminNetworkPolicyConfig(baselineAdminNetworkPolicyInformer, s.ConfigSyncPeriod)
+		baselineAdminNetworkPolicyConfig.RegisterEventHandler(s.BaselineAdminNetworkPolicyEventHandler)
+		go baselineAdminNetworkPolicyConfig.Run(wait.NeverStop)
+		go baselineAdminNetworkPolicyInformer.Run(wait.NeverStop)
+	}
+
 	StopCh = make(chan struct{})
 
 	wg.Add(1)
 	go s.Policy.SyncLoop(StopCh, &wg)
 
+	wg.Add(1)
+	go s.Policy.RunFlowLog(StopCh, &wg)
+
+	wg.Add(1)
+	go s.Policy.RunFQDNResolver(StopCh, &wg)
+
+	wg.Add(1)
+	go s.Policy.RunPolicyCounters(StopCh, &wg)
+
 
-	ch := make(chan os.Signal)
-	signal.Notify(ch, syscall.SIGINT, syscall.SIGTERM)
-	<-ch
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	for sig := range ch{
+		if sig != syscall.SIGHUP{
+			break
+		}
+		s.ReloadConfig()
+	}
 
 	glog.V(0).Infof("get sys terminal and exit enn policy")
-	StopCh <- struct{}{}
+	close(StopCh)
 
 	wg.Wait()
 
@@ -21,6 +21,18 @@ func main() {
 	pflag.Parse()
 	defer glog.Flush()
 
+	if config.Version{
+		app.ShowVersion()
+		os.Exit(0)
+	}
+
+	// merge config file with command line flags and validate the result
+	config, err := options.LoadEnnPolicyConfig(config.ConfigFile, os.Args[1:])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "EnnPolicy config error: %v\n", err)
+		os.Exit(1)
+	}
+
 	if config.GlogToStderr{
 		flag.Set("logtostderr", "true")
 	}
@@ -36,11 +48,19 @@ func main() {
 		os.Exit(0)
 	}
 
-	if config.Version{
-		app.ShowVersion()
+	// enn-policy preflight only runs preflight checks and exits
+	if pflag.Arg(0) == "preflight"{
+		if !app.PrintPreflight(){
+			os.Exit(1)
+		}
 		os.Exit(0)
 	}
 
+	if err = app.RunPreflight(config.IgnorePreflightErrors); err != nil {
+		fmt.Fprintf(os.Stderr, "EnnPolicy preflight error: %v\nrun \"enn-policy preflight\" for details, or set --ignore-preflight-errors to start anyway\n", err)
+		os.Exit(1)
+	}
+
 	s, err := app.NewEnnPolicyServerDefault(config)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "EnnPolicy config error: %v\n", err)
@@ -0,0 +1,3 @@
+// Package v1alpha1 is the v1alpha1 version of the networking.enn.cn api group,
+// it defines the custom resources watched by enn-policy, e.g GlobalNetworkPolicy
+package v1alpha1
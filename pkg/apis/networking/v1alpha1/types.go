@@ -0,0 +1,84 @@
+package v1alpha1
+
+import (
+	networking "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// GlobalNetworkPolicy is a cluster-scoped NetworkPolicy, it applies to pods selected by spec.podSelector
+// in every namespace selected by spec.namespaceSelector, e.g
+// apiVersion: networking.enn.cn/v1alpha1
+// kind: GlobalNetworkPolicy
+// metadata:
+//   name: deny-metadata
+// spec:
+//   namespaceSelector: {}
+//   podSelector: {}
+//   policyTypes: [Egress]
+//   egress:
+//   - to:
+//     - ipBlock:
+//         cidr: 0.0.0.0/0
+//         except: [169.254.169.254/32]
+type GlobalNetworkPolicy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec GlobalNetworkPolicySpec `json:"spec,omitempty"`
+}
+
+// GlobalNetworkPolicySpec is NetworkPolicySpec with a namespaceSelector for its targets
+type GlobalNetworkPolicySpec struct {
+	// Selects the namespaces to which this GlobalNetworkPolicy applies, an empty selector selects all namespaces.
+	NamespaceSelector metav1.LabelSelector `json:"namespaceSelector"`
+	// Selects the pods to which this GlobalNetworkPolicy applies in every selected namespace,
+	// an empty selector selects all pods of the namespace.
+	PodSelector metav1.LabelSelector `json:"podSelector"`
+	// Ingress and Egress rules have the same semantics as NetworkPolicy,
+	// a podSelector peer selects pods in the same namespace as the target pod.
+	Ingress []networking.NetworkPolicyIngressRule `json:"ingress,omitempty"`
+	Egress []networking.NetworkPolicyEgressRule `json:"egress,omitempty"`
+	PolicyTypes []networking.PolicyType `json:"policyTypes,omitempty"`
+	// Rules are explicit Allow and Deny rules of the selected pods, they are evaluated by priority
+	// before any NetworkPolicy, so a Deny rule blocks traffic even if a NetworkPolicy allows it.
+	Rules []ExplicitRule `json:"rules,omitempty"`
+}
+
+// ExplicitRuleAction is the action of an explicit rule, Allow or Deny
+type ExplicitRuleAction string
+
+const (
+	// ExplicitRuleActionAllow accepts the traffic, NetworkPolicies are not evaluated
+	ExplicitRuleActionAllow ExplicitRuleAction = "Allow"
+	// ExplicitRuleActionDeny denies the traffic by the deny action of the namespace, NetworkPolicies are not evaluated
+	ExplicitRuleActionDeny  ExplicitRuleAction = "Deny"
+)
+
+// ExplicitRule matches traffic of the pods selected by the GlobalNetworkPolicy, e.g
+// rules:
+// - action: Deny
+//   priority: 100
+//   direction: Egress
+//   peers:
+//   - ipBlock:
+//       cidr: 203.0.113.0/24
+type ExplicitRule struct {
+	Action ExplicitRuleAction `json:"action"`
+	// Priority orders explicit rules of all GlobalNetworkPolicies, a rule with lower priority is evaluated first,
+	// rules with the same priority are ordered by name of their policy and then by their index, default 1000.
+	Priority *int32 `json:"priority,omitempty"`
+	// Direction is Ingress or Egress of the selected pods.
+	Direction networking.PolicyType `json:"direction"`
+	// Peers only support ipBlock, empty peers match all traffic.
+	Peers []networking.NetworkPolicyPeer `json:"peers,omitempty"`
+	// Ports have the same semantics as NetworkPolicy, empty ports match all ports.
+	Ports []networking.NetworkPolicyPort `json:"ports,omitempty"`
+}
+
+// GlobalNetworkPolicyList is a list of GlobalNetworkPolicy objects.
+type GlobalNetworkPolicyList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+
+	Items []GlobalNetworkPolicy `json:"items"`
+}
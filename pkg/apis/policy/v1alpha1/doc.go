@@ -0,0 +1,3 @@
+// Package v1alpha1 is the subset of the v1alpha1 version of the policy.networking.k8s.io api group
+// (sigs.k8s.io/network-policy-api) which is enforced by enn-policy, e.g AdminNetworkPolicy and BaselineAdminNetworkPolicy
+package v1alpha1
@@ -0,0 +1,179 @@
+package v1alpha1
+
+import (
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// AdminNetworkPolicy is a cluster-scoped policy of cluster admins, its rules are evaluated before NetworkPolicy, e.g
+// apiVersion: policy.networking.k8s.io/v1alpha1
+// kind: AdminNetworkPolicy
+// metadata:
+//   name: deny-monitoring
+// spec:
+//   priority: 10
+//   subject:
+//     namespaces: {}
+//   ingress:
+//   - name: deny-from-monitoring
+//     action: Deny
+//     from:
+//     - namespaces:
+//         matchLabels:
+//           kubernetes.io/metadata.name: monitoring
+// status is not defined since enn-policy does not report it
+type AdminNetworkPolicy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec AdminNetworkPolicySpec `json:"spec"`
+}
+
+// AdminNetworkPolicySpec defines the desired state of AdminNetworkPolicy.
+type AdminNetworkPolicySpec struct {
+	// Priority is a value from 0 to 1000, a policy with lower priority is evaluated first.
+	Priority int32 `json:"priority"`
+	// Subject selects the pods the policy applies to.
+	Subject AdminNetworkPolicySubject `json:"subject"`
+	// Ingress rules are evaluated in order, the first rule which matches decides the action.
+	Ingress []AdminNetworkPolicyIngressRule `json:"ingress,omitempty"`
+	// Egress rules are evaluated in order, the first rule which matches decides the action.
+	Egress []AdminNetworkPolicyEgressRule `json:"egress,omitempty"`
+}
+
+// AdminNetworkPolicySubject selects pods, exactly one field must be set.
+type AdminNetworkPolicySubject struct {
+	// Namespaces selects all pods of the selected namespaces.
+	Namespaces *metav1.LabelSelector `json:"namespaces,omitempty"`
+	// Pods selects pods of the selected namespaces.
+	Pods *NamespacedPod `json:"pods,omitempty"`
+}
+
+// NamespacedPod selects pods by podSelector in the namespaces selected by namespaceSelector.
+type NamespacedPod struct {
+	NamespaceSelector metav1.LabelSelector `json:"namespaceSelector"`
+	PodSelector       metav1.LabelSelector `json:"podSelector"`
+}
+
+// AdminNetworkPolicyRuleAction is the action of a rule of AdminNetworkPolicy.
+type AdminNetworkPolicyRuleAction string
+
+const (
+	// AdminNetworkPolicyRuleActionAllow accepts the traffic, NetworkPolicy and BaselineAdminNetworkPolicy are not evaluated.
+	AdminNetworkPolicyRuleActionAllow AdminNetworkPolicyRuleAction = "Allow"
+	// AdminNetworkPolicyRuleActionDeny denies the traffic.
+	AdminNetworkPolicyRuleActionDeny  AdminNetworkPolicyRuleAction = "Deny"
+	// AdminNetworkPolicyRuleActionPass skips AdminNetworkPolicies with lower priority, the traffic is decided by NetworkPolicy.
+	AdminNetworkPolicyRuleActionPass  AdminNetworkPolicyRuleAction = "Pass"
+)
+
+// AdminNetworkPolicyIngressRule matches traffic from peers to the subject.
+type AdminNetworkPolicyIngressRule struct {
+	Name   string                         `json:"name,omitempty"`
+	Action AdminNetworkPolicyRuleAction   `json:"action"`
+	From   []AdminNetworkPolicyIngressPeer `json:"from"`
+	// Ports are optional, nil matches all ports.
+	Ports  *[]AdminNetworkPolicyPort       `json:"ports,omitempty"`
+}
+
+// AdminNetworkPolicyEgressRule matches traffic from the subject to peers.
+type AdminNetworkPolicyEgressRule struct {
+	Name   string                         `json:"name,omitempty"`
+	Action AdminNetworkPolicyRuleAction   `json:"action"`
+	To     []AdminNetworkPolicyEgressPeer `json:"to"`
+	// Ports are optional, nil matches all ports.
+	Ports  *[]AdminNetworkPolicyPort       `json:"ports,omitempty"`
+}
+
+// AdminNetworkPolicyIngressPeer selects pods, exactly one field must be set.
+type AdminNetworkPolicyIngressPeer struct {
+	Namespaces *metav1.LabelSelector `json:"namespaces,omitempty"`
+	Pods       *NamespacedPod        `json:"pods,omitempty"`
+}
+
+// AdminNetworkPolicyEgressPeer selects pods, nodes or networks, exactly one field must be set.
+type AdminNetworkPolicyEgressPeer struct {
+	Namespaces *metav1.LabelSelector `json:"namespaces,omitempty"`
+	Pods       *NamespacedPod        `json:"pods,omitempty"`
+	// Nodes is not supported by enn-policy.
+	Nodes      *metav1.LabelSelector `json:"nodes,omitempty"`
+	// Networks are CIDRs, e.g 10.0.0.0/8
+	Networks   []string              `json:"networks,omitempty"`
+}
+
+// AdminNetworkPolicyPort selects ports, exactly one field must be set.
+type AdminNetworkPolicyPort struct {
+	PortNumber *Port      `json:"portNumber,omitempty"`
+	// NamedPort is not supported by enn-policy.
+	NamedPort  *string    `json:"namedPort,omitempty"`
+	PortRange  *PortRange `json:"portRange,omitempty"`
+}
+
+// Port is a port number of a protocol.
+type Port struct {
+	Protocol core.Protocol `json:"protocol"`
+	Port     int32         `json:"port"`
+}
+
+// PortRange is an inclusive range of ports of a protocol.
+type PortRange struct {
+	Protocol core.Protocol `json:"protocol,omitempty"`
+	Start    int32         `json:"start"`
+	End      int32         `json:"end"`
+}
+
+// AdminNetworkPolicyList is a list of AdminNetworkPolicy objects.
+type AdminNetworkPolicyList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+
+	Items []AdminNetworkPolicy `json:"items"`
+}
+
+// BaselineAdminNetworkPolicy is the cluster-scoped default of traffic which is not selected by any NetworkPolicy,
+// it is a singleton named default, its rules are evaluated after NetworkPolicy.
+type BaselineAdminNetworkPolicy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec BaselineAdminNetworkPolicySpec `json:"spec"`
+}
+
+// BaselineAdminNetworkPolicySpec defines the desired state of BaselineAdminNetworkPolicy.
+type BaselineAdminNetworkPolicySpec struct {
+	Subject AdminNetworkPolicySubject              `json:"subject"`
+	Ingress []BaselineAdminNetworkPolicyIngressRule `json:"ingress,omitempty"`
+	Egress  []BaselineAdminNetworkPolicyEgressRule  `json:"egress,omitempty"`
+}
+
+// BaselineAdminNetworkPolicyRuleAction is the action of a rule of BaselineAdminNetworkPolicy.
+type BaselineAdminNetworkPolicyRuleAction string
+
+const (
+	BaselineAdminNetworkPolicyRuleActionAllow BaselineAdminNetworkPolicyRuleAction = "Allow"
+	BaselineAdminNetworkPolicyRuleActionDeny  BaselineAdminNetworkPolicyRuleAction = "Deny"
+)
+
+// BaselineAdminNetworkPolicyIngressRule matches traffic from peers to the subject.
+type BaselineAdminNetworkPolicyIngressRule struct {
+	Name   string                               `json:"name,omitempty"`
+	Action BaselineAdminNetworkPolicyRuleAction `json:"action"`
+	From   []AdminNetworkPolicyIngressPeer       `json:"from"`
+	Ports  *[]AdminNetworkPolicyPort             `json:"ports,omitempty"`
+}
+
+// BaselineAdminNetworkPolicyEgressRule matches traffic from the subject to peers.
+type BaselineAdminNetworkPolicyEgressRule struct {
+	Name   string                               `json:"name,omitempty"`
+	Action BaselineAdminNetworkPolicyRuleAction `json:"action"`
+	To     []AdminNetworkPolicyEgressPeer        `json:"to"`
+	Ports  *[]AdminNetworkPolicyPort             `json:"ports,omitempty"`
+}
+
+// BaselineAdminNetworkPolicyList is a list of BaselineAdminNetworkPolicy objects.
+type BaselineAdminNetworkPolicyList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+
+	Items []BaselineAdminNetworkPolicy `json:"items"`
+}
@@ -0,0 +1,369 @@
+package policy
+
+import (
+	adminApi "enn-policy/pkg/apis/policy/v1alpha1"
+	"github.com/golang/glog"
+	utilpolicy "enn-policy/pkg/policy/util"
+	utilIPSet "enn-policy/pkg/util/ipset"
+	utiliptables "enn-policy/pkg/util/k8siptables"
+
+	"crypto/sha256"
+	"encoding/base32"
+	"fmt"
+	"sort"
+)
+
+// AdminNetworkPolicies and BaselineAdminNetworkPolicies are rendered as two tiers around the entries of namespaces:
+// -A ENN-FORWARD -j MARK --set-xmark 0x0/0x30000
+// -A ENN-FORWARD -j ENN-ANP-EGRESS                          (Allow marks 0x20000, Pass returns, Deny denies)
+// -A ENN-FORWARD -j ENN-ANP-INGRESS                         (Allow marks 0x10000, Pass returns, Deny denies)
+// -A ENN-FORWARD -m mark --mark 0x30000/0x30000 -j ACCEPT
+// -A ENN-FORWARD -m set --match-set [namespace] dst -m mark ! --mark 0x10000/0x10000 -j ENN-INGRESS-xxx
+// -A ENN-FORWARD -m set --match-set [namespace] src -m mark ! --mark 0x20000/0x20000 -j ENN-EGRESS-xxx
+// -A ENN-FORWARD -m mark ! --mark 0x20000/0x20000 -j ENN-BANP-EGRESS
+// -A ENN-FORWARD -m mark ! --mark 0x10000/0x10000 -j ENN-BANP-INGRESS
+// so a direction allowed by an AdminNetworkPolicy skips NetworkPolicy and BaselineAdminNetworkPolicy,
+// and BaselineAdminNetworkPolicy only sees traffic which is not handled by NetworkPolicy of the namespace
+// explicit Allow rules of ENN-PRIORITY set the same marks, the marks are reset before ENN-PRIORITY, see writeAllowMarkReset
+const (
+	ENN_ANP_INGRESS_CHAIN  = "ENN-ANP-INGRESS"
+	ENN_ANP_EGRESS_CHAIN   = "ENN-ANP-EGRESS"
+	ENN_BANP_INGRESS_CHAIN = "ENN-BANP-INGRESS"
+	ENN_BANP_EGRESS_CHAIN  = "ENN-BANP-EGRESS"
+
+	// adminAllowIngressMark and adminAllowEgressMark are set on traffic allowed by an AdminNetworkPolicy in that direction
+	adminAllowIngressMark = "0x10000"
+	adminAllowEgressMark  = "0x20000"
+	adminAllowMarks       = "0x30000"
+)
+
+// adminPolicySet is an ipset of pods selected by the subject or a peer of admin network policies
+type adminPolicySet struct {
+	ipset     *utilIPSet.IPSet
+	selector  utilpolicy.AdminSelector
+	// subject is true if the set is a subject, hostNetwork pods are never the subject of a policy
+	subject   bool
+}
+
+func (policy *EnnPolicy) OnAdminNetworkPolicyAdd(adminNetworkPolicy *adminApi.AdminNetworkPolicy){
+	glog.V(6).Infof("OnAdminNetworkPolicyAdd policy name: %s", adminNetworkPolicy.Name)
+	if policy.adminNetworkPolicyChanges.UpdateAdmin(adminNetworkPolicy.Name, nil, adminNetworkPolicy) && policy.isInitialized() {
+		policy.syncEnnPolicy(SYNCADMINNETWORKPOLICY)
+	}
+}
+
+func (policy *EnnPolicy) OnAdminNetworkPolicyUpdate(oldAdminNetworkPolicy, adminNetworkPolicy *adminApi.AdminNetworkPolicy){
+	glog.V(6).Infof("OnAdminNetworkPolicyUpdate old policy name: %s; new policy name: %s", oldAdminNetworkPolicy.Name, adminNetworkPolicy.Name)
+	if policy.adminNetworkPolicyChanges.UpdateAdmin(adminNetworkPolicy.Name, oldAdminNetworkPolicy, adminNetworkPolicy) && policy.isInitialized() {
+		policy.syncEnnPolicy(SYNCADMINNETWORKPOLICY)
+	}
+}
+
+func (policy *EnnPolicy) OnAdminNetworkPolicyDelete(adminNetworkPolicy *adminApi.AdminNetworkPolicy){
+	glog.V(6).Infof("OnAdminNetworkPolicyDelete policy name: %s", adminNetworkPolicy.Name)
+	if policy.adminNetworkPolicyChanges.UpdateAdmin(adminNetworkPolicy.Name, adminNetworkPolicy, nil) && policy.isInitialized() {
+		policy.syncEnnPolicy(SYNCADMINNETWORKPOLICY)
+	}
+}
+
+func (policy *EnnPolicy) OnAdminNetworkPolicySynced(){
+	glog.V(6).Infof("OnAdminNetworkPolicySynced")
+	policy.mu.Lock()
+	policy.adminNetworkPolicySynced = true
+	policy.setInitialized(policy.allSynced())
+	policy.mu.Unlock()
+
+	policy.syncEnnPolicy(SYNCADMINNETWORKPOLICY)
+}
+
+func (policy *EnnPolicy) OnBaselineAdminNetworkPolicyAdd(baselineAdminNetworkPolicy *adminApi.BaselineAdminNetworkPolicy){
+	glog.V(6).Infof("OnBaselineAdminNetworkPolicyAdd policy name: %s", baselineAdminNetworkPolicy.Name)
+	if policy.baselineAdminNetworkPolicyChanges.UpdateBaseline(baselineAdminNetworkPolicy.Name, nil, baselineAdminNetworkPolicy) && policy.isInitialized() {
+		policy.syncEnnPolicy(SYNCADMINNETWORKPOLICY)
+	}
+}
+
+func (policy *EnnPolicy) OnBaselineAdminNetworkPolicyUpdate(oldBaselineAdminNetworkPolicy, baselineAdminNetworkPolicy *adminApi.BaselineAdminNetworkPolicy){
+	glog.V(6).Infof("OnBaselineAdminNetworkPolicyUpdate old policy name: %s; new policy name: %s", oldBaselineAdminNetworkPolicy.Name, baselineAdminNetworkPolicy.Name)
+	if policy.baselineAdminNetworkPolicyChanges.UpdateBaseline(baselineAdminNetworkPolicy.Name, oldBaselineAdminNetworkPolicy, baselineAdminNetworkPolicy) && policy.isInitialized() {
+		policy.syncEnnPolicy(SYNCADMINNETWORKPOLICY)
+	}
+}
+
+func (policy *EnnPolicy) OnBaselineAdminNetworkPolicyDelete(baselineAdminNetworkPolicy *adminApi.BaselineAdminNetworkPolicy){
+	glog.V(6).Infof("OnBaselineAdminNetworkPolicyDelete policy name: %s", baselineAdminNetworkPolicy.Name)
+	if policy.baselineAdminNetworkPolicyChanges.UpdateBaseline(baselineAdminNetworkPolicy.Name, baselineAdminNetworkPolicy, nil) && policy.isInitialized() {
+		policy.syncEnnPolicy(SYNCADMINNETWORKPOLICY)
+	}
+}
+
+func (policy *EnnPolicy) OnBaselineAdminNetworkPolicySynced(){
+	glog.V(6).Infof("OnBaselineAdminNetworkPolicySynced")
+	policy.mu.Lock()
+	policy.baselineAdminNetworkPolicySynced = true
+	policy.setInitialized(policy.allSynced())
+	policy.mu.Unlock()
+
+	policy.syncEnnPolicy(SYNCADMINNETWORKPOLICY)
+}
+
+// adminTierEnabled returns true if any AdminNetworkPolicy or BaselineAdminNetworkPolicy exists,
+// rules of namespaces are not changed otherwise
+func (policy *EnnPolicy) adminTierEnabled() bool{
+	return len(policy.adminNetworkPolicyMap) > 0 || len(policy.baselineAdminNetworkPolicyMap) > 0
+}
+
+// allowMarksEnabled returns true if an AdminNetworkPolicy tier or an explicit rule of globalNetworkPolicies may set allow marks
+func (policy *EnnPolicy) allowMarksEnabled() bool{
+	return policy.adminTierEnabled() || policy.hasExplicitRules()
+}
+
+// adminAllowedMatch returns the match of traffic which is not allowed by an AdminNetworkPolicy or an explicit Allow rule
+// in the direction of mark, it is added to entries of namespaces, so an allowed direction does not evaluate NetworkPolicy
+func (policy *EnnPolicy) adminAllowedMatch(mark string) []string{
+	if !policy.allowMarksEnabled(){
+		return nil
+	}
+	return []string{"-m", "mark", "!", "--mark", mark + "/" + mark}
+}
+
+// writeAllowMarkReset clears allow marks of the packet, it must be called before ENN-PRIORITY and the AdminNetworkPolicy tier are written
+func (policy *EnnPolicy) writeAllowMarkReset(){
+	if !policy.allowMarksEnabled(){
+		return
+	}
+	for _, entryChain := range []string{ENN_FORWARD_CHAIN, ENN_OUTPUT_CHAIN}{
+		writeLine(policy.filterRules,
+			"-A", entryChain,
+			"-m", "comment", "--comment", `"reset marks of admin network policies"`,
+			"-j", "MARK", "--set-xmark", "0x0/" + adminAllowMarks,
+		)
+	}
+}
+
+// sortedAdminNetworkPolicies returns policies of adminNetworkPolicyMap by priority and then by name,
+// the order of policies with the same priority is undefined upstream
+func sortedAdminNetworkPolicies(adminNetworkPolicyMap utilpolicy.AdminNetworkPolicyMap) []*utilpolicy.AdminNetworkPolicyInfo{
+	policies := make([]*utilpolicy.AdminNetworkPolicyInfo, 0, len(adminNetworkPolicyMap))
+	for _, info := range adminNetworkPolicyMap{
+		policies = append(policies, info)
+	}
+	sort.Slice(policies, func(i, j int) bool{
+		if policies[i].Priority != policies[j].Priority{
+			return policies[i].Priority < policies[j].Priority
+		}
+		return policies[i].Name < policies[j].Name
+	})
+	return policies
+}
+
+// writeAdminPolicyRules writes the AdminNetworkPolicy tier, it must be called before entries of namespaces are written
+func (policy *EnnPolicy) writeAdminPolicyRules(){
+
+	policy.adminPolicySets = make(map[string]*adminPolicySet)
+	if len(policy.adminNetworkPolicyMap) == 0{
+		return
+	}
+
+	policy.writeAdminChain(ENN_ANP_EGRESS_CHAIN)
+	policy.writeAdminChain(ENN_ANP_INGRESS_CHAIN)
+	for _, entryChain := range []string{ENN_FORWARD_CHAIN, ENN_OUTPUT_CHAIN}{
+		writeLine(policy.filterRules, "-A", entryChain, "-j", ENN_ANP_EGRESS_CHAIN)
+		writeLine(policy.filterRules, "-A", entryChain, "-j", ENN_ANP_INGRESS_CHAIN)
+		writeLine(policy.filterRules,
+			"-A", entryChain,
+			"-m", "mark", "--mark", adminAllowMarks + "/" + adminAllowMarks,
+			"-m", "comment", "--comment", `"both directions are allowed by admin network policies"`,
+			"-j", "ACCEPT",
+		)
+	}
+
+	for _, info := range sortedAdminNetworkPolicies(policy.adminNetworkPolicyMap){
+		policy.writeAdminPolicy(info, ENN_ANP_INGRESS_CHAIN, ENN_ANP_EGRESS_CHAIN)
+	}
+}
+
+// writeBaselineAdminPolicyRules writes the BaselineAdminNetworkPolicy tier, it must be called after entries of namespaces are written
+func (policy *EnnPolicy) writeBaselineAdminPolicyRules(){
+
+	if len(policy.baselineAdminNetworkPolicyMap) == 0{
+		return
+	}
+	policy.writeAdminChain(ENN_BANP_EGRESS_CHAIN)
+	policy.writeAdminChain(ENN_BANP_INGRESS_CHAIN)
+	for _, entryChain := range []string{ENN_FORWARD_CHAIN, ENN_OUTPUT_CHAIN}{
+		writeLine(policy.filterRules, append(append([]string{"-A", entryChain}, policy.adminAllowedMatch(adminAllowEgressMark)...),
+			"-j", ENN_BANP_EGRESS_CHAIN)...)
+		writeLine(policy.filterRules, append(append([]string{"-A", entryChain}, policy.adminAllowedMatch(adminAllowIngressMark)...),
+			"-j", ENN_BANP_INGRESS_CHAIN)...)
+	}
+
+	for _, info := range sortedAdminNetworkPolicies(policy.baselineAdminNetworkPolicyMap){
+		policy.writeAdminPolicy(info, ENN_BANP_INGRESS_CHAIN, ENN_BANP_EGRESS_CHAIN)
+	}
+}
+
+// writeAdminChain creates chain of a tier, replies of allowed connections are not evaluated by the tier, like ENN-PLY-* chains
+func (policy *EnnPolicy) writeAdminChain(chain string){
+	chainName := utiliptables.Chain(chain)
+	if existing, ok := policy.existingFilterChains[chainName]; ok {
+		writeLine(policy.filterChains, existing)
+	} else {
+		writeLine(policy.filterChains, utiliptables.MakeChainLine(chainName))
+	}
+	policy.activeFilterChains[chainName] = true
+	writeLine(policy.filterRules,
+		"-A", chain,
+		"-m", "conntrack", "--ctstate", "RELATED,ESTABLISHED",
+		"-j", "RETURN",
+	)
+}
+
+func (policy *EnnPolicy) writeAdminPolicy(info *utilpolicy.AdminNetworkPolicyInfo, ingressChain, egressChain string){
+
+	if info.MatchNone{
+		return
+	}
+	subjectSet := policy.adminPolicySetName(info.Subject, true)
+	if subjectSet == ""{
+		return
+	}
+	for i, rule := range info.Ingress{
+		policy.writeAdminRule(info, ingressChain, utilpolicy.TypeIngress, i, rule, subjectSet)
+	}
+	for i, rule := range info.Egress{
+		policy.writeAdminRule(info, egressChain, utilpolicy.TypeEgress, i, rule, subjectSet)
+	}
+}
+
+// writeAdminRule writes rule of info into chain, every peer and port is rendered as one rule, e.g
+// -A ENN-ANP-EGRESS -m set --match-set [subject] src -m set --match-set [peer] dst -p TCP --dport 80 -j MARK --set-xmark 0x20000/0x20000
+// -A ENN-ANP-EGRESS -m set --match-set [subject] src -m set --match-set [peer] dst -p TCP --dport 80 -j RETURN
+func (policy *EnnPolicy) writeAdminRule(info *utilpolicy.AdminNetworkPolicyInfo, chain string, direction string, index int,
+	rule utilpolicy.AdminRule, subjectSet string){
+
+	kind := "adminNetworkPolicy"
+	if info.Baseline{
+		kind = "baselineAdminNetworkPolicy"
+	}
+	subjectDirect, peerDirect, cidrDirect := "dst", "src", "-s"
+	flowDirection, allowMark := flowDirectionIngress, adminAllowIngressMark
+	if direction == utilpolicy.TypeEgress{
+		subjectDirect, peerDirect, cidrDirect = "src", "dst", "-d"
+		flowDirection, allowMark = flowDirectionEgress, adminAllowEgressMark
+	}
+	comment := fmt.Sprintf(`"%s %s rule %d of %s %s"`, rule.Action, direction, index, kind, info.Name)
+
+	var peerMatches [][]string
+	for _, peer := range rule.Peers{
+		if peer.Pods == nil{
+			for _, cidr := range peer.CIDRs{
+				peerMatches = append(peerMatches, []string{cidrDirect, cidr})
+			}
+			continue
+		}
+		peerSet := policy.adminPolicySetName(*peer.Pods, false)
+		if peerSet == ""{
+			continue
+		}
+		peerMatches = append(peerMatches, []string{"-m", "set", "--match-set", peerSet, peerDirect})
+	}
+	ports := rule.Ports
+	if len(ports) == 0{
+		ports = []utilpolicy.PolicyPort{{}}
+	}
+
+	for _, peerMatch := range peerMatches{
+		for _, port := range ports{
+			match := []string{"-m", "set", "--match-set", subjectSet, subjectDirect}
+			match = append(match, peerMatch...)
+			if port.Port != ""{
+				match = append(match, "-p", port.Protocol, "--dport", port.Port)
+			}
+			args := append([]string{"-A", chain, "-m", "comment", "--comment", comment}, match...)
+
+			switch rule.Action{
+			case utilpolicy.AdminPolicyActionAllow:
+				// traffic allowed by a BaselineAdminNetworkPolicy is accepted at the end of ENN-FORWARD/ENN-OUTPUT
+				if !info.Baseline{
+					writeLine(policy.filterRules, append(args, "-j", "MARK", "--set-xmark", allowMark + "/" + allowMark)...)
+				}
+				writeLine(policy.filterRules, append(args, "-j", "RETURN")...)
+			case utilpolicy.AdminPolicyActionPass:
+				writeLine(policy.filterRules, append(args, "-j", "RETURN")...)
+			default:
+				if flowLogRule := policy.flowLogRule(chain, policy.flowLogPrefix(flowLogTagDeny, flowDirection, "", info.Name),
+					comment, match...); flowLogRule != nil{
+					writeLine(policy.filterRules, flowLogRule...)
+				}
+				for _, denyRule := range denyRules(policy.denyActionMode(""), chain, comment, match...){
+					writeLine(policy.filterRules, denyRule...)
+				}
+			}
+		}
+	}
+}
+
+// adminPolicySetName returns the name of the ipset of pods selected by selector, it is created if necessary,
+// empty if it can not be created, entries are synced by syncAdminPolicySets
+func (policy *EnnPolicy) adminPolicySetName(selector utilpolicy.AdminSelector, subject bool) string{
+
+	kind := "peer"
+	if subject{
+		kind = "subject"
+	}
+	name := ennAdminIPSetName(kind, selector.Key())
+	if _, ok := policy.adminPolicySets[name]; ok{
+		return name
+	}
+	ipset := &utilIPSet.IPSet{
+		Name:    name,
+		Type:    utilIPSet.TypeHashIP,
+	}
+	if err := policy.ipsetInterface.CreateIPSet(ipset, true); err != nil{
+		glog.Errorf("create ipset %s for admin network policy %s %s err %v", name, kind, selector.Key(), err)
+		return ""
+	}
+	policy.activeIPSets[name] = ipset
+	policy.adminPolicySets[name] = &adminPolicySet{
+		ipset:    ipset,
+		selector: selector,
+		subject:  subject,
+	}
+	return name
+}
+
+// adminPolicySetMembers returns the pods in set
+func (policy *EnnPolicy) adminPolicySetMembers(set *adminPolicySet) utilpolicy.PodInfoMap{
+	members := make(utilpolicy.PodInfoMap)
+	for namespace, namespaceInfo := range policy.namespaceInfoMap{
+		if !set.selector.SelectsNamespace(namespaceInfo){
+			continue
+		}
+		for ip, pod := range policy.namespacePodMap[namespace]{
+			if set.subject && pod.HostNetwork{
+				continue
+			}
+			if set.selector.SelectsPod(pod){
+				members[ip] = pod
+			}
+		}
+	}
+	return members
+}
+
+// syncAdminPolicySets syncs entries of all ipsets of admin network policies, since they select pods by labels of namespaces
+// and pods, they are synced after every change of pods and namespaces
+func (policy *EnnPolicy) syncAdminPolicySets(){
+	for name, set := range policy.adminPolicySets{
+		if err := policy.syncIPSetEntry(set.ipset, policy.adminPolicySetMembers(set)); err != nil{
+			glog.Errorf("sync entry for ipset %s of admin network policy failed %v", name, err)
+		}
+	}
+}
+
+func ennAdminIPSetName(kind string, selector string) string{
+	hash := sha256.Sum256([]byte(kind + selector))
+	encoded := base32.StdEncoding.EncodeToString(hash[:])
+	return "ENN-ANPSET-" + encoded[:16]
+}
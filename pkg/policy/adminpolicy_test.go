@@ -0,0 +1,537 @@
+package policy
+
+import (
+	utilpolicy "enn-policy/pkg/policy/util"
+	utilIPSet "enn-policy/pkg/util/ipset"
+	fakeIPSet "enn-policy/pkg/util/ipset/testing"
+	utiliptables "enn-policy/pkg/util/k8siptables"
+
+	"bytes"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+const (
+	tenantAWeb = "10.0.1.1"
+	tenantADB  = "10.0.1.2"
+	tenantBWeb = "10.0.2.1"
+	monitoring = "10.0.3.1"
+	external   = "8.8.8.8"
+)
+
+// adminTestPacket is a new connection evaluated by adminTestChains
+type adminTestPacket struct {
+	src      string
+	dst      string
+	protocol string
+	port     string
+}
+
+// adminTestChains is a small evaluator of the rendered filter rules, it knows the matches and targets used by enn-policy,
+// so the semantics of admin network policy tiers can be checked without a kernel
+type adminTestChains struct {
+	rules map[string][][]string
+	sets  map[string]map[string]bool
+	mark  uint64
+}
+
+func splitAdminTestRule(line string) []string{
+	var args []string
+	var current strings.Builder
+	quoted := false
+	for _, c := range line{
+		switch {
+		case c == '"':
+			quoted = !quoted
+		case c == ' ' && !quoted:
+			if current.Len() > 0{
+				args = append(args, current.String())
+				current.Reset()
+			}
+		default:
+			current.WriteRune(c)
+		}
+	}
+	if current.Len() > 0{
+		args = append(args, current.String())
+	}
+	return args
+}
+
+func newAdminTestChains(policy *EnnPolicy, faker *fakeIPSet.Faker, sets map[string][]string) *adminTestChains{
+	chains := &adminTestChains{
+		rules: make(map[string][][]string),
+		sets:  make(map[string]map[string]bool),
+	}
+	for _, line := range strings.Split(policy.filterRules.String(), "\n"){
+		args := splitAdminTestRule(line)
+		if len(args) < 2 || args[0] != "-A"{
+			continue
+		}
+		chains.rules[args[1]] = append(chains.rules[args[1]], args[2:])
+	}
+	for set, entries := range faker.FakeSet{
+		chains.sets[set.Name] = make(map[string]bool)
+		for _, entry := range entries{
+			key := entry.IP
+			// hash:ip,port entries are matched by dst,dst like 10.0.0.1,tcp:80
+			if entry.Type == utilIPSet.TypeHashIPPort{
+				key, _ = utilIPSet.EntryToString(entry)
+			}
+			chains.sets[set.Name][key] = true
+		}
+	}
+	for name, ips := range sets{
+		chains.sets[name] = make(map[string]bool)
+		for _, ip := range ips{
+			chains.sets[name][ip] = true
+		}
+	}
+	return chains
+}
+
+func parseAdminTestMark(t *testing.T, value string) (uint64, uint64){
+	parts := strings.Split(value, "/")
+	mark, err := strconv.ParseUint(parts[0], 0, 32)
+	if err != nil{
+		t.Fatalf("invalid mark %s", value)
+	}
+	mask := uint64(0xffffffff)
+	if len(parts) == 2{
+		if mask, err = strconv.ParseUint(parts[1], 0, 32); err != nil{
+			t.Fatalf("invalid mask %s", value)
+		}
+	}
+	return mark, mask
+}
+
+func matchAdminTestAddress(address string, ip string) bool{
+	if _, cidr, err := net.ParseCIDR(address); err == nil{
+		return cidr.Contains(net.ParseIP(ip))
+	}
+	return address == ip
+}
+
+func matchAdminTestPort(port string, value string) bool{
+	bounds := strings.Split(port, ":")
+	if len(bounds) == 1{
+		return port == value
+	}
+	start, _ := strconv.Atoi(bounds[0])
+	end, _ := strconv.Atoi(bounds[1])
+	number, _ := strconv.Atoi(value)
+	return number >= start && number <= end
+}
+
+// evaluate returns the verdict of packet, traffic which is not accepted or denied by ENN-FORWARD is allowed
+func (chains *adminTestChains) evaluate(t *testing.T, packet adminTestPacket) string{
+	chains.mark = 0
+	if verdict := chains.run(t, ENN_FORWARD_CHAIN, packet, 0); verdict != ""{
+		return verdict
+	}
+	return "ACCEPT"
+}
+
+func (chains *adminTestChains) run(t *testing.T, chain string, packet adminTestPacket, depth int) string{
+	if depth > 10{
+		t.Fatalf("too many jumps at chain %s", chain)
+	}
+	for _, args := range chains.rules[chain]{
+		target, targetArgs, matched := chains.match(t, args, packet)
+		if !matched{
+			continue
+		}
+		switch target{
+		case "ACCEPT", "DROP", "REJECT":
+			return target
+		case "RETURN":
+			return ""
+		case "LOG", "NFLOG":
+		case "MARK":
+			mark, mask := parseAdminTestMark(t, targetArgs[1])
+			chains.mark = (chains.mark &^ mask) ^ mark
+		default:
+			if _, ok := chains.rules[target]; !ok{
+				t.Fatalf("jump to unknown chain %s in %v", target, args)
+			}
+			if verdict := chains.run(t, target, packet, depth+1); verdict != ""{
+				return verdict
+			}
+		}
+	}
+	return ""
+}
+
+// match returns the target of args and whether packet matches args
+func (chains *adminTestChains) match(t *testing.T, args []string, packet adminTestPacket) (string, []string, bool){
+	matched := true
+	for i := 0; i < len(args); i++{
+		switch args[i]{
+		case "-m":
+			i++
+			switch args[i]{
+			case "comment":
+				i += 2
+			case "limit":
+				i += 2
+			case "conntrack":
+				// packets are new connections
+				i += 2
+				matched = false
+			case "set":
+				negative := args[i+1] == "!"
+				if negative{
+					i++
+				}
+				name, direct := args[i+2], args[i+3]
+				i += 3
+				ip := packet.src
+				switch direct{
+				case "dst":
+					ip = packet.dst
+				case "dst,dst":
+					ip = fmt.Sprintf("%s,%s:%s", packet.dst, strings.ToLower(packet.protocol), packet.port)
+				}
+				if _, ok := chains.sets[name]; !ok{
+					t.Fatalf("unknown ipset %s in %v", name, args)
+				}
+				matched = matched && chains.sets[name][ip] != negative
+			case "mark":
+				negative := args[i+1] == "!"
+				if negative{
+					i++
+				}
+				mark, mask := parseAdminTestMark(t, args[i+2])
+				i += 2
+				matched = matched && ((chains.mark & mask) == mark) != negative
+			default:
+				t.Fatalf("unknown match %s in %v", args[i], args)
+			}
+		case "-s":
+			i++
+			matched = matched && matchAdminTestAddress(args[i], packet.src)
+		case "-d":
+			i++
+			matched = matched && matchAdminTestAddress(args[i], packet.dst)
+		case "-p":
+			i++
+			matched = matched && strings.EqualFold(args[i], packet.protocol)
+		case "--dport":
+			i++
+			matched = matched && matchAdminTestPort(args[i], packet.port)
+		case "-j":
+			return args[i+1], args[i+2:], matched
+		default:
+			t.Fatalf("unknown argument %s in %v", args[i], args)
+		}
+	}
+	t.Fatalf("rule without target %v", args)
+	return "", nil, false
+}
+
+// newAdminTestPolicy returns a policy with namespaces tenant-a and tenant-b labeled tenant=true and namespace monitoring
+func newAdminTestPolicy(faker *fakeIPSet.Faker) *EnnPolicy{
+	pod := func(namespace string, ip string, app string) *utilpolicy.PodInfo{
+		return &utilpolicy.PodInfo{IP: ip, Namespace: namespace, Labels: map[string]string{"app": app}}
+	}
+	return &EnnPolicy{
+		denyAction:           utilpolicy.DenyActionDrop,
+		ipsetInterface:       faker,
+		activeIPSets:         make(map[string]*utilIPSet.IPSet),
+		existingFilterChains: make(map[utiliptables.Chain]string),
+		activeFilterChains:   make(map[utiliptables.Chain]bool),
+		filterChains:         bytes.NewBuffer(nil),
+		filterRules:          bytes.NewBuffer(nil),
+		namespaceInfoMap: utilpolicy.NamespaceInfoMap{
+			"tenant-a":   &utilpolicy.NamespaceInfo{Name: "tenant-a", Labels: map[string]string{"tenant": "true"}},
+			"tenant-b":   &utilpolicy.NamespaceInfo{Name: "tenant-b", Labels: map[string]string{"tenant": "true"}},
+			"monitoring": &utilpolicy.NamespaceInfo{Name: "monitoring", Labels: map[string]string{"name": "monitoring"}},
+		},
+		namespacePodMap: utilpolicy.NamespacePodMap{
+			"tenant-a":   utilpolicy.PodInfoMap{tenantAWeb: pod("tenant-a", tenantAWeb, "web"), tenantADB: pod("tenant-a", tenantADB, "db")},
+			"tenant-b":   utilpolicy.PodInfoMap{tenantBWeb: pod("tenant-b", tenantBWeb, "web")},
+			"monitoring": utilpolicy.PodInfoMap{monitoring: pod("monitoring", monitoring, "prometheus")},
+		},
+		adminNetworkPolicyMap:         make(utilpolicy.AdminNetworkPolicyMap),
+		baselineAdminNetworkPolicyMap: make(utilpolicy.AdminNetworkPolicyMap),
+	}
+}
+
+// writeAdminTestIngressPolicy writes rules like a NetworkPolicy of namespace tenant-a which only allows ingress from allowed
+func writeAdminTestIngressPolicy(policy *EnnPolicy, allowed ...string){
+	args := []string{"-A", ENN_FORWARD_CHAIN, "-m", "set", "--match-set", "ENN-NS-TENANT-A", "dst"}
+	args = append(args, policy.adminAllowedMatch(adminAllowIngressMark)...)
+	writeLine(policy.filterRules, append(args, "-j", "ENN-INGRESS-TENANT-A")...)
+	for _, ip := range allowed{
+		writeLine(policy.filterRules, "-A", "ENN-INGRESS-TENANT-A", "-s", ip, "-j", "ACCEPT")
+	}
+	writeLine(policy.filterRules, "-A", "ENN-INGRESS-TENANT-A", "-j", "REJECT")
+}
+
+func namespacesPeer(labels map[string]string) utilpolicy.AdminPeer{
+	return utilpolicy.AdminPeer{Pods: &utilpolicy.AdminSelector{NamespaceSelector: labels}}
+}
+
+var tenantSubject = utilpolicy.AdminSelector{NamespaceSelector: map[string]string{"tenant": "true"}}
+
+func TestAdminNetworkPolicyConformance(t *testing.T){
+
+	allNamespaces := namespacesPeer(nil)
+	fromTenantB := namespacesPeer(map[string]string{"kubernetes.io/metadata.name": "tenant-b"})
+	fromMonitoring := namespacesPeer(map[string]string{"name": "monitoring"})
+	// tenant-b is the only namespace with label kubernetes.io/metadata.name in this test
+	ingressFromTenantB := adminTestPacket{src: tenantBWeb, dst: tenantAWeb, protocol: "TCP", port: "80"}
+	ingressFromMonitoring := adminTestPacket{src: monitoring, dst: tenantAWeb, protocol: "TCP", port: "9090"}
+
+	adminPolicy := func(name string, priority int32, rules ...utilpolicy.AdminRule) *utilpolicy.AdminNetworkPolicyInfo{
+		return &utilpolicy.AdminNetworkPolicyInfo{Name: name, Priority: priority, Subject: tenantSubject, Ingress: rules}
+	}
+	baselinePolicy := func(rules ...utilpolicy.AdminRule) *utilpolicy.AdminNetworkPolicyInfo{
+		return &utilpolicy.AdminNetworkPolicyInfo{Name: "default", Baseline: true, Subject: tenantSubject, Ingress: rules}
+	}
+	rule := func(action string, peers ...utilpolicy.AdminPeer) utilpolicy.AdminRule{
+		return utilpolicy.AdminRule{Action: action, Peers: peers}
+	}
+
+	testCases := []struct {
+		name      string
+		admin     []*utilpolicy.AdminNetworkPolicyInfo
+		baseline  *utilpolicy.AdminNetworkPolicyInfo
+		// allowed is nil if tenant-a has no NetworkPolicy
+		allowed   []string
+		packets   []adminTestPacket
+		expected  []string
+	}{
+		{
+			name:     "no policy allows all traffic",
+			packets:  []adminTestPacket{ingressFromTenantB, ingressFromMonitoring},
+			expected: []string{"ACCEPT", "ACCEPT"},
+		},
+		{
+			name:     "networkPolicy without admin network policies",
+			allowed:  []string{monitoring},
+			packets:  []adminTestPacket{ingressFromTenantB, ingressFromMonitoring},
+			expected: []string{"REJECT", "ACCEPT"},
+		},
+		{
+			name:     "deny of admin network policy overrides allow of networkPolicy",
+			admin:    []*utilpolicy.AdminNetworkPolicyInfo{adminPolicy("deny-tenant-b", 10, rule(utilpolicy.AdminPolicyActionDeny, fromTenantB))},
+			allowed:  []string{tenantBWeb, monitoring},
+			packets:  []adminTestPacket{ingressFromTenantB, ingressFromMonitoring},
+			expected: []string{"DROP", "ACCEPT"},
+		},
+		{
+			name:     "allow of admin network policy overrides deny of networkPolicy",
+			admin:    []*utilpolicy.AdminNetworkPolicyInfo{adminPolicy("allow-monitoring", 10, rule(utilpolicy.AdminPolicyActionAllow, fromMonitoring))},
+			allowed:  []string{},
+			packets:  []adminTestPacket{ingressFromTenantB, ingressFromMonitoring},
+			expected: []string{"REJECT", "ACCEPT"},
+		},
+		{
+			name: "pass delegates to networkPolicy",
+			admin: []*utilpolicy.AdminNetworkPolicyInfo{
+				adminPolicy("pass-tenant-b", 5, rule(utilpolicy.AdminPolicyActionPass, fromTenantB)),
+				adminPolicy("deny-all", 10, rule(utilpolicy.AdminPolicyActionDeny, allNamespaces)),
+			},
+			allowed:  []string{tenantBWeb},
+			packets:  []adminTestPacket{ingressFromTenantB, ingressFromMonitoring},
+			expected: []string{"ACCEPT", "DROP"},
+		},
+		{
+			name: "pass delegates to baselineAdminNetworkPolicy without networkPolicy",
+			admin: []*utilpolicy.AdminNetworkPolicyInfo{
+				adminPolicy("pass-all", 5, rule(utilpolicy.AdminPolicyActionPass, allNamespaces)),
+			},
+			baseline: baselinePolicy(rule(utilpolicy.AdminPolicyActionDeny, fromTenantB)),
+			packets:  []adminTestPacket{ingressFromTenantB, ingressFromMonitoring},
+			expected: []string{"DROP", "ACCEPT"},
+		},
+		{
+			name: "lower priority wins",
+			admin: []*utilpolicy.AdminNetworkPolicyInfo{
+				adminPolicy("deny-tenant-b", 20, rule(utilpolicy.AdminPolicyActionDeny, fromTenantB)),
+				adminPolicy("allow-tenant-b", 10, rule(utilpolicy.AdminPolicyActionAllow, fromTenantB)),
+			},
+			packets:  []adminTestPacket{ingressFromTenantB},
+			expected: []string{"ACCEPT"},
+		},
+		{
+			name: "first rule of a policy wins",
+			admin: []*utilpolicy.AdminNetworkPolicyInfo{
+				adminPolicy("tenant", 10, rule(utilpolicy.AdminPolicyActionDeny, fromTenantB),
+					rule(utilpolicy.AdminPolicyActionAllow, allNamespaces)),
+			},
+			allowed:  []string{},
+			packets:  []adminTestPacket{ingressFromTenantB, ingressFromMonitoring},
+			expected: []string{"DROP", "ACCEPT"},
+		},
+		{
+			name:     "baselineAdminNetworkPolicy applies without networkPolicy",
+			baseline: baselinePolicy(rule(utilpolicy.AdminPolicyActionDeny, allNamespaces)),
+			packets:  []adminTestPacket{ingressFromTenantB, ingressFromMonitoring},
+			expected: []string{"DROP", "DROP"},
+		},
+		{
+			name:     "networkPolicy overrides baselineAdminNetworkPolicy",
+			baseline: baselinePolicy(rule(utilpolicy.AdminPolicyActionDeny, allNamespaces)),
+			allowed:  []string{tenantBWeb},
+			packets:  []adminTestPacket{ingressFromTenantB, ingressFromMonitoring},
+			expected: []string{"ACCEPT", "REJECT"},
+		},
+		{
+			name:     "allow of admin network policy overrides baselineAdminNetworkPolicy",
+			admin:    []*utilpolicy.AdminNetworkPolicyInfo{adminPolicy("allow-monitoring", 10, rule(utilpolicy.AdminPolicyActionAllow, fromMonitoring))},
+			baseline: baselinePolicy(rule(utilpolicy.AdminPolicyActionDeny, allNamespaces)),
+			packets:  []adminTestPacket{ingressFromTenantB, ingressFromMonitoring},
+			expected: []string{"DROP", "ACCEPT"},
+		},
+		{
+			name: "allow of baselineAdminNetworkPolicy is evaluated before its deny",
+			baseline: baselinePolicy(rule(utilpolicy.AdminPolicyActionAllow, fromMonitoring),
+				rule(utilpolicy.AdminPolicyActionDeny, allNamespaces)),
+			packets:  []adminTestPacket{ingressFromTenantB, ingressFromMonitoring},
+			expected: []string{"DROP", "ACCEPT"},
+		},
+	}
+
+	for _, testCase := range testCases{
+		faker := fakeIPSet.NewFaker()
+		policy := newAdminTestPolicy(faker)
+		for _, info := range testCase.admin{
+			policy.adminNetworkPolicyMap[info.Name] = info
+		}
+		if testCase.baseline != nil{
+			policy.baselineAdminNetworkPolicyMap[testCase.baseline.Name] = testCase.baseline
+		}
+		// tenant-b is selected by its name label like kubernetes sets it
+		policy.namespaceInfoMap["tenant-b"].Labels["kubernetes.io/metadata.name"] = "tenant-b"
+
+		policy.writeAdminPolicyRules()
+		if testCase.allowed != nil{
+			writeAdminTestIngressPolicy(policy, testCase.allowed...)
+		}
+		policy.writeBaselineAdminPolicyRules()
+		policy.syncAdminPolicySets()
+
+		chains := newAdminTestChains(policy, faker, map[string][]string{"ENN-NS-TENANT-A": {tenantAWeb, tenantADB}})
+		for i, packet := range testCase.packets{
+			if verdict := chains.evaluate(t, packet); verdict != testCase.expected[i]{
+				t.Errorf("%s: expected %s for %s -> %s, get %s\nrules:\n%s", testCase.name, testCase.expected[i],
+					packet.src, packet.dst, verdict, policy.filterRules.String())
+			}
+		}
+	}
+}
+
+func TestAdminNetworkPolicyEgress(t *testing.T){
+
+	faker := fakeIPSet.NewFaker()
+	policy := newAdminTestPolicy(faker)
+	policy.adminNetworkPolicyMap["deny-dns"] = &utilpolicy.AdminNetworkPolicyInfo{
+		Name:     "deny-dns",
+		Priority: 10,
+		Subject:  utilpolicy.AdminSelector{NamespaceSelector: map[string]string{"tenant": "true"}, PodSelector: map[string]string{"app": "web"}},
+		Egress: []utilpolicy.AdminRule{
+			{
+				Action: utilpolicy.AdminPolicyActionDeny,
+				Peers:  []utilpolicy.AdminPeer{{CIDRs: []string{"8.8.8.0/24"}}},
+				Ports:  []utilpolicy.PolicyPort{{Protocol: "UDP", Port: "53"}, {Protocol: "TCP", Port: "8000:9000"}},
+			},
+			{
+				Action: utilpolicy.AdminPolicyActionDeny,
+				Peers:  []utilpolicy.AdminPeer{{Pods: &utilpolicy.AdminSelector{PodSelector: map[string]string{"app": "prometheus"}}}},
+			},
+		},
+	}
+	policy.writeAdminPolicyRules()
+	policy.writeBaselineAdminPolicyRules()
+	policy.syncAdminPolicySets()
+
+	chains := newAdminTestChains(policy, faker, nil)
+	testCases := []struct {
+		packet   adminTestPacket
+		expected string
+	}{
+		{adminTestPacket{src: tenantAWeb, dst: external, protocol: "UDP", port: "53"}, "DROP"},
+		{adminTestPacket{src: tenantAWeb, dst: external, protocol: "TCP", port: "8080"}, "DROP"},
+		{adminTestPacket{src: tenantAWeb, dst: external, protocol: "TCP", port: "443"}, "ACCEPT"},
+		{adminTestPacket{src: tenantBWeb, dst: monitoring, protocol: "TCP", port: "9090"}, "DROP"},
+		// db is not a subject
+		{adminTestPacket{src: tenantADB, dst: external, protocol: "UDP", port: "53"}, "ACCEPT"},
+		{adminTestPacket{src: monitoring, dst: external, protocol: "UDP", port: "53"}, "ACCEPT"},
+	}
+	for _, testCase := range testCases{
+		if verdict := chains.evaluate(t, testCase.packet); verdict != testCase.expected{
+			t.Errorf("expected %s for %+v, get %s\nrules:\n%s", testCase.expected, testCase.packet, verdict, policy.filterRules.String())
+		}
+	}
+}
+
+func TestAdminPolicySets(t *testing.T){
+
+	faker := fakeIPSet.NewFaker()
+	policy := newAdminTestPolicy(faker)
+	// hostNetwork pods are peers but never subjects
+	policy.namespacePodMap["tenant-a"]["192.168.1.10"] = &utilpolicy.PodInfo{IP: "192.168.1.10", Namespace: "tenant-a",
+		Labels: map[string]string{"app": "web"}, HostNetwork: true}
+	policy.adminPolicySets = make(map[string]*adminPolicySet)
+
+	subject := policy.adminPolicySetName(utilpolicy.AdminSelector{NamespaceSelector: map[string]string{"tenant": "true"},
+		PodSelector: map[string]string{"app": "web"}}, true)
+	peer := policy.adminPolicySetName(utilpolicy.AdminSelector{PodSelector: map[string]string{"app": "web"}}, false)
+	if subject == "" || peer == "" || subject == peer{
+		t.Fatalf("expected different ipsets for subject and peer, get %q and %q", subject, peer)
+	}
+	if again := policy.adminPolicySetName(utilpolicy.AdminSelector{PodSelector: map[string]string{"app": "web"}}, false); again != peer{
+		t.Errorf("expected the same ipset for the same selector, get %s and %s", peer, again)
+	}
+	if _, ok := policy.activeIPSets[subject]; !ok{
+		t.Errorf("expected ipset %s to be active", subject)
+	}
+	policy.syncAdminPolicySets()
+
+	chains := newAdminTestChains(policy, faker, nil)
+	if len(chains.sets[subject]) != 2 || !chains.sets[subject][tenantAWeb] || !chains.sets[subject][tenantBWeb]{
+		t.Errorf("expected web pods of tenants in subject set, get %v", chains.sets[subject])
+	}
+	if len(chains.sets[peer]) != 3 || !chains.sets[peer]["192.168.1.10"]{
+		t.Errorf("expected web pods and hostNetwork pod in peer set, get %v", chains.sets[peer])
+	}
+
+	// pods leaving the selector are removed
+	delete(policy.namespacePodMap["tenant-b"], tenantBWeb)
+	policy.syncAdminPolicySets()
+	chains = newAdminTestChains(policy, faker, nil)
+	if len(chains.sets[subject]) != 1 || !chains.sets[subject][tenantAWeb]{
+		t.Errorf("expected only %s in subject set, get %v", tenantAWeb, chains.sets[subject])
+	}
+}
+
+func TestAdminTierDisabled(t *testing.T){
+
+	policy := newAdminTestPolicy(fakeIPSet.NewFaker())
+	policy.writeAdminPolicyRules()
+	writeAdminTestIngressPolicy(policy)
+	policy.writeBaselineAdminPolicyRules()
+
+	expected := "-A ENN-FORWARD -m set --match-set ENN-NS-TENANT-A dst -j ENN-INGRESS-TENANT-A\n" +
+		"-A ENN-INGRESS-TENANT-A -j REJECT\n"
+	if policy.filterRules.String() != expected{
+		t.Errorf("expected no rules of admin network policies, get:\n%s", policy.filterRules.String())
+	}
+	if len(policy.activeFilterChains) != 0{
+		t.Errorf("expected no active chains, get %v", policy.activeFilterChains)
+	}
+
+	// a policy whose subject is not supported selects no pod
+	policy.adminNetworkPolicyMap["unsupported"] = &utilpolicy.AdminNetworkPolicyInfo{Name: "unsupported", MatchNone: true,
+		Ingress: []utilpolicy.AdminRule{{Action: utilpolicy.AdminPolicyActionDeny, Peers: []utilpolicy.AdminPeer{namespacesPeer(nil)}}}}
+	policy.filterRules.Reset()
+	policy.writeAdminPolicyRules()
+	if strings.Contains(policy.filterRules.String(), "DROP") || !policy.activeFilterChains[ENN_ANP_INGRESS_CHAIN]{
+		t.Errorf("expected empty admin network policy chains, get:\n%s", policy.filterRules.String())
+	}
+}
@@ -0,0 +1,45 @@
+package policy
+
+import (
+	"github.com/golang/glog"
+	utilpolicy "enn-policy/pkg/policy/util"
+)
+
+// auditLogPrefix is the prefix of kernel log of traffic accepted by audit mode
+const auditLogPrefix = `"ENN-POLICY-AUDIT: "`
+
+// policyMode returns whether policies of namespace are enforced or audited,
+// annotation enn-policy/policy-mode of namespace overrides --policy-mode
+func (policy *EnnPolicy) policyMode(namespace string) string{
+
+	if namespaceInfo, ok := policy.namespaceInfoMap[namespace]; ok && namespaceInfo.PolicyMode != ""{
+		if utilpolicy.IsValidPolicyMode(namespaceInfo.PolicyMode){
+			return namespaceInfo.PolicyMode
+		}
+		glog.V(2).Infof("namespace %s has invalid annotation %s=%q, use default %s",
+			namespace, utilpolicy.PolicyModeAnnotation, namespaceInfo.PolicyMode, policy.defaultPolicyMode)
+	}
+	if policy.defaultPolicyMode == utilpolicy.PolicyModeAudit{
+		return utilpolicy.PolicyModeAudit
+	}
+	return utilpolicy.PolicyModeEnforce
+}
+
+// auditRules returns the rules which accept traffic that would be denied in chain, e.g
+// -A chain [match] -m limit --limit 10/min -j LOG --log-prefix "ENN-POLICY-AUDIT: "
+// -A chain [match] -j ACCEPT
+// the LOG rule is only written if kernelLog is true, otherwise the traffic is logged and counted by the flow log
+func auditRules(kernelLog bool, chain string, comment string, match ...string) [][]string{
+
+	rule := func(args ...string) []string{
+		line := []string{"-A", chain, "-m", "comment", "--comment", comment}
+		line = append(line, match...)
+		return append(line, args...)
+	}
+
+	var rules [][]string
+	if kernelLog{
+		rules = append(rules, rule("-m", "limit", "--limit", denyLogLimit, "-j", "LOG", "--log-prefix", auditLogPrefix))
+	}
+	return append(rules, rule("-j", "ACCEPT"))
+}
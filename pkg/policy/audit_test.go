@@ -0,0 +1,158 @@
+package policy
+
+import (
+	utilpolicy "enn-policy/pkg/policy/util"
+	utiliptables "enn-policy/pkg/util/k8siptables"
+	utilnflog "enn-policy/pkg/util/nflog"
+	fakenflog "enn-policy/pkg/util/nflog/testing"
+	"enn-policy/pkg/util/metrics"
+
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestPolicyMode(t *testing.T){
+
+	policy := &EnnPolicy{
+		namespaceInfoMap: utilpolicy.NamespaceInfoMap{
+			"payment": &utilpolicy.NamespaceInfo{Name: "payment", PolicyMode: utilpolicy.PolicyModeAudit},
+			"invalid": &utilpolicy.NamespaceInfo{Name: "invalid", PolicyMode: "dry-run"},
+			"default": &utilpolicy.NamespaceInfo{Name: "default"},
+		},
+	}
+	for namespace, expected := range map[string]string{
+		"payment": utilpolicy.PolicyModeAudit,
+		"invalid": utilpolicy.PolicyModeEnforce,
+		"default": utilpolicy.PolicyModeEnforce,
+	}{
+		if mode := policy.policyMode(namespace); mode != expected{
+			t.Errorf("namespace %s: expected policy mode %s, get %s", namespace, expected, mode)
+		}
+	}
+
+	policy.defaultPolicyMode = utilpolicy.PolicyModeAudit
+	policy.namespaceInfoMap["default"].PolicyMode = utilpolicy.PolicyModeEnforce
+	if mode := policy.policyMode("invalid"); mode != utilpolicy.PolicyModeAudit{
+		t.Errorf("expected invalid annotation to use default audit, get %s", mode)
+	}
+	if mode := policy.policyMode("default"); mode != utilpolicy.PolicyModeEnforce{
+		t.Errorf("expected annotation enforce to override default audit, get %s", mode)
+	}
+}
+
+func TestWriteAuditRules(t *testing.T){
+
+	policy := &EnnPolicy{
+		denyAction:       utilpolicy.DenyActionDrop,
+		filterRules:      bytes.NewBuffer(nil),
+		namespaceInfoMap: utilpolicy.NamespaceInfoMap{
+			"payment": &utilpolicy.NamespaceInfo{Name: "payment", PolicyMode: utilpolicy.PolicyModeAudit},
+		},
+	}
+	policy.writeDenyRules("payment", "ENN-PLY-IN-X", flowDirectionIngress, flowLogDefaultPolicy, `"defualt reject rule"`)
+	expected := `-A ENN-PLY-IN-X -m comment --comment "defualt reject rule" -m limit --limit 10/min -j LOG --log-prefix "ENN-POLICY-AUDIT: "
+-A ENN-PLY-IN-X -m comment --comment "defualt reject rule" -j ACCEPT
+`
+	if rules := policy.filterRules.String(); rules != expected{
+		t.Errorf("expected audit rules:\n%s\nget:\n%s", expected, rules)
+	}
+
+	// with flow log, audit hits are sent to the nflog group instead of kernel log
+	policy.filterRules.Reset()
+	policy.flowLog = &flowLogger{group: 100}
+	policy.writeDenyRules("payment", "ENN-PLY-IN-X", flowDirectionIngress, flowLogDefaultPolicy, `"defualt reject rule"`)
+	expected = `-A ENN-PLY-IN-X -m comment --comment "defualt reject rule" -j NFLOG --nflog-group 100 --nflog-prefix "AUD:I:` +
+		flowLogPolicyRef("payment", flowLogDefaultPolicy) + `"
+-A ENN-PLY-IN-X -m comment --comment "defualt reject rule" -j ACCEPT
+`
+	if rules := policy.filterRules.String(); rules != expected{
+		t.Errorf("expected audit rules with flow log:\n%s\nget:\n%s", expected, rules)
+	}
+
+	// other namespaces are enforced
+	policy.filterRules.Reset()
+	policy.writeDenyRules("default", "ENN-PLY-IN-Y", flowDirectionIngress, flowLogDefaultPolicy, `"defualt reject rule"`)
+	if rules := policy.filterRules.String(); !strings.Contains(rules, `--nflog-prefix "ENN:I:` + flowLogPolicyRef("default", flowLogDefaultPolicy) + `"`) || !strings.Contains(rules, "-j DROP"){
+		t.Errorf("expected deny rules of enforced namespace, get:\n%s", rules)
+	}
+}
+
+func TestAuditHits(t *testing.T){
+
+	auditHits.Reset()
+	policyPackets.Reset()
+	policy := &EnnPolicy{
+		denyAction:            utilpolicy.DenyActionDrop,
+		filterRules:           bytes.NewBuffer(nil),
+		policyCounters:        newPolicyCounters(),
+		auditRuleOwners:       make(map[string]policyCounterOwner),
+		policyChainOwners:     map[utiliptables.Chain]policyCounterOwner{
+			"ENN-IPCIDR-WEB": {namespace: "payment", policy: "web", direction: "egress"},
+		},
+		policyChainNamespaces: map[utiliptables.Chain]string{"ENN-PLY-IN-PAYMENT": "payment"},
+		namespaceInfoMap:      utilpolicy.NamespaceInfoMap{
+			"payment": &utilpolicy.NamespaceInfo{Name: "payment", PolicyMode: utilpolicy.PolicyModeAudit},
+		},
+	}
+	// hits are counted without flow log
+	policy.writeDenyRules("payment", "ENN-PLY-IN-PAYMENT", flowDirectionIngress, flowLogDefaultPolicy, `"defualt reject rule"`)
+	policy.writeDenyRules("payment", "ENN-IPCIDR-WEB", flowDirectionEgress, "web", `"reject rule selected by policy payment/web: dst excpet cidr"`,
+		"-m", "set", "--match-set", "ENN-EXCEPT-X", "dst")
+
+	var save string
+	for i, rule := range strings.Split(strings.TrimSpace(policy.filterRules.String()), "\n"){
+		save += fmt.Sprintf("[%d:%d] %s\n", i+1, (i+1)*60, rule)
+	}
+	save += "[7:420] -A ENN-PLY-IN-PAYMENT -m conntrack --ctstate RELATED,ESTABLISHED -j ACCEPT\n"
+	save += "[2:120] -A ENN-IPCIDR-WEB -m comment --comment \"accept default traffic of cidr 10.0.0.0/8\" -j ACCEPT\n"
+	policy.collectPolicyCounters([]byte(save))
+
+	registry := &metrics.Registry{}
+	registry.MustRegister(auditHits, policyPackets)
+	output := string(registry.Gather())
+	for _, expected := range []string{
+		`enn_policy_audit_hits_total{namespace="payment",policy="",direction="ingress"} 2`,
+		`enn_policy_audit_hits_total{namespace="payment",policy="web",direction="egress"} 4`,
+		`enn_policy_packets_total{namespace="payment",policy="web",direction="egress",action="allowed"} 2`,
+	}{
+		if !strings.Contains(output, expected){
+			t.Errorf("expected %s in metrics:\n%s\nrules:\n%s", expected, output, save)
+		}
+	}
+	if strings.Contains(output, `action="denied"`) || strings.Contains(output, `direction="ingress",action="allowed"`){
+		t.Errorf("expected audit hits not to be counted as allowed or denied traffic:\n%s", output)
+	}
+}
+
+func TestAuditFlowLog(t *testing.T){
+
+	auditHits.Reset()
+	faker := fakenflog.NewFaker(
+		fakenflog.PacketFrom("AUD:I:" + flowLogPolicyRef("payment", flowLogDefaultPolicy), utilnflog.ProtocolTCP, "10.244.1.11", 40000, "10.244.1.10", 80),
+		fakenflog.PacketFrom("ENN:I:" + flowLogPolicyRef("default", flowLogDefaultPolicy), utilnflog.ProtocolTCP, "10.244.1.11", 40003, "10.244.2.10", 80),
+	)
+	logger, _ := newFlowLogger(100, "", 0, 0, faker)
+	buf := &bytes.Buffer{}
+	logger.writer = buf
+	policy := &EnnPolicy{flowLog: logger}
+
+	stopCh := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go policy.RunFlowLog(stopCh, &wg)
+	close(stopCh)
+	wg.Wait()
+
+	if !strings.Contains(buf.String(), `"action":"audit"`){
+		t.Errorf("expected audit record, get %s", buf.String())
+	}
+	// audit hits are counted by counters of rules, not by the flow log
+	registry := &metrics.Registry{}
+	registry.MustRegister(auditHits)
+	if output := string(registry.Gather()); strings.Contains(output, "enn_policy_audit_hits_total{"){
+		t.Errorf("expected flow log not to count audit hits:\n%s", output)
+	}
+}
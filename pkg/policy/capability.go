@@ -0,0 +1,96 @@
+package policy
+
+import (
+	"github.com/golang/glog"
+	utilpolicy "enn-policy/pkg/policy/util"
+
+	"fmt"
+	"strings"
+)
+
+// unsupportedPolicyMode returns how a networkPolicy which is not fully supported is enforced,
+// annotation enn-policy/unsupported-policy-mode of the networkPolicy overrides --unsupported-policy-mode
+func (policy *EnnPolicy) unsupportedPolicyMode(networkPolicy *utilpolicy.NetworkPolicyInfo) string{
+	if networkPolicy.UnsupportedPolicyMode != ""{
+		return networkPolicy.UnsupportedPolicyMode
+	}
+	if policy.unsupportedPolicy == ""{
+		return utilpolicy.UnsupportedPolicyModeBestEffort
+	}
+	return policy.unsupportedPolicy
+}
+
+// enforcedNetworkPolicy returns the networkPolicy which is rendered into iptables, nil means it is not rendered
+// - a fully supported networkPolicy is rendered as it is
+// - best-effort renders the supported rules, unsupported peers, ports and rules are already removed by buildNetworkPolicyInfo,
+//   a networkPolicy with unsupported spec.podSelector is not rendered since its targets are unknown
+// - fail-closed renders no rule for the policy types, so all traffic of the targets is rejected unless another policy allows it,
+//   all pods of the namespace are targets if spec.podSelector is unsupported
+func (policy *EnnPolicy) enforcedNetworkPolicy(networkPolicy *utilpolicy.NetworkPolicyInfo) *utilpolicy.NetworkPolicyInfo{
+
+	if networkPolicy.Support == utilpolicy.SupportFull || networkPolicy.Support == ""{
+		return networkPolicy
+	}
+
+	if policy.unsupportedPolicyMode(networkPolicy) == utilpolicy.UnsupportedPolicyModeFailClosed{
+		glog.V(4).Infof("networkPolicy %s/%s is %s supported, fail closed", networkPolicy.Namespace, networkPolicy.Name, networkPolicy.Support)
+		closedPolicy := *networkPolicy
+		closedPolicy.Ingress = nil
+		closedPolicy.Egress = nil
+		closedPolicy.EgressFQDNs = nil
+		closedPolicy.EgressServices = nil
+		if networkPolicy.Support == utilpolicy.SupportNone{
+			closedPolicy.PodSelector = nil
+		}
+		return &closedPolicy
+	}
+
+	if networkPolicy.Support == utilpolicy.SupportNone{
+		glog.V(4).Infof("networkPolicy %s/%s is not supported, skip it", networkPolicy.Namespace, networkPolicy.Name)
+		return nil
+	}
+	return networkPolicy
+}
+
+// unsupportedMessage describes what enn-policy enforces for networkPolicy, empty if networkPolicy is fully supported
+func (policy *EnnPolicy) unsupportedMessage(networkPolicy *utilpolicy.NetworkPolicyInfo) string{
+
+	if len(networkPolicy.Unsupported) == 0{
+		return ""
+	}
+	mode := policy.unsupportedPolicyMode(networkPolicy)
+	var action string
+	switch {
+	case mode == utilpolicy.UnsupportedPolicyModeFailClosed && networkPolicy.Support == utilpolicy.SupportNone:
+		action = "all traffic of all pods in the namespace is denied"
+	case mode == utilpolicy.UnsupportedPolicyModeFailClosed:
+		action = "all traffic of selected pods is denied"
+	case networkPolicy.Support == utilpolicy.SupportNone:
+		action = "policy is ignored"
+	default:
+		action = "only supported rules are enforced"
+	}
+	support := "partially supported"
+	if networkPolicy.Support == utilpolicy.SupportNone{
+		support = "not supported"
+	}
+	return fmt.Sprintf("policy is %s (%s), %s: %s",
+		support, mode, action, strings.Join(networkPolicy.Unsupported, "; "))
+}
+
+// updateSupportMetrics sets the number of networkPolicies by support level and mode
+func (policy *EnnPolicy) updateSupportMetrics(){
+
+	counts := make(map[[2]string]int)
+	for _, networkPolicy := range policy.networkPolicyMap{
+		support := networkPolicy.Support
+		if support == ""{
+			support = utilpolicy.SupportFull
+		}
+		counts[[2]string{support, policy.unsupportedPolicyMode(networkPolicy)}]++
+	}
+	networkPolicySupport.Reset()
+	for key, count := range counts{
+		networkPolicySupport.Set(float64(count), key[0], key[1])
+	}
+}
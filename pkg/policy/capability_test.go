@@ -0,0 +1,134 @@
+package policy
+
+import (
+	"k8s.io/apimachinery/pkg/types"
+	utilpolicy "enn-policy/pkg/policy/util"
+	"enn-policy/pkg/util/metrics"
+	fakeIPSet "enn-policy/pkg/util/ipset/testing"
+
+	"strings"
+	"testing"
+)
+
+func TestEnforcedNetworkPolicy(t *testing.T){
+
+	policy := &EnnPolicy{unsupportedPolicy: utilpolicy.UnsupportedPolicyModeBestEffort}
+	rules := []utilpolicy.IngressRule{{IPBlock: []utilpolicy.CIDRRange{{CIDR: "10.0.0.0/8"}}}}
+	makePolicy := func(support, mode string) *utilpolicy.NetworkPolicyInfo{
+		return &utilpolicy.NetworkPolicyInfo{
+			Name:                  "np1",
+			Namespace:             "ns1",
+			PodSelector:           map[string]string{"run": "nginx"},
+			Ingress:               rules,
+			PolicyType:            []string{utilpolicy.TypeIngress},
+			Support:               support,
+			UnsupportedPolicyMode: mode,
+		}
+	}
+
+	full := makePolicy(utilpolicy.SupportFull, "")
+	if policy.enforcedNetworkPolicy(full) != full{
+		t.Errorf("expected fully supported policy to be rendered as it is")
+	}
+	partial := makePolicy(utilpolicy.SupportPartial, "")
+	if policy.enforcedNetworkPolicy(partial) != partial{
+		t.Errorf("expected best-effort to render supported rules of partially supported policy")
+	}
+	if policy.enforcedNetworkPolicy(makePolicy(utilpolicy.SupportNone, "")) != nil{
+		t.Errorf("expected best-effort to skip unsupported policy")
+	}
+
+	// annotation overrides the flag
+	partial = makePolicy(utilpolicy.SupportPartial, utilpolicy.UnsupportedPolicyModeFailClosed)
+	partial.EgressFQDNs = []utilpolicy.FQDNRule{{Name: "api.partner.com"}}
+	partial.EgressServices = []utilpolicy.ServiceRef{{Name: "payments"}}
+	closed := policy.enforcedNetworkPolicy(partial)
+	if closed == nil || len(closed.Ingress) != 0 || len(closed.EgressFQDNs) != 0 || len(closed.EgressServices) != 0 || len(closed.PodSelector) != 1 || len(closed.PolicyType) != 1{
+		t.Errorf("expected fail-closed to keep targets and drop all rules, get %+v", closed)
+	}
+
+	policy.unsupportedPolicy = utilpolicy.UnsupportedPolicyModeFailClosed
+	unsupported := makePolicy(utilpolicy.SupportNone, "")
+	closed = policy.enforcedNetworkPolicy(unsupported)
+	if closed == nil || len(closed.Ingress) != 0 || len(closed.PodSelector) != 0{
+		t.Errorf("expected fail-closed to select all pods of the namespace and drop all rules, get %+v", closed)
+	}
+	if len(unsupported.Ingress) != 1 || len(unsupported.PodSelector) != 1{
+		t.Errorf("expected networkPolicy in map not to be changed, get %+v", unsupported)
+	}
+}
+
+func TestUnsupportedMessageAndMetrics(t *testing.T){
+
+	policy := &EnnPolicy{
+		unsupportedPolicy: utilpolicy.UnsupportedPolicyModeBestEffort,
+		networkPolicyMap:  make(utilpolicy.NetworkPolicyMap),
+	}
+	full := &utilpolicy.NetworkPolicyInfo{Name: "np1", Namespace: "ns1", Support: utilpolicy.SupportFull}
+	partial := &utilpolicy.NetworkPolicyInfo{Name: "np2", Namespace: "ns1", Support: utilpolicy.SupportPartial,
+		Unsupported: []string{`spec.ingress[0].ports[0]: named port "http"`}}
+	none := &utilpolicy.NetworkPolicyInfo{Name: "np3", Namespace: "ns1", Support: utilpolicy.SupportNone,
+		Unsupported: []string{"spec.podSelector: matchExpressions"}, UnsupportedPolicyMode: utilpolicy.UnsupportedPolicyModeFailClosed}
+
+	if message := policy.unsupportedMessage(full); message != ""{
+		t.Errorf("expected no message for fully supported policy, get %q", message)
+	}
+	expected := `policy is partially supported (best-effort), only supported rules are enforced: spec.ingress[0].ports[0]: named port "http"`
+	if message := policy.unsupportedMessage(partial); message != expected{
+		t.Errorf("expected message %q, get %q", expected, message)
+	}
+	expected = "policy is not supported (fail-closed), all traffic of all pods in the namespace is denied: spec.podSelector: matchExpressions"
+	if message := policy.unsupportedMessage(none); message != expected{
+		t.Errorf("expected message %q, get %q", expected, message)
+	}
+
+	for _, networkPolicy := range []*utilpolicy.NetworkPolicyInfo{full, partial, none}{
+		policy.networkPolicyMap[types.NamespacedName{Namespace: networkPolicy.Namespace, Name: networkPolicy.Name}] = networkPolicy
+	}
+	registry := &metrics.Registry{}
+	registry.MustRegister(networkPolicySupport)
+	policy.updateSupportMetrics()
+	output := string(registry.Gather())
+	for _, line := range []string{
+		`enn_policy_network_policies{support="full",mode="best-effort"} 1`,
+		`enn_policy_network_policies{support="partial",mode="best-effort"} 1`,
+		`enn_policy_network_policies{support="unsupported",mode="fail-closed"} 1`,
+	}{
+		if !strings.Contains(output, line + "\n"){
+			t.Errorf("expected metric %s in:\n%s", line, output)
+		}
+	}
+}
+
+func TestEmptyRuleAllowsAllTraffic(t *testing.T){
+
+	faker := fakeIPSet.NewFaker()
+	policy := newServiceTestPolicy(faker)
+	// egress: [{}]
+	networkPolicy := &utilpolicy.NetworkPolicyInfo{
+		Name:        "allow-all",
+		Namespace:   "tenant-a",
+		PodSelector: map[string]string{"app": "web"},
+		PolicyType:  []string{utilpolicy.TypeEgress},
+		Egress:      []utilpolicy.EgressRule{{}},
+		Support:     utilpolicy.SupportFull,
+	}
+	writeServiceTestRules(policy, networkPolicy)
+
+	podSetName := ennXLabelIPSetName("tenant-a", "pod", []string{"app", "web"})
+	chains := newAdminTestChains(policy, faker, map[string][]string{podSetName: {tenantAWeb}})
+	testCases := []struct {
+		packet   adminTestPacket
+		expected string
+	}{
+		{adminTestPacket{src: tenantAWeb, dst: external, protocol: "TCP", port: "443"}, "ACCEPT"},
+		{adminTestPacket{src: tenantAWeb, dst: tenantBWeb, protocol: "UDP", port: "53"}, "ACCEPT"},
+		// db is not selected by spec.podSelector
+		{adminTestPacket{src: tenantADB, dst: external, protocol: "TCP", port: "443"}, "REJECT"},
+	}
+	for _, testCase := range testCases{
+		if verdict := chains.evaluate(t, testCase.packet); verdict != testCase.expected{
+			t.Errorf("expected %s for %+v, get %s\nrules:\n%s", testCase.expected, testCase.packet, verdict, policy.filterRules.String())
+		}
+	}
+}
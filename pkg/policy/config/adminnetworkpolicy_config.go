@@ -0,0 +1,273 @@
+package config
+
+import (
+	api "enn-policy/pkg/apis/policy/v1alpha1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/rest"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	"k8s.io/apimachinery/pkg/fields"
+
+	"time"
+	"github.com/golang/glog"
+	"fmt"
+)
+
+// AdminNetworkPolicyHandler is an abstract interface of objects which receive
+// notifications about AdminNetworkPolicy object changes.
+type AdminNetworkPolicyHandler interface {
+	// OnAdminNetworkPolicyAdd is called whenever creation of new AdminNetworkPolicy object
+	// is observed.
+	OnAdminNetworkPolicyAdd(adminNetworkPolicy *api.AdminNetworkPolicy)
+	// OnAdminNetworkPolicyUpdate is called whenever modification of an existing
+	// AdminNetworkPolicy object is observed.
+	OnAdminNetworkPolicyUpdate(oldAdminNetworkPolicy, adminNetworkPolicy *api.AdminNetworkPolicy)
+	// OnAdminNetworkPolicyDelete is called whenever deletion of an existing AdminNetworkPolicy
+	// object is observed.
+	OnAdminNetworkPolicyDelete(adminNetworkPolicy *api.AdminNetworkPolicy)
+	// OnAdminNetworkPolicySynced is called once all the initial even handlers were
+	// called and the state is fully propagated to local cache.
+	OnAdminNetworkPolicySynced()
+}
+
+// BaselineAdminNetworkPolicyHandler is an abstract interface of objects which receive
+// notifications about BaselineAdminNetworkPolicy object changes.
+type BaselineAdminNetworkPolicyHandler interface {
+	// OnBaselineAdminNetworkPolicyAdd is called whenever creation of new BaselineAdminNetworkPolicy object
+	// is observed.
+	OnBaselineAdminNetworkPolicyAdd(baselineAdminNetworkPolicy *api.BaselineAdminNetworkPolicy)
+	// OnBaselineAdminNetworkPolicyUpdate is called whenever modification of an existing
+	// BaselineAdminNetworkPolicy object is observed.
+	OnBaselineAdminNetworkPolicyUpdate(oldBaselineAdminNetworkPolicy, baselineAdminNetworkPolicy *api.BaselineAdminNetworkPolicy)
+	// OnBaselineAdminNetworkPolicyDelete is called whenever deletion of an existing BaselineAdminNetworkPolicy
+	// object is observed.
+	OnBaselineAdminNetworkPolicyDelete(baselineAdminNetworkPolicy *api.BaselineAdminNetworkPolicy)
+	// OnBaselineAdminNetworkPolicySynced is called once all the initial even handlers were
+	// called and the state is fully propagated to local cache.
+	OnBaselineAdminNetworkPolicySynced()
+}
+
+// NewAdminNetworkPolicyClient returns a rest client of the policy.networking.k8s.io/v1alpha1 api group
+func NewAdminNetworkPolicyClient(config *rest.Config) (rest.Interface, error) {
+	scheme := runtime.NewScheme()
+	if err := api.AddToScheme(scheme); err != nil {
+		return nil, err
+	}
+	clientConfig := *config
+	clientConfig.GroupVersion = &api.SchemeGroupVersion
+	clientConfig.APIPath = "/apis"
+	clientConfig.ContentType = runtime.ContentTypeJSON
+	clientConfig.NegotiatedSerializer = serializer.DirectCodecFactory{CodecFactory: serializer.NewCodecFactory(scheme)}
+	return rest.RESTClientFor(&clientConfig)
+}
+
+// NewAdminNetworkPolicyInformer returns an informer of the cluster-scoped AdminNetworkPolicy,
+// there is no generated informer factory for custom resources, so it is started by its own Run
+func NewAdminNetworkPolicyInformer(client cache.Getter, resyncPeriod time.Duration) cache.SharedIndexInformer {
+	listWatch := cache.NewListWatchFromClient(client, "adminnetworkpolicies", "", fields.Everything())
+	return cache.NewSharedIndexInformer(listWatch, &api.AdminNetworkPolicy{}, resyncPeriod, cache.Indexers{})
+}
+
+// AdminNetworkPolicyConfig tracks a set of AdminNetworkPolicy configurations.
+// It accepts "set", "add" and "remove" operations of AdminNetworkPolicy via channels, and invokes registered handlers on change.
+type AdminNetworkPolicyConfig struct {
+	listerSynced  cache.InformerSynced
+	eventHandlers []AdminNetworkPolicyHandler
+}
+
+// NewAdminNetworkPolicyConfig creates a new AdminNetworkPolicyConfig.
+func NewAdminNetworkPolicyConfig(adminNetworkPolicyInformer cache.SharedIndexInformer, resyncPeriod time.Duration) *AdminNetworkPolicyConfig {
+	result := &AdminNetworkPolicyConfig{
+		listerSynced: adminNetworkPolicyInformer.HasSynced,
+	}
+
+	adminNetworkPolicyInformer.AddEventHandlerWithResyncPeriod(
+		cache.ResourceEventHandlerFuncs{
+			AddFunc:    result.handleAddAdminNetworkPolicy,
+			UpdateFunc: result.handleUpdateAdminNetworkPolicy,
+			DeleteFunc: result.handleDeleteAdminNetworkPolicy,
+		},
+		resyncPeriod,
+	)
+
+	return result
+}
+
+// RegisterEventHandler registers a handler which is called on every AdminNetworkPolicy change.
+func (c *AdminNetworkPolicyConfig) RegisterEventHandler(handler AdminNetworkPolicyHandler) {
+	c.eventHandlers = append(c.eventHandlers, handler)
+}
+
+// Run starts the goroutine responsible for calling
+// registered handlers.
+func (c *AdminNetworkPolicyConfig) Run(stopCh <-chan struct{}) {
+	defer utilruntime.HandleCrash()
+
+	glog.V(2).Info("Starting AdminNetworkPolicy config controller")
+	defer glog.V(2).Info("Shutting down AdminNetworkPolicy config controller")
+
+	if !waitForCacheSync("AdminNetworkPolicy config", stopCh, c.listerSynced) {
+		return
+	}
+
+	for i := range c.eventHandlers {
+		glog.V(3).Infof("Calling handler.OnAdminNetworkPolicySynced()")
+		c.eventHandlers[i].OnAdminNetworkPolicySynced()
+	}
+
+	<-stopCh
+}
+
+func (c *AdminNetworkPolicyConfig) handleAddAdminNetworkPolicy(obj interface{}) {
+	adminNetworkPolicy, ok := obj.(*api.AdminNetworkPolicy)
+	if !ok {
+		utilruntime.HandleError(fmt.Errorf("unexpected object type: %v", obj))
+		return
+	}
+	for i := range c.eventHandlers {
+		glog.V(4).Infof("Calling handler.OnAdminNetworkPolicyAdd")
+		c.eventHandlers[i].OnAdminNetworkPolicyAdd(adminNetworkPolicy)
+	}
+}
+
+func (c *AdminNetworkPolicyConfig) handleUpdateAdminNetworkPolicy(oldObj, newObj interface{}) {
+	oldAdminNetworkPolicy, ok := oldObj.(*api.AdminNetworkPolicy)
+	if !ok {
+		utilruntime.HandleError(fmt.Errorf("unexpected object type: %v", oldObj))
+		return
+	}
+	adminNetworkPolicy, ok := newObj.(*api.AdminNetworkPolicy)
+	if !ok {
+		utilruntime.HandleError(fmt.Errorf("unexpected object type: %v", newObj))
+		return
+	}
+	for i := range c.eventHandlers {
+		glog.V(4).Infof("Calling handler.OnAdminNetworkPolicyUpdate")
+		c.eventHandlers[i].OnAdminNetworkPolicyUpdate(oldAdminNetworkPolicy, adminNetworkPolicy)
+	}
+}
+
+func (c *AdminNetworkPolicyConfig) handleDeleteAdminNetworkPolicy(obj interface{}) {
+	adminNetworkPolicy, ok := obj.(*api.AdminNetworkPolicy)
+	if !ok {
+		tombstone, ok := obj.(cache.DeletedFinalStateUnknown)
+		if !ok {
+			utilruntime.HandleError(fmt.Errorf("unexpected object type: %v", obj))
+			return
+		}
+		if adminNetworkPolicy, ok = tombstone.Obj.(*api.AdminNetworkPolicy); !ok {
+			utilruntime.HandleError(fmt.Errorf("unexpected object type: %v", obj))
+			return
+		}
+	}
+	for i := range c.eventHandlers {
+		glog.V(4).Infof("Calling handler.OnAdminNetworkPolicyDelete")
+		c.eventHandlers[i].OnAdminNetworkPolicyDelete(adminNetworkPolicy)
+	}
+}
+
+// NewBaselineAdminNetworkPolicyInformer returns an informer of the cluster-scoped BaselineAdminNetworkPolicy,
+// there is no generated informer factory for custom resources, so it is started by its own Run
+func NewBaselineAdminNetworkPolicyInformer(client cache.Getter, resyncPeriod time.Duration) cache.SharedIndexInformer {
+	listWatch := cache.NewListWatchFromClient(client, "baselineadminnetworkpolicies", "", fields.Everything())
+	return cache.NewSharedIndexInformer(listWatch, &api.BaselineAdminNetworkPolicy{}, resyncPeriod, cache.Indexers{})
+}
+
+// BaselineAdminNetworkPolicyConfig tracks a set of BaselineAdminNetworkPolicy configurations.
+// It accepts "set", "add" and "remove" operations of BaselineAdminNetworkPolicy via channels, and invokes registered handlers on change.
+type BaselineAdminNetworkPolicyConfig struct {
+	listerSynced  cache.InformerSynced
+	eventHandlers []BaselineAdminNetworkPolicyHandler
+}
+
+// NewBaselineAdminNetworkPolicyConfig creates a new BaselineAdminNetworkPolicyConfig.
+func NewBaselineAdminNetworkPolicyConfig(baselineAdminNetworkPolicyInformer cache.SharedIndexInformer, resyncPeriod time.Duration) *BaselineAdminNetworkPolicyConfig {
+	result := &BaselineAdminNetworkPolicyConfig{
+		listerSynced: baselineAdminNetworkPolicyInformer.HasSynced,
+	}
+
+	baselineAdminNetworkPolicyInformer.AddEventHandlerWithResyncPeriod(
+		cache.ResourceEventHandlerFuncs{
+			AddFunc:    result.handleAddBaselineAdminNetworkPolicy,
+			UpdateFunc: result.handleUpdateBaselineAdminNetworkPolicy,
+			DeleteFunc: result.handleDeleteBaselineAdminNetworkPolicy,
+		},
+		resyncPeriod,
+	)
+
+	return result
+}
+
+// RegisterEventHandler registers a handler which is called on every BaselineAdminNetworkPolicy change.
+func (c *BaselineAdminNetworkPolicyConfig) RegisterEventHandler(handler BaselineAdminNetworkPolicyHandler) {
+	c.eventHandlers = append(c.eventHandlers, handler)
+}
+
+// Run starts the goroutine responsible for calling
+// registered handlers.
+func (c *BaselineAdminNetworkPolicyConfig) Run(stopCh <-chan struct{}) {
+	defer utilruntime.HandleCrash()
+
+	glog.V(2).Info("Starting BaselineAdminNetworkPolicy config controller")
+	defer glog.V(2).Info("Shutting down BaselineAdminNetworkPolicy config controller")
+
+	if !waitForCacheSync("BaselineAdminNetworkPolicy config", stopCh, c.listerSynced) {
+		return
+	}
+
+	for i := range c.eventHandlers {
+		glog.V(3).Infof("Calling handler.OnBaselineAdminNetworkPolicySynced()")
+		c.eventHandlers[i].OnBaselineAdminNetworkPolicySynced()
+	}
+
+	<-stopCh
+}
+
+func (c *BaselineAdminNetworkPolicyConfig) handleAddBaselineAdminNetworkPolicy(obj interface{}) {
+	baselineAdminNetworkPolicy, ok := obj.(*api.BaselineAdminNetworkPolicy)
+	if !ok {
+		utilruntime.HandleError(fmt.Errorf("unexpected object type: %v", obj))
+		return
+	}
+	for i := range c.eventHandlers {
+		glog.V(4).Infof("Calling handler.OnBaselineAdminNetworkPolicyAdd")
+		c.eventHandlers[i].OnBaselineAdminNetworkPolicyAdd(baselineAdminNetworkPolicy)
+	}
+}
+
+func (c *BaselineAdminNetworkPolicyConfig) handleUpdateBaselineAdminNetworkPolicy(oldObj, newObj interface{}) {
+	oldBaselineAdminNetworkPolicy, ok := oldObj.(*api.BaselineAdminNetworkPolicy)
+	if !ok {
+		utilruntime.HandleError(fmt.Errorf("unexpected object type: %v", oldObj))
+		return
+	}
+	baselineAdminNetworkPolicy, ok := newObj.(*api.BaselineAdminNetworkPolicy)
+	if !ok {
+		utilruntime.HandleError(fmt.Errorf("unexpected object type: %v", newObj))
+		return
+	}
+	for i := range c.eventHandlers {
+		glog.V(4).Infof("Calling handler.OnBaselineAdminNetworkPolicyUpdate")
+		c.eventHandlers[i].OnBaselineAdminNetworkPolicyUpdate(oldBaselineAdminNetworkPolicy, baselineAdminNetworkPolicy)
+	}
+}
+
+func (c *BaselineAdminNetworkPolicyConfig) handleDeleteBaselineAdminNetworkPolicy(obj interface{}) {
+	baselineAdminNetworkPolicy, ok := obj.(*api.BaselineAdminNetworkPolicy)
+	if !ok {
+		tombstone, ok := obj.(cache.DeletedFinalStateUnknown)
+		if !ok {
+			utilruntime.HandleError(fmt.Errorf("unexpected object type: %v", obj))
+			return
+		}
+		if baselineAdminNetworkPolicy, ok = tombstone.Obj.(*api.BaselineAdminNetworkPolicy); !ok {
+			utilruntime.HandleError(fmt.Errorf("unexpected object type: %v", obj))
+			return
+		}
+	}
+	for i := range c.eventHandlers {
+		glog.V(4).Infof("Calling handler.OnBaselineAdminNetworkPolicyDelete")
+		c.eventHandlers[i].OnBaselineAdminNetworkPolicyDelete(baselineAdminNetworkPolicy)
+	}
+}
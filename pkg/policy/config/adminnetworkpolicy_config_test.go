@@ -0,0 +1,255 @@
+package config
+
+import (
+	api "enn-policy/pkg/apis/policy/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/cache"
+
+	"testing"
+	"time"
+	"sync"
+	"sort"
+	"reflect"
+)
+
+type AdminNetworkPolicyHandlerMock struct {
+	lock      sync.Mutex
+
+	state     map[string]*api.AdminNetworkPolicy
+	synced    bool
+	updated   chan []*api.AdminNetworkPolicy
+}
+
+func NewAdminNetworkPolicyHandlerMock() *AdminNetworkPolicyHandlerMock {
+	return &AdminNetworkPolicyHandlerMock{
+		state:   make(map[string]*api.AdminNetworkPolicy),
+		updated: make(chan []*api.AdminNetworkPolicy, 5),
+	}
+}
+
+func (h *AdminNetworkPolicyHandlerMock) OnAdminNetworkPolicyAdd(adminNetworkPolicy *api.AdminNetworkPolicy) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.state[adminNetworkPolicy.Name] = adminNetworkPolicy
+	h.sendAdminNetworkPolicies()
+}
+
+func (h *AdminNetworkPolicyHandlerMock) OnAdminNetworkPolicyUpdate(oldAdminNetworkPolicy, adminNetworkPolicy *api.AdminNetworkPolicy) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.state[adminNetworkPolicy.Name] = adminNetworkPolicy
+	h.sendAdminNetworkPolicies()
+}
+
+func (h *AdminNetworkPolicyHandlerMock) OnAdminNetworkPolicyDelete(adminNetworkPolicy *api.AdminNetworkPolicy) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	delete(h.state, adminNetworkPolicy.Name)
+	h.sendAdminNetworkPolicies()
+}
+
+func (h *AdminNetworkPolicyHandlerMock) OnAdminNetworkPolicySynced() {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.synced = true
+	h.sendAdminNetworkPolicies()
+}
+
+func (h *AdminNetworkPolicyHandlerMock) sendAdminNetworkPolicies() {
+	if !h.synced {
+		return
+	}
+	adminNetworkPolicies := make([]*api.AdminNetworkPolicy, 0, len(h.state))
+	for _, policy := range h.state {
+		adminNetworkPolicies = append(adminNetworkPolicies, policy)
+	}
+	sort.Slice(adminNetworkPolicies, func(i, j int) bool { return adminNetworkPolicies[i].Name < adminNetworkPolicies[j].Name })
+	h.updated <- adminNetworkPolicies
+}
+
+func (h *AdminNetworkPolicyHandlerMock) ValidateAdminNetworkPolicies(t *testing.T, expectedAdminNetworkPolicies []*api.AdminNetworkPolicy) {
+
+	var adminNetworkPolicies []*api.AdminNetworkPolicy
+	for {
+		select {
+		case adminNetworkPolicies = <-h.updated:
+			if reflect.DeepEqual(adminNetworkPolicies, expectedAdminNetworkPolicies){
+				return
+			}
+		case <-time.After(wait.ForeverTestTimeout):
+			t.Errorf("Timed out. Expected %#v, Got %#v", expectedAdminNetworkPolicies, adminNetworkPolicies)
+			return
+		}
+	}
+}
+
+type BaselineAdminNetworkPolicyHandlerMock struct {
+	lock      sync.Mutex
+
+	state     map[string]*api.BaselineAdminNetworkPolicy
+	synced    bool
+	updated   chan []*api.BaselineAdminNetworkPolicy
+}
+
+func NewBaselineAdminNetworkPolicyHandlerMock() *BaselineAdminNetworkPolicyHandlerMock {
+	return &BaselineAdminNetworkPolicyHandlerMock{
+		state:   make(map[string]*api.BaselineAdminNetworkPolicy),
+		updated: make(chan []*api.BaselineAdminNetworkPolicy, 5),
+	}
+}
+
+func (h *BaselineAdminNetworkPolicyHandlerMock) OnBaselineAdminNetworkPolicyAdd(baselineAdminNetworkPolicy *api.BaselineAdminNetworkPolicy) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.state[baselineAdminNetworkPolicy.Name] = baselineAdminNetworkPolicy
+	h.sendBaselineAdminNetworkPolicies()
+}
+
+func (h *BaselineAdminNetworkPolicyHandlerMock) OnBaselineAdminNetworkPolicyUpdate(oldBaselineAdminNetworkPolicy, baselineAdminNetworkPolicy *api.BaselineAdminNetworkPolicy) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.state[baselineAdminNetworkPolicy.Name] = baselineAdminNetworkPolicy
+	h.sendBaselineAdminNetworkPolicies()
+}
+
+func (h *BaselineAdminNetworkPolicyHandlerMock) OnBaselineAdminNetworkPolicyDelete(baselineAdminNetworkPolicy *api.BaselineAdminNetworkPolicy) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	delete(h.state, baselineAdminNetworkPolicy.Name)
+	h.sendBaselineAdminNetworkPolicies()
+}
+
+func (h *BaselineAdminNetworkPolicyHandlerMock) OnBaselineAdminNetworkPolicySynced() {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.synced = true
+	h.sendBaselineAdminNetworkPolicies()
+}
+
+func (h *BaselineAdminNetworkPolicyHandlerMock) sendBaselineAdminNetworkPolicies() {
+	if !h.synced {
+		return
+	}
+	baselineAdminNetworkPolicies := make([]*api.BaselineAdminNetworkPolicy, 0, len(h.state))
+	for _, policy := range h.state {
+		baselineAdminNetworkPolicies = append(baselineAdminNetworkPolicies, policy)
+	}
+	sort.Slice(baselineAdminNetworkPolicies, func(i, j int) bool { return baselineAdminNetworkPolicies[i].Name < baselineAdminNetworkPolicies[j].Name })
+	h.updated <- baselineAdminNetworkPolicies
+}
+
+func (h *BaselineAdminNetworkPolicyHandlerMock) ValidateBaselineAdminNetworkPolicies(t *testing.T, expectedBaselineAdminNetworkPolicies []*api.BaselineAdminNetworkPolicy) {
+
+	var baselineAdminNetworkPolicies []*api.BaselineAdminNetworkPolicy
+	for {
+		select {
+		case baselineAdminNetworkPolicies = <-h.updated:
+			if reflect.DeepEqual(baselineAdminNetworkPolicies, expectedBaselineAdminNetworkPolicies){
+				return
+			}
+		case <-time.After(wait.ForeverTestTimeout):
+			t.Errorf("Timed out. Expected %#v, Got %#v", expectedBaselineAdminNetworkPolicies, baselineAdminNetworkPolicies)
+			return
+		}
+	}
+}
+
+func TestAdminNetworkPolicyAddRemoveAndNotified(t *testing.T){
+
+	fakeWatch := watch.NewFake()
+	listWatch := &cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			return &api.AdminNetworkPolicyList{}, nil
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			return fakeWatch, nil
+		},
+	}
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+
+	informer := cache.NewSharedIndexInformer(listWatch, &api.AdminNetworkPolicy{}, time.Minute, cache.Indexers{})
+	config := NewAdminNetworkPolicyConfig(informer, time.Minute)
+	handler := NewAdminNetworkPolicyHandlerMock()
+	config.RegisterEventHandler(handler)
+
+	go informer.Run(stopCh)
+	go config.Run(stopCh)
+
+	adminNetworkPolicy1 := &api.AdminNetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "deny-monitoring"},
+		Spec: api.AdminNetworkPolicySpec{
+			Priority: 10,
+			Subject:  api.AdminNetworkPolicySubject{Namespaces: &metav1.LabelSelector{}},
+			Ingress: []api.AdminNetworkPolicyIngressRule{
+				{
+					Action: api.AdminNetworkPolicyRuleActionDeny,
+					From:   []api.AdminNetworkPolicyIngressPeer{{Namespaces: &metav1.LabelSelector{MatchLabels: map[string]string{"name": "monitoring"}}}},
+				},
+			},
+		},
+	}
+	adminNetworkPolicy2 := &api.AdminNetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "pass-tenants"},
+		Spec: api.AdminNetworkPolicySpec{
+			Priority: 20,
+			Subject:  api.AdminNetworkPolicySubject{Namespaces: &metav1.LabelSelector{MatchLabels: map[string]string{"tenant": "true"}}},
+		},
+	}
+
+	fakeWatch.Add(adminNetworkPolicy1)
+	handler.ValidateAdminNetworkPolicies(t, []*api.AdminNetworkPolicy{adminNetworkPolicy1})
+
+	fakeWatch.Add(adminNetworkPolicy2)
+	handler.ValidateAdminNetworkPolicies(t, []*api.AdminNetworkPolicy{adminNetworkPolicy1, adminNetworkPolicy2})
+
+	fakeWatch.Delete(adminNetworkPolicy1)
+	handler.ValidateAdminNetworkPolicies(t, []*api.AdminNetworkPolicy{adminNetworkPolicy2})
+}
+
+func TestBaselineAdminNetworkPolicyAddRemoveAndNotified(t *testing.T){
+
+	fakeWatch := watch.NewFake()
+	listWatch := &cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			return &api.BaselineAdminNetworkPolicyList{}, nil
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			return fakeWatch, nil
+		},
+	}
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+
+	informer := cache.NewSharedIndexInformer(listWatch, &api.BaselineAdminNetworkPolicy{}, time.Minute, cache.Indexers{})
+	config := NewBaselineAdminNetworkPolicyConfig(informer, time.Minute)
+	handler := NewBaselineAdminNetworkPolicyHandlerMock()
+	config.RegisterEventHandler(handler)
+
+	go informer.Run(stopCh)
+	go config.Run(stopCh)
+
+	baselineAdminNetworkPolicy := &api.BaselineAdminNetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "default"},
+		Spec: api.BaselineAdminNetworkPolicySpec{
+			Subject: api.AdminNetworkPolicySubject{Namespaces: &metav1.LabelSelector{}},
+			Ingress: []api.BaselineAdminNetworkPolicyIngressRule{
+				{
+					Action: api.BaselineAdminNetworkPolicyRuleActionDeny,
+					From:   []api.AdminNetworkPolicyIngressPeer{{Namespaces: &metav1.LabelSelector{}}},
+				},
+			},
+		},
+	}
+
+	fakeWatch.Add(baselineAdminNetworkPolicy)
+	handler.ValidateBaselineAdminNetworkPolicies(t, []*api.BaselineAdminNetworkPolicy{baselineAdminNetworkPolicy})
+
+	fakeWatch.Delete(baselineAdminNetworkPolicy)
+	handler.ValidateBaselineAdminNetworkPolicies(t, []*api.BaselineAdminNetworkPolicy{})
+}
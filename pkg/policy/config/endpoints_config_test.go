@@ -0,0 +1,226 @@
+package config
+
+import (
+	api "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/apimachinery/pkg/watch"
+	ktesting "k8s.io/client-go/testing"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apimachinery/pkg/types"
+
+	"testing"
+	"time"
+	"sync"
+	"sort"
+	"reflect"
+)
+
+type sortedEndpointsList []*api.Endpoints
+
+func (s sortedEndpointsList) Len() int {
+	return len(s)
+}
+func (s sortedEndpointsList) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
+func (s sortedEndpointsList) Less(i, j int) bool {
+	return s[i].Name < s[j].Name
+}
+
+type EndpointsHandlerMock struct {
+	lock sync.Mutex
+
+	state   map[types.NamespacedName]*api.Endpoints
+	synced  bool
+	updated chan []*api.Endpoints
+	process func([]*api.Endpoints)
+}
+
+func NewEndpointsHandlerMock() *EndpointsHandlerMock {
+	shm := &EndpointsHandlerMock{
+		state:   make(map[types.NamespacedName]*api.Endpoints),
+		updated: make(chan []*api.Endpoints, 5),
+	}
+	shm.process = func(endpointsList []*api.Endpoints) {
+		shm.updated <- endpointsList
+	}
+	return shm
+}
+
+func (h *EndpointsHandlerMock) OnEndpointsAdd(endpoints *api.Endpoints) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.state[types.NamespacedName{Namespace: endpoints.Namespace, Name: endpoints.Name}] = endpoints
+	h.sendEndpoints()
+}
+
+func (h *EndpointsHandlerMock) OnEndpointsUpdate(oldEndpoints, endpoints *api.Endpoints) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.state[types.NamespacedName{Namespace: endpoints.Namespace, Name: endpoints.Name}] = endpoints
+	h.sendEndpoints()
+}
+
+func (h *EndpointsHandlerMock) OnEndpointsDelete(endpoints *api.Endpoints) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	delete(h.state, types.NamespacedName{Namespace: endpoints.Namespace, Name: endpoints.Name})
+	h.sendEndpoints()
+}
+
+func (h *EndpointsHandlerMock) OnEndpointsSynced() {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.synced = true
+	h.sendEndpoints()
+}
+
+func (h *EndpointsHandlerMock) sendEndpoints() {
+	if !h.synced {
+		return
+	}
+	endpointsList := make([]*api.Endpoints, 0, len(h.state))
+	for _, endpoints := range h.state {
+		endpointsList = append(endpointsList, endpoints)
+	}
+	sort.Sort(sortedEndpointsList(endpointsList))
+	h.process(endpointsList)
+}
+
+func (h *EndpointsHandlerMock) ValidateEndpoints(t *testing.T, expectedEndpointsList []*api.Endpoints) {
+	// We might get 1 or more updates for N Endpoints updates, because we
+	// over write older snapshots of Endpoints from the producer go-routine
+	// if the consumer falls behind.
+	var endpointsList []*api.Endpoints
+	for {
+		select {
+		case endpointsList = <-h.updated:
+			if reflect.DeepEqual(endpointsList, expectedEndpointsList) {
+				return
+			}
+		// Unittests will hard timeout in 5m with a stack trace, prevent that
+		// and surface a clearer reason for failure.
+		case <-time.After(wait.ForeverTestTimeout):
+			t.Errorf("Timed out. Expected %#v, Got %#v", expectedEndpointsList, endpointsList)
+			return
+		}
+	}
+}
+
+func TestEndpointsAddedAndNotified(t *testing.T) {
+
+	client := fake.NewSimpleClientset()
+	fakeWatch := watch.NewFake()
+	client.PrependWatchReactor("endpoints", ktesting.DefaultWatchReactor(fakeWatch, nil))
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+
+	sharedInformers := informers.NewSharedInformerFactory(client, time.Minute)
+
+	config := NewEndpointsConfig(sharedInformers.Core().V1().Endpoints(), time.Minute)
+	handler := NewEndpointsHandlerMock()
+	config.RegisterEventHandler(handler)
+	go sharedInformers.Start(stopCh)
+	go config.Run(stopCh)
+
+	endpoints := &api.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "foo1",
+		},
+		Subsets: []api.EndpointSubset{{Addresses: []api.EndpointAddress{{IP: "10.244.1.2"}}}},
+	}
+
+	fakeWatch.Add(endpoints)
+	handler.ValidateEndpoints(t, []*api.Endpoints{endpoints})
+}
+
+func TestEndpointsAddRemoveAndNotified(t *testing.T){
+
+	client := fake.NewSimpleClientset()
+	fakeWatch := watch.NewFake()
+	client.PrependWatchReactor("endpoints", ktesting.DefaultWatchReactor(fakeWatch, nil))
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+
+	sharedInformers := informers.NewSharedInformerFactory(client, time.Minute)
+
+	config := NewEndpointsConfig(sharedInformers.Core().V1().Endpoints(), time.Minute)
+	handler := NewEndpointsHandlerMock()
+	config.RegisterEventHandler(handler)
+	go sharedInformers.Start(stopCh)
+	go config.Run(stopCh)
+
+	endpoints1 := &api.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "foo1",
+		},
+		Subsets: []api.EndpointSubset{{Addresses: []api.EndpointAddress{{IP: "10.244.1.2"}}}},
+	}
+
+	endpoints2 := &api.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "foo2",
+		},
+		Subsets: []api.EndpointSubset{{Addresses: []api.EndpointAddress{{IP: "10.244.2.2"}}}},
+	}
+
+	fakeWatch.Add(endpoints1)
+	handler.ValidateEndpoints(t, []*api.Endpoints{endpoints1})
+
+	fakeWatch.Add(endpoints2)
+	handler.ValidateEndpoints(t, []*api.Endpoints{endpoints1,endpoints2})
+
+	fakeWatch.Delete(endpoints1)
+	handler.ValidateEndpoints(t, []*api.Endpoints{endpoints2})
+}
+
+func TestEndpointsMultipleHandlerAddAndNotified(t *testing.T){
+
+	client := fake.NewSimpleClientset()
+	fakeWatch := watch.NewFake()
+	client.PrependWatchReactor("endpoints", ktesting.DefaultWatchReactor(fakeWatch, nil))
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+
+	sharedInformers := informers.NewSharedInformerFactory(client, time.Minute)
+
+	config := NewEndpointsConfig(sharedInformers.Core().V1().Endpoints(), time.Minute)
+
+	handler1 := NewEndpointsHandlerMock()
+	config.RegisterEventHandler(handler1)
+	handler2 := NewEndpointsHandlerMock()
+	config.RegisterEventHandler(handler2)
+
+	go sharedInformers.Start(stopCh)
+	go config.Run(stopCh)
+
+	endpoints1 := &api.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "foo1",
+		},
+		Subsets: []api.EndpointSubset{{Addresses: []api.EndpointAddress{{IP: "10.244.1.2"}}}},
+	}
+
+	endpoints2 := &api.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "foo2",
+		},
+		Subsets: []api.EndpointSubset{{Addresses: []api.EndpointAddress{{IP: "10.244.2.2"}}}},
+	}
+
+	fakeWatch.Add(endpoints1)
+	fakeWatch.Add(endpoints2)
+
+	handler1.ValidateEndpoints(t, []*api.Endpoints{endpoints1,endpoints2})
+	handler2.ValidateEndpoints(t, []*api.Endpoints{endpoints1,endpoints2})
+}
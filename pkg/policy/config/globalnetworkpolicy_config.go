@@ -0,0 +1,151 @@
+package config
+
+import (
+	api "enn-policy/pkg/apis/networking/v1alpha1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/rest"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	"k8s.io/apimachinery/pkg/fields"
+
+	"time"
+	"github.com/golang/glog"
+	"fmt"
+)
+
+// GlobalNetworkPolicyHandler is an abstract interface of objects which receive
+// notifications about GlobalNetworkPolicy object changes.
+type GlobalNetworkPolicyHandler interface {
+	// OnGlobalNetworkPolicyAdd is called whenever creation of new GlobalNetworkPolicy object
+	// is observed.
+	OnGlobalNetworkPolicyAdd(globalNetworkPolicy *api.GlobalNetworkPolicy)
+	// OnGlobalNetworkPolicyUpdate is called whenever modification of an existing
+	// GlobalNetworkPolicy object is observed.
+	OnGlobalNetworkPolicyUpdate(oldGlobalNetworkPolicy, globalNetworkPolicy *api.GlobalNetworkPolicy)
+	// OnGlobalNetworkPolicyDelete is called whenever deletion of an existing GlobalNetworkPolicy
+	// object is observed.
+	OnGlobalNetworkPolicyDelete(globalNetworkPolicy *api.GlobalNetworkPolicy)
+	// OnGlobalNetworkPolicySynced is called once all the initial even handlers were
+	// called and the state is fully propagated to local cache.
+	OnGlobalNetworkPolicySynced()
+}
+
+// NewGlobalNetworkPolicyClient returns a rest client of the networking.enn.cn/v1alpha1 api group
+func NewGlobalNetworkPolicyClient(config *rest.Config) (rest.Interface, error) {
+	scheme := runtime.NewScheme()
+	if err := api.AddToScheme(scheme); err != nil {
+		return nil, err
+	}
+	clientConfig := *config
+	clientConfig.GroupVersion = &api.SchemeGroupVersion
+	clientConfig.APIPath = "/apis"
+	clientConfig.ContentType = runtime.ContentTypeJSON
+	clientConfig.NegotiatedSerializer = serializer.DirectCodecFactory{CodecFactory: serializer.NewCodecFactory(scheme)}
+	return rest.RESTClientFor(&clientConfig)
+}
+
+// NewGlobalNetworkPolicyInformer returns an informer of the cluster-scoped GlobalNetworkPolicy,
+// there is no generated informer factory for custom resources, so it is started by its own Run
+func NewGlobalNetworkPolicyInformer(client cache.Getter, resyncPeriod time.Duration) cache.SharedIndexInformer {
+	listWatch := cache.NewListWatchFromClient(client, "globalnetworkpolicies", "", fields.Everything())
+	return cache.NewSharedIndexInformer(listWatch, &api.GlobalNetworkPolicy{}, resyncPeriod, cache.Indexers{})
+}
+
+// GlobalNetworkPolicyConfig tracks a set of GlobalNetworkPolicy configurations.
+// It accepts "set", "add" and "remove" operations of GlobalNetworkPolicy via channels, and invokes registered handlers on change.
+type GlobalNetworkPolicyConfig struct {
+	listerSynced  cache.InformerSynced
+	eventHandlers []GlobalNetworkPolicyHandler
+}
+
+// NewGlobalNetworkPolicyConfig creates a new GlobalNetworkPolicyConfig.
+func NewGlobalNetworkPolicyConfig(globalNetworkPolicyInformer cache.SharedIndexInformer, resyncPeriod time.Duration) *GlobalNetworkPolicyConfig {
+	result := &GlobalNetworkPolicyConfig{
+		listerSynced: globalNetworkPolicyInformer.HasSynced,
+	}
+
+	globalNetworkPolicyInformer.AddEventHandlerWithResyncPeriod(
+		cache.ResourceEventHandlerFuncs{
+			AddFunc:    result.handleAddGlobalNetworkPolicy,
+			UpdateFunc: result.handleUpdateGlobalNetworkPolicy,
+			DeleteFunc: result.handleDeleteGlobalNetworkPolicy,
+		},
+		resyncPeriod,
+	)
+
+	return result
+}
+
+// RegisterEventHandler registers a handler which is called on every GlobalNetworkPolicy change.
+func (c *GlobalNetworkPolicyConfig) RegisterEventHandler(handler GlobalNetworkPolicyHandler) {
+	c.eventHandlers = append(c.eventHandlers, handler)
+}
+
+// Run starts the goroutine responsible for calling
+// registered handlers.
+func (c *GlobalNetworkPolicyConfig) Run(stopCh <-chan struct{}) {
+	defer utilruntime.HandleCrash()
+
+	glog.V(2).Info("Starting GlobalNetworkPolicy config controller")
+	defer glog.V(2).Info("Shutting down GlobalNetworkPolicy config controller")
+
+	if !waitForCacheSync("GlobalNetworkPolicy config", stopCh, c.listerSynced) {
+		return
+	}
+
+	for i := range c.eventHandlers {
+		glog.V(3).Infof("Calling handler.OnGlobalNetworkPolicySynced()")
+		c.eventHandlers[i].OnGlobalNetworkPolicySynced()
+	}
+
+	<-stopCh
+}
+
+func (c *GlobalNetworkPolicyConfig) handleAddGlobalNetworkPolicy(obj interface{}) {
+	globalNetworkPolicy, ok := obj.(*api.GlobalNetworkPolicy)
+	if !ok {
+		utilruntime.HandleError(fmt.Errorf("unexpected object type: %v", obj))
+		return
+	}
+	for i := range c.eventHandlers {
+		glog.V(4).Infof("Calling handler.OnGlobalNetworkPolicyAdd")
+		c.eventHandlers[i].OnGlobalNetworkPolicyAdd(globalNetworkPolicy)
+	}
+}
+
+func (c *GlobalNetworkPolicyConfig) handleUpdateGlobalNetworkPolicy(oldObj, newObj interface{}) {
+	oldGlobalNetworkPolicy, ok := oldObj.(*api.GlobalNetworkPolicy)
+	if !ok {
+		utilruntime.HandleError(fmt.Errorf("unexpected object type: %v", oldObj))
+		return
+	}
+	globalNetworkPolicy, ok := newObj.(*api.GlobalNetworkPolicy)
+	if !ok {
+		utilruntime.HandleError(fmt.Errorf("unexpected object type: %v", newObj))
+		return
+	}
+	for i := range c.eventHandlers {
+		glog.V(4).Infof("Calling handler.OnGlobalNetworkPolicyUpdate")
+		c.eventHandlers[i].OnGlobalNetworkPolicyUpdate(oldGlobalNetworkPolicy, globalNetworkPolicy)
+	}
+}
+
+func (c *GlobalNetworkPolicyConfig) handleDeleteGlobalNetworkPolicy(obj interface{}) {
+	globalNetworkPolicy, ok := obj.(*api.GlobalNetworkPolicy)
+	if !ok {
+		tombstone, ok := obj.(cache.DeletedFinalStateUnknown)
+		if !ok {
+			utilruntime.HandleError(fmt.Errorf("unexpected object type: %v", obj))
+			return
+		}
+		if globalNetworkPolicy, ok = tombstone.Obj.(*api.GlobalNetworkPolicy); !ok {
+			utilruntime.HandleError(fmt.Errorf("unexpected object type: %v", obj))
+			return
+		}
+	}
+	for i := range c.eventHandlers {
+		glog.V(4).Infof("Calling handler.OnGlobalNetworkPolicyDelete")
+		c.eventHandlers[i].OnGlobalNetworkPolicyDelete(globalNetworkPolicy)
+	}
+}
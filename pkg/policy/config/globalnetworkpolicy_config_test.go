@@ -0,0 +1,140 @@
+package config
+
+import (
+	api "enn-policy/pkg/apis/networking/v1alpha1"
+	networking "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/cache"
+
+	"testing"
+	"time"
+	"sync"
+	"sort"
+	"reflect"
+)
+
+type GlobalNetworkPolicyHandlerMock struct {
+	lock      sync.Mutex
+
+	state     map[string]*api.GlobalNetworkPolicy
+	synced    bool
+	updated   chan []*api.GlobalNetworkPolicy
+}
+
+func NewGlobalNetworkPolicyHandlerMock() *GlobalNetworkPolicyHandlerMock {
+	return &GlobalNetworkPolicyHandlerMock{
+		state:   make(map[string]*api.GlobalNetworkPolicy),
+		updated: make(chan []*api.GlobalNetworkPolicy, 5),
+	}
+}
+
+func (h *GlobalNetworkPolicyHandlerMock) OnGlobalNetworkPolicyAdd(globalNetworkPolicy *api.GlobalNetworkPolicy) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.state[globalNetworkPolicy.Name] = globalNetworkPolicy
+	h.sendGlobalNetworkPolicies()
+}
+
+func (h *GlobalNetworkPolicyHandlerMock) OnGlobalNetworkPolicyUpdate(oldGlobalNetworkPolicy, globalNetworkPolicy *api.GlobalNetworkPolicy) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.state[globalNetworkPolicy.Name] = globalNetworkPolicy
+	h.sendGlobalNetworkPolicies()
+}
+
+func (h *GlobalNetworkPolicyHandlerMock) OnGlobalNetworkPolicyDelete(globalNetworkPolicy *api.GlobalNetworkPolicy) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	delete(h.state, globalNetworkPolicy.Name)
+	h.sendGlobalNetworkPolicies()
+}
+
+func (h *GlobalNetworkPolicyHandlerMock) OnGlobalNetworkPolicySynced() {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.synced = true
+	h.sendGlobalNetworkPolicies()
+}
+
+func (h *GlobalNetworkPolicyHandlerMock) sendGlobalNetworkPolicies() {
+	if !h.synced {
+		return
+	}
+	globalNetworkPolicies := make([]*api.GlobalNetworkPolicy, 0, len(h.state))
+	for _, policy := range h.state {
+		globalNetworkPolicies = append(globalNetworkPolicies, policy)
+	}
+	sort.Slice(globalNetworkPolicies, func(i, j int) bool { return globalNetworkPolicies[i].Name < globalNetworkPolicies[j].Name })
+	h.updated <- globalNetworkPolicies
+}
+
+func (h *GlobalNetworkPolicyHandlerMock) ValidateGlobalNetworkPolicies(t *testing.T, expectedGlobalNetworkPolicies []*api.GlobalNetworkPolicy) {
+
+	var globalNetworkPolicies []*api.GlobalNetworkPolicy
+	for {
+		select {
+		case globalNetworkPolicies = <-h.updated:
+			if reflect.DeepEqual(globalNetworkPolicies, expectedGlobalNetworkPolicies){
+				return
+			}
+		case <-time.After(wait.ForeverTestTimeout):
+			t.Errorf("Timed out. Expected %#v, Got %#v", expectedGlobalNetworkPolicies, globalNetworkPolicies)
+			return
+		}
+	}
+}
+
+func TestGlobalNetworkPolicyAddRemoveAndNotified(t *testing.T){
+
+	fakeWatch := watch.NewFake()
+	listWatch := &cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			return &api.GlobalNetworkPolicyList{}, nil
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			return fakeWatch, nil
+		},
+	}
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+
+	informer := cache.NewSharedIndexInformer(listWatch, &api.GlobalNetworkPolicy{}, time.Minute, cache.Indexers{})
+	config := NewGlobalNetworkPolicyConfig(informer, time.Minute)
+	handler := NewGlobalNetworkPolicyHandlerMock()
+	config.RegisterEventHandler(handler)
+
+	go informer.Run(stopCh)
+	go config.Run(stopCh)
+
+	globalNetworkPolicy1 := &api.GlobalNetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "allow-dns"},
+		Spec: api.GlobalNetworkPolicySpec{
+			PolicyTypes: []networking.PolicyType{networking.PolicyTypeEgress},
+			Egress: []networking.NetworkPolicyEgressRule{
+				{
+					To: []networking.NetworkPolicyPeer{{NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"name": "kube-system"}}}},
+				},
+			},
+		},
+	}
+	globalNetworkPolicy2 := &api.GlobalNetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "deny-metadata"},
+		Spec: api.GlobalNetworkPolicySpec{
+			NamespaceSelector: metav1.LabelSelector{MatchLabels: map[string]string{"tenant": "true"}},
+			PolicyTypes:       []networking.PolicyType{networking.PolicyTypeEgress},
+		},
+	}
+
+	fakeWatch.Add(globalNetworkPolicy1)
+	handler.ValidateGlobalNetworkPolicies(t, []*api.GlobalNetworkPolicy{globalNetworkPolicy1})
+
+	fakeWatch.Add(globalNetworkPolicy2)
+	handler.ValidateGlobalNetworkPolicies(t, []*api.GlobalNetworkPolicy{globalNetworkPolicy1, globalNetworkPolicy2})
+
+	fakeWatch.Delete(globalNetworkPolicy1)
+	handler.ValidateGlobalNetworkPolicies(t, []*api.GlobalNetworkPolicy{globalNetworkPolicy2})
+}
@@ -0,0 +1,220 @@
+package config
+
+import (
+	api "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/apimachinery/pkg/watch"
+	ktesting "k8s.io/client-go/testing"
+	"k8s.io/apimachinery/pkg/util/wait"
+
+	"testing"
+	"time"
+	"sync"
+	"sort"
+	"reflect"
+)
+
+type sortedNodes []*api.Node
+
+func (s sortedNodes) Len() int {
+	return len(s)
+}
+func (s sortedNodes) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
+func (s sortedNodes) Less(i, j int) bool {
+	return s[i].Name < s[j].Name
+}
+
+type NodeHandlerMock struct {
+	lock sync.Mutex
+
+	state   map[string]*api.Node
+	synced  bool
+	updated chan []*api.Node
+	process func([]*api.Node)
+}
+
+func NewNodeHandlerMock() *NodeHandlerMock {
+	shm := &NodeHandlerMock{
+		state:   make(map[string]*api.Node),
+		updated: make(chan []*api.Node, 5),
+	}
+	shm.process = func(nodes []*api.Node) {
+		shm.updated <- nodes
+	}
+	return shm
+}
+
+func (h *NodeHandlerMock) OnNodeAdd(node *api.Node) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.state[node.Name] = node
+	h.sendNodes()
+}
+
+func (h *NodeHandlerMock) OnNodeUpdate(oldNode, node *api.Node) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.state[node.Name] = node
+	h.sendNodes()
+}
+
+func (h *NodeHandlerMock) OnNodeDelete(node *api.Node) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	delete(h.state, node.Name)
+	h.sendNodes()
+}
+
+func (h *NodeHandlerMock) OnNodeSynced() {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.synced = true
+	h.sendNodes()
+}
+
+func (h *NodeHandlerMock) sendNodes() {
+	if !h.synced {
+		return
+	}
+	nodes := make([]*api.Node, 0, len(h.state))
+	for _, node := range h.state {
+		nodes = append(nodes, node)
+	}
+	sort.Sort(sortedNodes(nodes))
+	h.process(nodes)
+}
+
+func (h *NodeHandlerMock) ValidateNodes(t *testing.T, expectedNodes []*api.Node) {
+	// We might get 1 or more updates for N Node updates, because we
+	// over write older snapshots of Nodes from the producer go-routine
+	// if the consumer falls behind.
+	var nodes []*api.Node
+	for {
+		select {
+		case nodes = <-h.updated:
+			if reflect.DeepEqual(nodes, expectedNodes) {
+				return
+			}
+		// Unittests will hard timeout in 5m with a stack trace, prevent that
+		// and surface a clearer reason for failure.
+		case <-time.After(wait.ForeverTestTimeout):
+			t.Errorf("Timed out. Expected %#v, Got %#v", expectedNodes, nodes)
+			return
+		}
+	}
+}
+
+func TestNodeAddedAndNotified(t *testing.T) {
+
+	client := fake.NewSimpleClientset()
+	fakeWatch := watch.NewFake()
+	client.PrependWatchReactor("nodes", ktesting.DefaultWatchReactor(fakeWatch, nil))
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+
+	sharedInformers := informers.NewSharedInformerFactory(client, time.Minute)
+
+	config := NewNodeConfig(sharedInformers.Core().V1().Nodes(), time.Minute)
+	handler := NewNodeHandlerMock()
+	config.RegisterEventHandler(handler)
+	go sharedInformers.Start(stopCh)
+	go config.Run(stopCh)
+
+	node := &api.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "foo1",
+		},
+		Spec: api.NodeSpec{PodCIDR: "10.244.1.0/24"},
+	}
+
+	fakeWatch.Add(node)
+	handler.ValidateNodes(t, []*api.Node{node})
+}
+
+func TestNodeAddRemoveAndNotified(t *testing.T){
+
+	client := fake.NewSimpleClientset()
+	fakeWatch := watch.NewFake()
+	client.PrependWatchReactor("nodes", ktesting.DefaultWatchReactor(fakeWatch, nil))
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+
+	sharedInformers := informers.NewSharedInformerFactory(client, time.Minute)
+
+	config := NewNodeConfig(sharedInformers.Core().V1().Nodes(), time.Minute)
+	handler := NewNodeHandlerMock()
+	config.RegisterEventHandler(handler)
+	go sharedInformers.Start(stopCh)
+	go config.Run(stopCh)
+
+	node1 := &api.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "foo1",
+		},
+		Spec: api.NodeSpec{PodCIDR: "10.244.1.0/24"},
+	}
+
+	node2 := &api.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "foo2",
+		},
+		Spec: api.NodeSpec{PodCIDR: "10.244.2.0/24"},
+	}
+
+	fakeWatch.Add(node1)
+	handler.ValidateNodes(t, []*api.Node{node1})
+
+	fakeWatch.Add(node2)
+	handler.ValidateNodes(t, []*api.Node{node1,node2})
+
+	fakeWatch.Delete(node1)
+	handler.ValidateNodes(t, []*api.Node{node2})
+}
+
+func TestNodeMultipleHandlerAddAndNotified(t *testing.T){
+
+	client := fake.NewSimpleClientset()
+	fakeWatch := watch.NewFake()
+	client.PrependWatchReactor("nodes", ktesting.DefaultWatchReactor(fakeWatch, nil))
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+
+	sharedInformers := informers.NewSharedInformerFactory(client, time.Minute)
+
+	config := NewNodeConfig(sharedInformers.Core().V1().Nodes(), time.Minute)
+
+	handler1 := NewNodeHandlerMock()
+	config.RegisterEventHandler(handler1)
+	handler2 := NewNodeHandlerMock()
+	config.RegisterEventHandler(handler2)
+
+	go sharedInformers.Start(stopCh)
+	go config.Run(stopCh)
+
+	node1 := &api.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "foo1",
+		},
+		Spec: api.NodeSpec{PodCIDR: "10.244.1.0/24"},
+	}
+
+	node2 := &api.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "foo2",
+		},
+		Spec: api.NodeSpec{PodCIDR: "10.244.2.0/24"},
+	}
+
+	fakeWatch.Add(node1)
+	fakeWatch.Add(node2)
+
+	handler1.ValidateNodes(t, []*api.Node{node1,node2})
+	handler2.ValidateNodes(t, []*api.Node{node1,node2})
+}
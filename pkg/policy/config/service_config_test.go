@@ -0,0 +1,226 @@
+package config
+
+import (
+	api "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/apimachinery/pkg/watch"
+	ktesting "k8s.io/client-go/testing"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apimachinery/pkg/types"
+
+	"testing"
+	"time"
+	"sync"
+	"sort"
+	"reflect"
+)
+
+type sortedServices []*api.Service
+
+func (s sortedServices) Len() int {
+	return len(s)
+}
+func (s sortedServices) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
+func (s sortedServices) Less(i, j int) bool {
+	return s[i].Name < s[j].Name
+}
+
+type ServiceHandlerMock struct {
+	lock sync.Mutex
+
+	state   map[types.NamespacedName]*api.Service
+	synced  bool
+	updated chan []*api.Service
+	process func([]*api.Service)
+}
+
+func NewServiceHandlerMock() *ServiceHandlerMock {
+	shm := &ServiceHandlerMock{
+		state:   make(map[types.NamespacedName]*api.Service),
+		updated: make(chan []*api.Service, 5),
+	}
+	shm.process = func(services []*api.Service) {
+		shm.updated <- services
+	}
+	return shm
+}
+
+func (h *ServiceHandlerMock) OnServiceAdd(service *api.Service) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.state[types.NamespacedName{Namespace: service.Namespace, Name: service.Name}] = service
+	h.sendServices()
+}
+
+func (h *ServiceHandlerMock) OnServiceUpdate(oldService, service *api.Service) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.state[types.NamespacedName{Namespace: service.Namespace, Name: service.Name}] = service
+	h.sendServices()
+}
+
+func (h *ServiceHandlerMock) OnServiceDelete(service *api.Service) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	delete(h.state, types.NamespacedName{Namespace: service.Namespace, Name: service.Name})
+	h.sendServices()
+}
+
+func (h *ServiceHandlerMock) OnServiceSynced() {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.synced = true
+	h.sendServices()
+}
+
+func (h *ServiceHandlerMock) sendServices() {
+	if !h.synced {
+		return
+	}
+	services := make([]*api.Service, 0, len(h.state))
+	for _, service := range h.state {
+		services = append(services, service)
+	}
+	sort.Sort(sortedServices(services))
+	h.process(services)
+}
+
+func (h *ServiceHandlerMock) ValidateServices(t *testing.T, expectedServices []*api.Service) {
+	// We might get 1 or more updates for N Service updates, because we
+	// over write older snapshots of Services from the producer go-routine
+	// if the consumer falls behind.
+	var services []*api.Service
+	for {
+		select {
+		case services = <-h.updated:
+			if reflect.DeepEqual(services, expectedServices) {
+				return
+			}
+		// Unittests will hard timeout in 5m with a stack trace, prevent that
+		// and surface a clearer reason for failure.
+		case <-time.After(wait.ForeverTestTimeout):
+			t.Errorf("Timed out. Expected %#v, Got %#v", expectedServices, services)
+			return
+		}
+	}
+}
+
+func TestServiceAddedAndNotified(t *testing.T) {
+
+	client := fake.NewSimpleClientset()
+	fakeWatch := watch.NewFake()
+	client.PrependWatchReactor("services", ktesting.DefaultWatchReactor(fakeWatch, nil))
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+
+	sharedInformers := informers.NewSharedInformerFactory(client, time.Minute)
+
+	config := NewServiceConfig(sharedInformers.Core().V1().Services(), time.Minute)
+	handler := NewServiceHandlerMock()
+	config.RegisterEventHandler(handler)
+	go sharedInformers.Start(stopCh)
+	go config.Run(stopCh)
+
+	service := &api.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "foo1",
+		},
+		Spec: api.ServiceSpec{ClusterIP: "10.96.0.1"},
+	}
+
+	fakeWatch.Add(service)
+	handler.ValidateServices(t, []*api.Service{service})
+}
+
+func TestServiceAddRemoveAndNotified(t *testing.T){
+
+	client := fake.NewSimpleClientset()
+	fakeWatch := watch.NewFake()
+	client.PrependWatchReactor("services", ktesting.DefaultWatchReactor(fakeWatch, nil))
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+
+	sharedInformers := informers.NewSharedInformerFactory(client, time.Minute)
+
+	config := NewServiceConfig(sharedInformers.Core().V1().Services(), time.Minute)
+	handler := NewServiceHandlerMock()
+	config.RegisterEventHandler(handler)
+	go sharedInformers.Start(stopCh)
+	go config.Run(stopCh)
+
+	service1 := &api.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "foo1",
+		},
+		Spec: api.ServiceSpec{ClusterIP: "10.96.0.1"},
+	}
+
+	service2 := &api.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "foo2",
+		},
+		Spec: api.ServiceSpec{ClusterIP: "10.96.0.2"},
+	}
+
+	fakeWatch.Add(service1)
+	handler.ValidateServices(t, []*api.Service{service1})
+
+	fakeWatch.Add(service2)
+	handler.ValidateServices(t, []*api.Service{service1,service2})
+
+	fakeWatch.Delete(service1)
+	handler.ValidateServices(t, []*api.Service{service2})
+}
+
+func TestServiceMultipleHandlerAddAndNotified(t *testing.T){
+
+	client := fake.NewSimpleClientset()
+	fakeWatch := watch.NewFake()
+	client.PrependWatchReactor("services", ktesting.DefaultWatchReactor(fakeWatch, nil))
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+
+	sharedInformers := informers.NewSharedInformerFactory(client, time.Minute)
+
+	config := NewServiceConfig(sharedInformers.Core().V1().Services(), time.Minute)
+
+	handler1 := NewServiceHandlerMock()
+	config.RegisterEventHandler(handler1)
+	handler2 := NewServiceHandlerMock()
+	config.RegisterEventHandler(handler2)
+
+	go sharedInformers.Start(stopCh)
+	go config.Run(stopCh)
+
+	service1 := &api.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "foo1",
+		},
+		Spec: api.ServiceSpec{ClusterIP: "10.96.0.1"},
+	}
+
+	service2 := &api.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "foo2",
+		},
+		Spec: api.ServiceSpec{ClusterIP: "10.96.0.2"},
+	}
+
+	fakeWatch.Add(service1)
+	fakeWatch.Add(service2)
+
+	handler1.ValidateServices(t, []*api.Service{service1,service2})
+	handler2.ValidateServices(t, []*api.Service{service1,service2})
+}
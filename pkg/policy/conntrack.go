@@ -0,0 +1,541 @@
+package policy
+
+import (
+	"k8s.io/apimachinery/pkg/types"
+	"github.com/golang/glog"
+	utilpolicy "enn-policy/pkg/policy/util"
+	utilconntrack "enn-policy/pkg/util/conntrack"
+
+	"net"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// policyAccess is a snapshot of the traffic allowed by NetworkPolicies and the admin tiers after a sync,
+// it is compared with the snapshot of the last sync to find connections which lose access
+// since ENN-PLY-* chains accept RELATED,ESTABLISHED traffic before any other rule and ENN-ANP-*/ENN-BANP-* chains return it
+type policyAccess struct {
+	// ingress stores the rules which allow ingress traffic of each isolated target pod ip
+	ingress map[string][]accessRule
+	// egress stores the rules which allow egress traffic of each isolated target pod ip
+	egress  map[string][]accessRule
+
+	// priorityIngress and priorityEgress are explicit rules of globalNetworkPolicies in the order of ENN-PRIORITY
+	priorityIngress []priorityAccessRule
+	priorityEgress  []priorityAccessRule
+
+	// adminIngress and adminEgress are rules of AdminNetworkPolicies in the order of ENN-ANP-* chains,
+	// baselineIngress and baselineEgress are rules of BaselineAdminNetworkPolicies in the order of ENN-BANP-* chains
+	adminIngress    []adminAccessRule
+	adminEgress     []adminAccessRule
+	baselineIngress []adminAccessRule
+	baselineEgress  []adminAccessRule
+}
+
+// adminAccessRule is a rule of an admin network policy with its subject and peers resolved to pod ips
+type adminAccessRule struct {
+	action   string
+	subjects map[string]bool
+	peers    map[string]bool
+	cidrs    []string
+	// ports is empty if the rule matches all ports, Port of a port range is start:end
+	ports    []utilpolicy.PolicyPort
+}
+
+// priorityAccessRule is an explicit rule of a globalNetworkPolicy with its selected pods resolved to pod ips
+type priorityAccessRule struct {
+	priorityRule
+	targets  map[string]bool
+}
+
+// accessRule is an ingress or egress rule with its peers resolved to pod ips
+type accessRule struct {
+	ports    []utilpolicy.PolicyPort
+	// allPeers is true for a rule which only has ports, and for a rule of EgressFQDNs,
+	// whose ips are resolved without a sync, so connections to its ports are never flushed
+	allPeers bool
+	peers    map[string]bool
+	ipBlocks []utilpolicy.CIDRRange
+	// endpoints are the entries of ipsets of EgressServices like 10.244.1.10,TCP:80
+	endpoints map[string]bool
+}
+
+// buildPolicyAccess resolves the networkPolicies rendered in this sync into pod ips,
+// selectors are resolved the same way as ipsets of dispatch chains, where labels of a peer selector are ORed
+func (policy *EnnPolicy) buildPolicyAccess() *policyAccess{
+
+	access := &policyAccess{
+		ingress: make(map[string][]accessRule),
+		egress:  make(map[string][]accessRule),
+	}
+	var priorityRules []priorityAccessRule
+	// rules of a target are in the same order in each sync
+	for _, networkPolicy := range policy.renderedNetworkPolicies(){
+		if policy.isHostEndpointPolicy(networkPolicy){
+			continue
+		}
+		networkPolicy = policy.enforcedNetworkPolicy(networkPolicy)
+		if networkPolicy == nil{
+			continue
+		}
+		// explicit rules are enforced in audit mode too, like collectPriorityRules
+		if networkPolicy.Support != utilpolicy.SupportNone && len(networkPolicy.ExplicitRules) > 0{
+			targets := make(map[string]bool)
+			for _, ip := range policy.targetPodIPs(networkPolicy, false){
+				targets[ip] = true
+			}
+			for i, rule := range networkPolicy.ExplicitRules{
+				priorityRules = append(priorityRules, priorityAccessRule{
+					priorityRule: priorityRule{namespace: networkPolicy.Namespace, policyName: networkPolicy.Name, index: i, rule: rule},
+					targets:      targets,
+				})
+			}
+		}
+		// traffic of namespaces in audit mode is accepted even if policies do not allow it
+		if policy.policyMode(networkPolicy.Namespace) == utilpolicy.PolicyModeAudit{
+			continue
+		}
+		targets := policy.targetPodIPs(networkPolicy, true)
+		for _, policyType := range networkPolicy.PolicyType{
+			var rules []accessRule
+			isolated := access.ingress
+			if policyType == utilpolicy.TypeIngress{
+				for _, ingress := range networkPolicy.Ingress{
+					rules = append(rules, policy.buildAccessRule(networkPolicy.Namespace,
+						ingress.Ports, ingress.PodSelector, ingress.NamespaceSelector, ingress.IPBlock))
+				}
+			} else if policyType == utilpolicy.TypeEgress{
+				isolated = access.egress
+				for _, egress := range networkPolicy.Egress{
+					rules = append(rules, policy.buildAccessRule(networkPolicy.Namespace,
+						egress.Ports, egress.PodSelector, egress.NamespaceSelector, egress.IPBlock))
+				}
+				for _, fqdn := range networkPolicy.EgressFQDNs{
+					rules = append(rules, accessRule{ports: fqdn.Ports, allPeers: true})
+				}
+				// EgressServices allow nothing unless services and endpoints are watched, see dispatchServices
+				if len(networkPolicy.EgressServices) > 0 && policy.egressServices{
+					rules = append(rules, policy.buildServiceAccessRule(networkPolicy))
+				}
+			} else {
+				continue
+			}
+			for _, ip := range targets{
+				// a target without rules is isolated and denies all traffic
+				isolated[ip] = append(isolated[ip], rules...)
+			}
+		}
+	}
+	sort.SliceStable(priorityRules, func(i, j int) bool{
+		return priorityRuleLess(priorityRules[i].priorityRule, priorityRules[j].priorityRule)
+	})
+	for _, rule := range priorityRules{
+		if rule.rule.Direction == utilpolicy.TypeEgress{
+			access.priorityEgress = append(access.priorityEgress, rule)
+		} else {
+			access.priorityIngress = append(access.priorityIngress, rule)
+		}
+	}
+	for _, info := range sortedAdminNetworkPolicies(policy.adminNetworkPolicyMap){
+		access.adminIngress = append(access.adminIngress, policy.buildAdminAccessRules(info, info.Ingress)...)
+		access.adminEgress = append(access.adminEgress, policy.buildAdminAccessRules(info, info.Egress)...)
+	}
+	for _, info := range sortedAdminNetworkPolicies(policy.baselineAdminNetworkPolicyMap){
+		access.baselineIngress = append(access.baselineIngress, policy.buildAdminAccessRules(info, info.Ingress)...)
+		access.baselineEgress = append(access.baselineEgress, policy.buildAdminAccessRules(info, info.Egress)...)
+	}
+	return access
+}
+
+// buildAdminAccessRules resolves rules of an admin network policy the same way as ipsets of writeAdminPolicy
+func (policy *EnnPolicy) buildAdminAccessRules(info *utilpolicy.AdminNetworkPolicyInfo, rules []utilpolicy.AdminRule) []adminAccessRule{
+
+	if info.MatchNone || len(rules) == 0{
+		return nil
+	}
+	subjects := make(map[string]bool)
+	for ip := range policy.adminPolicySetMembers(&adminPolicySet{selector: info.Subject, subject: true}){
+		subjects[ip] = true
+	}
+	var result []adminAccessRule
+	for _, rule := range rules{
+		accessRule := adminAccessRule{
+			action:   rule.Action,
+			subjects: subjects,
+			peers:    make(map[string]bool),
+			ports:    rule.Ports,
+		}
+		for _, peer := range rule.Peers{
+			if peer.Pods == nil{
+				accessRule.cidrs = append(accessRule.cidrs, peer.CIDRs...)
+				continue
+			}
+			for ip := range policy.adminPolicySetMembers(&adminPolicySet{selector: *peer.Pods}){
+				accessRule.peers[ip] = true
+			}
+		}
+		result = append(result, accessRule)
+	}
+	return result
+}
+
+// targetPodIPs returns ips of pods selected by spec.podSelector, labels of spec.podSelector are ANDed,
+// exempted pods are never isolated, so they are skipped if skipExempted is true, explicit rules still apply to them
+func (policy *EnnPolicy) targetPodIPs(networkPolicy *utilpolicy.NetworkPolicyInfo, skipExempted bool) []string{
+	var ips []string
+	namespaceInfo := policy.namespaceInfoMap[networkPolicy.Namespace]
+	for ip, podInfo := range policy.namespacePodMap[networkPolicy.Namespace]{
+		if podInfo.HostNetwork || (skipExempted && policy.exemptions.ExemptsPod(namespaceInfo, podInfo)){
+			continue
+		}
+		matched := true
+		for key, value := range networkPolicy.PodSelector{
+			if podInfo.Labels[key] != value{
+				matched = false
+				break
+			}
+		}
+		if matched{
+			ips = append(ips, ip)
+		}
+	}
+	return ips
+}
+
+func (policy *EnnPolicy) buildAccessRule(namespace string, ports []utilpolicy.PolicyPort,
+	podSelectors, namespaceSelectors []utilpolicy.LabelSelector, ipBlocks []utilpolicy.CIDRRange) accessRule{
+
+	rule := accessRule{
+		ports:    ports,
+		allPeers: len(podSelectors) == 0 && len(namespaceSelectors) == 0 && len(ipBlocks) == 0,
+		peers:    make(map[string]bool),
+		ipBlocks: ipBlocks,
+	}
+	for _, podSelector := range podSelectors{
+		if len(podSelector.Label) == 0{
+			for ip := range policy.namespacePodMap[namespace]{
+				rule.peers[ip] = true
+			}
+		}
+		for key, value := range podSelector.Label{
+			label := utilpolicy.NamespacedLabel{Namespace: namespace, LabelKey: key, LabelValue: value}
+			for ip := range policy.podMatchLabelMap[label]{
+				rule.peers[ip] = true
+			}
+		}
+	}
+	for _, namespaceSelector := range namespaceSelectors{
+		if len(namespaceSelector.Label) == 0{
+			for _, podInfoMap := range policy.namespacePodMap{
+				for ip := range podInfoMap{
+					rule.peers[ip] = true
+				}
+			}
+		}
+		for key, value := range namespaceSelector.Label{
+			for ip := range policy.namespaceMatchLabelMap[utilpolicy.Label{LabelKey: key, LabelValue: value}]{
+				rule.peers[ip] = true
+			}
+		}
+	}
+	return rule
+}
+
+// buildServiceAccessRule resolves EgressServices of networkPolicy the same way as ipsets of dispatchServices
+func (policy *EnnPolicy) buildServiceAccessRule(networkPolicy *utilpolicy.NetworkPolicyInfo) accessRule{
+
+	rule := accessRule{endpoints: make(map[string]bool)}
+	for _, ref := range networkPolicy.EgressServices{
+		service := types.NamespacedName{Namespace: ref.Namespace, Name: ref.Name}
+		if service.Namespace == ""{
+			service.Namespace = networkPolicy.Namespace
+		}
+		for _, endpoint := range utilpolicy.ServiceEndpoints(policy.serviceInfoMap[service], policy.endpointsInfoMap[service]){
+			rule.endpoints[serviceEndpointKey(endpoint.IP, endpoint.Port.Protocol, endpoint.Port.Port)] = true
+		}
+	}
+	return rule
+}
+
+func serviceEndpointKey(ip string, protocol string, port string) string{
+	return ip + "," + protocol + ":" + port
+}
+
+// allows returns true if rule allows traffic from or to peer on protocol and port of the target pod
+func (rule *accessRule) allows(peer net.IP, protocol string, port uint16) bool{
+
+	if len(rule.ports) > 0{
+		matched := false
+		for _, policyPort := range rule.ports{
+			if policyPort.Protocol == protocol && (policyPort.Port == "" || policyPort.Port == strconv.Itoa(int(port))){
+				matched = true
+				break
+			}
+		}
+		if !matched{
+			return false
+		}
+	}
+	if rule.allPeers || rule.peers[peer.String()]{
+		return true
+	}
+	if rule.endpoints[serviceEndpointKey(peer.String(), protocol, strconv.Itoa(int(port)))]{
+		return true
+	}
+	for _, ipBlock := range rule.ipBlocks{
+		if cidrContains(ipBlock.CIDR, peer) && !cidrsContain(ipBlock.ExceptCIDR, peer){
+			return true
+		}
+	}
+	return false
+}
+
+// matches returns true if rule matches traffic of subject from or to peer on protocol and port,
+// a rule without port matches all protocols like the rules written by writeAdminRule
+func (rule *adminAccessRule) matches(subject, peer net.IP, protocol string, port uint16) bool{
+
+	if !rule.subjects[subject.String()]{
+		return false
+	}
+	if len(rule.ports) > 0{
+		matched := false
+		for _, policyPort := range rule.ports{
+			if policyPort.Port == "" || (policyPort.Protocol == protocol && portRangeContains(policyPort.Port, port)){
+				matched = true
+				break
+			}
+		}
+		if !matched{
+			return false
+		}
+	}
+	return rule.peers[peer.String()] || cidrsContain(rule.cidrs, peer)
+}
+
+// matches returns true if rule matches traffic of target from or to peer on protocol and port like the rules written by writePriorityRules
+func (rule *priorityAccessRule) matches(target, peer net.IP, protocol string, port uint16) bool{
+
+	if !rule.targets[target.String()]{
+		return false
+	}
+	if len(rule.rule.Ports) > 0{
+		matched := false
+		for _, policyPort := range rule.rule.Ports{
+			if policyPort.Port == "" || (policyPort.Protocol == protocol && portRangeContains(policyPort.Port, port)){
+				matched = true
+				break
+			}
+		}
+		if !matched{
+			return false
+		}
+	}
+	if len(rule.rule.IPBlock) == 0{
+		return true
+	}
+	for _, ipBlock := range rule.rule.IPBlock{
+		if (ipBlock.CIDR == "" || cidrContains(ipBlock.CIDR, peer)) && !cidrsContain(ipBlock.ExceptCIDR, peer){
+			return true
+		}
+	}
+	return false
+}
+
+// priorityAction returns the action of the first rule in rules which matches the traffic, empty if no rule matches
+func priorityAction(rules []priorityAccessRule, target, peer net.IP, protocol string, port uint16) string{
+	for i := range rules{
+		if rules[i].matches(target, peer, protocol, port){
+			return rules[i].rule.Action
+		}
+	}
+	return ""
+}
+
+// adminAction returns the action of the first rule in rules which matches the traffic, empty if no rule matches
+func adminAction(rules []adminAccessRule, subject, peer net.IP, protocol string, port uint16) string{
+	for i := range rules{
+		if rules[i].matches(subject, peer, protocol, port){
+			return rules[i].action
+		}
+	}
+	return ""
+}
+
+func portRangeContains(portRange string, port uint16) bool{
+	bounds := strings.Split(portRange, ":")
+	start, err := strconv.Atoi(bounds[0])
+	if err != nil{
+		return false
+	}
+	end := start
+	if len(bounds) == 2{
+		if end, err = strconv.Atoi(bounds[1]); err != nil{
+			return false
+		}
+	}
+	return int(port) >= start && int(port) <= end
+}
+
+// allows returns true if traffic from src to port of dst is allowed,
+// inRange tells if ingress or egress of an ip is restricted, policies are not enforced out of --ip-range
+func (access *policyAccess) allows(src, dst net.IP, protocol string, port uint16, inRange func(net.IP) bool) bool{
+
+	ingressRules, ingressIsolated := access.ingress[dst.String()]
+	if !allowsDirection(ingressRules, ingressIsolated && inRange(dst), access.priorityIngress, access.adminIngress, access.baselineIngress,
+		dst, src, protocol, port){
+		return false
+	}
+	egressRules, egressIsolated := access.egress[src.String()]
+	return allowsDirection(egressRules, egressIsolated && inRange(src), access.priorityEgress, access.adminEgress, access.baselineEgress,
+		src, dst, protocol, port)
+}
+
+// allowsDirection evaluates one direction of traffic of target the same way as ENN-FORWARD:
+// explicit rules first, then AdminNetworkPolicies, then NetworkPolicies if target is isolated, then BaselineAdminNetworkPolicies,
+// an explicit Allow rule skips NetworkPolicies and BaselineAdminNetworkPolicies, but not AdminNetworkPolicies
+func allowsDirection(rules []accessRule, isolated bool, priorityRules []priorityAccessRule, adminRules, baselineRules []adminAccessRule,
+	target, peer net.IP, protocol string, port uint16) bool{
+
+	priority := priorityAction(priorityRules, target, peer, protocol, port)
+	if priority == utilpolicy.ExplicitRuleActionDeny{
+		return false
+	}
+	switch adminAction(adminRules, target, peer, protocol, port){
+	case utilpolicy.AdminPolicyActionAllow:
+		return true
+	case utilpolicy.AdminPolicyActionDeny:
+		return false
+	}
+	if priority == utilpolicy.ExplicitRuleActionAllow{
+		return true
+	}
+	if isolated{
+		return anyRuleAllows(rules, peer, protocol, port)
+	}
+	return adminAction(baselineRules, target, peer, protocol, port) != utilpolicy.AdminPolicyActionDeny
+}
+
+func anyRuleAllows(rules []accessRule, peer net.IP, protocol string, port uint16) bool{
+	for i := range rules{
+		if rules[i].allows(peer, protocol, port){
+			return true
+		}
+	}
+	return false
+}
+
+// flushRevokedConnections deletes conntrack entries of connections which were allowed after the last sync
+// but are not allowed after this sync, it is called after rules or pod and namespace ipsets of this sync are synced
+// nothing is deleted on the first sync since what was allowed before enn-policy starts is unknown
+func (policy *EnnPolicy) flushRevokedConnections(){
+
+	if !policy.flushConntrack || policy.conntrackInterface == nil{
+		policy.lastAccess = nil
+		return
+	}
+	previous := policy.lastAccess
+	current := policy.buildPolicyAccess()
+	policy.lastAccess = current
+	if previous == nil || reflect.DeepEqual(previous, current){
+		return
+	}
+
+	flows, err := policy.conntrackInterface.ListFlows()
+	if err != nil{
+		glog.Errorf("failed to list conntrack entries, connections which lose access are not flushed: %v", err)
+		return
+	}
+	inRange, exempt := policy.conntrackScope()
+	deleted := 0
+	for i := range flows{
+		flow := &flows[i]
+		protocol := conntrackProtocol(flow.Protocol)
+		// the destination of policy rules is the endpoint after DNAT, e.g the pod behind a service
+		src, dst, port := flow.Orig.Src, flow.Reply.Src, flow.Reply.SrcPort
+		if protocol == "" || exempt(src) || exempt(dst){
+			continue
+		}
+		if !previous.allows(src, dst, protocol, port, inRange) || current.allows(src, dst, protocol, port, inRange){
+			continue
+		}
+		glog.V(4).Infof("connection %s is not allowed any more, delete its conntrack entry", flow.String())
+		if err := policy.conntrackInterface.DeleteFlow(flow); err != nil{
+			glog.Errorf("failed to delete conntrack entry: %v", err)
+			continue
+		}
+		deleted++
+	}
+	if deleted > 0{
+		glog.V(2).Infof("deleted %d conntrack entries of connections which are not allowed any more", deleted)
+	}
+}
+
+// conntrackScope returns inRange which tells if an ip is in --ip-range,
+// and exempt which tells if traffic of an ip is always accepted, so its connections are kept:
+// ips in --exclude-ip-range and ips of nodes which may be accepted by --accept-node-gateway-ip or --accept-local-node
+func (policy *EnnPolicy) conntrackScope() (inRange, exempt func(net.IP) bool){
+
+	var ipRanges, excludeIPRanges []*net.IPNet
+	for _, ipRange := range policy.iPRanges{
+		if _, ipNet, err := net.ParseCIDR(ipRange); err == nil{
+			ipRanges = append(ipRanges, ipNet)
+		}
+	}
+	for _, ipRange := range policy.excludeIPRanges{
+		if _, ipNet, err := net.ParseCIDR(ipRange); err == nil{
+			excludeIPRanges = append(excludeIPRanges, ipNet)
+		}
+	}
+	nodeIPs := make(map[string]bool)
+	for _, ip := range utilpolicy.NodeGatewayIPs(policy.nodeInfoMap){
+		nodeIPs[ip] = true
+	}
+	if policy.nodeIP != nil{
+		nodeIPs[policy.nodeIP.String()] = true
+	}
+
+	inRange = func(ip net.IP) bool{
+		return ipNetsContain(ipRanges, ip)
+	}
+	exempt = func(ip net.IP) bool{
+		return nodeIPs[ip.String()] || ipNetsContain(excludeIPRanges, ip)
+	}
+	return inRange, exempt
+}
+
+func conntrackProtocol(protocol uint8) string{
+	switch protocol{
+	case utilconntrack.ProtocolTCP:
+		return "TCP"
+	case utilconntrack.ProtocolUDP:
+		return "UDP"
+	case utilconntrack.ProtocolSCTP:
+		return "SCTP"
+	}
+	return ""
+}
+
+func cidrContains(cidr string, ip net.IP) bool{
+	_, ipNet, err := net.ParseCIDR(cidr)
+	return err == nil && ipNet.Contains(ip)
+}
+
+func cidrsContain(cidrs []string, ip net.IP) bool{
+	for _, cidr := range cidrs{
+		if cidrContains(cidr, ip){
+			return true
+		}
+	}
+	return false
+}
+
+func ipNetsContain(ipNets []*net.IPNet, ip net.IP) bool{
+	for _, ipNet := range ipNets{
+		if ipNet.Contains(ip){
+			return true
+		}
+	}
+	return false
+}
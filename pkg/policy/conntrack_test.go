@@ -0,0 +1,288 @@
+package policy
+
+import (
+	"k8s.io/apimachinery/pkg/types"
+	utilpolicy "enn-policy/pkg/policy/util"
+	utilconntrack "enn-policy/pkg/util/conntrack"
+	fakeconntrack "enn-policy/pkg/util/conntrack/testing"
+
+	"net"
+	"testing"
+)
+
+func makeConntrackPolicy() *EnnPolicy{
+
+	pod := func(ip, name string, labels map[string]string) *utilpolicy.PodInfo{
+		return &utilpolicy.PodInfo{IP: ip, Name: name, Namespace: "ns1", Labels: labels}
+	}
+	nginx := pod("10.244.1.10", "nginx", map[string]string{"run": "nginx"})
+	client := pod("10.244.1.11", "client", map[string]string{"role": "client"})
+	other := pod("10.244.1.12", "other", map[string]string{"role": "other"})
+
+	policy := &EnnPolicy{
+		flushConntrack:         true,
+		iPRanges:               []string{"10.244.0.0/16"},
+		excludeIPRanges:        []string{"10.244.255.0/24"},
+		unsupportedPolicy:      utilpolicy.UnsupportedPolicyModeBestEffort,
+		networkPolicyMap:       make(utilpolicy.NetworkPolicyMap),
+		podMatchLabelMap:       make(utilpolicy.PodMatchLabelMap),
+		namespaceMatchLabelMap: make(utilpolicy.NamespaceMatchLabelMap),
+		namespacePodMap:        utilpolicy.NamespacePodMap{
+			"ns1": utilpolicy.PodInfoMap{nginx.IP: nginx, client.IP: client, other.IP: other},
+		},
+		nodeInfoMap:            make(utilpolicy.NodeInfoMap),
+	}
+	policy.podMatchLabelMap[utilpolicy.NamespacedLabel{Namespace: "ns1", LabelKey: "role", LabelValue: "client"}] =
+		utilpolicy.PodInfoMap{client.IP: client}
+	policy.networkPolicyMap[types.NamespacedName{Namespace: "ns1", Name: "np1"}] = &utilpolicy.NetworkPolicyInfo{
+		Name:        "np1",
+		Namespace:   "ns1",
+		PodSelector: map[string]string{"run": "nginx"},
+		Ingress:     []utilpolicy.IngressRule{{
+			Ports:       []utilpolicy.PolicyPort{{Protocol: "TCP", Port: "80"}},
+			PodSelector: []utilpolicy.LabelSelector{{Label: map[string]string{"role": "client"}}},
+		}},
+		PolicyType:  []string{utilpolicy.TypeIngress},
+	}
+	return policy
+}
+
+func TestFlushRevokedConnections(t *testing.T){
+
+	clientToNginx := fakeconntrack.FlowFrom(utilconntrack.ProtocolTCP, "10.244.1.11", 40000, "10.244.1.10", 80)
+	clientToService := fakeconntrack.FlowWithDNAT(utilconntrack.ProtocolTCP, "10.244.1.11", 40001, "10.96.0.10", 8080, "10.244.1.10", 80)
+	otherToNginx := fakeconntrack.FlowFrom(utilconntrack.ProtocolTCP, "10.244.1.12", 40002, "10.244.1.10", 80)
+	clientToOther := fakeconntrack.FlowFrom(utilconntrack.ProtocolTCP, "10.244.1.11", 40003, "10.244.1.12", 80)
+	excludedToNginx := fakeconntrack.FlowFrom(utilconntrack.ProtocolTCP, "10.244.255.1", 40004, "10.244.1.10", 80)
+
+	policy := makeConntrackPolicy()
+	faker := fakeconntrack.NewFaker(clientToNginx, clientToService, otherToNginx, clientToOther, excludedToNginx)
+	policy.conntrackInterface = faker
+
+	// nothing is flushed in the first sync
+	policy.flushRevokedConnections()
+	if len(faker.Deleted) != 0 || policy.lastAccess == nil{
+		t.Fatalf("expected first sync to only save allowed traffic, deleted %v", faker.Deleted)
+	}
+
+	// nothing is flushed if allowed traffic is not changed
+	policy.flushRevokedConnections()
+	if len(faker.Deleted) != 0{
+		t.Errorf("expected no deleted flow without change, get %v", faker.Deleted)
+	}
+
+	// client is relabeled so it loses access to nginx
+	delete(policy.podMatchLabelMap, utilpolicy.NamespacedLabel{Namespace: "ns1", LabelKey: "role", LabelValue: "client"})
+	policy.flushRevokedConnections()
+	if len(faker.Deleted) != 2{
+		t.Fatalf("expected 2 deleted flows, get %v", faker.Deleted)
+	}
+	for i, expected := range []utilconntrack.Flow{clientToNginx, clientToService}{
+		if faker.Deleted[i].Orig.SrcPort != expected.Orig.SrcPort{
+			t.Errorf("expected deleted flow %s, get %s", expected.String(), faker.Deleted[i].String())
+		}
+	}
+	if len(faker.Flows) != 3{
+		t.Errorf("expected denied, unrestricted and excluded flows to be kept, get %v", faker.Flows)
+	}
+}
+
+func TestFlushRevokedConnectionsDisabled(t *testing.T){
+
+	policy := makeConntrackPolicy()
+	faker := fakeconntrack.NewFaker(fakeconntrack.FlowFrom(utilconntrack.ProtocolTCP, "10.244.1.11", 40000, "10.244.1.10", 80))
+	policy.conntrackInterface = faker
+	policy.flushRevokedConnections()
+
+	policy.flushConntrack = false
+	delete(policy.networkPolicyMap, types.NamespacedName{Namespace: "ns1", Name: "np1"})
+	policy.networkPolicyMap[types.NamespacedName{Namespace: "ns1", Name: "deny"}] = &utilpolicy.NetworkPolicyInfo{
+		Name:       "deny",
+		Namespace:  "ns1",
+		PolicyType: []string{utilpolicy.TypeIngress},
+	}
+	policy.flushRevokedConnections()
+	if len(faker.Deleted) != 0 || policy.lastAccess != nil{
+		t.Errorf("expected no deleted flow when flush conntrack is disabled, get %v", faker.Deleted)
+	}
+
+	// allowed traffic before flush conntrack is enabled again is unknown
+	policy.flushConntrack = true
+	policy.flushRevokedConnections()
+	if len(faker.Deleted) != 0{
+		t.Errorf("expected no deleted flow in the first sync after enabled, get %v", faker.Deleted)
+	}
+}
+
+func TestPolicyAccessAllows(t *testing.T){
+
+	policy := makeConntrackPolicy()
+	policy.networkPolicyMap[types.NamespacedName{Namespace: "ns1", Name: "egress"}] = &utilpolicy.NetworkPolicyInfo{
+		Name:        "egress",
+		Namespace:   "ns1",
+		PodSelector: map[string]string{"role": "client"},
+		Egress:      []utilpolicy.EgressRule{{
+			IPBlock: []utilpolicy.CIDRRange{{CIDR: "10.244.0.0/16", ExceptCIDR: []string{"10.244.1.12/32"}}},
+		}},
+		PolicyType:  []string{utilpolicy.TypeEgress},
+	}
+	access := policy.buildPolicyAccess()
+	inRange, _ := policy.conntrackScope()
+
+	testCases := []struct {
+		name     string
+		src      string
+		dst      string
+		protocol string
+		port     uint16
+		allowed  bool
+	}{
+		{"allowed by ingress and egress", "10.244.1.11", "10.244.1.10", "TCP", 80, true},
+		{"wrong port", "10.244.1.11", "10.244.1.10", "TCP", 443, false},
+		{"wrong protocol", "10.244.1.11", "10.244.1.10", "UDP", 80, false},
+		{"except cidr of egress", "10.244.1.11", "10.244.1.12", "TCP", 80, false},
+		{"target not isolated", "10.244.1.10", "10.244.1.12", "TCP", 80, true},
+		{"egress out of ipBlock", "10.244.1.11", "192.168.1.1", "TCP", 80, false},
+	}
+	for _, testCase := range testCases{
+		allowed := access.allows(net.ParseIP(testCase.src).To4(), net.ParseIP(testCase.dst).To4(), testCase.protocol, testCase.port, inRange)
+		if allowed != testCase.allowed{
+			t.Errorf("%s: expected allowed %v, get %v", testCase.name, testCase.allowed, allowed)
+		}
+	}
+}
+
+func TestFlushRevokedConnectionsOfAdminTiers(t *testing.T){
+
+	clientToNginx := fakeconntrack.FlowFrom(utilconntrack.ProtocolTCP, "10.244.1.11", 40000, "10.244.1.10", 80)
+	otherToNginx := fakeconntrack.FlowFrom(utilconntrack.ProtocolTCP, "10.244.1.12", 40001, "10.244.1.10", 80)
+	otherToClient := fakeconntrack.FlowFrom(utilconntrack.ProtocolTCP, "10.244.1.12", 40002, "10.244.1.11", 8080)
+
+	policy := makeConntrackPolicy()
+	policy.namespaceInfoMap = utilpolicy.NamespaceInfoMap{"ns1": &utilpolicy.NamespaceInfo{Name: "ns1"}}
+	policy.adminNetworkPolicyMap = make(utilpolicy.AdminNetworkPolicyMap)
+	policy.baselineAdminNetworkPolicyMap = make(utilpolicy.AdminNetworkPolicyMap)
+	faker := fakeconntrack.NewFaker(clientToNginx, otherToNginx, otherToClient)
+	policy.conntrackInterface = faker
+
+	nginx := utilpolicy.AdminSelector{PodSelector: map[string]string{"run": "nginx"}}
+	fromPods := func(labels map[string]string) []utilpolicy.AdminPeer{
+		return []utilpolicy.AdminPeer{{Pods: &utilpolicy.AdminSelector{PodSelector: labels}}}
+	}
+	// other is allowed to nginx by an AdminNetworkPolicy although np1 does not allow it
+	policy.adminNetworkPolicyMap["allow-other"] = &utilpolicy.AdminNetworkPolicyInfo{
+		Name: "allow-other", Priority: 10, Subject: nginx,
+		Ingress: []utilpolicy.AdminRule{{Action: utilpolicy.AdminPolicyActionAllow, Peers: fromPods(map[string]string{"role": "other"})}},
+	}
+	policy.flushRevokedConnections()
+
+	// a new AdminNetworkPolicy Deny revokes connections which are allowed by np1
+	policy.adminNetworkPolicyMap["deny-client"] = &utilpolicy.AdminNetworkPolicyInfo{
+		Name: "deny-client", Priority: 20, Subject: nginx,
+		Ingress: []utilpolicy.AdminRule{{Action: utilpolicy.AdminPolicyActionDeny, Peers: fromPods(map[string]string{"role": "client"}),
+			Ports: []utilpolicy.PolicyPort{{Protocol: "TCP", Port: "79:81"}}}},
+	}
+	policy.flushRevokedConnections()
+	if len(faker.Deleted) != 1 || faker.Deleted[0].Orig.SrcPort != clientToNginx.Orig.SrcPort{
+		t.Fatalf("expected flow %s to be deleted, get %v", clientToNginx.String(), faker.Deleted)
+	}
+
+	// removing the Allow leaves the connection to np1, which denies it
+	delete(policy.adminNetworkPolicyMap, "allow-other")
+	policy.flushRevokedConnections()
+	if len(faker.Deleted) != 2 || faker.Deleted[1].Orig.SrcPort != otherToNginx.Orig.SrcPort{
+		t.Fatalf("expected flow %s to be deleted, get %v", otherToNginx.String(), faker.Deleted)
+	}
+
+	// a BaselineAdminNetworkPolicy Deny revokes connections of pods which are not isolated by NetworkPolicies
+	policy.baselineAdminNetworkPolicyMap["default"] = &utilpolicy.AdminNetworkPolicyInfo{
+		Name: "default", Baseline: true, Subject: utilpolicy.AdminSelector{},
+		Ingress: []utilpolicy.AdminRule{{Action: utilpolicy.AdminPolicyActionDeny, Peers: fromPods(nil)}},
+	}
+	policy.flushRevokedConnections()
+	if len(faker.Deleted) != 3 || faker.Deleted[2].Orig.SrcPort != otherToClient.Orig.SrcPort{
+		t.Fatalf("expected flow %s to be deleted, get %v", otherToClient.String(), faker.Deleted)
+	}
+}
+
+func TestFlushRevokedConnectionsOfEgressFQDNsAndServices(t *testing.T){
+
+	clientToName := fakeconntrack.FlowFrom(utilconntrack.ProtocolTCP, "10.244.1.11", 40000, "203.0.113.10", 443)
+	clientToOtherPort := fakeconntrack.FlowFrom(utilconntrack.ProtocolTCP, "10.244.1.11", 40001, "203.0.113.10", 80)
+	clientToService := fakeconntrack.FlowWithDNAT(utilconntrack.ProtocolTCP, "10.244.1.11", 40002, "10.96.0.20", 5432, "10.244.1.12", 5432)
+	clientToOtherPod := fakeconntrack.FlowFrom(utilconntrack.ProtocolTCP, "10.244.1.11", 40003, "10.244.1.12", 80)
+
+	db := types.NamespacedName{Namespace: "ns1", Name: "db"}
+	dbPort := utilpolicy.PolicyPort{Protocol: "TCP", Port: "5432"}
+	policy := makeConntrackPolicy()
+	policy.egressServices = true
+	policy.serviceInfoMap = utilpolicy.ServiceInfoMap{db: &utilpolicy.ServiceInfo{Namespace: "ns1", Name: "db", ClusterIP: "10.96.0.20",
+		Ports: []utilpolicy.PolicyPort{dbPort}}}
+	policy.endpointsInfoMap = utilpolicy.EndpointsInfoMap{db: &utilpolicy.EndpointsInfo{Namespace: "ns1", Name: "db",
+		Endpoints: []utilpolicy.ServiceEndpoint{{IP: "10.244.1.12", Port: dbPort}}}}
+	faker := fakeconntrack.NewFaker(clientToName, clientToOtherPort, clientToService, clientToOtherPod)
+	policy.conntrackInterface = faker
+	policy.flushRevokedConnections()
+
+	// egress of client is only allowed to a name, whose ips are not known by the snapshot, and to the endpoints of a service
+	policy.networkPolicyMap[types.NamespacedName{Namespace: "ns1", Name: "egress"}] = &utilpolicy.NetworkPolicyInfo{
+		Name:           "egress",
+		Namespace:      "ns1",
+		PodSelector:    map[string]string{"role": "client"},
+		EgressFQDNs:    []utilpolicy.FQDNRule{{Name: "api.example.com", Ports: []utilpolicy.PolicyPort{{Protocol: "TCP", Port: "443"}}}},
+		EgressServices: []utilpolicy.ServiceRef{{Name: "db"}},
+		PolicyType:     []string{utilpolicy.TypeEgress},
+	}
+	policy.flushRevokedConnections()
+	if len(faker.Deleted) != 2 || faker.Deleted[0].Orig.SrcPort != clientToOtherPort.Orig.SrcPort ||
+		faker.Deleted[1].Orig.SrcPort != clientToOtherPod.Orig.SrcPort{
+		t.Fatalf("expected flows %s and %s to be deleted, get %v", clientToOtherPort.String(), clientToOtherPod.String(), faker.Deleted)
+	}
+
+	// EgressServices allow nothing if services are not watched
+	policy.egressServices = false
+	policy.flushRevokedConnections()
+	if len(faker.Deleted) != 3 || faker.Deleted[2].Orig.SrcPort != clientToService.Orig.SrcPort{
+		t.Fatalf("expected flow %s to be deleted, get %v", clientToService.String(), faker.Deleted)
+	}
+}
+
+func TestFlushRevokedConnectionsOfPriorityRules(t *testing.T){
+
+	clientToNginx := fakeconntrack.FlowFrom(utilconntrack.ProtocolTCP, "10.244.1.11", 40000, "10.244.1.10", 80)
+	otherToNginx := fakeconntrack.FlowFrom(utilconntrack.ProtocolTCP, "10.244.1.12", 40001, "10.244.1.10", 80)
+	otherToClient := fakeconntrack.FlowFrom(utilconntrack.ProtocolTCP, "10.244.1.12", 40002, "10.244.1.11", 8080)
+
+	policy := makeConntrackPolicy()
+	policy.namespaceInfoMap = utilpolicy.NamespaceInfoMap{"ns1": &utilpolicy.NamespaceInfo{Name: "ns1"}}
+	faker := fakeconntrack.NewFaker(clientToNginx, otherToNginx, otherToClient)
+	policy.conntrackInterface = faker
+
+	// other is allowed to nginx by an explicit rule although np1 does not allow it
+	allowOther := utilpolicy.ExplicitRule{Action: utilpolicy.ExplicitRuleActionAllow, Priority: 100, Direction: utilpolicy.TypeIngress,
+		IPBlock: []utilpolicy.CIDRRange{{CIDR: "10.244.1.12/32"}}}
+	denyClient := utilpolicy.ExplicitRule{Action: utilpolicy.ExplicitRuleActionDeny, Priority: 50, Direction: utilpolicy.TypeIngress,
+		IPBlock: []utilpolicy.CIDRRange{{CIDR: "10.244.1.0/24", ExceptCIDR: []string{"10.244.1.12/32"}}}}
+	guardrails := &utilpolicy.NetworkPolicyInfo{
+		Name:          "global:guardrails",
+		Namespace:     "ns1",
+		PodSelector:   map[string]string{"run": "nginx"},
+		ExplicitRules: []utilpolicy.ExplicitRule{allowOther},
+	}
+	policy.networkPolicyMap[types.NamespacedName{Namespace: "ns1", Name: "global:guardrails"}] = guardrails
+	policy.flushRevokedConnections()
+
+	// a Deny rule with higher priority revokes connections which are allowed by np1
+	guardrails.ExplicitRules = []utilpolicy.ExplicitRule{allowOther, denyClient}
+	policy.flushRevokedConnections()
+	if len(faker.Deleted) != 1 || faker.Deleted[0].Orig.SrcPort != clientToNginx.Orig.SrcPort{
+		t.Fatalf("expected flow %s to be deleted, get %v", clientToNginx.String(), faker.Deleted)
+	}
+
+	// removing the Allow leaves the connection to np1, which denies it
+	guardrails.ExplicitRules = []utilpolicy.ExplicitRule{denyClient}
+	policy.flushRevokedConnections()
+	if len(faker.Deleted) != 2 || faker.Deleted[1].Orig.SrcPort != otherToNginx.Orig.SrcPort{
+		t.Fatalf("expected flow %s to be deleted, get %v", otherToNginx.String(), faker.Deleted)
+	}
+}
@@ -0,0 +1,208 @@
+package policy
+
+import (
+	"github.com/golang/glog"
+	utilpolicy "enn-policy/pkg/policy/util"
+	utiliptables "enn-policy/pkg/util/k8siptables"
+
+	"bytes"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// policyCountersPeriod is how often counters of rules are read when no sync happens
+const policyCountersPeriod = 30 * time.Second
+
+// policyCounterOwner is the NetworkPolicy whose rules are in a chain,
+// policy is empty for ENN-PLY-* chains of a namespace, whose default deny rule does not belong to any policy
+type policyCounterOwner struct {
+	namespace string
+	policy    string
+	direction string
+}
+
+type ruleCounter struct {
+	packets uint64
+	bytes   uint64
+}
+
+// policyCounters turns counters of rules into the monotonic metrics enn_policy_packets_total and enn_policy_bytes_total,
+// counters of rules start from 0 again after each iptables-restore, so only the increase since the last read is added
+type policyCounters struct {
+	// last stores counters of each rule read last time, keyed by the rule without counters
+	last map[string]ruleCounter
+}
+
+func newPolicyCounters() *policyCounters{
+	return &policyCounters{
+		last: make(map[string]ruleCounter),
+	}
+}
+
+// reset is called after iptables-restore, when counters of all rules start from 0
+func (counters *policyCounters) reset(){
+	counters.last = make(map[string]ruleCounter)
+}
+
+// indexPolicyChain records networkPolicy as the owner of dispatch or ipBlock chain,
+// so counters of rules in the chain are attributed to it
+func (policy *EnnPolicy) indexPolicyChain(chain utiliptables.Chain, networkPolicy *utilpolicy.NetworkPolicyInfo, ruleType int){
+	direction := flowDirectionIngress
+	if ruleType == TYPE_EGRESS{
+		direction = flowDirectionEgress
+	}
+	if networkPolicy.HostEndpoint{
+		direction = "H" + direction
+	}
+	policy.policyChainOwners[chain] = policyCounterOwner{
+		namespace: networkPolicy.Namespace,
+		policy:    networkPolicy.Name,
+		direction: flowDirectionNames[direction],
+	}
+}
+
+// collectPolicyCounters reads counters of rules in save, the output of iptables-save -c -t filter, e.g
+// [10:600] -A ENN-DPATCH-XXXX -m set --match-set ENN-PODSELECTOR-XXXX src -j ACCEPT
+// ACCEPT rules of dispatch and ipBlock chains are counted as allowed traffic of their policy,
+// REJECT and DROP rules as denied traffic of their policy, or of the namespace for ENN-PLY-* chains,
+// ACCEPT rules of audit mode are counted as audit hits in enn_policy_audit_hits_total
+// chains are attributed by the index of the sync which wrote them, so it must be called before the index is rebuilt
+func (policy *EnnPolicy) collectPolicyCounters(save []byte){
+
+	if policy.policyCounters == nil{
+		return
+	}
+	current := make(map[string]ruleCounter)
+	owners := make(map[string]policyCounterOwner)
+	actions := make(map[string]string)
+	for _, line := range strings.Split(string(save), "\n"){
+		counter, rule, ok := parseRuleCounter(line)
+		if !ok{
+			continue
+		}
+		fields := strings.Fields(rule)
+		if len(fields) < 2 || fields[0] != "-A"{
+			continue
+		}
+		chain := utiliptables.Chain(fields[1])
+		action := ruleAction(fields)
+		owner, ok := policy.policyChainOwners[chain]
+		if auditOwner, isAudit := policy.auditRuleOwners[rule]; isAudit{
+			owner, ok, action = auditOwner, true, ruleActionAudit
+		}
+		if !ok{
+			namespace, isPolicyChain := policy.policyChainNamespaces[chain]
+			// ACCEPT rules of ENN-PLY-* chains are RELATED,ESTABLISHED traffic or audit mode, not allowed by a policy
+			if !isPolicyChain || action != "denied"{
+				continue
+			}
+			owner = policyCounterOwner{namespace: namespace, direction: flowDirectionNames[chainFlowDirection(string(chain))]}
+		}
+		if action == ""{
+			continue
+		}
+		sum := current[rule]
+		sum.packets += counter.packets
+		sum.bytes += counter.bytes
+		current[rule] = sum
+		owners[rule] = owner
+		actions[rule] = action
+	}
+
+	for rule, counter := range current{
+		last, ok := policy.policyCounters.last[rule]
+		delta := counter
+		// counters smaller than last time mean the rule is restored again
+		if ok && counter.packets >= last.packets && counter.bytes >= last.bytes{
+			delta = ruleCounter{packets: counter.packets - last.packets, bytes: counter.bytes - last.bytes}
+		}
+		if delta.packets == 0 && delta.bytes == 0{
+			continue
+		}
+		owner := owners[rule]
+		if actions[rule] == ruleActionAudit{
+			auditHits.Add(float64(delta.packets), owner.namespace, owner.policy, owner.direction)
+			continue
+		}
+		policyPackets.Add(float64(delta.packets), owner.namespace, owner.policy, owner.direction, actions[rule])
+		policyBytes.Add(float64(delta.bytes), owner.namespace, owner.policy, owner.direction, actions[rule])
+	}
+	policy.policyCounters.last = current
+}
+
+// parseRuleCounter splits a rule of iptables-save -c into its counters and the rule
+func parseRuleCounter(line string) (counter ruleCounter, rule string, ok bool){
+	if !strings.HasPrefix(line, "["){
+		return counter, "", false
+	}
+	end := strings.Index(line, "]")
+	if end < 0{
+		return counter, "", false
+	}
+	values := strings.Split(line[1:end], ":")
+	if len(values) != 2{
+		return counter, "", false
+	}
+	var err error
+	if counter.packets, err = strconv.ParseUint(values[0], 10, 64); err != nil{
+		return counter, "", false
+	}
+	if counter.bytes, err = strconv.ParseUint(values[1], 10, 64); err != nil{
+		return counter, "", false
+	}
+	return counter, strings.TrimSpace(line[end+1:]), true
+}
+
+// ruleActionAudit is the action of ACCEPT rules of audit mode, they are not counted in enn_policy_packets_total
+const ruleActionAudit = "audit"
+
+// ruleAction returns allowed for ACCEPT rules, denied for REJECT and DROP rules, empty for other rules
+func ruleAction(fields []string) string{
+	for i := len(fields) - 2; i >= 0; i--{
+		if fields[i] != "-j"{
+			continue
+		}
+		switch fields[i+1]{
+		case "ACCEPT":
+			return "allowed"
+		case "REJECT", "DROP":
+			return "denied"
+		}
+		return ""
+	}
+	return ""
+}
+
+// savePolicyCounters reads counters of rules from iptables, it is called with policy.mu held
+func (policy *EnnPolicy) savePolicyCounters(){
+	iptablesData := bytes.NewBuffer(nil)
+	if err := policy.k8siptablesInterface.SaveCountersInto(utiliptables.TableFilter, iptablesData); err != nil{
+		glog.Errorf("failed to read counters of policy rules: %v", err)
+		return
+	}
+	policy.collectPolicyCounters(iptablesData.Bytes())
+}
+
+// RunPolicyCounters reads counters of rules every policyCountersPeriod until stopCh is closed,
+// it does nothing if metrics are disabled
+func (policy *EnnPolicy) RunPolicyCounters(stopCh <-chan struct{}, wg *sync.WaitGroup){
+
+	defer wg.Done()
+	if policy.policyCounters == nil{
+		return
+	}
+	t := time.NewTicker(policyCountersPeriod)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			policy.mu.Lock()
+			policy.savePolicyCounters()
+			policy.mu.Unlock()
+		case <-stopCh:
+			return
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package policy
+
+import (
+	utiliptables "enn-policy/pkg/util/k8siptables"
+	"enn-policy/pkg/util/metrics"
+
+	"strings"
+	"testing"
+)
+
+func TestParseRuleCounter(t *testing.T){
+
+	counter, rule, ok := parseRuleCounter("[10:600] -A ENN-DPATCH-X -j ACCEPT")
+	if !ok || counter.packets != 10 || counter.bytes != 600 || rule != "-A ENN-DPATCH-X -j ACCEPT"{
+		t.Errorf("unexpected counter %+v rule %s ok %v", counter, rule, ok)
+	}
+	for _, line := range []string{":ENN-DPATCH-X - [0:0]", "[10] -A ENN-DPATCH-X -j ACCEPT", "[a:b] -A ENN-DPATCH-X -j ACCEPT", "COMMIT"}{
+		if _, _, ok := parseRuleCounter(line); ok{
+			t.Errorf("expected line %s to be ignored", line)
+		}
+	}
+}
+
+func TestCollectPolicyCounters(t *testing.T){
+
+	policyPackets.Reset()
+	policyBytes.Reset()
+	policy := &EnnPolicy{
+		policyCounters: newPolicyCounters(),
+		policyChainOwners: map[utiliptables.Chain]policyCounterOwner{
+			"ENN-DPATCH-WEB": {namespace: "payment", policy: "web", direction: "ingress"},
+			"ENN-IPCIDR-WEB": {namespace: "payment", policy: "web", direction: "egress"},
+		},
+		policyChainNamespaces: map[utiliptables.Chain]string{
+			"ENN-PLY-IN-PAYMENT": "payment",
+		},
+	}
+
+	save := `*filter
+:ENN-DPATCH-WEB - [0:0]
+[10:600] -A ENN-DPATCH-WEB -m set --match-set ENN-PODSELECTOR-X src -j ACCEPT
+[5:300] -A ENN-IPCIDR-WEB -d 10.0.0.0/8 -j REJECT
+[2:120] -A ENN-IPCIDR-WEB -d 10.0.0.0/16 -j ACCEPT
+[7:420] -A ENN-PLY-IN-PAYMENT -m conntrack --ctstate RELATED,ESTABLISHED -j ACCEPT
+[3:180] -A ENN-PLY-IN-PAYMENT -j ENN-DPATCH-WEB
+[4:240] -A ENN-PLY-IN-PAYMENT -j REJECT
+[9:540] -A ENN-INGRESS -j ENN-PLY-IN-PAYMENT
+COMMIT
+`
+	policy.collectPolicyCounters([]byte(save))
+	// only the increase since the last read is added
+	policy.collectPolicyCounters([]byte(strings.Replace(save, "[10:600]", "[15:900]", 1)))
+	// counters are read again after iptables-restore
+	policy.policyCounters.reset()
+	policy.collectPolicyCounters([]byte(strings.Replace(save, "[4:240]", "[1:60]", 1)))
+
+	registry := &metrics.Registry{}
+	registry.MustRegister(policyPackets, policyBytes)
+	output := string(registry.Gather())
+	for _, expected := range []string{
+		`enn_policy_packets_total{namespace="payment",policy="web",direction="ingress",action="allowed"} 25`,
+		`enn_policy_bytes_total{namespace="payment",policy="web",direction="ingress",action="allowed"} 1500`,
+		`enn_policy_packets_total{namespace="payment",policy="web",direction="egress",action="denied"} 10`,
+		`enn_policy_packets_total{namespace="payment",policy="web",direction="egress",action="allowed"} 4`,
+		`enn_policy_packets_total{namespace="payment",policy="",direction="ingress",action="denied"} 5`,
+		`enn_policy_bytes_total{namespace="payment",policy="",direction="ingress",action="denied"} 300`,
+	}{
+		if !strings.Contains(output, expected){
+			t.Errorf("expected %s in metrics:\n%s", expected, output)
+		}
+	}
+	if strings.Contains(output, `policy="",direction="ingress",action="allowed"`){
+		t.Errorf("expected ACCEPT rules of ENN-PLY-* chains not to be counted:\n%s", output)
+	}
+}
@@ -0,0 +1,115 @@
+package policy
+
+import (
+	"github.com/golang/glog"
+	utilpolicy "enn-policy/pkg/policy/util"
+
+	"reflect"
+	"strings"
+)
+
+const (
+	// denyLogPrefix is the prefix of kernel log of denied traffic, iptables LOG allows at most 29 characters
+	denyLogPrefix = `"ENN-POLICY-DENY: "`
+	// denyLogLimit limits kernel log of each deny rule so a flood of denied traffic does not flood the log
+	denyLogLimit  = "10/min"
+)
+
+// denyActionMode returns how traffic denied by policies of namespace is handled,
+// annotation enn-policy/deny-action of namespace overrides --deny-action
+func (policy *EnnPolicy) denyActionMode(namespace string) string{
+
+	if namespaceInfo, ok := policy.namespaceInfoMap[namespace]; ok && namespaceInfo.DenyAction != ""{
+		if utilpolicy.IsValidDenyAction(namespaceInfo.DenyAction){
+			return namespaceInfo.DenyAction
+		}
+		glog.V(2).Infof("namespace %s has invalid annotation %s=%q, use default %s",
+			namespace, utilpolicy.DenyActionAnnotation, namespaceInfo.DenyAction, policy.denyAction)
+	}
+	if utilpolicy.IsValidDenyAction(policy.denyAction){
+		return policy.denyAction
+	}
+	return utilpolicy.DenyActionReject
+}
+
+// denyRules returns the rules which deny traffic in chain, match selects the traffic to deny, e.g
+// reject:                  -A chain [match] -j REJECT
+// reject-tcp-reset:        -A chain [match] -p tcp -j REJECT --reject-with tcp-reset
+//                          -A chain [match] -j REJECT
+// reject-admin-prohibited: -A chain [match] -j REJECT --reject-with icmp-admin-prohibited
+// drop:                    -A chain [match] -j DROP
+// log-reject and log-drop add a rate limited LOG rule before reject and drop
+func denyRules(action string, chain string, comment string, match ...string) [][]string{
+
+	rule := func(args ...string) []string{
+		line := []string{"-A", chain, "-m", "comment", "--comment", comment}
+		line = append(line, match...)
+		return append(line, args...)
+	}
+
+	var rules [][]string
+	if action == utilpolicy.DenyActionLogReject || action == utilpolicy.DenyActionLogDrop{
+		rules = append(rules, rule("-m", "limit", "--limit", denyLogLimit, "-j", "LOG", "--log-prefix", denyLogPrefix))
+	}
+	switch action{
+	case utilpolicy.DenyActionDrop, utilpolicy.DenyActionLogDrop:
+		rules = append(rules, rule("-j", "DROP"))
+	case utilpolicy.DenyActionRejectTCPReset:
+		rules = append(rules, rule("-p", "tcp", "-j", "REJECT", "--reject-with", "tcp-reset"))
+		rules = append(rules, rule("-j", "REJECT"))
+	case utilpolicy.DenyActionRejectAdminProhibited:
+		rules = append(rules, rule("-j", "REJECT", "--reject-with", "icmp-admin-prohibited"))
+	default:
+		rules = append(rules, rule("-j", "REJECT"))
+	}
+	return rules
+}
+
+// writeDenyRules writes the terminal rules of traffic which is not allowed by policies of namespace into filterRules,
+// they are denyRules of the deny action of namespace, or auditRules if namespace is in audit mode
+// if flow log is enabled, the traffic is sent to the NFLOG group first, with the prefix of direction and policyName
+// ACCEPT rules of audit mode are indexed by auditRuleOwners, so their counters are exported as enn_policy_audit_hits_total
+func (policy *EnnPolicy) writeDenyRules(namespace string, chain string, direction string, policyName string, comment string, match ...string){
+	audit := policy.policyMode(namespace) == utilpolicy.PolicyModeAudit
+	tag := flowLogTagDeny
+	if audit{
+		tag = flowLogTagAudit
+	}
+	if rule := policy.flowLogRule(chain, policy.flowLogPrefix(tag, direction, namespace, policyName), comment, match...); rule != nil{
+		writeLine(policy.filterRules, rule...)
+	}
+	rules := denyRules(policy.denyActionMode(namespace), chain, comment, match...)
+	if audit{
+		rules = auditRules(policy.flowLog == nil, chain, comment, match...)
+		if policy.auditRuleOwners != nil{
+			owner := policyCounterOwner{namespace: namespace, direction: flowDirectionNames[direction]}
+			if policyName != flowLogDefaultPolicy{
+				owner.policy = policyName
+			}
+			policy.auditRuleOwners[strings.Join(rules[len(rules)-1], " ")] = owner
+		}
+	}
+	for _, rule := range rules{
+		writeLine(policy.filterRules, rule...)
+	}
+}
+
+// namespaceRulesChanged returns true if annotation enn-policy/deny-action, enn-policy/policy-mode or
+// net.beta.kubernetes.io/network-policy of a namespace in changes is changed, terminal rules of ENN-PLY-* chains
+// and default deny policies depend on them, so rules need to be rebuilt
+func namespaceRulesChanged(changes *utilpolicy.NamespaceChangeMap) bool{
+	for _, change := range changes.Items{
+		var previous, current utilpolicy.NamespaceInfo
+		if change.Previous != nil{
+			previous = *change.Previous
+		}
+		if change.Current != nil{
+			current = *change.Current
+		}
+		if previous.DenyAction != current.DenyAction || previous.PolicyMode != current.PolicyMode ||
+			!reflect.DeepEqual(previous.DefaultDeny, current.DefaultDeny){
+			return true
+		}
+	}
+	return false
+}
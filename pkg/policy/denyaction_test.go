@@ -0,0 +1,114 @@
+package policy
+
+import (
+	"k8s.io/apimachinery/pkg/types"
+	utilpolicy "enn-policy/pkg/policy/util"
+
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDenyRules(t *testing.T){
+
+	match := []string{"-m", "set", "--match-set", "ENN-EXCEPT", "dst"}
+	testCases := []struct {
+		action   string
+		expected []string
+	}{
+		{utilpolicy.DenyActionReject, []string{
+			`-A ENN-PLY-E-X -m comment --comment "deny" -m set --match-set ENN-EXCEPT dst -j REJECT`,
+		}},
+		{utilpolicy.DenyActionRejectTCPReset, []string{
+			`-A ENN-PLY-E-X -m comment --comment "deny" -m set --match-set ENN-EXCEPT dst -p tcp -j REJECT --reject-with tcp-reset`,
+			`-A ENN-PLY-E-X -m comment --comment "deny" -m set --match-set ENN-EXCEPT dst -j REJECT`,
+		}},
+		{utilpolicy.DenyActionRejectAdminProhibited, []string{
+			`-A ENN-PLY-E-X -m comment --comment "deny" -m set --match-set ENN-EXCEPT dst -j REJECT --reject-with icmp-admin-prohibited`,
+		}},
+		{utilpolicy.DenyActionDrop, []string{
+			`-A ENN-PLY-E-X -m comment --comment "deny" -m set --match-set ENN-EXCEPT dst -j DROP`,
+		}},
+		{utilpolicy.DenyActionLogReject, []string{
+			`-A ENN-PLY-E-X -m comment --comment "deny" -m set --match-set ENN-EXCEPT dst -m limit --limit 10/min -j LOG --log-prefix "ENN-POLICY-DENY: "`,
+			`-A ENN-PLY-E-X -m comment --comment "deny" -m set --match-set ENN-EXCEPT dst -j REJECT`,
+		}},
+		{utilpolicy.DenyActionLogDrop, []string{
+			`-A ENN-PLY-E-X -m comment --comment "deny" -m set --match-set ENN-EXCEPT dst -m limit --limit 10/min -j LOG --log-prefix "ENN-POLICY-DENY: "`,
+			`-A ENN-PLY-E-X -m comment --comment "deny" -m set --match-set ENN-EXCEPT dst -j DROP`,
+		}},
+	}
+	for _, testCase := range testCases{
+		var rules []string
+		for _, rule := range denyRules(testCase.action, "ENN-PLY-E-X", `"deny"`, match...){
+			rules = append(rules, strings.Join(rule, " "))
+		}
+		if !reflect.DeepEqual(rules, testCase.expected){
+			t.Errorf("%s: expected rules %v, get %v", testCase.action, testCase.expected, rules)
+		}
+	}
+}
+
+func TestDenyActionMode(t *testing.T){
+
+	policy := &EnnPolicy{
+		denyAction:       utilpolicy.DenyActionRejectTCPReset,
+		namespaceInfoMap: utilpolicy.NamespaceInfoMap{
+			"payment": &utilpolicy.NamespaceInfo{Name: "payment", DenyAction: utilpolicy.DenyActionLogDrop},
+			"invalid": &utilpolicy.NamespaceInfo{Name: "invalid", DenyAction: "accept"},
+			"default": &utilpolicy.NamespaceInfo{Name: "default"},
+		},
+	}
+	for namespace, expected := range map[string]string{
+		"payment": utilpolicy.DenyActionLogDrop,
+		"invalid": utilpolicy.DenyActionRejectTCPReset,
+		"default": utilpolicy.DenyActionRejectTCPReset,
+		"unknown": utilpolicy.DenyActionRejectTCPReset,
+	}{
+		if action := policy.denyActionMode(namespace); action != expected{
+			t.Errorf("namespace %s: expected deny action %s, get %s", namespace, expected, action)
+		}
+	}
+
+	policy.denyAction = ""
+	if action := policy.denyActionMode("default"); action != utilpolicy.DenyActionReject{
+		t.Errorf("expected deny action reject without default, get %s", action)
+	}
+}
+
+func TestNamespaceRulesChanged(t *testing.T){
+
+	changes := utilpolicy.NewNamespaceChangeMap()
+	key := types.NamespacedName{Name: "payment"}
+	changes.Items[key] = &utilpolicy.NamespaceChange{
+		Previous: &utilpolicy.NamespaceInfo{Name: "payment", Labels: map[string]string{"app": "payment"}},
+		Current:  &utilpolicy.NamespaceInfo{Name: "payment"},
+	}
+	if namespaceRulesChanged(&changes){
+		t.Errorf("expected label change not to change deny action")
+	}
+	changes.Items[key].Current.DenyAction = utilpolicy.DenyActionDrop
+	if !namespaceRulesChanged(&changes){
+		t.Errorf("expected annotation change to change deny action")
+	}
+	changes.Items[key] = &utilpolicy.NamespaceChange{
+		Current: &utilpolicy.NamespaceInfo{Name: "payment", DenyAction: utilpolicy.DenyActionDrop},
+	}
+	if !namespaceRulesChanged(&changes){
+		t.Errorf("expected new namespace with annotation to change deny action")
+	}
+	changes.Items[key] = &utilpolicy.NamespaceChange{
+		Previous: &utilpolicy.NamespaceInfo{Name: "payment"},
+		Current:  &utilpolicy.NamespaceInfo{Name: "payment", PolicyMode: utilpolicy.PolicyModeAudit},
+	}
+	if !namespaceRulesChanged(&changes){
+		t.Errorf("expected annotation change to change policy mode")
+	}
+	changes.Items[key] = &utilpolicy.NamespaceChange{
+		Previous: &utilpolicy.NamespaceInfo{Name: "payment"},
+		Current:  &utilpolicy.NamespaceInfo{Name: "payment", DefaultDeny: []string{utilpolicy.TypeIngress}},
+	}
+	if !namespaceRulesChanged(&changes){
+		t.Errorf("expected annotation change to change default deny")
+	}
+}
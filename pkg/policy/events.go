@@ -0,0 +1,222 @@
+package policy
+
+import (
+	api "k8s.io/api/core/v1"
+	globalApi "enn-policy/pkg/apis/networking/v1alpha1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/flowcontrol"
+	"github.com/golang/glog"
+	utilpolicy "enn-policy/pkg/policy/util"
+
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	EventReasonPolicyApplied     = "PolicyApplied"
+	EventReasonPolicyApplyFailed = "PolicyApplyFailed"
+	EventReasonUnsupportedField  = "UnsupportedField"
+)
+
+// policyEventRecorder records Kubernetes Events for results of syncPolicyRules,
+// events are only recorded when the result of a networkPolicy or node changes, e.g
+// PolicyApplyFailed when a policy fails or fails with another error, PolicyApplied when a failed policy is applied again,
+// so a healthy cluster does not send an event for each policy on each node
+// events are also limited by a token bucket so thousands of nodes do not flood the apiserver
+// all methods can be called with nil recorder, e.g in FakePolicy, and do nothing
+type policyEventRecorder struct {
+	recorder      record.EventRecorder
+	limiter       flowcontrol.RateLimiter
+	nodeRef       *api.ObjectReference
+
+	// errors stores errors of each networkPolicy in the current sync,
+	// errors of networkPolicies rendered from a GlobalNetworkPolicy are stored by the key of globalPolicyEventKey
+	errors        map[types.NamespacedName][]string
+	// status stores the last recorded error of each networkPolicy or GlobalNetworkPolicy, empty means applied
+	status        map[types.NamespacedName]string
+	// unsupported stores the last recorded unsupported message of each networkPolicy
+	unsupported   map[types.NamespacedName]string
+	// nodeError stores the last recorded error of iptables-restore
+	nodeError     string
+}
+
+// newPolicyEventRecorder returns nil if recorder is nil,
+// eventQPS <= 0 means events are not limited
+func newPolicyEventRecorder(recorder record.EventRecorder, hostName string, eventQPS float32, eventBurst int) *policyEventRecorder{
+
+	if recorder == nil{
+		return nil
+	}
+	var limiter flowcontrol.RateLimiter
+	if eventQPS > 0{
+		limiter = flowcontrol.NewTokenBucketRateLimiter(eventQPS, eventBurst)
+	}
+	return &policyEventRecorder{
+		recorder:    recorder,
+		limiter:     limiter,
+		// node events use node name as uid, just like kubelet and kube-proxy
+		nodeRef:     &api.ObjectReference{
+			Kind:      "Node",
+			Name:      hostName,
+			UID:       types.UID(hostName),
+			Namespace: "",
+		},
+		errors:      make(map[types.NamespacedName][]string),
+		status:      make(map[types.NamespacedName]string),
+		unsupported: make(map[types.NamespacedName]string),
+	}
+}
+
+func networkPolicyRef(networkPolicy *utilpolicy.NetworkPolicyInfo) *api.ObjectReference{
+	return &api.ObjectReference{
+		Kind:       "NetworkPolicy",
+		APIVersion: "networking.k8s.io/v1",
+		Namespace:  networkPolicy.Namespace,
+		Name:       networkPolicy.Name,
+		UID:        networkPolicy.UID,
+	}
+}
+
+func globalNetworkPolicyRef(globalNetworkPolicy *utilpolicy.GlobalNetworkPolicyInfo) *api.ObjectReference{
+	return &api.ObjectReference{
+		Kind:       "GlobalNetworkPolicy",
+		APIVersion: globalApi.SchemeGroupVersion.String(),
+		Name:       globalNetworkPolicy.Name,
+		UID:        globalNetworkPolicy.UID,
+	}
+}
+
+// globalPolicyEventKey is the key of errors and status of a GlobalNetworkPolicy,
+// it has no namespace, so it never conflicts with a NetworkPolicy
+func globalPolicyEventKey(name string) types.NamespacedName{
+	return types.NamespacedName{Name: utilpolicy.GlobalNetworkPolicyPrefix + name}
+}
+
+// eventTarget is the object events of a key of status are recorded on
+type eventTarget struct {
+	ref           *api.ObjectReference
+	// networkPolicy is nil if unsupported fields of the target are not recorded
+	networkPolicy *utilpolicy.NetworkPolicyInfo
+	// onNode is true for default deny policies of namespaces, which are not objects of the apiserver, so they are recorded on node
+	onNode        bool
+}
+
+// startSync clears errors of the last sync
+func (r *policyEventRecorder) startSync(){
+	if r == nil{
+		return
+	}
+	r.errors = make(map[types.NamespacedName][]string)
+}
+
+// policyError stores an error of networkPolicy in the current sync, it is recorded by finishSync,
+// errors of networkPolicies rendered from a GlobalNetworkPolicy are stored on the GlobalNetworkPolicy with their namespace
+func (r *policyEventRecorder) policyError(networkPolicy *utilpolicy.NetworkPolicyInfo, format string, args ...interface{}){
+	if r == nil{
+		return
+	}
+	key := types.NamespacedName{Namespace: networkPolicy.Namespace, Name: networkPolicy.Name}
+	message := fmt.Sprintf(format, args...)
+	if strings.HasPrefix(networkPolicy.Name, utilpolicy.GlobalNetworkPolicyPrefix){
+		key = types.NamespacedName{Name: networkPolicy.Name}
+		message = fmt.Sprintf("namespace %s: %s", networkPolicy.Namespace, message)
+	}
+	r.errors[key] = append(r.errors[key], message)
+}
+
+// finishSync records events for networkPolicies, globalNetworkPolicies and default deny policies of namespaces
+// whose result is changed in this sync,
+// unsupportedMessage describes the unsupported fields of a networkPolicy, empty if it is fully supported
+// restoreErr is the error of iptables-restore which fails rules of all policies, so it is recorded on node
+func (r *policyEventRecorder) finishSync(networkPolicyMap utilpolicy.NetworkPolicyMap, globalNetworkPolicyMap utilpolicy.GlobalNetworkPolicyMap,
+	namespaceInfoMap utilpolicy.NamespaceInfoMap, unsupportedMessage func(*utilpolicy.NetworkPolicyInfo) string, restoreErr error){
+	if r == nil{
+		return
+	}
+
+	if restoreErr != nil{
+		message := fmt.Sprintf("failed to restore iptables rules: %v", restoreErr)
+		if message != r.nodeError && r.event(r.nodeRef, api.EventTypeWarning, EventReasonPolicyApplyFailed, message){
+			r.nodeError = message
+		}
+		// rules of all policies are not applied, so keep the status of policies until next sync
+		return
+	}
+	if r.nodeError != "" && r.event(r.nodeRef, api.EventTypeNormal, EventReasonPolicyApplied, "iptables rules are restored"){
+		r.nodeError = ""
+	}
+
+	targets := make(map[types.NamespacedName]eventTarget)
+	for key, networkPolicy := range networkPolicyMap{
+		targets[key] = eventTarget{ref: networkPolicyRef(networkPolicy), networkPolicy: networkPolicy}
+	}
+	for name, globalNetworkPolicy := range globalNetworkPolicyMap{
+		targets[globalPolicyEventKey(name)] = eventTarget{ref: globalNetworkPolicyRef(globalNetworkPolicy)}
+	}
+	for namespace, namespaceInfo := range namespaceInfoMap{
+		if len(namespaceInfo.DefaultDeny) > 0{
+			targets[types.NamespacedName{Namespace: namespace, Name: utilpolicy.DefaultDenyPolicyName}] = eventTarget{ref: r.nodeRef, onNode: true}
+		}
+	}
+
+	// sort keys so events are recorded in the same order when they are limited
+	keys := make([]types.NamespacedName, 0, len(targets))
+	for key := range targets{
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool{ return keys[i].String() < keys[j].String() })
+
+	// state of a key is only updated when its event is recorded, so an event dropped by the limiter is recorded by a later sync
+	for _, key := range keys{
+		target := targets[key]
+
+		if target.networkPolicy != nil{
+			unsupported := unsupportedMessage(target.networkPolicy)
+			if unsupported != r.unsupported[key] &&
+				(unsupported == "" || r.event(target.ref, api.EventTypeWarning, EventReasonUnsupportedField, unsupported)){
+				r.unsupported[key] = unsupported
+			}
+		}
+
+		message := strings.Join(r.errors[key], "; ")
+		previous, seen := r.status[key]
+		recorded := true
+		if message != "" && message != previous{
+			failed := fmt.Sprintf("failed to apply policy on node %s: %s", r.nodeRef.Name, message)
+			if target.onNode{
+				failed = fmt.Sprintf("failed to apply policy %s of namespace %s: %s", key.Name, key.Namespace, message)
+			}
+			recorded = r.event(target.ref, api.EventTypeWarning, EventReasonPolicyApplyFailed, failed)
+		} else if message == "" && seen && previous != ""{
+			applied := fmt.Sprintf("policy is applied on node %s", r.nodeRef.Name)
+			if target.onNode{
+				applied = fmt.Sprintf("policy %s of namespace %s is applied", key.Name, key.Namespace)
+			}
+			recorded = r.event(target.ref, api.EventTypeNormal, EventReasonPolicyApplied, applied)
+		}
+		if recorded{
+			r.status[key] = message
+		}
+	}
+
+	// forget deleted networkPolicies, globalNetworkPolicies and default deny policies
+	for key := range r.status{
+		if _, ok := targets[key]; !ok{
+			delete(r.status, key)
+			delete(r.unsupported, key)
+		}
+	}
+}
+
+// event returns false if the event is dropped by the limiter
+func (r *policyEventRecorder) event(ref *api.ObjectReference, eventType, reason, message string) bool{
+	if r.limiter != nil && !r.limiter.TryAccept(){
+		glog.V(2).Infof("too many events, drop event %s %s/%s: %s", reason, ref.Namespace, ref.Name, message)
+		return false
+	}
+	glog.V(4).Infof("record event %s %s/%s: %s", reason, ref.Namespace, ref.Name, message)
+	r.recorder.Event(ref, eventType, reason, message)
+	return true
+}
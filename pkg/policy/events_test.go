@@ -0,0 +1,207 @@
+package policy
+
+import (
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/flowcontrol"
+	utilpolicy "enn-policy/pkg/policy/util"
+
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// expectEvents checks events recorded since the last call, each expected event is "type reason"
+func expectEvents(t *testing.T, recorder *record.FakeRecorder, expected ...string){
+	var events []string
+	for{
+		select{
+		case event := <-recorder.Events:
+			fields := strings.SplitN(event, " ", 3)
+			events = append(events, fields[0] + " " + fields[1])
+			continue
+		default:
+		}
+		break
+	}
+	if strings.Join(events, ",") != strings.Join(expected, ","){
+		t.Errorf("expected events %v, get %v", expected, events)
+	}
+}
+
+func unsupportedFields(networkPolicy *utilpolicy.NetworkPolicyInfo) string{
+	return strings.Join(networkPolicy.Unsupported, ", ")
+}
+
+func TestPolicyEventRecorder(t *testing.T){
+
+	if newPolicyEventRecorder(nil, "node1", 0, 0) != nil{
+		t.Errorf("expected nil event recorder without recorder")
+	}
+	// nil recorder does nothing
+	var nilRecorder *policyEventRecorder
+	nilRecorder.startSync()
+	nilRecorder.policyError(&utilpolicy.NetworkPolicyInfo{Name: "np"}, "err")
+	nilRecorder.finishSync(nil, nil, nil, unsupportedFields, fmt.Errorf("err"))
+
+	fakeRecorder := record.NewFakeRecorder(100)
+	events := newPolicyEventRecorder(fakeRecorder, "node1", 0, 0)
+
+	np1 := &utilpolicy.NetworkPolicyInfo{Name: "np1", Namespace: "ns1", UID: "uid1"}
+	np2 := &utilpolicy.NetworkPolicyInfo{Name: "np2", Namespace: "ns1", UID: "uid2",
+		Unsupported: []string{"spec.podSelector.matchExpressions"}}
+	networkPolicyMap := utilpolicy.NetworkPolicyMap{
+		types.NamespacedName{Namespace: "ns1", Name: "np1"}: np1,
+		types.NamespacedName{Namespace: "ns1", Name: "np2"}: np2,
+	}
+
+	// healthy policy does not record event, unsupported field is recorded once
+	for i := 0; i < 2; i++{
+		events.startSync()
+		events.finishSync(networkPolicyMap, nil, nil, unsupportedFields, nil)
+	}
+	expectEvents(t, fakeRecorder, "Warning " + EventReasonUnsupportedField)
+
+	// failure is recorded once until it changes
+	for i := 0; i < 2; i++{
+		events.startSync()
+		events.policyError(np1, "create ipset err %v", "exist")
+		events.finishSync(networkPolicyMap, nil, nil, unsupportedFields, nil)
+	}
+	expectEvents(t, fakeRecorder, "Warning " + EventReasonPolicyApplyFailed)
+	events.startSync()
+	events.policyError(np1, "create ipset err %v", "no space")
+	events.finishSync(networkPolicyMap, nil, nil, unsupportedFields, nil)
+	expectEvents(t, fakeRecorder, "Warning " + EventReasonPolicyApplyFailed)
+
+	// iptables-restore failure is recorded on node and keeps the status of policies
+	for i := 0; i < 2; i++{
+		events.startSync()
+		events.finishSync(networkPolicyMap, nil, nil, unsupportedFields, fmt.Errorf("exit status 1"))
+	}
+	expectEvents(t, fakeRecorder, "Warning " + EventReasonPolicyApplyFailed)
+
+	// recovery of node and policy
+	events.startSync()
+	events.finishSync(networkPolicyMap, nil, nil, unsupportedFields, nil)
+	expectEvents(t, fakeRecorder, "Normal " + EventReasonPolicyApplied, "Normal " + EventReasonPolicyApplied)
+
+	// deleted policy is forgotten, so the same unsupported field is recorded again when it is created again
+	delete(networkPolicyMap, types.NamespacedName{Namespace: "ns1", Name: "np2"})
+	events.startSync()
+	events.finishSync(networkPolicyMap, nil, nil, unsupportedFields, nil)
+	networkPolicyMap[types.NamespacedName{Namespace: "ns1", Name: "np2"}] = np2
+	events.startSync()
+	events.finishSync(networkPolicyMap, nil, nil, unsupportedFields, nil)
+	expectEvents(t, fakeRecorder, "Warning " + EventReasonUnsupportedField)
+}
+
+func TestPolicyEventRecorderRateLimit(t *testing.T){
+
+	fakeRecorder := record.NewFakeRecorder(100)
+	// 1 event per 1000 seconds with burst 2, so only 2 events are recorded in this test
+	events := newPolicyEventRecorder(fakeRecorder, "node1", 0.001, 2)
+
+	networkPolicyMap := make(utilpolicy.NetworkPolicyMap)
+	for i := 0; i < 5; i++{
+		name := fmt.Sprintf("np%d", i)
+		networkPolicyMap[types.NamespacedName{Namespace: "ns1", Name: name}] = &utilpolicy.NetworkPolicyInfo{
+			Name:        name,
+			Namespace:   "ns1",
+			Unsupported: []string{"spec.podSelector.matchExpressions"},
+		}
+	}
+	events.startSync()
+	events.finishSync(networkPolicyMap, nil, nil, unsupportedFields, nil)
+	expectEvents(t, fakeRecorder, "Warning " + EventReasonUnsupportedField, "Warning " + EventReasonUnsupportedField)
+
+	// dropped events are recorded by a later sync once the limiter allows them
+	events.limiter = flowcontrol.NewFakeAlwaysRateLimiter()
+	events.startSync()
+	events.finishSync(networkPolicyMap, nil, nil, unsupportedFields, nil)
+	expectEvents(t, fakeRecorder, "Warning " + EventReasonUnsupportedField, "Warning " + EventReasonUnsupportedField,
+		"Warning " + EventReasonUnsupportedField)
+
+	// a dropped failure is recorded later too
+	events.limiter = flowcontrol.NewFakeNeverRateLimiter()
+	events.startSync()
+	events.policyError(networkPolicyMap[types.NamespacedName{Namespace: "ns1", Name: "np0"}], "create ipset err %v", "exist")
+	events.finishSync(networkPolicyMap, nil, nil, unsupportedFields, nil)
+	expectEvents(t, fakeRecorder)
+	events.limiter = flowcontrol.NewFakeAlwaysRateLimiter()
+	events.startSync()
+	events.policyError(networkPolicyMap[types.NamespacedName{Namespace: "ns1", Name: "np0"}], "create ipset err %v", "exist")
+	events.finishSync(networkPolicyMap, nil, nil, unsupportedFields, nil)
+	expectEvents(t, fakeRecorder, "Warning " + EventReasonPolicyApplyFailed)
+}
+
+func TestPolicyEventRecorderRenderedPolicies(t *testing.T){
+
+	fakeRecorder := record.NewFakeRecorder(100)
+	events := newPolicyEventRecorder(fakeRecorder, "node1", 0, 0)
+
+	globalNetworkPolicy := &utilpolicy.GlobalNetworkPolicyInfo{Name: "deny-metadata", UID: "uid1",
+		Policy: &utilpolicy.NetworkPolicyInfo{Name: utilpolicy.GlobalNetworkPolicyPrefix + "deny-metadata"}}
+	globalNetworkPolicyMap := utilpolicy.GlobalNetworkPolicyMap{"deny-metadata": globalNetworkPolicy}
+	namespaceInfoMap := utilpolicy.NamespaceInfoMap{
+		"legacy": &utilpolicy.NamespaceInfo{Name: "legacy", DefaultDeny: []string{utilpolicy.TypeIngress}},
+	}
+
+	// errors of copies in each namespace are recorded once on the GlobalNetworkPolicy
+	events.startSync()
+	events.policyError(globalNetworkPolicy.ForNamespace("ns1"), "create ipset err %v", "exist")
+	events.policyError(globalNetworkPolicy.ForNamespace("ns2"), "create ipset err %v", "exist")
+	events.policyError(namespaceInfoMap["legacy"].DefaultDenyPolicy(), "create ipset err %v", "exist")
+	events.finishSync(nil, globalNetworkPolicyMap, namespaceInfoMap, unsupportedFields, nil)
+	var recorded []string
+	for len(fakeRecorder.Events) > 0{
+		recorded = append(recorded, <-fakeRecorder.Events)
+	}
+	if len(recorded) != 2 || !strings.Contains(recorded[0], "namespace ns1: create ipset err exist; namespace ns2: create ipset err exist") ||
+		!strings.Contains(recorded[1], "failed to apply policy legacy:default-deny of namespace legacy"){
+		t.Errorf("expected failures of the GlobalNetworkPolicy and the default deny policy, get %v", recorded)
+	}
+
+	// recovery is recorded, deleted policies are forgotten
+	events.startSync()
+	events.finishSync(nil, globalNetworkPolicyMap, namespaceInfoMap, unsupportedFields, nil)
+	expectEvents(t, fakeRecorder, "Normal " + EventReasonPolicyApplied, "Normal " + EventReasonPolicyApplied)
+	events.startSync()
+	events.finishSync(nil, nil, nil, unsupportedFields, nil)
+	if len(events.status) != 0{
+		t.Errorf("expected status of deleted policies to be forgotten, get %v", events.status)
+	}
+}
+
+func TestHostEndpointPolicyRejected(t *testing.T){
+
+	fakeRecorder := record.NewFakeRecorder(100)
+	policy := &EnnPolicy{
+		hostEndpointNamespace: "host-endpoint",
+		events:                newPolicyEventRecorder(fakeRecorder, "node1", 0, 0),
+	}
+	hostPolicy := &utilpolicy.NetworkPolicyInfo{Name: "np1", Namespace: "host-endpoint", UID: "uid1", HostEndpoint: true}
+	misplaced := &utilpolicy.NetworkPolicyInfo{Name: "np2", Namespace: "ns1", UID: "uid2", HostEndpoint: true}
+	podPolicy := &utilpolicy.NetworkPolicyInfo{Name: "np3", Namespace: "ns1", UID: "uid3"}
+	networkPolicyMap := utilpolicy.NetworkPolicyMap{
+		types.NamespacedName{Namespace: "host-endpoint", Name: "np1"}: hostPolicy,
+		types.NamespacedName{Namespace: "ns1", Name: "np2"}: misplaced,
+		types.NamespacedName{Namespace: "ns1", Name: "np3"}: podPolicy,
+	}
+
+	policy.events.startSync()
+	for _, networkPolicy := range []*utilpolicy.NetworkPolicyInfo{hostPolicy, misplaced, podPolicy}{
+		rejected := policy.rejectHostEndpointPolicy(networkPolicy)
+		if rejected != (networkPolicy == misplaced){
+			t.Errorf("expected policy %s rejected %v, get %v", networkPolicy.Name, networkPolicy == misplaced, rejected)
+		}
+	}
+	policy.events.finishSync(networkPolicyMap, nil, nil, unsupportedFields, nil)
+	expectEvents(t, fakeRecorder, "Warning " + EventReasonPolicyApplyFailed)
+
+	// every host endpoint policy is rejected when host endpoint policy is disabled
+	policy.hostEndpointNamespace = ""
+	if !policy.rejectHostEndpointPolicy(hostPolicy){
+		t.Errorf("expected host endpoint policy to be rejected without host endpoint namespace")
+	}
+}
@@ -0,0 +1,62 @@
+package policy
+
+import (
+	"github.com/golang/glog"
+	utilpolicy "enn-policy/pkg/policy/util"
+	utilIPSet "enn-policy/pkg/util/ipset"
+)
+
+// createExemptSet creates ENN-EXEMPT if any pod can be exempted, it must be called before entries of namespaces are written
+func (policy *EnnPolicy) createExemptSet(){
+
+	policy.exemptSet = nil
+	if policy.exemptions.IsEmpty(){
+		return
+	}
+	ipset := &utilIPSet.IPSet{
+		Name:    ENN_EXEMPT_SET,
+		Type:    utilIPSet.TypeHashIP,
+	}
+	if err := policy.ipsetInterface.CreateIPSet(ipset, true); err != nil{
+		glog.Errorf("create ipset %s for exempted pods err %v", ipset.Name, err)
+		return
+	}
+	policy.activeIPSets[ipset.Name] = ipset
+	policy.exemptSet = ipset
+}
+
+// exemptedMatch returns the match of traffic whose pod in direction (src or dst) is not exempted, e.g
+// iptables -t filter -A ENN-FORWARD -m set --match-set [namespaceIPSet] dst -m set ! --match-set ENN-EXEMPT dst -j ENN-INGRESS-xxxxxx
+// it is added to entries of namespaces, so exempted pods never jump into their own entry,
+// traffic between them and other pods is still evaluated by the entries of the other pods
+func (policy *EnnPolicy) exemptedMatch(direction string) []string{
+	if policy.exemptSet == nil{
+		return nil
+	}
+	return []string{"-m", "set", "!", "--match-set", ENN_EXEMPT_SET, direction}
+}
+
+// exemptedPods returns the pods exempted by exemptions
+func (policy *EnnPolicy) exemptedPods() utilpolicy.PodInfoMap{
+	members := make(utilpolicy.PodInfoMap)
+	for namespace, podInfoMap := range policy.namespacePodMap{
+		namespaceInfo := policy.namespaceInfoMap[namespace]
+		for ip, pod := range podInfoMap{
+			if policy.exemptions.ExemptsPod(namespaceInfo, pod){
+				members[ip] = pod
+			}
+		}
+	}
+	return members
+}
+
+// syncExemptSet syncs entries of ENN-EXEMPT, since exemptions select pods by namespaces, labels and priorityClasses,
+// it is synced after every change of pods and namespaces
+func (policy *EnnPolicy) syncExemptSet(){
+	if policy.exemptSet == nil{
+		return
+	}
+	if err := policy.syncIPSetEntry(policy.exemptSet, policy.exemptedPods()); err != nil{
+		glog.Errorf("sync entry for ipset %s of exempted pods failed %v", policy.exemptSet.Name, err)
+	}
+}
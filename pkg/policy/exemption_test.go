@@ -0,0 +1,145 @@
+package policy
+
+import (
+	"enn-policy/app/options"
+	utilpolicy "enn-policy/pkg/policy/util"
+	utilIPSet "enn-policy/pkg/util/ipset"
+	fakeIPSet "enn-policy/pkg/util/ipset/testing"
+	utiliptables "enn-policy/pkg/util/k8siptables"
+
+	"strings"
+	"testing"
+)
+
+// writeExemptionTestRules writes entries of namespace tenant-a like syncIngressRule and syncEgressRule,
+// traffic of pods of tenant-a is rejected in both directions unless they are exempted
+func writeExemptionTestRules(policy *EnnPolicy){
+	policy.filterChains.Reset()
+	policy.filterRules.Reset()
+	policy.createExemptSet()
+	args := []string{"-A", ENN_FORWARD_CHAIN, "-m", "set", "--match-set", "ENN-NS-TENANT-A", "dst"}
+	args = append(args, policy.exemptedMatch("dst")...)
+	writeLine(policy.filterRules, append(args, "-j", "ENN-INGRESS-TENANT-A")...)
+	args = []string{"-A", ENN_FORWARD_CHAIN, "-m", "set", "--match-set", "ENN-NS-TENANT-A", "src"}
+	args = append(args, policy.exemptedMatch("src")...)
+	writeLine(policy.filterRules, append(args, "-j", "ENN-EGRESS-TENANT-A")...)
+	writeLine(policy.filterRules, "-A", "ENN-INGRESS-TENANT-A", "-j", "REJECT")
+	writeLine(policy.filterRules, "-A", "ENN-EGRESS-TENANT-A", "-j", "REJECT")
+	policy.syncExemptSet()
+}
+
+func TestExemptionRules(t *testing.T){
+
+	faker := fakeIPSet.NewFaker()
+	policy := newAdminTestPolicy(faker)
+	tenantA := map[string][]string{"ENN-NS-TENANT-A": {tenantAWeb, tenantADB}}
+	policy.exemptions, _ = utilpolicy.ParseExemptions(nil, nil, []string{"app=db"}, nil)
+	writeExemptionTestRules(policy)
+
+	if set, ok := policy.activeIPSets[ENN_EXEMPT_SET]; !ok || set.Type != utilIPSet.TypeHashIP{
+		t.Fatalf("expected active hash:ip ipset %s, get %+v", ENN_EXEMPT_SET, set)
+	}
+	testCases := []struct {
+		packet   adminTestPacket
+		expected string
+	}{
+		// the exempted pod never jumps into its own entries
+		{adminTestPacket{src: monitoring, dst: tenantADB, protocol: "TCP", port: "5432"}, "ACCEPT"},
+		{adminTestPacket{src: tenantADB, dst: external, protocol: "TCP", port: "443"}, "ACCEPT"},
+		// traffic between the exempted pod and other pods is still evaluated by the entries of the other pods
+		{adminTestPacket{src: tenantAWeb, dst: tenantADB, protocol: "TCP", port: "5432"}, "REJECT"},
+		{adminTestPacket{src: tenantADB, dst: tenantAWeb, protocol: "TCP", port: "80"}, "REJECT"},
+		{adminTestPacket{src: monitoring, dst: tenantAWeb, protocol: "TCP", port: "80"}, "REJECT"},
+	}
+	chains := newAdminTestChains(policy, faker, tenantA)
+	for _, testCase := range testCases{
+		if verdict := chains.evaluate(t, testCase.packet); verdict != testCase.expected{
+			t.Errorf("expected %s for %+v, get %s\nrules:\n%s", testCase.expected, testCase.packet, verdict, policy.filterRules.String())
+		}
+	}
+
+	// the ipset follows labels of pods without rendering rules again
+	policy.namespacePodMap["tenant-a"][tenantADB].Labels = map[string]string{"app": "cache"}
+	policy.syncExemptSet()
+	chains = newAdminTestChains(policy, faker, tenantA)
+	if verdict := chains.evaluate(t, adminTestPacket{src: monitoring, dst: tenantADB, protocol: "TCP", port: "5432"}); verdict != "REJECT"{
+		t.Errorf("expected REJECT to %s which is not exempted any more, get %s", tenantADB, verdict)
+	}
+
+	// without exemptions neither the ipset nor the match exist
+	policy.exemptions = nil
+	policy.activeIPSets = make(map[string]*utilIPSet.IPSet)
+	writeExemptionTestRules(policy)
+	if _, ok := policy.activeIPSets[ENN_EXEMPT_SET]; ok || policy.exemptSet != nil{
+		t.Errorf("expected no ipset %s without exemptions", ENN_EXEMPT_SET)
+	}
+	if strings.Contains(policy.filterRules.String(), ENN_EXEMPT_SET){
+		t.Errorf("expected no match of %s without exemptions, get\n%s", ENN_EXEMPT_SET, policy.filterRules.String())
+	}
+}
+
+func TestExemptionEntries(t *testing.T){
+
+	faker := fakeIPSet.NewFaker()
+	policy := newAdminTestPolicy(faker)
+	policy.iPRanges = []string{utilpolicy.DefaultIPRange}
+	policy.policyChainNamespaces = make(map[utiliptables.Chain]string)
+	policy.policyChainOwners = make(map[utiliptables.Chain]policyCounterOwner)
+	policy.exemptions, _ = utilpolicy.ParseExemptions([]string{"kube-system"}, nil, nil, nil)
+	policy.createExemptSet()
+
+	networkPolicy := &utilpolicy.NetworkPolicyInfo{
+		Name:        "deny-all",
+		Namespace:   "tenant-a",
+		PodSelector: map[string]string{},
+		PolicyType:  []string{utilpolicy.TypeIngress, utilpolicy.TypeEgress},
+	}
+	policy.syncIngressRule(networkPolicy, "ENN-NS-TENANT-A")
+	policy.syncEgressRule(networkPolicy, "ENN-NS-TENANT-A")
+
+	var entries []string
+	for _, line := range strings.Split(policy.filterRules.String(), "\n"){
+		if strings.HasPrefix(line, "-A " + ENN_FORWARD_CHAIN) || strings.HasPrefix(line, "-A " + ENN_OUTPUT_CHAIN){
+			entries = append(entries, line)
+		}
+	}
+	if len(entries) != 4{
+		t.Fatalf("expected 4 entries of namespace tenant-a, get\n%s", strings.Join(entries, "\n"))
+	}
+	for _, entry := range entries{
+		direction := "dst"
+		if strings.Contains(entry, ennNamespaceEgressChainName("tenant-a")){
+			direction = "src"
+		}
+		if !strings.Contains(entry, "-m set ! --match-set " + ENN_EXEMPT_SET + " " + direction){
+			t.Errorf("expected entry to skip exempted pods by %s, get %s", direction, entry)
+		}
+	}
+}
+
+func TestReloadConfigKeepsInvalidValues(t *testing.T){
+
+	exemptions, _ := utilpolicy.ParseExemptions([]string{"kube-system"}, nil, nil, nil)
+	failsafe := []utilpolicy.PolicyPort{{Protocol: "TCP", Port: "22"}}
+	policy := &EnnPolicy{
+		exemptions:       exemptions,
+		failsafeInbound:  failsafe,
+		failsafeOutbound: failsafe,
+		syncPeriodCh:     make(chan struct{}, 1),
+	}
+	policy.ReloadConfig(&options.EnnPolicyConfig{
+		ExemptNamespaces:             []string{"monitoring"},
+		ExemptPodLabels:              []string{"invalid"},
+		HostEndpointFailsafeInbound:  []string{"ssh"},
+		HostEndpointFailsafeOutbound: []string{"udp:53"},
+	})
+	if !policy.exemptions.Namespaces["kube-system"] || policy.exemptions.Namespaces["monitoring"]{
+		t.Errorf("expected invalid exemptions to keep the previous ones, get %+v", policy.exemptions)
+	}
+	if len(policy.failsafeInbound) != 1 || policy.failsafeInbound[0].Port != "22"{
+		t.Errorf("expected invalid failsafe inbound ports to keep the previous ones, get %+v", policy.failsafeInbound)
+	}
+	if len(policy.failsafeOutbound) != 1 || policy.failsafeOutbound[0].Port != "53"{
+		t.Errorf("expected valid failsafe outbound ports to be reloaded, get %+v", policy.failsafeOutbound)
+	}
+}
@@ -0,0 +1,294 @@
+package policy
+
+import (
+	"k8s.io/client-go/util/flowcontrol"
+	"github.com/golang/glog"
+	utilnflog "enn-policy/pkg/util/nflog"
+
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// flowLogDefaultPolicy is the policy in prefixes of the default deny rule of a chain,
+	// traffic is denied because no policy of the namespace allows it
+	flowLogDefaultPolicy = "*"
+	flowLogRetryPeriod   = 10 * time.Second
+
+	// flowLogTagDeny and flowLogTagAudit start prefixes of denied traffic and traffic accepted by audit mode
+	flowLogTagDeny       = "ENN"
+	flowLogTagAudit      = "AUD"
+)
+
+var flowLogActions = map[string]string{
+	flowLogTagDeny:  "deny",
+	flowLogTagAudit: "audit",
+}
+
+// direction of denied traffic in flow log prefixes and records
+const (
+	flowDirectionIngress     = "I"
+	flowDirectionEgress      = "E"
+	flowDirectionHostIngress = "HI"
+	flowDirectionHostEgress  = "HE"
+)
+
+var flowDirectionNames = map[string]string{
+	flowDirectionIngress:     "ingress",
+	flowDirectionEgress:      "egress",
+	flowDirectionHostIngress: "host-ingress",
+	flowDirectionHostEgress:  "host-egress",
+}
+
+// flowLogger collects packets logged by NFLOG rules before deny rules of ENN-PLY-* chains
+// and writes them as json lines, records beyond the rate limit are counted and reported in the next record
+// packets accepted by audit mode are counted in metric enn_policy_audit_hits_total by counters of rules, see collectPolicyCounters
+type flowLogger struct {
+	group      uint16
+	nflog      utilnflog.Interface
+	writer     io.Writer
+	limiter    flowcontrol.RateLimiter
+
+	// pods maps ips of pods to namespace/name, it is replaced after each sync so the collector does not take policy.mu
+	pods       atomic.Value
+	// policies maps policy references in prefixes to namespace/policy, it is replaced by each sync like pods
+	policies   atomic.Value
+	suppressed uint64
+}
+
+// flowRecord is one line of the flow log
+type flowRecord struct {
+	Time       string `json:"time"`
+	// Action is deny, or audit if the traffic would be denied but is accepted by audit mode
+	Action     string `json:"action"`
+	Direction  string `json:"direction"`
+	Namespace  string `json:"namespace"`
+	// Policy is empty if traffic is denied because no policy of the namespace allows it
+	Policy     string `json:"policy,omitempty"`
+	Protocol   string `json:"protocol"`
+	SrcIP      string `json:"srcIP"`
+	SrcPort    uint16 `json:"srcPort,omitempty"`
+	SrcPod     string `json:"srcPod,omitempty"`
+	DstIP      string `json:"dstIP"`
+	DstPort    uint16 `json:"dstPort,omitempty"`
+	DstPod     string `json:"dstPod,omitempty"`
+	// Suppressed is the number of records dropped by the rate limit before this record
+	Suppressed uint64 `json:"suppressed,omitempty"`
+}
+
+// newFlowLogger returns nil if group is 0, path is the flow log file, empty means standard output
+// flowLogQPS <= 0 means records are not limited
+func newFlowLogger(group int, path string, flowLogQPS float32, flowLogBurst int, nflog utilnflog.Interface) (*flowLogger, error){
+
+	if group <= 0{
+		return nil, nil
+	}
+	var writer io.Writer = os.Stdout
+	if path != ""{
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0640)
+		if err != nil{
+			return nil, fmt.Errorf("open flow log file %s error %v", path, err)
+		}
+		writer = file
+	}
+	var limiter flowcontrol.RateLimiter
+	if flowLogQPS > 0{
+		limiter = flowcontrol.NewTokenBucketRateLimiter(flowLogQPS, flowLogBurst)
+	}
+	logger := &flowLogger{
+		group:   uint16(group),
+		nflog:   nflog,
+		writer:  writer,
+		limiter: limiter,
+	}
+	logger.pods.Store(map[string]string{})
+	logger.policies.Store(map[string]string{})
+	return logger, nil
+}
+
+// flowLogPolicyRef returns the reference of namespace/policyName in prefixes,
+// --nflog-prefix has at most 63 characters, so names are hashed and resolved by the collector
+func flowLogPolicyRef(namespace, policyName string) string{
+	hash := sha256.Sum256([]byte(namespace + "/" + policyName))
+	encoded := base32.StdEncoding.EncodeToString(hash[:])
+	return encoded[:16]
+}
+
+// flowLogPrefix returns --nflog-prefix of the NFLOG rule before a deny rule, e.g ENN:I:NOY2XTTZRJAY3MAT for default/*,
+// tag is flowLogTagDeny or flowLogTagAudit, the reference of the policy is stored in flowLogPolicies
+func (policy *EnnPolicy) flowLogPrefix(tag, direction, namespace, policyName string) string{
+	ref := flowLogPolicyRef(namespace, policyName)
+	if policy.flowLogPolicies != nil{
+		policy.flowLogPolicies[ref] = namespace + "/" + policyName
+	}
+	return fmt.Sprintf("%s:%s:%s", tag, direction, ref)
+}
+
+// parseFlowLogPrefix returns action, direction and policy reference of prefix, ok is false if prefix is not written by enn-policy
+func parseFlowLogPrefix(prefix string) (action, direction, ref string, ok bool){
+	fields := strings.SplitN(prefix, ":", 3)
+	if len(fields) != 3{
+		return "", "", "", false
+	}
+	action, ok = flowLogActions[fields[0]]
+	if !ok{
+		return "", "", "", false
+	}
+	if _, ok := flowDirectionNames[fields[1]]; !ok{
+		return "", "", "", false
+	}
+	return action, fields[1], fields[2], true
+}
+
+// resolveFlowLogPolicy returns namespace and policy of ref,
+// a reference which is not rendered by the last sync, e.g of a policy just deleted, is returned as policy without namespace
+func resolveFlowLogPolicy(policies map[string]string, ref string) (namespace, policyName string){
+	name, ok := policies[ref]
+	if !ok{
+		return "", ref
+	}
+	namespace, policyName = name, ""
+	if i := strings.Index(name, "/"); i >= 0{
+		namespace, policyName = name[:i], name[i+1:]
+	}
+	if policyName == flowLogDefaultPolicy{
+		policyName = ""
+	}
+	return namespace, policyName
+}
+
+// chainFlowDirection returns the direction of an ENN-PLY-* chain
+func chainFlowDirection(chain string) string{
+	switch {
+	case strings.HasPrefix(chain, "ENN-PLY-HIN-"):
+		return flowDirectionHostIngress
+	case strings.HasPrefix(chain, "ENN-PLY-HE-"):
+		return flowDirectionHostEgress
+	case strings.HasPrefix(chain, "ENN-PLY-E-"):
+		return flowDirectionEgress
+	}
+	return flowDirectionIngress
+}
+
+// flowLogRule returns the NFLOG rule written before deny rules in chain, nil if flow log is disabled
+func (policy *EnnPolicy) flowLogRule(chain string, prefix string, comment string, match ...string) []string{
+	if policy.flowLog == nil{
+		return nil
+	}
+	rule := []string{"-A", chain, "-m", "comment", "--comment", comment}
+	rule = append(rule, match...)
+	return append(rule, "-j", "NFLOG", "--nflog-group", fmt.Sprintf("%d", policy.flowLog.group),
+		"--nflog-prefix", fmt.Sprintf("%q", prefix))
+}
+
+// updateFlowLogPods refreshes the ips of pods which are resolved in flow log records, it is called with policy.mu held
+func (policy *EnnPolicy) updateFlowLogPods(){
+	if policy.flowLog == nil{
+		return
+	}
+	pods := make(map[string]string)
+	for namespace, podInfoMap := range policy.namespacePodMap{
+		for ip, podInfo := range podInfoMap{
+			// hostNetwork pods share the ip of the node
+			if podInfo.HostNetwork{
+				continue
+			}
+			pods[ip] = namespace + "/" + podInfo.Name
+		}
+	}
+	policy.flowLog.pods.Store(pods)
+}
+
+// updateFlowLogPolicies publishes references of prefixes written by this sync to the collector,
+// it is called before the rules are restored
+func (policy *EnnPolicy) updateFlowLogPolicies(){
+	if policy.flowLog == nil || policy.flowLogPolicies == nil{
+		return
+	}
+	policy.flowLog.policies.Store(policy.flowLogPolicies)
+}
+
+// RunFlowLog collects denied flows until stopCh is closed, it does nothing if flow log is disabled
+func (policy *EnnPolicy) RunFlowLog(stopCh <-chan struct{}, wg *sync.WaitGroup){
+
+	defer wg.Done()
+	if policy.flowLog == nil{
+		return
+	}
+	glog.V(2).Infof("enn policy start flow log of nflog group %d", policy.flowLog.group)
+	for {
+		err := policy.flowLog.nflog.Listen(policy.flowLog.group, stopCh, policy.flowLog.handle)
+		if err == nil{
+			return
+		}
+		glog.Errorf("flow log stopped, retry after %v: %v", flowLogRetryPeriod, err)
+		select {
+		case <-stopCh:
+			return
+		case <-time.After(flowLogRetryPeriod):
+		}
+	}
+}
+
+func (logger *flowLogger) handle(packet *utilnflog.Packet){
+
+	action, direction, ref, ok := parseFlowLogPrefix(packet.Prefix)
+	if !ok{
+		return
+	}
+	if logger.limiter != nil && !logger.limiter.TryAccept(){
+		atomic.AddUint64(&logger.suppressed, 1)
+		return
+	}
+	timestamp := packet.Timestamp
+	if timestamp.IsZero(){
+		timestamp = time.Now()
+	}
+	pods := logger.pods.Load().(map[string]string)
+	namespace, policyName := resolveFlowLogPolicy(logger.policies.Load().(map[string]string), ref)
+	record := &flowRecord{
+		Time:       timestamp.UTC().Format(time.RFC3339Nano),
+		Action:     action,
+		Direction:  flowDirectionNames[direction],
+		Namespace:  namespace,
+		Policy:     policyName,
+		Protocol:   flowProtocol(packet.Protocol),
+		SrcIP:      packet.Src.String(),
+		SrcPort:    packet.SrcPort,
+		SrcPod:     pods[packet.Src.String()],
+		DstIP:      packet.Dst.String(),
+		DstPort:    packet.DstPort,
+		DstPod:     pods[packet.Dst.String()],
+		Suppressed: atomic.SwapUint64(&logger.suppressed, 0),
+	}
+	line, err := json.Marshal(record)
+	if err != nil{
+		glog.Errorf("marshal flow log record error %v", err)
+		return
+	}
+	if _, err := logger.writer.Write(append(line, '\n')); err != nil{
+		glog.Errorf("write flow log error %v", err)
+	}
+}
+
+func flowProtocol(protocol uint8) string{
+	switch protocol{
+	case utilnflog.ProtocolICMP:
+		return "ICMP"
+	case utilnflog.ProtocolTCP:
+		return "TCP"
+	case utilnflog.ProtocolUDP:
+		return "UDP"
+	case utilnflog.ProtocolSCTP:
+		return "SCTP"
+	}
+	return fmt.Sprintf("%d", protocol)
+}
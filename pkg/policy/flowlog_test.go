@@ -0,0 +1,138 @@
+package policy
+
+import (
+	utilpolicy "enn-policy/pkg/policy/util"
+	utilnflog "enn-policy/pkg/util/nflog"
+	fakenflog "enn-policy/pkg/util/nflog/testing"
+
+	"bytes"
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestFlowLogPrefix(t *testing.T){
+
+	policy := &EnnPolicy{flowLogPolicies: make(map[string]string)}
+	testCases := []struct {
+		tag       string
+		action    string
+		direction string
+		namespace string
+		policy    string
+		expected  string
+		parsed    string
+	}{
+		{flowLogTagDeny, "deny", flowDirectionIngress, "default", flowLogDefaultPolicy, "ENN:I:NOY2XTTZRJAY3MAT", ""},
+		{flowLogTagDeny, "deny", flowDirectionHostEgress, "host-endpoint", "deny-etcd", "ENN:HE:" + flowLogPolicyRef("host-endpoint", "deny-etcd"), "deny-etcd"},
+		{flowLogTagAudit, "audit", flowDirectionEgress, "payment", "web", "AUD:E:" + flowLogPolicyRef("payment", "web"), "web"},
+		// names longer than --nflog-prefix allows are resolved as they are
+		{flowLogTagDeny, "deny", flowDirectionEgress, strings.Repeat("n", 63), strings.Repeat("p", 253),
+			"ENN:E:" + flowLogPolicyRef(strings.Repeat("n", 63), strings.Repeat("p", 253)), strings.Repeat("p", 253)},
+	}
+	for _, testCase := range testCases{
+		prefix := policy.flowLogPrefix(testCase.tag, testCase.direction, testCase.namespace, testCase.policy)
+		if prefix != testCase.expected{
+			t.Errorf("expected prefix %s, get %s", testCase.expected, prefix)
+		}
+		if len(prefix) > 63{
+			t.Errorf("expected prefix %s not to be longer than 63 characters", prefix)
+		}
+		action, direction, ref, ok := parseFlowLogPrefix(prefix)
+		if !ok || action != testCase.action || direction != testCase.direction{
+			t.Errorf("prefix %s: unexpected action %s direction %s ok %v", prefix, action, direction, ok)
+		}
+		namespace, policyName := resolveFlowLogPolicy(policy.flowLogPolicies, ref)
+		if namespace != testCase.namespace || policyName != testCase.parsed{
+			t.Errorf("prefix %s: unexpected namespace %s policy %s", prefix, namespace, policyName)
+		}
+	}
+
+	// reference of a policy which is not rendered by the last sync is kept in records
+	if namespace, policyName := resolveFlowLogPolicy(policy.flowLogPolicies, "UNKNOWN"); namespace != "" || policyName != "UNKNOWN"{
+		t.Errorf("expected unknown reference to be kept, get namespace %s policy %s", namespace, policyName)
+	}
+	if _, _, _, ok := parseFlowLogPrefix("IPTABLES-DROP"); ok{
+		t.Errorf("expected prefix of other rules to be ignored")
+	}
+}
+
+func TestFlowLogRecords(t *testing.T){
+
+	policy := &EnnPolicy{
+		flowLogPolicies: make(map[string]string),
+		namespacePodMap: utilpolicy.NamespacePodMap{
+			"ns1": utilpolicy.PodInfoMap{
+				"10.244.1.10": &utilpolicy.PodInfo{IP: "10.244.1.10", Name: "nginx", Namespace: "ns1"},
+				"10.244.1.11": &utilpolicy.PodInfo{IP: "10.244.1.11", Name: "client", Namespace: "ns1"},
+			},
+		},
+	}
+	ingressPrefix := policy.flowLogPrefix(flowLogTagDeny, flowDirectionIngress, "ns1", flowLogDefaultPolicy)
+	egressPrefix := policy.flowLogPrefix(flowLogTagDeny, flowDirectionEgress, "ns1", "egress")
+	faker := fakenflog.NewFaker(
+		fakenflog.PacketFrom(ingressPrefix, utilnflog.ProtocolTCP, "10.244.1.11", 40000, "10.244.1.10", 80),
+		fakenflog.PacketFrom(egressPrefix, utilnflog.ProtocolUDP, "10.244.1.11", 5353, "10.96.0.10", 53),
+		fakenflog.PacketFrom("OTHER", utilnflog.ProtocolTCP, "10.244.1.11", 40001, "10.244.1.10", 80),
+		fakenflog.PacketFrom(ingressPrefix, utilnflog.ProtocolTCP, "10.244.1.11", 40002, "10.244.1.10", 80),
+		fakenflog.PacketFrom(ingressPrefix, utilnflog.ProtocolTCP, "10.244.1.11", 40003, "10.244.1.10", 80),
+	)
+	logger, err := newFlowLogger(100, "", 1, 2, faker)
+	if err != nil{
+		t.Fatalf("new flow logger error %v", err)
+	}
+	buf := &bytes.Buffer{}
+	logger.writer = buf
+	policy.flowLog = logger
+	policy.updateFlowLogPods()
+	policy.updateFlowLogPolicies()
+
+	stopCh := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go policy.RunFlowLog(stopCh, &wg)
+	close(stopCh)
+	wg.Wait()
+
+	if faker.Group != 100{
+		t.Errorf("expected nflog group 100, get %d", faker.Group)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	// burst is 2, so the last 2 packets of enn-policy are suppressed
+	if len(lines) != 2{
+		t.Fatalf("expected 2 records, get %v", lines)
+	}
+	var records []flowRecord
+	for _, line := range lines{
+		record := flowRecord{}
+		if err := json.Unmarshal([]byte(line), &record); err != nil{
+			t.Fatalf("unmarshal record %s error %v", line, err)
+		}
+		records = append(records, record)
+	}
+	if records[0].Direction != "ingress" || records[0].Namespace != "ns1" || records[0].Policy != "" ||
+		records[0].Protocol != "TCP" || records[0].SrcPod != "ns1/client" || records[0].DstPod != "ns1/nginx" || records[0].DstPort != 80{
+		t.Errorf("unexpected record %+v", records[0])
+	}
+	if records[1].Direction != "egress" || records[1].Namespace != "ns1" || records[1].Policy != "egress" || records[1].DstPod != "" || records[1].DstIP != "10.96.0.10"{
+		t.Errorf("unexpected record %+v", records[1])
+	}
+	if logger.suppressed != 2{
+		t.Errorf("expected 2 suppressed records, get %d", logger.suppressed)
+	}
+}
+
+func TestFlowLogRule(t *testing.T){
+
+	policy := &EnnPolicy{}
+	if rule := policy.flowLogRule("ENN-PLY-IN-X", "ENN:I:ns1/*", `"deny"`); rule != nil{
+		t.Errorf("expected no rule when flow log is disabled, get %v", rule)
+	}
+	policy.flowLog = &flowLogger{group: 100}
+	rule := strings.Join(policy.flowLogRule("ENN-PLY-IN-X", "ENN:I:ns1/*", `"deny"`), " ")
+	expected := `-A ENN-PLY-IN-X -m comment --comment "deny" -j NFLOG --nflog-group 100 --nflog-prefix "ENN:I:ns1/*"`
+	if rule != expected{
+		t.Errorf("expected rule %s, get %s", expected, rule)
+	}
+}
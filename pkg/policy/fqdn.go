@@ -0,0 +1,263 @@
+package policy
+
+import (
+	utilpolicy "enn-policy/pkg/policy/util"
+	utildns "enn-policy/pkg/util/dns"
+	utilIPSet "enn-policy/pkg/util/ipset"
+	utiliptables "enn-policy/pkg/util/k8siptables"
+	"github.com/golang/glog"
+
+	"crypto/sha256"
+	"encoding/base32"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// fqdnMaxResolvePeriod bounds the period of names with a long ttl, so that changed answers are not missed for long
+	fqdnMaxResolvePeriod = time.Hour
+	// fqdnSetTimeout is the default timeout of ENN-FQDN-* ipsets, every entry is added with its own timeout
+	fqdnSetTimeout = 300
+)
+
+// fqdnSet is the ipset of the ips of a name used by EgressFQDNs of networkPolicies,
+// entries expire in the kernel unless they are refreshed by the next resolution
+type fqdnSet struct {
+	ipset       *utilIPSet.IPSet
+	// nextResolve is when the name is resolved again, zero means the name is not resolved yet
+	nextResolve time.Time
+	// active is true if the name is used by a networkPolicy rendered in the last sync
+	active      bool
+}
+
+// dispatchFQDNs creates a dispatch chain for every EgressFQDNs rule of networkPolicy e.g
+// iptables -t filter -A ENN-PLY-E-xxxxxx -j ENN-DPATCH-xxxxxx
+// iptables -t filter -A ENN-DPATCH-xxxxxx -m set --match-set ENN-PODSET-xxxxxx src -m set --match-set ENN-FQDN-xxxxxx dst -p TCP --dport 443 -j ACCEPT
+func (policy *EnnPolicy) dispatchFQDNs(networkPolicy *utilpolicy.NetworkPolicyInfo, iPRangeChainName string){
+
+	var podMatch []string
+	if len(networkPolicy.PodSelector) > 0{
+		var xLabel []string
+		for labelKey, labelValue := range networkPolicy.PodSelector{
+			xLabel = append(xLabel, labelKey)
+			xLabel = append(xLabel, labelValue)
+		}
+		podMatch = []string{"-m", "set", "--match-set", ennXLabelIPSetName(networkPolicy.Namespace, "pod", xLabel), "src"}
+	}
+
+	for _, rule := range networkPolicy.EgressFQDNs{
+		glog.V(4).Infof("process sync fqdn %s policy rules for networkPolicy %s/%s", rule.Name, networkPolicy.Namespace, networkPolicy.Name)
+		fqdnSetName := policy.fqdnSetName(rule.Name)
+		if fqdnSetName == ""{
+			continue
+		}
+
+		dispatchChainName := ennDispatchChainName(
+			networkPolicy.Namespace,
+			networkPolicy.Name,
+			strconv.Itoa(TYPE_EGRESS),
+			"fqdn",
+			rule.Name,
+			"",
+			"",
+		)
+		chainName := utiliptables.Chain(dispatchChainName)
+		if chain, ok := policy.existingFilterChains[chainName]; ok {
+			writeLine(policy.filterChains, chain)
+		} else {
+			writeLine(policy.filterChains, utiliptables.MakeChainLine(chainName))
+		}
+		policy.activeFilterChains[chainName] = true
+		policy.indexPolicyChain(chainName, networkPolicy, TYPE_EGRESS)
+
+		comment := fmt.Sprintf(`"policy %s:%s entry for fqdn %s"`,
+			networkPolicy.Namespace,
+			networkPolicy.Name,
+			rule.Name,
+		)
+		args := []string{
+			"-A", iPRangeChainName,
+			"-m", "comment", "--comment", comment,
+		}
+		writeLine(policy.filterRules, append(args, "-j", dispatchChainName)...)
+
+		comment = fmt.Sprintf(`"accept rule selected by policy %s/%s: dst match fqdn %s"`,
+			networkPolicy.Namespace,
+			networkPolicy.Name,
+			rule.Name,
+		)
+		args = []string{
+			"-A", dispatchChainName,
+			"-m", "comment", "--comment", comment,
+		}
+		args = append(args, podMatch...)
+		args = append(args, "-m", "set", "--match-set", fqdnSetName, "dst")
+		if len(rule.Ports) == 0{
+			writeLine(policy.filterRules, append(args, "-j", "ACCEPT")...)
+			continue
+		}
+		for _, port := range rule.Ports{
+			portArgs := append([]string{}, args...)
+			portArgs = append(portArgs, "-p", port.Protocol, "--dport", port.Port, "-j", "ACCEPT")
+			writeLine(policy.filterRules, portArgs...)
+		}
+	}
+}
+
+// fqdnSetName returns the name of the ipset of the ips of name, it is created if necessary,
+// empty if it can not be created, entries are added by RunFQDNResolver
+func (policy *EnnPolicy) fqdnSetName(name string) string{
+
+	if set, ok := policy.fqdnSets[name]; ok{
+		set.active = true
+		policy.activeIPSets[set.ipset.Name] = set.ipset
+		return set.ipset.Name
+	}
+	ipset := &utilIPSet.IPSet{
+		Name:    ennFQDNIPSetName(name),
+		Type:    utilIPSet.TypeHashIP,
+		Timeout: fqdnSetTimeout,
+	}
+	if err := policy.ipsetInterface.CreateIPSet(ipset, true); err != nil{
+		glog.Errorf("create ipset %s for fqdn %s err %v", ipset.Name, name, err)
+		return ""
+	}
+	policy.activeIPSets[ipset.Name] = ipset
+	policy.fqdnSets[name] = &fqdnSet{
+		ipset:  ipset,
+		active: true,
+	}
+	// the name is resolved as soon as possible instead of waiting for the next due name
+	select {
+	case policy.fqdnCh <- struct{}{}:
+	default:
+	}
+	return ipset.Name
+}
+
+// resetFQDNSets is called before networkPolicies are rendered, names which are not used again are removed by pruneFQDNSets
+func (policy *EnnPolicy) resetFQDNSets(){
+	for _, set := range policy.fqdnSets{
+		set.active = false
+	}
+}
+
+// pruneFQDNSets stops resolving names which are no longer used, their ipsets are destroyed by checkUnusedIPSets
+func (policy *EnnPolicy) pruneFQDNSets(){
+	for name, set := range policy.fqdnSets{
+		if !set.active{
+			glog.V(4).Infof("fqdn %s is no longer used by any network policy", name)
+			delete(policy.fqdnSets, name)
+		}
+	}
+}
+
+// RunFQDNResolver resolves names used by EgressFQDNs of networkPolicies when their answers expire,
+// and adds the ips into the ipsets of names with a timeout, so ips which are not answered again expire in the kernel
+func (policy *EnnPolicy) RunFQDNResolver(stopCh <-chan struct{}, wg *sync.WaitGroup){
+
+	defer wg.Done()
+	if policy.dnsInterface == nil{
+		return
+	}
+	glog.V(2).Infof("enn policy start fqdn resolver")
+	for {
+		wait := policy.resolveFQDNs(time.Now())
+		select {
+		case <-stopCh:
+			return
+		case <-policy.fqdnCh:
+		case <-time.After(wait):
+		}
+	}
+}
+
+// resolveFQDNs resolves names which are due at now and returns how long to wait for the next due name
+func (policy *EnnPolicy) resolveFQDNs(now time.Time) time.Duration{
+
+	policy.mu.Lock()
+	var names []string
+	for name, set := range policy.fqdnSets{
+		if !set.nextResolve.After(now){
+			names = append(names, name)
+		}
+	}
+	policy.mu.Unlock()
+	sort.Strings(names)
+
+	// names are resolved without the lock, so a slow nameserver does not block syncs
+	records := make(map[string][]utildns.Record)
+	errs := make(map[string]error)
+	for _, name := range names{
+		records[name], errs[name] = policy.dnsInterface.LookupIPv4(name)
+	}
+
+	policy.mu.Lock()
+	defer policy.mu.Unlock()
+	for _, name := range names{
+		set, ok := policy.fqdnSets[name]
+		if !ok{
+			// the name is removed during the resolution
+			continue
+		}
+		if errs[name] != nil{
+			// ips of the last answer are kept until their timeout
+			glog.Errorf("resolve fqdn %s err %v, retry after %v", name, errs[name], policy.fqdnMinTTL)
+			set.nextResolve = now.Add(policy.fqdnMinTTL)
+			continue
+		}
+		period := fqdnResolvePeriod(records[name], policy.fqdnMinTTL)
+		set.nextResolve = now.Add(period)
+		// ips are kept for twice the period, so they do not expire before the next resolution refreshes them
+		timeout := int(2 * period / time.Second)
+		for _, record := range records[name]{
+			entry := &utilIPSet.Entry{
+				IP:      record.IP,
+				Type:    utilIPSet.TypeHashIP,
+				Timeout: timeout,
+			}
+			if err := policy.ipsetInterface.AddEntry(set.ipset, entry, true); err != nil{
+				glog.Errorf("add ip %s of fqdn %s into ipset %s err %v", record.IP, name, set.ipset.Name, err)
+			}
+		}
+		glog.V(4).Infof("fqdn %s is resolved to %d ips, resolve again after %v", name, len(records[name]), period)
+	}
+
+	wait := fqdnMaxResolvePeriod
+	for _, set := range policy.fqdnSets{
+		if set.nextResolve.IsZero(){
+			return 0
+		}
+		if next := set.nextResolve.Sub(now); next < wait{
+			wait = next
+		}
+	}
+	return wait
+}
+
+// fqdnResolvePeriod returns the smallest ttl of records, bounded by minTTL and fqdnMaxResolvePeriod
+func fqdnResolvePeriod(records []utildns.Record, minTTL time.Duration) time.Duration{
+	period := fqdnMaxResolvePeriod
+	for _, record := range records{
+		if record.TTL < period{
+			period = record.TTL
+		}
+	}
+	if period < minTTL{
+		period = minTTL
+	}
+	// an entry without timeout never expires, so the period is at least one second
+	if period < time.Second{
+		period = time.Second
+	}
+	return period
+}
+
+func ennFQDNIPSetName(name string) string{
+	hash := sha256.Sum256([]byte(name))
+	encoded := base32.StdEncoding.EncodeToString(hash[:])
+	return "ENN-FQDN-" + encoded[:16]
+}
@@ -0,0 +1,194 @@
+package policy
+
+import (
+	utilpolicy "enn-policy/pkg/policy/util"
+	utildns "enn-policy/pkg/util/dns"
+	fakeDNS "enn-policy/pkg/util/dns/testing"
+	utilIPSet "enn-policy/pkg/util/ipset"
+	fakeIPSet "enn-policy/pkg/util/ipset/testing"
+	utiliptables "enn-policy/pkg/util/k8siptables"
+
+	"testing"
+	"time"
+)
+
+const (
+	partnerIP1 = "203.0.113.10"
+	partnerIP2 = "203.0.113.11"
+	partnerIP3 = "203.0.113.12"
+	fqdnTestChain = "ENN-PLY-E-TEST"
+)
+
+func newFQDNTestPolicy(faker *fakeIPSet.Faker, resolver *fakeDNS.Faker) *EnnPolicy{
+	policy := newAdminTestPolicy(faker)
+	policy.policyChainOwners = make(map[utiliptables.Chain]policyCounterOwner)
+	policy.fqdnSets = make(map[string]*fqdnSet)
+	policy.dnsInterface = resolver
+	policy.fqdnMinTTL = 30 * time.Second
+	return policy
+}
+
+// writeFQDNTestRules renders networkPolicies like syncPolicyRules, egress not allowed by them is rejected
+func writeFQDNTestRules(policy *EnnPolicy, networkPolicies ...*utilpolicy.NetworkPolicyInfo){
+	policy.filterChains.Reset()
+	policy.filterRules.Reset()
+	policy.resetFQDNSets()
+	writeLine(policy.filterRules, "-A", ENN_FORWARD_CHAIN, "-j", fqdnTestChain)
+	for _, networkPolicy := range networkPolicies{
+		policy.dispatchEgressRules(networkPolicy, fqdnTestChain)
+	}
+	writeLine(policy.filterRules, "-A", fqdnTestChain, "-j", "REJECT")
+	policy.pruneFQDNSets()
+}
+
+func fqdnTestEntries(faker *fakeIPSet.Faker, name string) map[string]int{
+	entries := make(map[string]int)
+	for set, setEntries := range faker.FakeSet{
+		if set.Name != name{
+			continue
+		}
+		for _, entry := range setEntries{
+			entries[entry.IP] = entry.Timeout
+		}
+	}
+	return entries
+}
+
+func TestFQDNRules(t *testing.T){
+
+	faker := fakeIPSet.NewFaker()
+	resolver := fakeDNS.NewFaker()
+	resolver.SetRecords("api.partner.com",
+		utildns.Record{IP: partnerIP1, TTL: 10 * time.Second},
+		utildns.Record{IP: partnerIP2, TTL: 120 * time.Second},
+	)
+	policy := newFQDNTestPolicy(faker, resolver)
+	networkPolicy := &utilpolicy.NetworkPolicyInfo{
+		Name:        "partner",
+		Namespace:   "tenant-a",
+		PodSelector: map[string]string{"app": "web"},
+		PolicyType:  []string{utilpolicy.TypeEgress},
+		EgressFQDNs: []utilpolicy.FQDNRule{
+			{Name: "api.partner.com", Ports: []utilpolicy.PolicyPort{{Protocol: "TCP", Port: "443"}}},
+		},
+	}
+	writeFQDNTestRules(policy, networkPolicy)
+
+	setName := ennFQDNIPSetName("api.partner.com")
+	set, ok := policy.activeIPSets[setName]
+	if !ok || set.Type != utilIPSet.TypeHashIP || set.Timeout != fqdnSetTimeout{
+		t.Fatalf("expected active hash:ip ipset %s with timeout, get %+v", setName, set)
+	}
+
+	now := time.Now()
+	// the smallest ttl is 10s, it is bounded by fqdn min ttl
+	if wait := policy.resolveFQDNs(now); wait != 30 * time.Second{
+		t.Errorf("expected next resolution after 30s, get %v", wait)
+	}
+	expectedEntries := map[string]int{partnerIP1: 60, partnerIP2: 60}
+	if entries := fqdnTestEntries(faker, setName); len(entries) != 2 || entries[partnerIP1] != 60 || entries[partnerIP2] != 60{
+		t.Errorf("expected entries %v, get %v", expectedEntries, entries)
+	}
+
+	podSetName := ennXLabelIPSetName("tenant-a", "pod", []string{"app", "web"})
+	chains := newAdminTestChains(policy, faker, map[string][]string{podSetName: {tenantAWeb}})
+	testCases := []struct {
+		packet   adminTestPacket
+		expected string
+	}{
+		{adminTestPacket{src: tenantAWeb, dst: partnerIP1, protocol: "TCP", port: "443"}, "ACCEPT"},
+		{adminTestPacket{src: tenantAWeb, dst: partnerIP2, protocol: "TCP", port: "443"}, "ACCEPT"},
+		{adminTestPacket{src: tenantAWeb, dst: partnerIP1, protocol: "TCP", port: "80"}, "REJECT"},
+		{adminTestPacket{src: tenantAWeb, dst: external, protocol: "TCP", port: "443"}, "REJECT"},
+		// db is not selected by spec.podSelector
+		{adminTestPacket{src: tenantADB, dst: partnerIP1, protocol: "TCP", port: "443"}, "REJECT"},
+	}
+	for _, testCase := range testCases{
+		if verdict := chains.evaluate(t, testCase.packet); verdict != testCase.expected{
+			t.Errorf("expected %s for %+v, get %s\nrules:\n%s", testCase.expected, testCase.packet, verdict, policy.filterRules.String())
+		}
+	}
+}
+
+func TestFQDNResolution(t *testing.T){
+
+	faker := fakeIPSet.NewFaker()
+	resolver := fakeDNS.NewFaker()
+	resolver.SetRecords("api.partner.com", utildns.Record{IP: partnerIP1, TTL: 60 * time.Second})
+	policy := newFQDNTestPolicy(faker, resolver)
+	networkPolicy := &utilpolicy.NetworkPolicyInfo{
+		Name:        "partner",
+		Namespace:   "tenant-a",
+		PolicyType:  []string{utilpolicy.TypeEgress},
+		EgressFQDNs: []utilpolicy.FQDNRule{{Name: "api.partner.com"}, {Name: "missing.partner.com"}},
+	}
+	writeFQDNTestRules(policy, networkPolicy)
+	setName := ennFQDNIPSetName("api.partner.com")
+
+	now := time.Now()
+	// missing.partner.com can not be resolved, it is retried after fqdn min ttl
+	if wait := policy.resolveFQDNs(now); wait != 30 * time.Second{
+		t.Errorf("expected next resolution after 30s, get %v", wait)
+	}
+	if entries := fqdnTestEntries(faker, setName); len(entries) != 1 || entries[partnerIP1] != 120{
+		t.Errorf("expected entry %s with timeout 120, get %v", partnerIP1, entries)
+	}
+
+	// names are not resolved again before their ttl expires
+	policy.resolveFQDNs(now.Add(30 * time.Second))
+	if count := resolver.LookupCount("api.partner.com"); count != 1{
+		t.Errorf("expected api.partner.com to be resolved once before its ttl expires, get %d", count)
+	}
+	if count := resolver.LookupCount("missing.partner.com"); count != 2{
+		t.Errorf("expected missing.partner.com to be retried, get %d", count)
+	}
+
+	// the answer changes, the old ip is not deleted but expires by its timeout
+	resolver.SetRecords("api.partner.com", utildns.Record{IP: partnerIP3, TTL: 600 * time.Second})
+	policy.resolveFQDNs(now.Add(60 * time.Second))
+	if count := resolver.LookupCount("api.partner.com"); count != 2{
+		t.Errorf("expected api.partner.com to be resolved again after its ttl expires, get %d", count)
+	}
+	if entries := fqdnTestEntries(faker, setName); len(entries) != 2 || entries[partnerIP1] != 120 || entries[partnerIP3] != 1200{
+		t.Errorf("expected entries %s with timeout 120 and %s with timeout 1200, get %v", partnerIP1, partnerIP3, entries)
+	}
+
+	// the same answer refreshes the timeout of existing entries
+	policy.fqdnSets["api.partner.com"].nextResolve = time.Time{}
+	resolver.SetRecords("api.partner.com", utildns.Record{IP: partnerIP1, TTL: 300 * time.Second})
+	policy.resolveFQDNs(now.Add(90 * time.Second))
+	if entries := fqdnTestEntries(faker, setName); entries[partnerIP1] != 600{
+		t.Errorf("expected timeout of entry %s to be refreshed to 600, get %v", partnerIP1, entries)
+	}
+
+	// names which are not used any more are not resolved
+	writeFQDNTestRules(policy)
+	if len(policy.fqdnSets) != 0{
+		t.Errorf("expected no fqdn after the policy is deleted, get %v", policy.fqdnSets)
+	}
+	if wait := policy.resolveFQDNs(now.Add(time.Hour)); wait != fqdnMaxResolvePeriod{
+		t.Errorf("expected to wait %v without fqdn, get %v", fqdnMaxResolvePeriod, wait)
+	}
+	if count := resolver.LookupCount("api.partner.com"); count != 3{
+		t.Errorf("expected unused name not to be resolved, get %d lookups", count)
+	}
+}
+
+func TestFQDNResolvePeriod(t *testing.T){
+
+	testCases := []struct {
+		records  []utildns.Record
+		minTTL   time.Duration
+		expected time.Duration
+	}{
+		{[]utildns.Record{{TTL: 300 * time.Second}, {TTL: 60 * time.Second}}, 30 * time.Second, 60 * time.Second},
+		{[]utildns.Record{{TTL: 5 * time.Second}}, 30 * time.Second, 30 * time.Second},
+		{[]utildns.Record{{TTL: 24 * time.Hour}}, 30 * time.Second, fqdnMaxResolvePeriod},
+		{[]utildns.Record{{TTL: 0}}, 0, time.Second},
+	}
+	for _, testCase := range testCases{
+		if period := fqdnResolvePeriod(testCase.records, testCase.minTTL); period != testCase.expected{
+			t.Errorf("expected period %v for records %v and min ttl %v, get %v", testCase.expected, testCase.records, testCase.minTTL, period)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package policy
+
+import (
+	globalApi "enn-policy/pkg/apis/networking/v1alpha1"
+	"github.com/golang/glog"
+	utilpolicy "enn-policy/pkg/policy/util"
+	"k8s.io/apimachinery/pkg/types"
+
+	"sort"
+)
+
+func (policy *EnnPolicy) OnGlobalNetworkPolicyAdd(globalNetworkPolicy *globalApi.GlobalNetworkPolicy){
+	glog.V(6).Infof("OnGlobalNetworkPolicyAdd policy name: %s", globalNetworkPolicy.Name)
+	glog.V(6).Infof("policy initialized %v", policy.isInitialized())
+	if policy.globalNetworkPolicyChanges.Update(globalNetworkPolicy.Name, nil, globalNetworkPolicy) && policy.isInitialized() {
+		policy.syncEnnPolicy(SYNCGLOBALNETWORKPOLICY)
+	}
+}
+
+func (policy *EnnPolicy) OnGlobalNetworkPolicyUpdate(oldGlobalNetworkPolicy, globalNetworkPolicy *globalApi.GlobalNetworkPolicy){
+	glog.V(6).Infof("OnGlobalNetworkPolicyUpdate old policy name: %s; new policy name: %s", oldGlobalNetworkPolicy.Name, globalNetworkPolicy.Name)
+	glog.V(6).Infof("policy initialized %v", policy.isInitialized())
+	if policy.globalNetworkPolicyChanges.Update(globalNetworkPolicy.Name, oldGlobalNetworkPolicy, globalNetworkPolicy) && policy.isInitialized() {
+		policy.syncEnnPolicy(SYNCGLOBALNETWORKPOLICY)
+	}
+}
+
+func (policy *EnnPolicy) OnGlobalNetworkPolicyDelete(globalNetworkPolicy *globalApi.GlobalNetworkPolicy){
+	glog.V(6).Infof("OnGlobalNetworkPolicyDelete policy name: %s", globalNetworkPolicy.Name)
+	glog.V(6).Infof("policy initialized %v", policy.isInitialized())
+	if policy.globalNetworkPolicyChanges.Update(globalNetworkPolicy.Name, globalNetworkPolicy, nil) && policy.isInitialized() {
+		policy.syncEnnPolicy(SYNCGLOBALNETWORKPOLICY)
+	}
+}
+
+func (policy *EnnPolicy) OnGlobalNetworkPolicySynced(){
+	glog.V(6).Infof("OnGlobalNetworkPolicySynced")
+	policy.mu.Lock()
+	policy.globalNetworkPolicySynced = true
+	policy.setInitialized(policy.allSynced())
+	policy.mu.Unlock()
+
+	policy.syncEnnPolicy(SYNCGLOBALNETWORKPOLICY)
+}
+
+// renderedNetworkPolicies returns networkPolicies in the order they are rendered into ENN-PLY-* chains:
+// globalNetworkPolicies first, one networkPolicy for every selected namespace, then default deny policies of namespaces
+// isolated by the legacy DefaultDeny annotation, then namespaced networkPolicies, so an except cidr of a global policy denies traffic before any namespaced policy can accept it
+func (policy *EnnPolicy) renderedNetworkPolicies() []*utilpolicy.NetworkPolicyInfo{
+
+	names := make([]string, 0, len(policy.globalNetworkPolicyMap))
+	for name := range policy.globalNetworkPolicyMap{
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	namespaces := make([]string, 0, len(policy.namespaceInfoMap))
+	for namespace := range policy.namespaceInfoMap{
+		namespaces = append(namespaces, namespace)
+	}
+	sort.Strings(namespaces)
+
+	var networkPolicies []*utilpolicy.NetworkPolicyInfo
+	for _, name := range names{
+		globalNetworkPolicy := policy.globalNetworkPolicyMap[name]
+		for _, namespace := range namespaces{
+			if globalNetworkPolicy.SelectsNamespace(policy.namespaceInfoMap[namespace]){
+				networkPolicies = append(networkPolicies, globalNetworkPolicy.ForNamespace(namespace))
+			}
+		}
+	}
+
+	// namespaces isolated by the legacy DefaultDeny annotation get a policy without rules
+	for _, namespace := range namespaces{
+		if defaultDenyPolicy := policy.namespaceInfoMap[namespace].DefaultDenyPolicy(); defaultDenyPolicy != nil{
+			networkPolicies = append(networkPolicies, defaultDenyPolicy)
+		}
+	}
+
+	keys := make([]types.NamespacedName, 0, len(policy.networkPolicyMap))
+	for key := range policy.networkPolicyMap{
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool{ return keys[i].String() < keys[j].String() })
+	for _, key := range keys{
+		networkPolicies = append(networkPolicies, policy.networkPolicyMap[key])
+	}
+	return networkPolicies
+}
+
+// globalPolicyNamespacesChanged returns true if a namespace change adds or removes a namespace selected by a globalNetworkPolicy
+func (policy *EnnPolicy) globalPolicyNamespacesChanged(changes *utilpolicy.NamespaceChangeMap) bool{
+	for _, change := range changes.Items{
+		for _, globalNetworkPolicy := range policy.globalNetworkPolicyMap{
+			if globalNetworkPolicy.SelectsNamespace(change.Previous) != globalNetworkPolicy.SelectsNamespace(change.Current){
+				return true
+			}
+		}
+	}
+	return false
+}
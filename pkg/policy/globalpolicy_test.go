@@ -0,0 +1,79 @@
+package policy
+
+import (
+	utilpolicy "enn-policy/pkg/policy/util"
+	"k8s.io/apimachinery/pkg/types"
+
+	"testing"
+)
+
+func TestRenderedNetworkPolicies(t *testing.T){
+
+	policy := &EnnPolicy{
+		namespaceInfoMap: utilpolicy.NamespaceInfoMap{
+			"tenant-b":    &utilpolicy.NamespaceInfo{Name: "tenant-b", Labels: map[string]string{"tenant": "true"},
+				DefaultDeny: []string{utilpolicy.TypeIngress}},
+			"tenant-a":    &utilpolicy.NamespaceInfo{Name: "tenant-a", Labels: map[string]string{"tenant": "true"}},
+			"kube-system": &utilpolicy.NamespaceInfo{Name: "kube-system"},
+		},
+		globalNetworkPolicyMap: utilpolicy.GlobalNetworkPolicyMap{
+			"deny-metadata": &utilpolicy.GlobalNetworkPolicyInfo{
+				Name:              "deny-metadata",
+				NamespaceSelector: map[string]string{"tenant": "true"},
+				Policy:            &utilpolicy.NetworkPolicyInfo{Name: "global:deny-metadata"},
+			},
+			"allow-dns": &utilpolicy.GlobalNetworkPolicyInfo{
+				Name:   "allow-dns",
+				Policy: &utilpolicy.NetworkPolicyInfo{Name: "global:allow-dns"},
+			},
+		},
+		networkPolicyMap: utilpolicy.NetworkPolicyMap{
+			types.NamespacedName{Namespace: "tenant-a", Name: "web"}: &utilpolicy.NetworkPolicyInfo{Namespace: "tenant-a", Name: "web"},
+		},
+	}
+
+	expected := []string{
+		"kube-system/global:allow-dns",
+		"tenant-a/global:allow-dns",
+		"tenant-b/global:allow-dns",
+		"tenant-a/global:deny-metadata",
+		"tenant-b/global:deny-metadata",
+		"tenant-b/legacy:default-deny",
+		"tenant-a/web",
+	}
+	networkPolicies := policy.renderedNetworkPolicies()
+	if len(networkPolicies) != len(expected){
+		t.Fatalf("expected %d policies, get %d", len(expected), len(networkPolicies))
+	}
+	for i, networkPolicy := range networkPolicies{
+		if name := networkPolicy.Namespace + "/" + networkPolicy.Name; name != expected[i]{
+			t.Errorf("expected policy %d to be %s, get %s", i, expected[i], name)
+		}
+	}
+}
+
+func TestGlobalPolicyNamespacesChanged(t *testing.T){
+
+	policy := &EnnPolicy{
+		globalNetworkPolicyMap: utilpolicy.GlobalNetworkPolicyMap{
+			"deny-metadata": &utilpolicy.GlobalNetworkPolicyInfo{
+				Name:              "deny-metadata",
+				NamespaceSelector: map[string]string{"tenant": "true"},
+			},
+		},
+	}
+	changes := utilpolicy.NewNamespaceChangeMap()
+	changes.Items[types.NamespacedName{Name: "a"}] = &utilpolicy.NamespaceChange{
+		Previous: &utilpolicy.NamespaceInfo{Name: "a", Labels: map[string]string{"team": "a"}},
+		Current:  &utilpolicy.NamespaceInfo{Name: "a", Labels: map[string]string{"team": "b"}},
+	}
+	if policy.globalPolicyNamespacesChanged(&changes){
+		t.Errorf("expected labels which are not selected not to change global policies")
+	}
+	changes.Items[types.NamespacedName{Name: "b"}] = &utilpolicy.NamespaceChange{
+		Current: &utilpolicy.NamespaceInfo{Name: "b", Labels: map[string]string{"tenant": "true"}},
+	}
+	if !policy.globalPolicyNamespacesChanged(&changes){
+		t.Errorf("expected new selected namespace to change global policies")
+	}
+}
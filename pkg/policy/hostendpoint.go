@@ -0,0 +1,178 @@
+package policy
+
+import (
+	"github.com/golang/glog"
+	utilpolicy "enn-policy/pkg/policy/util"
+	utiliptables "enn-policy/pkg/util/k8siptables"
+
+	"crypto/sha256"
+	"encoding/base32"
+	"fmt"
+	"sort"
+)
+
+// isHostEndpointPolicy returns true if networkPolicy protects nodes instead of pods,
+// host endpoint policy is never rendered as a pod policy
+func (policy *EnnPolicy) isHostEndpointPolicy(networkPolicy *utilpolicy.NetworkPolicyInfo) bool{
+	return networkPolicy.HostEndpoint
+}
+
+// rejectHostEndpointPolicy reports a host endpoint policy which is not in host endpoint namespace,
+// such policy is neither rendered for nodes nor for pods, so the error is recorded as an event on the policy
+func (policy *EnnPolicy) rejectHostEndpointPolicy(networkPolicy *utilpolicy.NetworkPolicyInfo) bool{
+
+	if !networkPolicy.HostEndpoint || (policy.hostEndpointNamespace != "" && networkPolicy.Namespace == policy.hostEndpointNamespace){
+		return false
+	}
+	glog.Warningf("networkPolicy %s/%s has annotation %s but is not in host endpoint namespace %q, so reject it",
+		networkPolicy.Namespace, networkPolicy.Name, utilpolicy.HostEndpointAnnotation, policy.hostEndpointNamespace)
+	policy.events.policyError(networkPolicy, "annotation %s is only applied in host endpoint namespace %q, policy is rejected",
+		utilpolicy.HostEndpointAnnotation, policy.hostEndpointNamespace)
+	return true
+}
+
+// localNodeLabels returns labels of this node, nil if this node is not received from node informer
+func (policy *EnnPolicy) localNodeLabels() map[string]string{
+	if nodeInfo, ok := policy.nodeInfoMap[policy.hostName]; ok{
+		return nodeInfo.Labels
+	}
+	return nil
+}
+
+// syncHostEndpointRules renders host endpoint policies which select this node, e.g
+// -A ENN-INPUT -i lo -j ACCEPT
+// -A ENN-INPUT -m addrtype --dst-type LOCAL -p tcp --dport 22 -m comment --comment "host endpoint failsafe inbound TCP:22" -j ACCEPT
+// -A ENN-INPUT -m addrtype --dst-type LOCAL -m comment --comment "host endpoint ingress" -j ENN-PLY-HIN-xxxxxx
+// -A ENN-PLY-HIN-xxxxxx -j ENN-DPATCH-xxxxxx
+// -A ENN-OUTPUT -o lo -j ACCEPT
+// -A ENN-OUTPUT -m addrtype --src-type LOCAL -p udp --dport 53 -m comment --comment "host endpoint failsafe outbound UDP:53" -j ACCEPT
+// -A ENN-OUTPUT -m addrtype --src-type LOCAL -m comment --comment "host endpoint egress" -j ENN-PLY-HE-xxxxxx
+// -A ENN-PLY-HE-xxxxxx -j ENN-DPATCH-xxxxxx
+// ENN-PLY-HIN/ENN-PLY-HE get the same established and default reject rules as other ENN-PLY chains
+// it must be called after all pod policies are rendered, so traffic from node to a pod selected by pod policy
+// is judged by the ingress entry of the pod namespace in ENN-OUTPUT first
+func (policy *EnnPolicy) syncHostEndpointRules(){
+
+	if policy.hostEndpointNamespace == ""{
+		return
+	}
+	nodeLabels := policy.localNodeLabels()
+	if nodeLabels == nil{
+		glog.Warningf("local node %s is not found in node informer, skip host endpoint policy", policy.hostName)
+		return
+	}
+
+	var ingressPolicies, egressPolicies []*utilpolicy.NetworkPolicyInfo
+	for _, networkPolicy := range policy.networkPolicyMap{
+		if !networkPolicy.HostEndpoint || networkPolicy.Namespace != policy.hostEndpointNamespace{
+			continue
+		}
+		if !utilpolicy.HostEndpointSelectsNode(networkPolicy, nodeLabels){
+			glog.V(4).Infof("host endpoint policy %s/%s does not select node %s", networkPolicy.Namespace, networkPolicy.Name, policy.hostName)
+			continue
+		}
+		enforcedPolicy := policy.enforcedNetworkPolicy(networkPolicy)
+		if enforcedPolicy == nil{
+			continue
+		}
+		// the policy target is this node, so rules must not match target pods by spec.podSelector
+		hostPolicy := *enforcedPolicy
+		hostPolicy.PodSelector = nil
+		for _, policyType := range hostPolicy.PolicyType{
+			if policyType == utilpolicy.TypeIngress{
+				ingressPolicies = append(ingressPolicies, &hostPolicy)
+			} else if policyType == utilpolicy.TypeEgress{
+				egressPolicies = append(egressPolicies, &hostPolicy)
+			}
+		}
+	}
+	sort.Slice(ingressPolicies, func(i, j int) bool{ return ingressPolicies[i].Name < ingressPolicies[j].Name })
+	sort.Slice(egressPolicies, func(i, j int) bool{ return egressPolicies[i].Name < egressPolicies[j].Name })
+
+	if len(ingressPolicies) > 0{
+		hostIngressChainName := ennHostEndpointIngressChainName(policy.hostName)
+		policy.writeHostEndpointChain(hostIngressChainName)
+
+		writeLine(policy.filterRules,
+			"-A", ENN_INPUT_CHAIN,
+			"-i", "lo",
+			"-m", "comment", "--comment", `"accept loopback traffic of host endpoint"`,
+			"-j", "ACCEPT",
+		)
+		for _, port := range policy.failsafeInbound{
+			writeLine(policy.filterRules,
+				"-A", ENN_INPUT_CHAIN,
+				"-m", "addrtype", "--dst-type", "LOCAL",
+				"-p", port.Protocol,
+				"--dport", port.Port,
+				"-m", "comment", "--comment", fmt.Sprintf(`"host endpoint failsafe inbound %s:%s"`, port.Protocol, port.Port),
+				"-j", "ACCEPT",
+			)
+		}
+		writeLine(policy.filterRules,
+			"-A", ENN_INPUT_CHAIN,
+			"-m", "addrtype", "--dst-type", "LOCAL",
+			"-m", "comment", "--comment", `"host endpoint ingress"`,
+			"-j", hostIngressChainName,
+		)
+		for _, networkPolicy := range ingressPolicies{
+			glog.V(4).Infof("process host endpoint ingress policy %s/%s", networkPolicy.Namespace, networkPolicy.Name)
+			policy.dispatchIngressRules(networkPolicy, hostIngressChainName)
+		}
+	}
+
+	if len(egressPolicies) > 0{
+		hostEgressChainName := ennHostEndpointEgressChainName(policy.hostName)
+		policy.writeHostEndpointChain(hostEgressChainName)
+
+		writeLine(policy.filterRules,
+			"-A", ENN_OUTPUT_CHAIN,
+			"-o", "lo",
+			"-m", "comment", "--comment", `"accept loopback traffic of host endpoint"`,
+			"-j", "ACCEPT",
+		)
+		for _, port := range policy.failsafeOutbound{
+			writeLine(policy.filterRules,
+				"-A", ENN_OUTPUT_CHAIN,
+				"-m", "addrtype", "--src-type", "LOCAL",
+				"-p", port.Protocol,
+				"--dport", port.Port,
+				"-m", "comment", "--comment", fmt.Sprintf(`"host endpoint failsafe outbound %s:%s"`, port.Protocol, port.Port),
+				"-j", "ACCEPT",
+			)
+		}
+		writeLine(policy.filterRules,
+			"-A", ENN_OUTPUT_CHAIN,
+			"-m", "addrtype", "--src-type", "LOCAL",
+			"-m", "comment", "--comment", `"host endpoint egress"`,
+			"-j", hostEgressChainName,
+		)
+		for _, networkPolicy := range egressPolicies{
+			glog.V(4).Infof("process host endpoint egress policy %s/%s", networkPolicy.Namespace, networkPolicy.Name)
+			policy.dispatchEgressRules(networkPolicy, hostEgressChainName)
+		}
+	}
+}
+
+func (policy *EnnPolicy) writeHostEndpointChain(chainName string){
+	chain := utiliptables.Chain(chainName)
+	if line, ok := policy.existingFilterChains[chain]; ok {
+		writeLine(policy.filterChains, line)
+	} else {
+		writeLine(policy.filterChains, utiliptables.MakeChainLine(chain))
+	}
+	policy.activeFilterChains[chain] = true
+	policy.policyChainNamespaces[chain] = policy.hostEndpointNamespace
+}
+
+func ennHostEndpointIngressChainName(hostName string) string{
+	hash := sha256.Sum256([]byte("host-endpoint" + hostName))
+	encoded := base32.StdEncoding.EncodeToString(hash[:])
+	return "ENN-PLY-HIN-" + encoded[:16]
+}
+
+func ennHostEndpointEgressChainName(hostName string) string{
+	hash := sha256.Sum256([]byte("host-endpoint" + hostName))
+	encoded := base32.StdEncoding.EncodeToString(hash[:])
+	return "ENN-PLY-HE-" + encoded[:16]
+}
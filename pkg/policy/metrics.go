@@ -0,0 +1,39 @@
+package policy
+
+import (
+	"enn-policy/pkg/util/metrics"
+
+	"sync"
+)
+
+var (
+	networkPolicySupport = metrics.NewGaugeVec(
+		"enn_policy_network_policies",
+		"Number of NetworkPolicies by support level (full, partial, unsupported) and unsupported policy mode",
+		"support", "mode",
+	)
+	auditHits = metrics.NewCounterVec(
+		"enn_policy_audit_hits_total",
+		"Number of packets which would be denied but are accepted since their namespace is in audit mode, policy is empty if no policy of the namespace allows them",
+		"namespace", "policy", "direction",
+	)
+	policyPackets = metrics.NewCounterVec(
+		"enn_policy_packets_total",
+		"Number of packets allowed or denied by rules of NetworkPolicies, policy is empty for the default deny rule of a namespace",
+		"namespace", "policy", "direction", "action",
+	)
+	policyBytes = metrics.NewCounterVec(
+		"enn_policy_bytes_total",
+		"Number of bytes allowed or denied by rules of NetworkPolicies, policy is empty for the default deny rule of a namespace",
+		"namespace", "policy", "direction", "action",
+	)
+)
+
+var registerMetricsOnce sync.Once
+
+// RegisterMetrics registers metrics of enn-policy into metrics.DefaultRegistry
+func RegisterMetrics(){
+	registerMetricsOnce.Do(func(){
+		metrics.MustRegister(networkPolicySupport, auditHits, policyPackets, policyBytes)
+	})
+}
@@ -6,12 +6,15 @@ import (
 	utilexec "k8s.io/utils/exec"
 	utilpolicy "enn-policy/pkg/policy/util"
 	"k8s.io/client-go/util/flowcontrol"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/apimachinery/pkg/types"
 	"github.com/golang/glog"
 	utilIPSet "enn-policy/pkg/util/ipset"
+	utilconntrack "enn-policy/pkg/util/conntrack"
+	utilnflog "enn-policy/pkg/util/nflog"
+	utildns "enn-policy/pkg/util/dns"
 	utiliptables "enn-policy/pkg/util/k8siptables"
-	utiltool "enn-policy/pkg/util/tool"
 	"enn-policy/pkg/util/iptables"
 	"enn-policy/app/options"
 
@@ -25,6 +28,7 @@ import (
 	"strconv"
 	"strings"
 	"bytes"
+	"reflect"
 	"sort"
 )
 
@@ -38,6 +42,13 @@ const (
 	ENN_FORWARD_CHAIN  = "ENN-FORWARD"
 )
 
+const (
+	ENN_NODE_GATEWAY_SET = "ENN-NODE-GATEWAY"
+	ENN_LOCAL_NODE_SET   = "ENN-LOCAL-NODE"
+	ENN_CLUSTER_NODE_SET = "ENN-CLUSTER-NODE"
+	ENN_EXEMPT_SET       = "ENN-EXEMPT"
+)
+
 const (
 	TYPE_INGRESS       = 1
 	TYPE_EGRESS        = 2
@@ -48,6 +59,10 @@ const (
 	SYNCNETWORKPOLICY  = 1
 	SYNCPOD            = 2
 	SYNCNAMESPACE      = 3
+	SYNCNODE           = 4
+	SYNCGLOBALNETWORKPOLICY = 5
+	SYNCADMINNETWORKPOLICY  = 6
+	SYNCSERVICE             = 7
 )
 
 type EnnPolicy struct {
@@ -57,20 +72,74 @@ type EnnPolicy struct {
 	syncPeriod	        time.Duration
 	minSyncPeriod           time.Duration
 	throttle                flowcontrol.RateLimiter
+	// syncPeriodCh notifies SyncLoop that syncPeriod is changed by ReloadConfig
+	syncPeriodCh            chan struct{}
 
 	hostName                string
 	nodeIP                  net.IP
 	clusterCIDR             string
-	iPRange                 string
-
-	acceptFlannel           bool
-	flannelNet              string
-	flannelLen              int
+	iPRanges                []string
+	excludeIPRanges         []string
+
+	acceptNodeGateway       bool
+	acceptLocalNode         bool
+
+	// terminatingPods is the default handling of terminating pods in peer ipsets, keep or drop
+	terminatingPods         string
+	// terminatingSync syncs peer ipsets again when the grace period of a kept terminating pod ends
+	terminatingSync         *time.Timer
+	terminatingSyncAt       time.Time
+
+	// denyAction is the default handling of traffic denied by policies, see utilpolicy.DenyActionReject
+	denyAction              string
+	// defaultPolicyMode is the default of namespaces without annotation enn-policy/policy-mode, enforce or audit
+	defaultPolicyMode       string
+
+	// proxyMode is the detected or user defined kube-proxy mode, iptables or ipvs
+	proxyMode               string
+	// configuredProxyMode is the proxy mode of config, auto is detected again on each full sync
+	configuredProxyMode     string
+	// interfaceExists checks network interfaces of this node, it is replaced in tests
+	interfaceExists         func(name string) bool
+
+	// hostEndpointNamespace is the namespace of host endpoint policies, empty means host endpoint policy is disabled
+	hostEndpointNamespace   string
+	failsafeInbound         []utilpolicy.PolicyPort
+	failsafeOutbound        []utilpolicy.PolicyPort
+
+	// exemptions select pods which are never enforced, exemptSet is ENN-EXEMPT if any pod can be exempted, see exemptedMatch
+	exemptions              *utilpolicy.Exemptions
+	exemptSet               *utilIPSet.IPSet
+
+	// unsupportedPolicy is the default handling of networkPolicies which are not fully supported, best-effort or fail-closed
+	unsupportedPolicy       string
+
+	// events records results of syncPolicyRules on networkPolicies and node, nil means events are disabled
+	events                  *policyEventRecorder
+
+	// flowLog collects denied traffic logged by NFLOG rules, nil means flow log is disabled
+	flowLog                 *flowLogger
+	// flowLogPolicies maps policy references of NFLOG prefixes written by the current sync to namespace/policy
+	flowLogPolicies         map[string]string
+
+	// flushConntrack deletes conntrack entries of connections which lose access after a sync
+	flushConntrack          bool
+	conntrackInterface      utilconntrack.Interface
+	// lastAccess is the traffic allowed after the last sync, nil if it is unknown
+	lastAccess              *policyAccess
 
 	initialized             int32
 	networkPolicySynced     bool
 	podSynced               bool
 	namespaceSynced         bool
+	nodeSynced              bool
+	// globalNetworkPolicySynced is always true if GlobalNetworkPolicy is not watched
+	globalNetworkPolicySynced bool
+	// adminNetworkPolicySynced and baselineAdminNetworkPolicySynced are always true if admin network policies are not watched
+	adminNetworkPolicySynced bool
+	baselineAdminNetworkPolicySynced bool
+	serviceSynced           bool
+	endpointsSynced         bool
 	initAllSynced           bool
 
 	execInterface           utilexec.Interface
@@ -81,12 +150,24 @@ type EnnPolicy struct {
 	networkPolicyChanges    utilpolicy.NetworkPolicyChangeMap
 	podChanges              utilpolicy.PodChangeMap
 	namespaceChanges        utilpolicy.NamespaceChangeMap
+	nodeChanges             utilpolicy.NodeChangeMap
+	globalNetworkPolicyChanges utilpolicy.GlobalNetworkPolicyChangeMap
+	adminNetworkPolicyChanges  utilpolicy.AdminNetworkPolicyChangeMap
+	baselineAdminNetworkPolicyChanges utilpolicy.AdminNetworkPolicyChangeMap
+	serviceChanges          utilpolicy.ServiceChangeMap
+	endpointsChanges        utilpolicy.EndpointsChangeMap
 
 	networkPolicyMap        utilpolicy.NetworkPolicyMap
 	podMatchLabelMap        utilpolicy.PodMatchLabelMap
 	namespaceMatchLabelMap  utilpolicy.NamespaceMatchLabelMap
 	namespacePodMap         utilpolicy.NamespacePodMap
 	namespaceInfoMap        utilpolicy.NamespaceInfoMap
+	nodeInfoMap             utilpolicy.NodeInfoMap
+	globalNetworkPolicyMap  utilpolicy.GlobalNetworkPolicyMap
+	adminNetworkPolicyMap   utilpolicy.AdminNetworkPolicyMap
+	baselineAdminNetworkPolicyMap utilpolicy.AdminNetworkPolicyMap
+	serviceInfoMap          utilpolicy.ServiceInfoMap
+	endpointsInfoMap        utilpolicy.EndpointsInfoMap
 
 	// map activeIPSets stores the active ipsets created by syncPolicyRules which key is ipset name
 	activeIPSets            map[string]*utilIPSet.IPSet
@@ -103,6 +184,29 @@ type EnnPolicy struct {
 
 	existingFilterChains    map[utiliptables.Chain]string
 	activeFilterChains      map[utiliptables.Chain]bool
+	// policyChainNamespaces maps active ENN-PLY-* chains to the namespace whose deny action is used in them
+	policyChainNamespaces   map[utiliptables.Chain]string
+	// policyChainOwners maps active dispatch and ipBlock chains to the networkPolicy whose rules are in them
+	policyChainOwners       map[utiliptables.Chain]policyCounterOwner
+	// auditRuleOwners maps ACCEPT rules of audit mode to the networkPolicy whose traffic they accept, see writeDenyRules
+	auditRuleOwners         map[string]policyCounterOwner
+	// priorityRules are explicit rules of globalNetworkPolicies collected during a sync, see writePriorityRules
+	priorityRules           []priorityRule
+	// adminPolicySets are ipsets of subjects and peers of admin network policies created during a sync, see adminPolicySetName
+	adminPolicySets         map[string]*adminPolicySet
+	// fqdnSets are ipsets of names used by EgressFQDNs of networkPolicies, entries are added by RunFQDNResolver
+	fqdnSets                map[string]*fqdnSet
+	dnsInterface            utildns.Interface
+	// fqdnMinTTL is the smallest period of resolving a name, even if its answer has a smaller ttl
+	fqdnMinTTL              time.Duration
+	// fqdnCh notifies RunFQDNResolver that a new name is used
+	fqdnCh                  chan struct{}
+	// serviceSets are ipsets of services used by EgressServices of networkPolicies created during a sync, see serviceSetName
+	serviceSets             map[types.NamespacedName]*utilIPSet.IPSet
+	// egressServices is true if services and endpoints are watched, EgressServices of networkPolicies allow nothing otherwise
+	egressServices          bool
+	// policyCounters exports counters of policy rules as metrics, nil means metrics are disabled
+	policyCounters          *policyCounters
 
 	// The following buffers are used to reuse memory and avoid allocations
 	// that are significantly impacting performance.
@@ -120,18 +224,15 @@ func NewEnnPolicy(
     ipsetInterface          utilIPSet.Interface,
     iptablesInterface       iptables.Interface,
     k8siptablesInterface    utiliptables.Interface,
+    recorder                record.EventRecorder,
 )(*EnnPolicy, error){
 
 	syncPeriod      := config.PolicyPeriod
 	minSyncPeriod   := config.MinSyncPeriod
-	iPRange         := config.IPRange
-	acceptFlannel   := config.AcceptFlannelIP
-	flannelNet      := config.FlannelNetwork
-	flannelLen, err := strconv.Atoi(config.FlannelLenBit)
-	if err != nil{
-		glog.Errorf("invalid flannelLen %s, err: %v, set this value to default number 8", config.FlannelLenBit, err)
-		flannelLen = 8
-	}
+	iPRanges        := config.IPRanges
+	excludeIPRanges := config.ExcludeIPRanges
+	acceptNodeGateway := config.AcceptNodeGatewayIP
+	acceptLocalNode := config.AcceptLocalNode
 
 	glog.V(4).Infof("start to build ennPolicy structure")
 	// check valid user input
@@ -148,12 +249,39 @@ func NewEnnPolicy(
 		glog.Warningf("clusterCIDR not specified, unable to distinguish between internal and external traffic")
 	}
 
-	var throttle flowcontrol.RateLimiter
-	if minSyncPeriod != 0{
-		qps := float32(time.Second) / float32(minSyncPeriod)
-		burst := 2
-		glog.V(3).Infof("minSyncPeriod: %v, syncPeriod: %v, burstSyncs: %d", minSyncPeriod, syncPeriod, burst)
-		throttle = flowcontrol.NewTokenBucketRateLimiter(qps,burst)
+	throttle := newSyncThrottle(syncPeriod, minSyncPeriod)
+
+	proxyMode := resolveProxyMode(config.ProxyMode, ipsetInterface)
+	glog.V(0).Infof("kube-proxy mode is %s", proxyMode)
+
+	// failsafe ports are already checked by options.Validate
+	failsafeInbound, _ := utilpolicy.ParseProtocolPorts(config.HostEndpointFailsafeInbound)
+	failsafeOutbound, _ := utilpolicy.ParseProtocolPorts(config.HostEndpointFailsafeOutbound)
+	// exemptions are already checked by options.Validate
+	exemptions, _ := utilpolicy.ParseExemptions(config.ExemptNamespaces, config.ExemptNamespaceLabels, config.ExemptPodLabels, config.ExemptPriorityClasses)
+
+	// counters of policy rules are only read if they are exported as metrics
+	var policyCounters *policyCounters
+	if config.MetricsBindAddress != ""{
+		policyCounters = newPolicyCounters()
+	}
+
+	flowLog, err := newFlowLogger(config.FlowLogGroup, config.FlowLogFile, config.FlowLogQPS, config.FlowLogBurst, utilnflog.NewEnnNFLog())
+	if err != nil{
+		return nil, err
+	}
+
+	// nameservers are already checked by options.Validate
+	nameservers, _ := utildns.ParseNameservers(config.FQDNNameservers)
+	if len(nameservers) == 0{
+		nameservers, err = utildns.ReadResolvConf(utildns.DefaultResolvConf)
+		if err != nil{
+			glog.Warningf("read nameservers for egress fqdns err %v, names can not be resolved", err)
+		}
+	}
+
+	if config.HostNetworkPeers{
+		glog.Warningf("host-network-peers is enabled, a podSelector or namespaceSelector peer which matches a hostNetwork pod allows every host-network process on the node of that pod")
 	}
 
 	ennpolicy := EnnPolicy{
@@ -161,13 +289,36 @@ func NewEnnPolicy(
 		hostName:                hostName,
 		nodeIP:                  nodeIP,
 		clusterCIDR:             clusterCIDR,
-		iPRange:                 iPRange,
-		acceptFlannel:           acceptFlannel,
-		flannelNet:              flannelNet,
-		flannelLen:              flannelLen,
+		iPRanges:                iPRanges,
+		excludeIPRanges:         excludeIPRanges,
+		acceptNodeGateway:       acceptNodeGateway,
+		acceptLocalNode:         acceptLocalNode,
+		terminatingPods:         config.TerminatingPods,
+		denyAction:              config.DenyAction,
+		defaultPolicyMode:       config.PolicyMode,
+		proxyMode:               proxyMode,
+		configuredProxyMode:     config.ProxyMode,
+		interfaceExists:         interfaceExists,
+		hostEndpointNamespace:   config.HostEndpointNamespace,
+		failsafeInbound:         failsafeInbound,
+		failsafeOutbound:        failsafeOutbound,
+		exemptions:              exemptions,
+		unsupportedPolicy:       config.UnsupportedPolicyMode,
+		events:                  newPolicyEventRecorder(recorder, hostName, config.EventQPS, config.EventBurst),
+		flowLog:                 flowLog,
+		policyCounters:          policyCounters,
+		flushConntrack:          config.FlushConntrack,
+		conntrackInterface:      utilconntrack.NewEnnConntrack(),
 		networkPolicySynced:     false,
 		podSynced:               false,
 		namespaceSynced:         false,
+		nodeSynced:              false,
+		globalNetworkPolicySynced: !config.GlobalNetworkPolicy,
+		adminNetworkPolicySynced: !config.AdminNetworkPolicy,
+		baselineAdminNetworkPolicySynced: !config.AdminNetworkPolicy,
+		serviceSynced:           !config.EgressServices,
+		endpointsSynced:         !config.EgressServices,
+		egressServices:          config.EgressServices,
 		initAllSynced:           true,
 		execInterface:           execInterface,
 		ipsetInterface:          ipsetInterface,
@@ -176,14 +327,33 @@ func NewEnnPolicy(
 		throttle:                throttle,
 		syncPeriod:              syncPeriod,
 		minSyncPeriod:           minSyncPeriod,
+		syncPeriodCh:            make(chan struct{}, 1),
 		networkPolicyChanges:    utilpolicy.NewNetworkPolicyChangeMap(),
 		podChanges:              utilpolicy.NewPodLabelChangeMap(),
 		namespaceChanges:        utilpolicy.NewNamespaceChangeMap(),
+		nodeChanges:             utilpolicy.NewNodeChangeMap(),
+		globalNetworkPolicyChanges: utilpolicy.NewGlobalNetworkPolicyChangeMap(),
+		adminNetworkPolicyChanges: utilpolicy.NewAdminNetworkPolicyChangeMap(),
+		baselineAdminNetworkPolicyChanges: utilpolicy.NewAdminNetworkPolicyChangeMap(),
+		serviceChanges:          utilpolicy.NewServiceChangeMap(),
+		endpointsChanges:        utilpolicy.NewEndpointsChangeMap(),
 		networkPolicyMap:        make(utilpolicy.NetworkPolicyMap),
 		podMatchLabelMap:        make(utilpolicy.PodMatchLabelMap),
 		namespaceMatchLabelMap:  make(utilpolicy.NamespaceMatchLabelMap),
 		namespacePodMap:         make(utilpolicy.NamespacePodMap),
 		namespaceInfoMap:        make(utilpolicy.NamespaceInfoMap),
+		nodeInfoMap:             make(utilpolicy.NodeInfoMap),
+		globalNetworkPolicyMap:  make(utilpolicy.GlobalNetworkPolicyMap),
+		adminNetworkPolicyMap:   make(utilpolicy.AdminNetworkPolicyMap),
+		baselineAdminNetworkPolicyMap: make(utilpolicy.AdminNetworkPolicyMap),
+		serviceInfoMap:          make(utilpolicy.ServiceInfoMap),
+		endpointsInfoMap:        make(utilpolicy.EndpointsInfoMap),
+		adminPolicySets:         make(map[string]*adminPolicySet),
+		fqdnSets:                make(map[string]*fqdnSet),
+		dnsInterface:            utildns.NewEnnResolver(nameservers),
+		fqdnMinTTL:              config.FQDNMinTTL,
+		fqdnCh:                  make(chan struct{}, 1),
+		serviceSets:             make(map[types.NamespacedName]*utilIPSet.IPSet),
 		activeIPSets:            make(map[string]*utilIPSet.IPSet),
 		podXLabelMap:            make(map[types.NamespacedName]*utilpolicy.NamespacedLabelMap),
 		podXLabelSet:            make(map[types.NamespacedName]*utilIPSet.IPSet),
@@ -196,6 +366,7 @@ func NewEnnPolicy(
 		filterChains:            bytes.NewBuffer(nil),
 		filterRules:             bytes.NewBuffer(nil),
 	}
+	ennpolicy.podChanges.HostNetworkPeers = config.HostNetworkPeers
 
 	return &ennpolicy, nil
 }
@@ -259,7 +430,7 @@ func (policy *EnnPolicy) OnNetworkPolicySynced(){
 	glog.V(6).Infof("OnNetworkPolicySynced")
 	policy.mu.Lock()
 	policy.networkPolicySynced = true
-	policy.setInitialized(policy.networkPolicySynced && policy.podSynced && policy.namespaceSynced)
+	policy.setInitialized(policy.allSynced())
 	policy.mu.Unlock()
 
 	policy.syncEnnPolicy(SYNCNETWORKPOLICY)
@@ -297,7 +468,7 @@ func (policy *EnnPolicy) OnPodSynced(){
 	glog.V(6).Infof("OnPodSynced")
 	policy.mu.Lock()
 	policy.podSynced = true
-	policy.setInitialized(policy.networkPolicySynced && policy.podSynced && policy.namespaceSynced)
+	policy.setInitialized(policy.allSynced())
 	policy.mu.Unlock()
 
 	policy.syncEnnPolicy(SYNCPOD)
@@ -335,17 +506,61 @@ func (policy *EnnPolicy) OnNamespaceSynced(){
 	glog.V(6).Infof("OnNamespaceSynced")
 	policy.mu.Lock()
 	policy.namespaceSynced = true
-	policy.setInitialized(policy.networkPolicySynced && policy.podSynced && policy.namespaceSynced)
+	policy.setInitialized(policy.allSynced())
 	policy.mu.Unlock()
 
 	policy.syncEnnPolicy(SYNCNAMESPACE)
 }
 
+func (policy *EnnPolicy) OnNodeAdd(node *api.Node){
+	glog.V(6).Infof("OnNodeAdd node name: %s", node.Name)
+	glog.V(6).Infof("policy initialized %v", policy.isInitialized())
+	if policy.nodeChanges.Update(node.Name, nil, node) && policy.isInitialized() {
+		policy.syncEnnPolicy(SYNCNODE)
+	}
+}
+
+func (policy *EnnPolicy) OnNodeUpdate(oldNode, node *api.Node){
+	glog.V(6).Infof("OnNodeUpdate old node name: %s; new node name: %s", oldNode.Name, node.Name)
+	glog.V(6).Infof("policy initialized %v", policy.isInitialized())
+	if policy.nodeChanges.Update(node.Name, oldNode, node) && policy.isInitialized() {
+		policy.syncEnnPolicy(SYNCNODE)
+	}
+}
+
+func (policy *EnnPolicy) OnNodeDelete(node *api.Node){
+	glog.V(6).Infof("OnNodeDelete node name: %s", node.Name)
+	glog.V(6).Infof("policy initialized %v", policy.isInitialized())
+	if policy.nodeChanges.Update(node.Name, node, nil) && policy.isInitialized() {
+		policy.syncEnnPolicy(SYNCNODE)
+	}
+}
+
+func (policy *EnnPolicy) OnNodeSynced(){
+	glog.V(6).Infof("OnNodeSynced")
+	policy.mu.Lock()
+	policy.nodeSynced = true
+	policy.setInitialized(policy.allSynced())
+	policy.mu.Unlock()
+
+	policy.syncEnnPolicy(SYNCNODE)
+}
+
+// allSynced returns true when networkPolicy & pods & namespace & nodes & globalNetworkPolicy & admin network policies
+// & services & endpoints have been received from master
+func (policy *EnnPolicy) allSynced() bool{
+	return policy.networkPolicySynced && policy.podSynced && policy.namespaceSynced && policy.nodeSynced &&
+		policy.globalNetworkPolicySynced && policy.adminNetworkPolicySynced && policy.baselineAdminNetworkPolicySynced &&
+		policy.serviceSynced && policy.endpointsSynced
+}
+
 func (policy *EnnPolicy) SyncLoop(stopCh <-chan struct{}, wg *sync.WaitGroup){
 
 	glog.V(2).Infof("enn policy start run loop")
-	t := time.NewTicker(policy.syncPeriod)
-	defer t.Stop()
+	t := time.NewTicker(policy.getSyncPeriod())
+	defer func() {
+		t.Stop()
+	}()
 	defer wg.Done()
 
 	for{
@@ -353,6 +568,11 @@ func (policy *EnnPolicy) SyncLoop(stopCh <-chan struct{}, wg *sync.WaitGroup){
 		case <-t.C:
 			glog.V(4).Infof("Periodic sync")
 			policy.Sync()
+		case <-policy.syncPeriodCh:
+			syncPeriod := policy.getSyncPeriod()
+			glog.V(2).Infof("sync period is changed to %v, restart periodic sync", syncPeriod)
+			t.Stop()
+			t = time.NewTicker(syncPeriod)
 		case <-stopCh:
 			glog.V(4).Infof("stop sync")
 			return
@@ -360,6 +580,78 @@ func (policy *EnnPolicy) SyncLoop(stopCh <-chan struct{}, wg *sync.WaitGroup){
 	}
 }
 
+func (policy *EnnPolicy) getSyncPeriod() time.Duration{
+	policy.mu.Lock()
+	defer policy.mu.Unlock()
+	return policy.syncPeriod
+}
+
+// ReloadConfig applies the reloadable fields of a validated config to the running enn-policy,
+// these fields are ip range, node gateway setting, local node setting, terminating pods, deny action, policy mode, conntrack flush, host endpoint setting and sync periods
+// a full sync is triggered so that rules for the new config take effect immediately
+func (policy *EnnPolicy) ReloadConfig(config *options.EnnPolicyConfig){
+
+	policy.mu.Lock()
+	glog.V(2).Infof("reload config: ip range %v, exclude ip range %v, accept node gateway %v, accept local node %v, sync period %v, min sync period %v",
+		config.IPRanges, config.ExcludeIPRanges, config.AcceptNodeGatewayIP, config.AcceptLocalNode, config.PolicyPeriod, config.MinSyncPeriod)
+	policy.iPRanges        = config.IPRanges
+	policy.excludeIPRanges = config.ExcludeIPRanges
+	policy.acceptNodeGateway = config.AcceptNodeGatewayIP
+	policy.acceptLocalNode   = config.AcceptLocalNode
+	policy.terminatingPods   = config.TerminatingPods
+	policy.denyAction        = config.DenyAction
+	policy.defaultPolicyMode = config.PolicyMode
+	policy.unsupportedPolicy = config.UnsupportedPolicyMode
+	policy.flushConntrack    = config.FlushConntrack
+	policy.fqdnMinTTL        = config.FQDNMinTTL
+	policy.hostEndpointNamespace = config.HostEndpointNamespace
+	// config is validated before it is reloaded, a parse error keeps the previous value anyway
+	if failsafeInbound, err := utilpolicy.ParseProtocolPorts(config.HostEndpointFailsafeInbound); err != nil{
+		glog.Errorf("reload config: invalid host endpoint failsafe inbound %v, keep previous value: %v", config.HostEndpointFailsafeInbound, err)
+	} else {
+		policy.failsafeInbound = failsafeInbound
+	}
+	if failsafeOutbound, err := utilpolicy.ParseProtocolPorts(config.HostEndpointFailsafeOutbound); err != nil{
+		glog.Errorf("reload config: invalid host endpoint failsafe outbound %v, keep previous value: %v", config.HostEndpointFailsafeOutbound, err)
+	} else {
+		policy.failsafeOutbound = failsafeOutbound
+	}
+	if exemptions, err := utilpolicy.ParseExemptions(config.ExemptNamespaces, config.ExemptNamespaceLabels, config.ExemptPodLabels, config.ExemptPriorityClasses); err != nil{
+		glog.Errorf("reload config: invalid exemptions, keep previous exemptions: %v", err)
+	} else {
+		policy.exemptions = exemptions
+	}
+	periodChanged := policy.syncPeriod != config.PolicyPeriod
+	if periodChanged || policy.minSyncPeriod != config.MinSyncPeriod{
+		policy.syncPeriod    = config.PolicyPeriod
+		policy.minSyncPeriod = config.MinSyncPeriod
+		policy.throttle      = newSyncThrottle(policy.syncPeriod, policy.minSyncPeriod)
+	}
+	policy.mu.Unlock()
+
+	if periodChanged{
+		select {
+		case policy.syncPeriodCh <- struct{}{}:
+		default:
+		}
+	}
+
+	if policy.isInitialized(){
+		policy.Sync()
+	}
+}
+
+// newSyncThrottle returns the rate limiter of syncEnnPolicy, nil means no limit
+func newSyncThrottle(syncPeriod, minSyncPeriod time.Duration) flowcontrol.RateLimiter{
+	if minSyncPeriod == 0{
+		return nil
+	}
+	qps := float32(time.Second) / float32(minSyncPeriod)
+	burst := 2
+	glog.V(3).Infof("minSyncPeriod: %v, syncPeriod: %v, burstSyncs: %d", minSyncPeriod, syncPeriod, burst)
+	return flowcontrol.NewTokenBucketRateLimiter(qps,burst)
+}
+
 func (policy *EnnPolicy) Sync(){
 
 	policy.syncEnnPolicy(SYNCALL)
@@ -395,23 +687,44 @@ func (policy *EnnPolicy) syncEnnPolicy(syncType int){
 		return
 	}
 
-	// ensure ipset for flannel net
-	flannelNetSet, err := policy.ensureFlannelNetSet()
+	// ensure ipset for node gateway ips
+	nodeGatewaySet, err := policy.ensureNodeGatewaySet()
+	if err!= nil{
+		glog.Errorf("ensure ipset for node gateway error %v", err)
+		return
+	}
+
+	// ensure ipset for local node ips
+	localNodeSet, err := policy.ensureLocalNodeSet()
 	if err!= nil{
-		glog.Errorf("ensure ipset for flannel net %s error %v", policy.iPRange, err)
+		glog.Errorf("ensure ipset for local node error %v", err)
+		return
+	}
+
+	// ensure ipset for all nodes in cluster
+	clusterNodeSet, err := policy.ensureClusterNodeSet()
+	if err!= nil{
+		glog.Errorf("ensure ipset for cluster node error %v", err)
 		return
 	}
 
 	// ensure ipset for iPRange
 	iPRangeSet, err := policy.ensureIPRangeSet()
 	if err!= nil{
-		glog.Errorf("ensure ipset for ip range %s error %v", policy.iPRange, err)
+		glog.Errorf("ensure ipset for ip range %v error %v", policy.iPRanges, err)
+		return
+	}
+
+	// ensure ipset for excluded iPRange
+	excludeIPRangeSet, err := policy.ensureExcludeIPRangeSet()
+	if err!= nil{
+		glog.Errorf("ensure ipset for exclude ip range %v error %v", policy.excludeIPRanges, err)
 		return
 	}
 
 	// don't sync rules till we've received networkPolicy & pods & namespace
-	if !policy.networkPolicySynced || !policy.podSynced || !policy.namespaceSynced {
-		glog.V(2).Info("Not syncing ipvs rules until networkPolicy & pods & namespace have been received from master")
+	if !policy.allSynced() {
+		glog.V(2).Info("Not syncing ipvs rules until networkPolicy & pods & namespace & nodes have been received from master")
 		return
 	}
 
@@ -428,6 +741,9 @@ func (policy *EnnPolicy) syncEnnPolicy(syncType int){
 		policy.podChanges.Lock.Lock()
 		policy.namespaceChanges.Lock.Lock()
 		utilpolicy.UpdateNetworkPolicyMap(policy.networkPolicyMap, &policy.networkPolicyChanges)
+		utilpolicy.UpdateGlobalNetworkPolicyMap(policy.globalNetworkPolicyMap, &policy.globalNetworkPolicyChanges)
+		utilpolicy.UpdateAdminNetworkPolicyMap(policy.adminNetworkPolicyMap, &policy.adminNetworkPolicyChanges)
+		utilpolicy.UpdateAdminNetworkPolicyMap(policy.baselineAdminNetworkPolicyMap, &policy.baselineAdminNetworkPolicyChanges)
 		utilpolicy.UpdatePodMatchLabelMap(policy.podMatchLabelMap, &policy.podChanges)
 		utilpolicy.UpdateNamespacePodMap(policy.namespacePodMap, &policy.podChanges)
 		utilpolicy.UpdateNamespaceInfoMap(policy.namespaceInfoMap, &policy.namespaceChanges)
@@ -436,6 +752,12 @@ func (policy *EnnPolicy) syncEnnPolicy(syncType int){
 		policy.namespaceChanges.CleanUpItem()
 		policy.podChanges.Lock.Unlock()
 		policy.namespaceChanges.Lock.Unlock()
+		policy.nodeChanges.Lock.Lock()
+		utilpolicy.UpdateNodeInfoMap(policy.nodeInfoMap, &policy.nodeChanges)
+		policy.refreshLocalNode()
+		policy.nodeChanges.CleanUpItem()
+		policy.nodeChanges.Lock.Unlock()
+		policy.updateServiceMaps()
 	}
 
 	// todo: delete unused iptables, delete unused ipsets(check whether label is deleted)
@@ -443,7 +765,7 @@ func (policy *EnnPolicy) syncEnnPolicy(syncType int){
 	case SYNCALL:
 		glog.V(4).Infof("syncType is SYNCALL, so sync all rules and check unused rule")
 		// no map changed so we need to sync the whole iptables rules and ipset rules
-		err := policy.initActiveIPSets(iPRangeSet, flannelNetSet)
+		err := policy.initActiveIPSets(iPRangeSet, excludeIPRangeSet, nodeGatewaySet, localNodeSet, clusterNodeSet)
 		if err != nil{
 			glog.Errorf("init active IPSets failed %v", err)
 		}
@@ -451,10 +773,24 @@ func (policy *EnnPolicy) syncEnnPolicy(syncType int){
 		if err != nil{
 			glog.Errorf("ensure ip range member err %v", err)
 		}
-		err = policy.ensureFlannelNetSetMember(flannelNetSet)
+		err = policy.ensureExcludeIPRangeSetMember(excludeIPRangeSet)
 		if err != nil{
-			glog.Errorf("ensure flannel net member err %v", err)
+			glog.Errorf("ensure exclude ip range member err %v", err)
 		}
+		err = policy.ensureNodeGatewaySetMember(nodeGatewaySet)
+		if err != nil{
+			glog.Errorf("ensure node gateway member err %v", err)
+		}
+		err = policy.ensureLocalNodeSetMember(localNodeSet)
+		if err != nil{
+			glog.Errorf("ensure local node member err %v", err)
+		}
+		err = policy.ensureClusterNodeSetMember(clusterNodeSet)
+		if err != nil{
+			glog.Errorf("ensure cluster node member err %v", err)
+		}
+		// kube-proxy may be switched to another mode without restarting enn-policy
+		policy.refreshProxyMode()
 		err = policy.syncPolicyRules()
 		if err != nil{
 			glog.Errorf("sync policy rule failed %v", err)
@@ -467,14 +803,17 @@ func (policy *EnnPolicy) syncEnnPolicy(syncType int){
 		if err != nil{
 			glog.Errorf("check unused ipsets failed %v", err)
 		}
-	case SYNCNETWORKPOLICY:
-		glog.V(4).Infof("syncType is SYNCNETWORKPOLICY, so sync all rules")
+	case SYNCNETWORKPOLICY, SYNCGLOBALNETWORKPOLICY, SYNCADMINNETWORKPOLICY:
+		glog.V(4).Infof("syncType is SYNCNETWORKPOLICY, SYNCGLOBALNETWORKPOLICY or SYNCADMINNETWORKPOLICY, so sync all rules")
 		// if networkPolicy map update, we need to sync the whole iptables rules
 		// since syncAllPodSets will sync ipset created by syncPolicyRules
 		// so we also neet to sync ipset rules
 		// todo: better use incremental update
 		utilpolicy.UpdateNetworkPolicyMap(policy.networkPolicyMap, &policy.networkPolicyChanges)
-		err := policy.initActiveIPSets(iPRangeSet, flannelNetSet)
+		utilpolicy.UpdateGlobalNetworkPolicyMap(policy.globalNetworkPolicyMap, &policy.globalNetworkPolicyChanges)
+		utilpolicy.UpdateAdminNetworkPolicyMap(policy.adminNetworkPolicyMap, &policy.adminNetworkPolicyChanges)
+		utilpolicy.UpdateAdminNetworkPolicyMap(policy.baselineAdminNetworkPolicyMap, &policy.baselineAdminNetworkPolicyChanges)
+		err := policy.initActiveIPSets(iPRangeSet, excludeIPRangeSet, nodeGatewaySet, localNodeSet, clusterNodeSet)
 		if err != nil{
 			glog.Errorf("init active IPSets failed %v", err)
 		}
@@ -496,6 +835,10 @@ func (policy *EnnPolicy) syncEnnPolicy(syncType int){
 		if err != nil{
 			glog.Errorf("sync pod ipset failed %v", err)
 		}
+		policy.syncAdminPolicySets()
+		policy.syncExemptSet()
+		// a relabeled or deleted pod may lose access without any change of iptables rules
+		policy.flushRevokedConnections()
 		policy.podChanges.CleanUpItem()
 		policy.podChanges.Lock.Unlock()
 
@@ -508,10 +851,76 @@ func (policy *EnnPolicy) syncEnnPolicy(syncType int){
 		if err != nil{
 			glog.Errorf("sync pod ipset failed %v", err)
 		}
+		policy.syncAdminPolicySets()
+		policy.syncExemptSet()
+		// terminal rules of ENN-PLY-* chains depend on annotations enn-policy/deny-action and enn-policy/policy-mode of namespaces,
+		// default deny policies are rendered from the legacy DefaultDeny annotation net.beta.kubernetes.io/network-policy,
+		// and globalNetworkPolicies are rendered in namespaces selected by their labels
+		if namespaceRulesChanged(&policy.namespaceChanges) || policy.globalPolicyNamespacesChanged(&policy.namespaceChanges){
+			glog.V(2).Infof("deny action, policy mode, DefaultDeny annotation or global policies of namespace are changed, so sync policy rules")
+			err = policy.initActiveIPSets(iPRangeSet, excludeIPRangeSet, nodeGatewaySet, localNodeSet, clusterNodeSet)
+			if err != nil{
+				glog.Errorf("init active IPSets failed %v", err)
+			}
+			err = policy.syncPolicyRules()
+			if err != nil{
+				glog.Errorf("sync policy rule failed %v", err)
+			}
+			err = policy.syncAllPodSets()
+			if err != nil{
+				glog.Errorf("sync pod ipset failed %v", err)
+			}
+		}
+		policy.flushRevokedConnections()
 		policy.namespaceChanges.CleanUpItem()
 		policy.namespaceChanges.Lock.Unlock()
+
+	case SYNCNODE:
+		glog.V(4).Infof("syncType is SYNCNODE, so sync node gateway set, local node set and cluster node set")
+		policy.nodeChanges.Lock.Lock()
+		oldNodeLabels := policy.localNodeLabels()
+		utilpolicy.UpdateNodeInfoMap(policy.nodeInfoMap, &policy.nodeChanges)
+		policy.refreshLocalNode()
+		err := policy.ensureNodeGatewaySetMember(nodeGatewaySet)
+		if err != nil{
+			glog.Errorf("ensure node gateway member err %v", err)
+		}
+		err = policy.ensureLocalNodeSetMember(localNodeSet)
+		if err != nil{
+			glog.Errorf("ensure local node member err %v", err)
+		}
+		err = policy.ensureClusterNodeSetMember(clusterNodeSet)
+		if err != nil{
+			glog.Errorf("ensure cluster node member err %v", err)
+		}
+		// host endpoint policies select nodes by labels, so rules need to be rebuilt if labels of this node are changed
+		if policy.hostEndpointNamespace != "" && !reflect.DeepEqual(oldNodeLabels, policy.localNodeLabels()){
+			glog.V(2).Infof("labels of local node %s are changed, so sync host endpoint policy", policy.hostName)
+			err = policy.initActiveIPSets(iPRangeSet, excludeIPRangeSet, nodeGatewaySet, localNodeSet, clusterNodeSet)
+			if err != nil{
+				glog.Errorf("init active IPSets failed %v", err)
+			}
+			err = policy.syncPolicyRules()
+			if err != nil{
+				glog.Errorf("sync policy rule failed %v", err)
+			}
+			err = policy.syncAllPodSets()
+			if err != nil{
+				glog.Errorf("sync pod ipset failed %v", err)
+			}
+		}
+		policy.nodeChanges.CleanUpItem()
+		policy.nodeChanges.Lock.Unlock()
+
+	case SYNCSERVICE:
+		glog.V(4).Infof("syncType is SYNCSERVICE, so sync service sets")
+		// rules of EgressServices only match ipsets of services, so only entries need to be synced
+		policy.updateServiceMaps()
+		policy.syncServiceSets()
 	}
 
+	// pods of denied flows are resolved with pods of this sync
+	policy.updateFlowLogPods()
 }
 
 // insert ennPolicy entry in filter tables, e.g
@@ -566,164 +975,143 @@ func (policy *EnnPolicy) ensureEnnEntry() error{
 }
 
 
-// insert ipset for ip range e.g:
-// Name: ENN-FLANNEL-xxxxxx
+// insert ipset for node gateway ips e.g:
+// Name: ENN-NODE-GATEWAY
 // Type: hash:ip
 // Revision: 2
 // Header: family inet hashsize 1024 maxelem 65536
 // Size in memory: 448
 // References: 1
 // Members:
-// 10.244.0.0
-// 10.244.0.1
-func (policy *EnnPolicy) ensureFlannelNetSet() (*utilIPSet.IPSet, error){
-	glog.V(4).Infof("start to ensure flannel net ip set")
-	flannelNetName := ennFlannelIPSetName(policy.flannelNet, strconv.Itoa(policy.flannelLen))
-	flannelNetSet := &utilIPSet.IPSet{
-		Name:    flannelNetName,
+// 10.244.1.0
+// 10.244.1.1
+// 192.168.1.10
+func (policy *EnnPolicy) ensureNodeGatewaySet() (*utilIPSet.IPSet, error){
+	glog.V(4).Infof("start to ensure node gateway ip set")
+	nodeGatewaySet := &utilIPSet.IPSet{
+		Name:    ENN_NODE_GATEWAY_SET,
 		Type:    utilIPSet.TypeHashIP,
 	}
-	err := policy.ipsetInterface.CreateIPSet(flannelNetSet, true)
+	err := policy.ipsetInterface.CreateIPSet(nodeGatewaySet, true)
 	if err!= nil{
-		return nil, fmt.Errorf("ensure flannelNetSet error %v", err)
+		return nil, fmt.Errorf("ensure nodeGatewaySet error %v", err)
 	}
-	return flannelNetSet, nil
+	return nodeGatewaySet, nil
 }
 
-func (policy *EnnPolicy) ensureFlannelNetSetMember(flannelNetSet *utilIPSet.IPSet) error{
-
-	if !policy.acceptFlannel{
-		glog.V(4).Infof("accept flannel is set to false, so skip ensure flannelNetSet members")
-		return nil
-	}
-
-	if policy.flannelLen > 32 || policy.flannelLen < 0 {
-		return fmt.Errorf("invalid flannelLen:%d", policy.flannelLen)
-	}
+// ensureNodeGatewaySetMember builds entries from the podCIDR and InternalIPs of every node,
+// so it works for any bridge based cni and any podCIDR size
+func (policy *EnnPolicy) ensureNodeGatewaySetMember(nodeGatewaySet *utilIPSet.IPSet) error{
 
-	str := strings.Split(policy.flannelNet, "/")
-	if len(str) != 2{
-		return fmt.Errorf("invalid flannelNet:%s", policy.flannelNet)
+	var ips []string
+	if policy.acceptNodeGateway{
+		ips = utilpolicy.NodeGatewayIPs(policy.nodeInfoMap)
+	} else {
+		glog.V(4).Infof("accept node gateway is set to false, so keep nodeGatewaySet empty")
 	}
 
-	// get flannel net ip
-	flannelIP   := str[0]
-	ips := strings.Split(flannelIP, ".")
-	if len(ips) != 4{
-		return fmt.Errorf("invalid flannelNet:%s", policy.flannelNet)
-	}
-	flannelIpsInt, err := utiltool.IpStringToInt(ips)
+	err := policy.syncIPSetEntryForIP(nodeGatewaySet, ips)
 	if err != nil{
-		return fmt.Errorf("invalid flannelNet:%s", policy.flannelNet)
+		return fmt.Errorf("ensure nodeGatewaySet member error %v", err)
 	}
+	return nil
+}
 
-	// get flannel net sublen
-	flannelMask, err := strconv.Atoi(str[1])
-	if err != nil{
-		return fmt.Errorf("invalid flannelNet:%s", policy.flannelNet)
+// insert ipset for local node ips e.g:
+// Name: ENN-LOCAL-NODE
+// Type: hash:ip
+// Revision: 2
+// Header: family inet hashsize 1024 maxelem 65536
+// Size in memory: 448
+// References: 1
+// Members:
+// 192.168.1.10
+// 10.244.1.1
+func (policy *EnnPolicy) ensureLocalNodeSet() (*utilIPSet.IPSet, error){
+	glog.V(4).Infof("start to ensure local node ip set")
+	localNodeSet := &utilIPSet.IPSet{
+		Name:    ENN_LOCAL_NODE_SET,
+		Type:    utilIPSet.TypeHashIP,
 	}
-	//flanelSubLen := 32 - flannelMask
-	dockerMask   := flannelMask + policy.flannelLen
-	if dockerMask > 32 || dockerMask < 0 {
-		return fmt.Errorf("invalid dockerMask, flannelNet:%s, flannelLen:%d", policy.flannelNet, policy.flannelLen)
+	err := policy.ipsetInterface.CreateIPSet(localNodeSet, true)
+	if err!= nil{
+		return nil, fmt.Errorf("ensure localNodeSet error %v", err)
 	}
-	dockerSubLen := 32 - dockerMask
+	return localNodeSet, nil
+}
+
+// ensureLocalNodeSetMember adds the node ip and the bridge gateway of this node,
+// so that kubelet health probes can reach pods on this node, traffic from other nodes is not matched
+func (policy *EnnPolicy) ensureLocalNodeSetMember(localNodeSet *utilIPSet.IPSet) error{
 
-	// build flannel/docker ip map
-	// add all possible flannel ips and docker ips
-	// flannel ip end up with .0 and docker ip end up with .1
-	var item int
-	for item = 0; item * 8 <= dockerSubLen; item ++{}
-	item --
-	if item == 0{
-		return fmt.Errorf("dockerSubLen is less than 8: %d", dockerSubLen)
+	var ips []string
+	if policy.acceptLocalNode{
+		ips = utilpolicy.LocalNodeIPs(policy.nodeIP, policy.clusterCIDR)
+	} else {
+		glog.V(4).Infof("accept local node is set to false, so keep localNodeSet empty")
 	}
-	dockerBit := dockerSubLen - item * 8
-	step      := utiltool.PowerInt(2, dockerBit)
-	stepLimit := utiltool.PowerInt(2, policy.flannelLen)
 
+	err := policy.syncIPSetEntryForIP(localNodeSet, ips)
+	if err != nil{
+		return fmt.Errorf("ensure localNodeSet member error %v", err)
+	}
+	return nil
+}
 
-	flanelIPMap := make(map[string]bool)
+// refreshLocalNode updates clusterCIDR and nodeIP when spec or status of this node is changed,
+// so that they are no longer fixed to the values read at startup
+func (policy *EnnPolicy) refreshLocalNode(){
 
-	for i := 0; i < stepLimit; i++{
-		// add flannel ip (end up with .0)
-		ipString, err := utiltool.IpIntToString(flannelIpsInt)
-		if err != nil{
-			fmt.Errorf("ensureFlannelNetSetMember: invalid ip err: %v", err)
-		} else {
-			flanelIPMap[ipString] = true
-		}
-		// add docker ip (end up with .1)
-		dockerIpsInt, err := utiltool.IpOperateAdd(flannelIpsInt, 0, 1)
-		if err != nil{
-			fmt.Errorf("ensureFlannelNetSetMember: ip add step error: %v", err)
-		} else {
-			ipString, err := utiltool.IpIntToString(dockerIpsInt)
-			if err != nil{
-				fmt.Errorf("ensureFlannelNetSetMember: invalid ip err: %v", err)
-			} else {
-				flanelIPMap[ipString] = true
-			}
-		}
-		// get next flannel ip
-		flannelIpsInt, err = utiltool.IpOperateAdd(flannelIpsInt, item, step)
-		if err != nil{
-			fmt.Errorf("ensureFlannelNetSetMember: ip add step error: %v", err)
-			break
-		}
+	nodeInfo, ok := policy.nodeInfoMap[policy.hostName]
+	if !ok{
+		glog.V(4).Infof("local node %s is not found in node informer, keep clusterCIDR %s and nodeIP %v", policy.hostName, policy.clusterCIDR, policy.nodeIP)
+		return
 	}
-
-	kernelSet, err := policy.ipsetInterface.GetIPSet(flannelNetSet.Name)
-	if err!= nil{
-		return err
+	if nodeInfo.PodCIDR != "" && nodeInfo.PodCIDR != policy.clusterCIDR{
+		glog.V(2).Infof("clusterCIDR of local node %s is changed from %s to %s", policy.hostName, policy.clusterCIDR, nodeInfo.PodCIDR)
+		policy.clusterCIDR = nodeInfo.PodCIDR
 	}
-	kernelEntries, err := policy.ipsetInterface.ListEntry(kernelSet)
-	if err!= nil{
-		return err
+	if nodeIP := nodeInfo.HostIP(); nodeIP != nil && !nodeIP.Equal(policy.nodeIP){
+		glog.V(2).Infof("nodeIP of local node %s is changed from %v to %v", policy.hostName, policy.nodeIP, nodeIP)
+		policy.nodeIP = nodeIP
 	}
+}
 
-	//delete unused entries
-	for _, kernelEntry := range kernelEntries{
-		glog.V(7).Infof("kernel entry is type:%s, ip:%s, port:%s, net:%s",
-			kernelEntry.Type, kernelEntry.IP, kernelEntry.Port, kernelEntry.Net)
-		ip, err := utilIPSet.EntryToString(kernelEntry)
-		if err!= nil{
-			glog.Errorf("get entry err ipset:%s, entry type:%s err:%v", kernelSet.Name, kernelEntry.Type, err)
-			continue
-		}
-		_, ok := flanelIPMap[ip]
-		if !ok{
-			glog.V(6).Infof("find unused entry %s of ipset %s:%s so delete it", ip, kernelSet.Name, kernelSet.Type)
-			err := policy.ipsetInterface.DelEntry(kernelSet, kernelEntry, false)
-			if err != nil{
-				glog.Errorf("ensureFlannelNetSetMember error : %v", err)
-				continue
-			}
-		}
-	}
-	// add new entries
-	kernelEntryIPMap := make(map[string]bool)
-	for _, kernelEntry := range kernelEntries{
-		kernelEntryIPMap[kernelEntry.IP] = true
+// insert ipset for all nodes in cluster e.g:
+// Name: ENN-CLUSTER-NODE
+// Type: hash:net
+// Revision: 6
+// Header: family inet hashsize 1024 maxelem 65536
+// Size in memory: 448
+// References: 0
+// Members:
+// 192.168.1.10
+// 192.168.1.11
+// 10.244.1.0/24
+// 10.244.2.0/24
+// no rule matches the set yet, it is kept up to date by the node informer as groundwork for rules of host traffic,
+// so they can match all nodes without waiting for the set to be filled
+func (policy *EnnPolicy) ensureClusterNodeSet() (*utilIPSet.IPSet, error){
+	glog.V(4).Infof("start to ensure cluster node set")
+	clusterNodeSet := &utilIPSet.IPSet{
+		Name:    ENN_CLUSTER_NODE_SET,
+		Type:    utilIPSet.TypeHashNet,
 	}
-	for ip := range flanelIPMap{
-		glog.V(7).Infof("podInfoMap ip is %s", ip)
-		_, ok := kernelEntryIPMap[ip]
-		if !ok{
-			glog.V(6).Infof("find new entry %s of ipset %s:%s so add it", ip, kernelSet.Name, kernelSet.Type)
-			entry := &utilIPSet.Entry{
-				IP:    ip,
-				Type:  utilIPSet.TypeHashIP,
-			}
-			err := policy.ipsetInterface.AddEntry(kernelSet, entry, true)
-			if err != nil{
-				glog.Errorf("ensureFlannelNetSetMember error : %v", err)
-				continue
-			}
-		}
+	err := policy.ipsetInterface.CreateIPSet(clusterNodeSet, true)
+	if err!= nil{
+		return nil, fmt.Errorf("ensure clusterNodeSet error %v", err)
 	}
+	return clusterNodeSet, nil
+}
 
+// ensureClusterNodeSetMember adds addresses and podCIDR of every node in cluster
+func (policy *EnnPolicy) ensureClusterNodeSetMember(clusterNodeSet *utilIPSet.IPSet) error{
 
+	entries := utilpolicy.NodeNetEntries(policy.nodeInfoMap)
+	err := policy.syncIPSetEntryForNet(clusterNodeSet, entries)
+	if err != nil{
+		return fmt.Errorf("ensure clusterNodeSet member error %v", err)
+	}
 	return nil
 }
 
@@ -736,9 +1124,10 @@ func (policy *EnnPolicy) ensureFlannelNetSetMember(flannelNetSet *utilIPSet.IPSe
 // References: 1
 // Members:
 // 10.244.0.0/16
+// 192.168.10.0/24
 func (policy *EnnPolicy) ensureIPRangeSet() (*utilIPSet.IPSet, error){
 	glog.V(4).Infof("start to ensure IPRangeSet")
-	iPRangeName := ennIPRangeIPSetName(policy.iPRange)
+	iPRangeName := ennIPRangeIPSetName(policy.ipRangeKey())
 	iPRangeSet := &utilIPSet.IPSet{
 		Name:    iPRangeName,
 		Type:    utilIPSet.TypeHashNet,
@@ -750,64 +1139,68 @@ func (policy *EnnPolicy) ensureIPRangeSet() (*utilIPSet.IPSet, error){
 	return iPRangeSet, nil
 }
 
+// ipset cannot handle 0.0.0.0/0, so 0.0.0.0/0 is stored as 0.0.0.0/1 and 128.0.0.0/1
+// rules do not match this ipset if 0.0.0.0/0 is one of ip ranges, but entries are still kept correct
 func (policy *EnnPolicy) ensureIPRangeSetMember(iPRangeSet *utilIPSet.IPSet) error{
 
-	entries, err := policy.ipsetInterface.ListEntry(iPRangeSet)
+	err := policy.syncIPSetEntryForNet(iPRangeSet, utilpolicy.IPRangeSetEntries(policy.iPRanges))
 	if err != nil{
 		return fmt.Errorf("ensure IPRangeSetMember error %v", err)
 	}
-	// delete unused entry for IPRangeSet
-	for _, entry := range entries{
-		net, err := utilIPSet.EntryToString(entry)
-		if err != nil{
-			return fmt.Errorf("invalid IPRangeSet %v", err)
-		}
-		if strings.Compare(net, policy.iPRange) != 0{
-			glog.V(6).Infof("find unused entry: %s of ipset %s:%s so delete it", net, iPRangeSet.Name, iPRangeSet.Type)
-			err := policy.ipsetInterface.DelEntry(iPRangeSet, entry, false)
-			if err != nil{
-				return fmt.Errorf("ensure IPRangeSetMember error %v", err)
-			}
-		}
-	}
-
-	// add iPRange to IPRangeSet
-
-	if strings.Compare(policy.iPRange, "0.0.0.0/0") == 0{
-		glog.V(4).Infof("default ip range is 0.0.0.0/0, so skip add entry (ipset cannot handle 0.0.0.0/0)")
-		return nil
-	}
+	return nil
+}
 
-	iPRangeEntry := &utilIPSet.Entry{
+// insert ipset for excluded ip range, traffic from/to these ranges is always accepted e.g:
+// Name: ENN-RANGEEX-xxxxxx
+// Type: hash:net
+// Members:
+// 10.244.255.0/24
+func (policy *EnnPolicy) ensureExcludeIPRangeSet() (*utilIPSet.IPSet, error){
+	glog.V(4).Infof("start to ensure ExcludeIPRangeSet")
+	excludeIPRangeName := ennExcludeIPRangeIPSetName(policy.ipRangeKey())
+	excludeIPRangeSet := &utilIPSet.IPSet{
+		Name:    excludeIPRangeName,
 		Type:    utilIPSet.TypeHashNet,
-		Net:     policy.iPRange,
 	}
-	err = policy.ipsetInterface.AddEntry(iPRangeSet, iPRangeEntry, true)
+	err := policy.ipsetInterface.CreateIPSet(excludeIPRangeSet, true)
 	if err!= nil{
-		return fmt.Errorf("ensure IPRangeSet  add entry error %v", err)
+		return nil, fmt.Errorf("ensure ExcludeIPRangeSet error %v", err)
+	}
+	return excludeIPRangeSet, nil
+}
+
+func (policy *EnnPolicy) ensureExcludeIPRangeSetMember(excludeIPRangeSet *utilIPSet.IPSet) error{
+
+	err := policy.syncIPSetEntryForNet(excludeIPRangeSet, utilpolicy.IPRangeSetEntries(policy.excludeIPRanges))
+	if err != nil{
+		return fmt.Errorf("ensure ExcludeIPRangeSetMember error %v", err)
 	}
 	return nil
 }
 
+// ipRangeKey identifies current included and excluded ip ranges
+// it is used in names of ip range ipsets and ENN-PLY-IN/ENN-PLY-E chains
+func (policy *EnnPolicy) ipRangeKey() string{
+	return utilpolicy.IPRangeKey(policy.iPRanges, policy.excludeIPRanges)
+}
+
 // initActiveIPSets will init policy.activeIPSets
-// and add first ipset "ipRangeSet" into this map
+// and add base ipsets which are not created by syncPolicyRules into this map,
+// e.g ipRangeSet, excludeIPRangeSet, nodeGatewaySet, localNodeSet and clusterNodeSet
 // this map will store ipsets which created by enn-policy
 // enn-policy will only sync ipsets which is "active"
-func (policy *EnnPolicy) initActiveIPSets(iPRangeSet, flannelNetSet *utilIPSet.IPSet) error{
-	// init activeIPSets
+func (policy *EnnPolicy) initActiveIPSets(baseIPSets ...*utilIPSet.IPSet) error{
 	policy.activeIPSets = make(map[string]*utilIPSet.IPSet)
-	if iPRangeSet == nil{
-		return fmt.Errorf("ipRangeSet is nil")
-	}
-	if flannelNetSet == nil{
-		return fmt.Errorf("flannelNetSet is nil")
+	for i, ipset := range baseIPSets{
+		if ipset == nil{
+			return fmt.Errorf("base ipset %d is nil", i)
+		}
+		policy.activeIPSets[ipset.Name] = ipset
 	}
-	policy.activeIPSets[iPRangeSet.Name]    = iPRangeSet
-	policy.activeIPSets[flannelNetSet.Name] = flannelNetSet
 	return nil
 }
 
-// syncPolicyRules will scan the whole networkPolicyMap and create iptables filter rule
+// syncPolicyRules will scan the whole networkPolicyMap and globalNetworkPolicyMap and create iptables filter rule
 // s for each networkPolicyInfo
 // syncPolicyReles will also create ipset for namespace/podSelector/namespaceSelector/ipRange for each networkPolicyInfo if required
 // these ipsets will be stored in map and entries will be added in syncPodSets function
@@ -822,13 +1215,21 @@ func (policy *EnnPolicy) syncPolicyRules() error{
 	//}
 	var args []string
 	policy.existingFilterChains = make(map[utiliptables.Chain]string)
+	policy.events.startSync()
 
 	policy.iptablesData.Reset()
-	err := policy.k8siptablesInterface.SaveInto(utiliptables.TableFilter, policy.iptablesData)
+	var err error
+	if policy.policyCounters != nil{
+		// counters of rules written by the last sync are read before they are restored again
+		err = policy.k8siptablesInterface.SaveCountersInto(utiliptables.TableFilter, policy.iptablesData)
+	} else {
+		err = policy.k8siptablesInterface.SaveInto(utiliptables.TableFilter, policy.iptablesData)
+	}
 	if err != nil { // if we failed to get any rules
 		glog.Errorf("Failed to execute iptables-save, syncing all rules: %v", err)
 	} else { // otherwise parse the output
 		policy.existingFilterChains = utiliptables.GetChainLines(utiliptables.TableFilter, policy.iptablesData.Bytes())
+		policy.collectPolicyCounters(policy.iptablesData.Bytes())
 	}
 
 	// Reset all buffers used later.
@@ -857,13 +1258,45 @@ func (policy *EnnPolicy) syncPolicyRules() error{
 		writeLine(policy.filterChains, utiliptables.MakeChainLine(utiliptables.Chain(ENN_FORWARD_CHAIN)))
 	}
 
+	// rules for kube-proxy mode should be the first rules of ENN-INPUT/ENN-OUTPUT/ENN-FORWARD
+	policy.writeProxyModeRules()
+	// exempted pods never jump into entries of their namespace, see exemptedMatch
+	policy.createExemptSet()
+
 	// Accumulate NAT chains to keep.
 	policy.activeFilterChains = make(map[utiliptables.Chain]bool) // use a map as a set
-
-	for _, networkPolicy := range policy.networkPolicyMap {
+	policy.policyChainNamespaces = make(map[utiliptables.Chain]string)
+	policy.policyChainOwners = make(map[utiliptables.Chain]policyCounterOwner)
+	policy.auditRuleOwners = make(map[string]policyCounterOwner)
+	policy.flowLogPolicies = make(map[string]string)
+
+	// allow marks are set by ENN-PRIORITY and ENN-ANP-*, and checked by the entries of namespaces
+	policy.writeAllowMarkReset()
+	// explicit rules of globalNetworkPolicies are evaluated before the entries of namespaces
+	policy.writePriorityEntry()
+	// adminNetworkPolicies are evaluated before the entries of namespaces, see adminpolicy.go
+	policy.writeAdminPolicyRules()
+	// names of EgressFQDNs which are not rendered again are pruned after all networkPolicies are rendered
+	policy.resetFQDNSets()
+	policy.serviceSets = make(map[types.NamespacedName]*utilIPSet.IPSet)
+
+	// globalNetworkPolicies are rendered ahead of namespaced networkPolicies
+	for _, networkPolicy := range policy.renderedNetworkPolicies() {
 		policyName := networkPolicy.Name
 		policyNamespace := networkPolicy.Namespace
 
+		if policy.isHostEndpointPolicy(networkPolicy){
+			if !policy.rejectHostEndpointPolicy(networkPolicy){
+				glog.V(4).Infof("networkpolicy %s/%s is a host endpoint policy, so skip pod rules", policyNamespace, policyName)
+			}
+			continue
+		}
+		// render what enn-policy can enforce for a policy which is not fully supported
+		networkPolicy = policy.enforcedNetworkPolicy(networkPolicy)
+		if networkPolicy == nil{
+			continue
+		}
+
 		// create ipset for corresponding namespace (NetworkPolicy.metadata.namespace)
 		glog.V(4).Infof("networkpolicy %s is defined in namespace %s, so create ipset for this namespace", networkPolicy.Name, networkPolicy.Namespace)
 		namespacePodSetName := ennNamespaceIPSetName(policyNamespace)
@@ -874,6 +1307,7 @@ func (policy *EnnPolicy) syncPolicyRules() error{
 		err := policy.ipsetInterface.CreateIPSet(namespaceIPSet, true)
 		if err != nil{
 			glog.Errorf("networkPolicy %s create ipset for namespace %s err %v", policyName, policyNamespace, err)
+			policy.events.policyError(networkPolicy, "create ipset for namespace %s err %v", policyNamespace, err)
 			continue
 		}
 		// add IPSet into map if this IPSet is not created
@@ -886,6 +1320,7 @@ func (policy *EnnPolicy) syncPolicyRules() error{
 		// create ipset for corresponding policy podSelector (NetworkPolicy.spec.podSelector)
 		// var policyPodSetNames []string
 		var xLabel []string
+		targetPodSetName := namespacePodSetName
 		specPodSelector := &utilpolicy.NamespacedLabelMap{
 			Namespace:  policyNamespace,
 			Label:      make(map[string]string),
@@ -906,6 +1341,7 @@ func (policy *EnnPolicy) syncPolicyRules() error{
 					labelValue,
 					err,
 				)
+				policy.events.policyError(networkPolicy, "create ipset for spec.podSelector %s=%s err %v", labelKey, labelValue, err)
 				continue
 			}
 			// policyPodSetNames = append(policyPodSetNames, policyPodSetName)
@@ -935,11 +1371,12 @@ func (policy *EnnPolicy) syncPolicyRules() error{
 			}
 			err := policy.ipsetInterface.CreateIPSet(policyIPSet, true)
 			if err != nil{
-				glog.Errorf("networkPolicy %s:%s create ipset for policy spec podSelector",
+				glog.Errorf("networkPolicy %s:%s create ipset for policy spec podSelector err %v",
 					policyName,
 					policyNamespace,
 					err,
 				)
+				policy.events.policyError(networkPolicy, "create ipset for spec.podSelector err %v", err)
 			}
 			policy.activeIPSets[policyIPSet.Name] = policyIPSet
 
@@ -950,7 +1387,9 @@ func (policy *EnnPolicy) syncPolicyRules() error{
 			policy.podXLabelSet[namespaceName] = policyIPSet
 
 			policy.activeIPSets[policyIPSet.Name] = policyIPSet
+			targetPodSetName = policyPodSetName
 		}
+		policy.collectPriorityRules(networkPolicy, targetPodSetName)
 
 		// create iptables rules in filter table
 		// todo: should better use iptables-save/restore
@@ -967,6 +1406,17 @@ func (policy *EnnPolicy) syncPolicyRules() error{
 		}
 	}
 
+	policy.writePriorityRules()
+	// baselineAdminNetworkPolicies only see traffic which is not handled by the entries of namespaces
+	policy.writeBaselineAdminPolicyRules()
+
+	// rules of host endpoint are appended after the namespace entries of ENN-OUTPUT
+	policy.syncHostEndpointRules()
+	policy.pruneFQDNSets()
+	policy.syncServiceSets()
+	policy.syncExemptSet()
+	policy.updateSupportMetrics()
+
 	for chain := range policy.activeFilterChains {
 		chainString := string(chain)
 		if strings.HasPrefix(chainString, "ENN-PLY-"){
@@ -981,15 +1431,11 @@ func (policy *EnnPolicy) syncPolicyRules() error{
 			}
 			writeLine(policy.filterRules, args...)
 
-			// reject other traffic by default
+			// reject other traffic by default, or handle it by the deny action of the namespace
 			// iptables -t filter -A ENN-PLY-x-xxxxxx -j REJECT
 			// need to ensure this sure should always be the last rule of chain ENN-PLY-x-xxxxx
-			args = []string{
-				"-A", chainString,
-				"-m", "comment", "--comment", `"defualt reject rule"`,
-				"-j", "REJECT",
-			}
-			writeLine(policy.filterRules, args...)
+			policy.writeDenyRules(policy.policyChainNamespaces[chain], chainString,
+				chainFlowDirection(chainString), flowLogDefaultPolicy, `"defualt reject rule"`)
 		}
 	}
 
@@ -1001,8 +1447,13 @@ func (policy *EnnPolicy) syncPolicyRules() error{
 				!strings.HasPrefix(chainString, "ENN-EGRESS-") &&
 				!strings.HasPrefix(chainString, "ENN-PLY-IN-") &&
 				!strings.HasPrefix(chainString, "ENN-PLY-E-") &&
+				!strings.HasPrefix(chainString, "ENN-PLY-HIN-") &&
+				!strings.HasPrefix(chainString, "ENN-PLY-HE-") &&
 				!strings.HasPrefix(chainString, "ENN-DPATCH-")&&
-				!strings.HasPrefix(chainString, "ENN-IPCIDR-"){
+				!strings.HasPrefix(chainString, "ENN-IPCIDR-") &&
+				!strings.HasPrefix(chainString, "ENN-PRIORITY") &&
+				!strings.HasPrefix(chainString, "ENN-ANP-") &&
+				!strings.HasPrefix(chainString, "ENN-BANP-"){
 				// Ignore chains that aren't ours.
 				continue
 			}
@@ -1023,15 +1474,26 @@ func (policy *EnnPolicy) syncPolicyRules() error{
 	policy.iptablesData.Write(policy.filterChains.Bytes())
 	policy.iptablesData.Write(policy.filterRules.Bytes())
 
+	// references in NFLOG prefixes of the new rules are resolved by the collector once they are restored
+	policy.updateFlowLogPolicies()
 	glog.V(5).Infof("Restoring iptables rules: %s", policy.iptablesData.Bytes())
 	//fmt.Printf("Restoring iptables rules: %s", policy.iptablesData.Bytes())
 	err = policy.k8siptablesInterface.RestoreAll(policy.iptablesData.Bytes(), utiliptables.NoFlushTables, utiliptables.RestoreCounters)
+	// failure of iptables-restore is recorded on node since no rule of any policy is applied
+	policy.events.finishSync(policy.networkPolicyMap, policy.globalNetworkPolicyMap, policy.namespaceInfoMap, policy.unsupportedMessage, err)
 	if err != nil {
 		glog.Errorf("Failed to execute iptables-restore: %v", err)
 
 		return err
 	}
 
+	if policy.policyCounters != nil{
+		policy.policyCounters.reset()
+	}
+
+	// connections allowed by the last sync keep working by RELATED,ESTABLISHED unless their conntrack entries are deleted
+	policy.flushRevokedConnections()
+
 	return nil
 }
 
@@ -1066,23 +1528,30 @@ func (policy *EnnPolicy) syncIngressRule(networkPolicy *utilpolicy.NetworkPolicy
 			"-m", "set", "--match-set", namespacePodSetName, "dst",
 			"-m", "comment", "--comment", comment,
 		}
+		args = append(args, policy.adminAllowedMatch(adminAllowIngressMark)...)
+		args = append(args, policy.exemptedMatch("dst")...)
 		writeLine(policy.filterRules, append(args, "-j", namespaceIngressChainName)...)
 		args = []string{
 			"-A", string(ENN_OUTPUT_CHAIN),
 			"-m", "set", "--match-set", namespacePodSetName, "dst",
 			"-m", "comment", "--comment", comment,
 		}
+		args = append(args, policy.adminAllowedMatch(adminAllowIngressMark)...)
+		args = append(args, policy.exemptedMatch("dst")...)
 		writeLine(policy.filterRules, append(args, "-j", namespaceIngressChainName)...)
 	}
 
 	// create iptables ingress policy rule for iPRange, like
 	// iptables -t filter -N ENN-PLY-IN-xxxxxx
-	// iptables -t filter -A ENN-INGRESS-xxxxxx -m set --match-set [flannelRnage] src -j ACCEPT
+	// iptables -t filter -A ENN-INGRESS-xxxxxx -m set --match-set ENN-NODE-GATEWAY src -j ACCEPT
+	// iptables -t filter -A ENN-INGRESS-xxxxxx -m set --match-set ENN-LOCAL-NODE src -j ACCEPT
+	// iptables -t filter -A ENN-INGRESS-xxxxxx -m set --match-set [excludeIPRange] src -j ACCEPT
 	// iptables -t filter -A ENN-INGRESS-xxxxxx -m set --match-set [iPRange] src -j ENN-PLY-IN-xxxxxx
 	// iptables -t filter -A ENN-INGRESS-xxxxxx -j ACCEPT
 
-	glog.V(4).Infof("process iptables ingress policy rule for iPRange %s/ ", policy.iPRange)
-	iPRangeIngressChainName := ennIPRangeIngressChainName(networkPolicy.Namespace, policy.iPRange)
+	ipRangeKey := policy.ipRangeKey()
+	glog.V(4).Infof("process iptables ingress policy rule for iPRange %s", ipRangeKey)
+	iPRangeIngressChainName := ennIPRangeIngressChainName(networkPolicy.Namespace, ipRangeKey)
 	chainName = utiliptables.Chain(iPRangeIngressChainName)
 	if chain, ok := policy.existingFilterChains[chainName]; ok {
 		writeLine(policy.filterChains, chain)
@@ -1096,29 +1565,52 @@ func (policy *EnnPolicy) syncIngressRule(networkPolicy *utilpolicy.NetworkPolicy
 	} else {
 
 		policy.activeFilterChains[chainName] = true
-		if policy.acceptFlannel{
-			glog.V(4).Infof("process iptables ingress policy rule for all flannel/docker ips: %s", policy.flannelNet)
-			flannelNetName := ennFlannelIPSetName(policy.flannelNet, strconv.Itoa(policy.flannelLen))
-			comment := fmt.Sprintf(`"match flannel ip net: %s"`, policy.flannelNet)
+		policy.policyChainNamespaces[chainName] = networkPolicy.Namespace
+		if policy.acceptNodeGateway{
+			glog.V(4).Infof("process iptables ingress policy rule for all node gateway ips")
+			comment := `"match node gateway ip"`
 			args = []string{
 				"-A", namespaceIngressChainName,
-				"-m", "set", "--match-set", flannelNetName, "src",
+				"-m", "set", "--match-set", ENN_NODE_GATEWAY_SET, "src",
 				"-m", "comment", "--comment", comment,
 				"-j", "ACCEPT",
 			}
 			writeLine(policy.filterRules, args...)
 		}
-		if strings.Compare(policy.iPRange, "0.0.0.0/0") == 0 {
-			glog.V(4).Infof("iprange is default value 0.0.0.0/0 so derectly jump to iPRangeChain")
-			comment := fmt.Sprintf(`"iprange is default value %s so derectly jump to iPRangeChain"`, policy.iPRange)
+		// only ingress accepts local node, so pods are still restricted to reach the host by egress rules
+		if policy.acceptLocalNode{
+			glog.V(4).Infof("process iptables ingress policy rule for local node ips")
+			comment := `"match local node ip"`
+			args = []string{
+				"-A", namespaceIngressChainName,
+				"-m", "set", "--match-set", ENN_LOCAL_NODE_SET, "src",
+				"-m", "comment", "--comment", comment,
+				"-j", "ACCEPT",
+			}
+			writeLine(policy.filterRules, args...)
+		}
+		if len(policy.excludeIPRanges) > 0{
+			comment := fmt.Sprintf(`"accept traffic of exclude ip range %s"`, strings.Join(policy.excludeIPRanges, ","))
+			excludeIPRangeName := ennExcludeIPRangeIPSetName(ipRangeKey)
+			args = []string{
+				"-A", namespaceIngressChainName,
+				"-m", "set", "--match-set", excludeIPRangeName, "src",
+				"-m", "comment", "--comment", comment,
+				"-j", "ACCEPT",
+			}
+			writeLine(policy.filterRules, args...)
+		}
+		if utilpolicy.ContainsDefaultIPRange(policy.iPRanges) {
+			glog.V(4).Infof("iprange contains default value 0.0.0.0/0 so derectly jump to iPRangeChain")
+			comment := fmt.Sprintf(`"iprange contains default value %s so derectly jump to iPRangeChain"`, utilpolicy.DefaultIPRange)
 			args = []string{
 				"-A", namespaceIngressChainName,
 				"-m", "comment", "--comment", comment,
 			}
 			writeLine(policy.filterRules, append(args, "-j", iPRangeIngressChainName)...)
 		} else {
-			comment := fmt.Sprintf(`"match ip range %s"`, policy.iPRange)
-			iPRangeName := ennIPRangeIPSetName(policy.iPRange)
+			comment := fmt.Sprintf(`"match ip range %s"`, strings.Join(policy.iPRanges, ","))
+			iPRangeName := ennIPRangeIPSetName(ipRangeKey)
 			args = []string{
 				"-A", namespaceIngressChainName,
 				"-m", "set", "--match-set", iPRangeName, "src",
@@ -1134,58 +1626,8 @@ func (policy *EnnPolicy) syncIngressRule(networkPolicy *utilpolicy.NetworkPolicy
 		}
 	}
 
-	// through all ingress rules to handle ingress rules in iptables filter table e.g
-	// iptables -t filter -A ENN-PLY-IN-xxxxxx -j ENN-DPATCH-Axxxx
-	// iptables -t filter -A ENN-PLY-IN-xxxxxx -j ENN-DPATCH-Bxxxx
-	// iptables -t filter -A ENN-PLY-IN-xxxxxx -j ENN-DPATCH-Cxxxx
-	for _, ingress := range networkPolicy.Ingress{
-
-		// no PodSelector and NamespaceSelector and CIDR defined
-		// which means ingress.spec is empty
-		// but if only ports defined, should apply rule for all ip with special ports
-		if len(ingress.PodSelector) == 0 && len(ingress.NamespaceSelector) == 0 && len(ingress.IPBlock) == 0 {
-
-			if len(ingress.Ports) > 0 {
-				policy.dispatchOnlyPorts(
-					TYPE_INGRESS,
-					networkPolicy,
-					ingress.Ports,
-					iPRangeIngressChainName,
-				)
-			}
-		}
-		// handle iptables rules for podSelect
-		for _, podSelect := range ingress.PodSelector{
-			policy.dispatchPodSelector(
-				TYPE_INGRESS,
-				networkPolicy,
-				podSelect,
-				ingress.Ports,
-				iPRangeIngressChainName,
-			)
-		}
-		// handle iptables rules for namespaceSelect
-		for _, namespaceSelect := range ingress.NamespaceSelector{
-			policy.dispatchNamespaceSelector(
-				TYPE_INGRESS,
-				networkPolicy,
-				namespaceSelect,
-				ingress.Ports,
-				iPRangeIngressChainName,
-			)
-		}
-		// handle iptables rules for ipBlock
-		for _, ipBlock := range ingress.IPBlock{
-			policy.dispatchIPBlock(
-				TYPE_INGRESS,
-				networkPolicy,
-				ipBlock,
-				ingress.Ports,
-				iPRangeIngressChainName,
-			)
-		}
-
-	}
+	// create dispatch chains for all ingress rules
+	policy.dispatchIngressRules(networkPolicy, iPRangeIngressChainName)
 }
 
 func (policy *EnnPolicy) syncEgressRule(networkPolicy *utilpolicy.NetworkPolicyInfo, namespacePodSetName string) {
@@ -1197,6 +1639,7 @@ func (policy *EnnPolicy) syncEgressRule(networkPolicy *utilpolicy.NetworkPolicyI
 	// iptables -t filter -N ENN-EGRESS-xxxxxx
 	// iptables -t filter -A ENN-FORWARD -m set --match-set [namespaceIPSet] src -j ENN-EGRESS-xxxxxx
 	// iptables -t filter -A ENN-OUTPUT -m set --match-set [namespaceIPSet] src -j ENN-EGRESS-xxxxxx
+	// the ENN-OUTPUT entry enforces egress of service traffic forwarded by ipvs, see proxyModeRules
 	namespaceEgressChainName := ennNamespaceEgressChainName(networkPolicy.Namespace)
 	chainName := utiliptables.Chain(namespaceEgressChainName)
 	if chain, ok := policy.existingFilterChains[chainName]; ok {
@@ -1216,23 +1659,29 @@ func (policy *EnnPolicy) syncEgressRule(networkPolicy *utilpolicy.NetworkPolicyI
 			"-m", "set", "--match-set", namespacePodSetName, "src",
 			"-m", "comment", "--comment", comment,
 		}
+		args = append(args, policy.adminAllowedMatch(adminAllowEgressMark)...)
+		args = append(args, policy.exemptedMatch("src")...)
 		writeLine(policy.filterRules, append(args, "-j", namespaceEgressChainName)...)
 		args = []string{
 			"-A", string(ENN_OUTPUT_CHAIN),
 			"-m", "set", "--match-set", namespacePodSetName, "src",
 			"-m", "comment", "--comment", comment,
 		}
+		args = append(args, policy.adminAllowedMatch(adminAllowEgressMark)...)
+		args = append(args, policy.exemptedMatch("src")...)
 		writeLine(policy.filterRules, append(args, "-j", namespaceEgressChainName)...)
 	}
 
 	// create iptables egress policy rule for iPRange, like
 	// iptables -t filter -N ENN-PLY-E-xxxxxx
-	// iptables -t filter -A ENN-INGRESS-xxxxxx -m set --match-set [flannelRnage] dst -j ACCEPT
+	// iptables -t filter -A ENN-INGRESS-xxxxxx -m set --match-set ENN-NODE-GATEWAY dst -j ACCEPT
+	// iptables -t filter -A ENN-EGRESS-xxxxxx -m set --match-set [excludeIPRange] dst -j ACCEPT
 	// iptables -t filter -A ENN-EGRESS-xxxxxx -m set --match-set [iPRange] dst -j ENN-PLY-E-xxxxxx
 	// iptables -t filter -A ENN-EGRESS-xxxxxx -j ACCEPT
 
-	glog.V(4).Infof("process iptables egress policy rule for iPRange %s/ ", policy.iPRange)
-	iPRangeEgressChainName := ennIPRangeEgressChainName(networkPolicy.Namespace, policy.iPRange)
+	ipRangeKey := policy.ipRangeKey()
+	glog.V(4).Infof("process iptables egress policy rule for iPRange %s", ipRangeKey)
+	iPRangeEgressChainName := ennIPRangeEgressChainName(networkPolicy.Namespace, ipRangeKey)
 	chainName = utiliptables.Chain(iPRangeEgressChainName)
 	if chain, ok := policy.existingFilterChains[chainName]; ok {
 		writeLine(policy.filterChains, chain)
@@ -1246,29 +1695,40 @@ func (policy *EnnPolicy) syncEgressRule(networkPolicy *utilpolicy.NetworkPolicyI
 	} else {
 
 		policy.activeFilterChains[chainName] = true
-		if policy.acceptFlannel{
-			glog.V(4).Infof("process iptables egress policy rule for all flannel/docker ips: %s", policy.flannelNet)
-			flannelNetName := ennFlannelIPSetName(policy.flannelNet, strconv.Itoa(policy.flannelLen))
-			comment := fmt.Sprintf(`"match flannel ip net: %s"`, policy.flannelNet)
+		policy.policyChainNamespaces[chainName] = networkPolicy.Namespace
+		if policy.acceptNodeGateway{
+			glog.V(4).Infof("process iptables egress policy rule for all node gateway ips")
+			comment := `"match node gateway ip"`
 			args = []string{
 				"-A", namespaceEgressChainName,
-				"-m", "set", "--match-set", flannelNetName, "dst",
+				"-m", "set", "--match-set", ENN_NODE_GATEWAY_SET, "dst",
 				"-m", "comment", "--comment", comment,
 				"-j", "ACCEPT",
 			}
 			writeLine(policy.filterRules, args...)
 		}
-		if strings.Compare(policy.iPRange, "0.0.0.0/0") == 0 {
-			glog.V(4).Infof("iprange is default value 0.0.0.0/0 so derectly jump to iPRangeChain")
-			comment := fmt.Sprintf(`"iprange is default value %s so derectly jump to iPRangeChain"`, policy.iPRange)
+		if len(policy.excludeIPRanges) > 0{
+			comment := fmt.Sprintf(`"accept traffic of exclude ip range %s"`, strings.Join(policy.excludeIPRanges, ","))
+			excludeIPRangeName := ennExcludeIPRangeIPSetName(ipRangeKey)
+			args = []string{
+				"-A", namespaceEgressChainName,
+				"-m", "set", "--match-set", excludeIPRangeName, "dst",
+				"-m", "comment", "--comment", comment,
+				"-j", "ACCEPT",
+			}
+			writeLine(policy.filterRules, args...)
+		}
+		if utilpolicy.ContainsDefaultIPRange(policy.iPRanges) {
+			glog.V(4).Infof("iprange contains default value 0.0.0.0/0 so derectly jump to iPRangeChain")
+			comment := fmt.Sprintf(`"iprange contains default value %s so derectly jump to iPRangeChain"`, utilpolicy.DefaultIPRange)
 			args = []string{
 				"-A", namespaceEgressChainName,
 				"-m", "comment", "--comment", comment,
 			}
 			writeLine(policy.filterRules, append(args, "-j", iPRangeEgressChainName)...)
 		} else {
-			comment := fmt.Sprintf(`"match ip range %s"`, policy.iPRange)
-			iPRangeName := ennIPRangeIPSetName(policy.iPRange)
+			comment := fmt.Sprintf(`"match ip range %s"`, strings.Join(policy.iPRanges, ","))
+			iPRangeName := ennIPRangeIPSetName(ipRangeKey)
 			args = []string{
 				"-A", namespaceEgressChainName,
 				"-m", "set", "--match-set", iPRangeName, "dst",
@@ -1284,7 +1744,72 @@ func (policy *EnnPolicy) syncEgressRule(networkPolicy *utilpolicy.NetworkPolicyI
 		}
 	}
 
+	// create dispatch chains for all egress rules
+	policy.dispatchEgressRules(networkPolicy, iPRangeEgressChainName)
+
+}
+
+// dispatchIngressRules creates dispatch chains for every ingress rule of networkPolicy,
+// the dispatch chains are jumped from iPRangeChainName
+func (policy *EnnPolicy) dispatchIngressRules(networkPolicy *utilpolicy.NetworkPolicyInfo, iPRangeChainName string) {
+
 	// through all ingress rules to handle ingress rules in iptables filter table e.g
+	// iptables -t filter -A ENN-PLY-IN-xxxxxx -j ENN-DPATCH-Axxxx
+	// iptables -t filter -A ENN-PLY-IN-xxxxxx -j ENN-DPATCH-Bxxxx
+	// iptables -t filter -A ENN-PLY-IN-xxxxxx -j ENN-DPATCH-Cxxxx
+	for _, ingress := range networkPolicy.Ingress{
+
+		// no PodSelector and NamespaceSelector and CIDR defined
+		// which means ingress.spec is empty
+		// if only ports defined, should apply rule for all ip with special ports,
+		// if ports are not defined either, the rule allows all traffic
+		if len(ingress.PodSelector) == 0 && len(ingress.NamespaceSelector) == 0 && len(ingress.IPBlock) == 0 {
+			policy.dispatchOnlyPorts(
+				TYPE_INGRESS,
+				networkPolicy,
+				ingress.Ports,
+				iPRangeChainName,
+			)
+		}
+		// handle iptables rules for podSelect
+		for _, podSelect := range ingress.PodSelector{
+			policy.dispatchPodSelector(
+				TYPE_INGRESS,
+				networkPolicy,
+				podSelect,
+				ingress.Ports,
+				iPRangeChainName,
+			)
+		}
+		// handle iptables rules for namespaceSelect
+		for _, namespaceSelect := range ingress.NamespaceSelector{
+			policy.dispatchNamespaceSelector(
+				TYPE_INGRESS,
+				networkPolicy,
+				namespaceSelect,
+				ingress.Ports,
+				iPRangeChainName,
+			)
+		}
+		// handle iptables rules for ipBlock
+		for _, ipBlock := range ingress.IPBlock{
+			policy.dispatchIPBlock(
+				TYPE_INGRESS,
+				networkPolicy,
+				ipBlock,
+				ingress.Ports,
+				iPRangeChainName,
+			)
+		}
+
+	}
+}
+
+// dispatchEgressRules creates dispatch chains for every egress rule of networkPolicy,
+// the dispatch chains are jumped from iPRangeChainName
+func (policy *EnnPolicy) dispatchEgressRules(networkPolicy *utilpolicy.NetworkPolicyInfo, iPRangeChainName string) {
+
+	// through all egress rules to handle egress rules in iptables filter table e.g
 	// iptables -t filter -A ENN-PLY-E-xxxxxx -j ENN-DPATCH-Axxxx
 	// iptables -t filter -A ENN-PLY-E-xxxxxx -j ENN-DPATCH-Bxxxx
 	// iptables -t filter -A ENN-PLY-E-xxxxxx -j ENN-DPATCH-Cxxxx
@@ -1292,17 +1817,15 @@ func (policy *EnnPolicy) syncEgressRule(networkPolicy *utilpolicy.NetworkPolicyI
 
 		// no PodSelector and NamespaceSelector and CIDR defined
 		// which means egress.spec is empty
-		// but if only ports defined, should apply rule for all ip with special ports
+		// if only ports defined, should apply rule for all ip with special ports,
+		// if ports are not defined either, the rule allows all traffic
 		if len(egress.PodSelector) == 0 && len(egress.NamespaceSelector) == 0 && len(egress.IPBlock) == 0 {
-
-			if len(egress.Ports) > 0 {
-				policy.dispatchOnlyPorts(
-					TYPE_EGRESS,
-					networkPolicy,
-					egress.Ports,
-					iPRangeEgressChainName,
-				)
-			}
+			policy.dispatchOnlyPorts(
+				TYPE_EGRESS,
+				networkPolicy,
+				egress.Ports,
+				iPRangeChainName,
+			)
 		}
 		// handle iptables rules for podSelect
 		for _, podSelect := range egress.PodSelector{
@@ -1311,7 +1834,7 @@ func (policy *EnnPolicy) syncEgressRule(networkPolicy *utilpolicy.NetworkPolicyI
 				networkPolicy,
 				podSelect,
 				egress.Ports,
-				iPRangeEgressChainName,
+				iPRangeChainName,
 			)
 		}
 		// handle iptables rules for namespaceSelect
@@ -1321,7 +1844,7 @@ func (policy *EnnPolicy) syncEgressRule(networkPolicy *utilpolicy.NetworkPolicyI
 				networkPolicy,
 				namespaceSelect,
 				egress.Ports,
-				iPRangeEgressChainName,
+				iPRangeChainName,
 			)
 		}
 		// handle iptables rules for ipBlock
@@ -1331,16 +1854,18 @@ func (policy *EnnPolicy) syncEgressRule(networkPolicy *utilpolicy.NetworkPolicyI
 				networkPolicy,
 				ipBlock,
 				egress.Ports,
-				iPRangeEgressChainName,
+				iPRangeChainName,
 			)
 		}
 
 	}
-
+	// handle iptables rules for fqdns of annotation enn-policy/egress-fqdns
+	policy.dispatchFQDNs(networkPolicy, iPRangeChainName)
+	policy.dispatchServices(networkPolicy, iPRangeChainName)
 }
 
 // dispatchOnlyPorts create iptables for ingress/egress rules only contains ports
-// accept traffic with special ports
+// accept traffic with special ports, or all traffic if Ports is empty
 func (policy *EnnPolicy) dispatchOnlyPorts( ruleType         int,
                                             networkPolicy    *utilpolicy.NetworkPolicyInfo,
                                             Ports            []utilpolicy.PolicyPort,
@@ -1379,6 +1904,7 @@ func (policy *EnnPolicy) dispatchOnlyPorts( ruleType         int,
 		writeLine(policy.filterChains, utiliptables.MakeChainLine(chainName))
 	}
 	policy.activeFilterChains[chainName] = true
+	policy.indexPolicyChain(chainName, networkPolicy, ruleType)
 
 	comment := fmt.Sprintf(`"policy %s:%s entry for only ports"`,
 		networkPolicy.Namespace,
@@ -1390,8 +1916,16 @@ func (policy *EnnPolicy) dispatchOnlyPorts( ruleType         int,
 	}
 	writeLine(policy.filterRules, append(args, "-j", dispatchChainName)...)
 
-
+	// a rule without peers and ports, e.g ingress: [{}], accepts traffic of all ports
+	portArgs := make([][]string, 0, len(Ports))
 	for _, port := range Ports{
+		portArgs = append(portArgs, []string{"-p", port.Protocol, "--dport", port.Port})
+	}
+	if len(portArgs) == 0{
+		portArgs = append(portArgs, nil)
+	}
+
+	for _, portArg := range portArgs{
 		// spec.podSelector is not defined, so create rule match all pods
 		if len(networkPolicy.PodSelector) == 0{
 			glog.V(4).Infof("network policy %s/%s spec.podSelector is not defined so create rule match all pod %s",
@@ -1405,11 +1939,9 @@ func (policy *EnnPolicy) dispatchOnlyPorts( ruleType         int,
 			args = []string{
 				"-A", dispatchChainName,
 				"-m", "comment", "--comment", comment,
-				"-p", port.Protocol,
-				"--dport", port.Port,
-				"-j", "ACCEPT",
 			}
-			writeLine(policy.filterRules, args...)
+			args = append(args, portArg...)
+			writeLine(policy.filterRules, append(args, "-j", "ACCEPT")...)
 
 		} else {
 			// if spec.podSelector is defined, so create rule match pods src with labels
@@ -1435,11 +1967,9 @@ func (policy *EnnPolicy) dispatchOnlyPorts( ruleType         int,
 				"-A", dispatchChainName,
 				"-m", "comment", "--comment", comment,
 				"-m", "set", "--match-set", policyPodSetName, policyPodMatchDirect,
-				"-p", port.Protocol,
-				"--dport", port.Port,
-				"-j", "ACCEPT",
 			}
-			writeLine(policy.filterRules, args...)
+			args = append(args, portArg...)
+			writeLine(policy.filterRules, append(args, "-j", "ACCEPT")...)
 		}
 	}
 }
@@ -1491,6 +2021,7 @@ func (policy *EnnPolicy) dispatchPodSelector(ruleType         int,
 				podLabelValue,
 				err,
 			)
+			policy.events.policyError(networkPolicy, "create ipset for podSelector %s=%s err %v", podLabelKey, podLabelValue, err)
 			continue
 		}
 		namespacedLabel := utilpolicy.NamespacedLabel{
@@ -1523,6 +2054,7 @@ func (policy *EnnPolicy) dispatchPodSelector(ruleType         int,
 			writeLine(policy.filterChains, utiliptables.MakeChainLine(chainName))
 		}
 		policy.activeFilterChains[chainName] = true
+		policy.indexPolicyChain(chainName, networkPolicy, ruleType)
 
 		comment := fmt.Sprintf(`"policy %s:%s entry for podSelector"`,
 			networkPolicy.Namespace,
@@ -1670,6 +2202,7 @@ func (policy *EnnPolicy) dispatchNamespaceSelector(ruleType         int,
 				namespaceLabelValue,
 				err,
 			)
+			policy.events.policyError(networkPolicy, "create ipset for namespaceSelector %s=%s err %v", namespaceLabelKey, namespaceLabelValue, err)
 			continue
 		}
 		label := utilpolicy.Label{
@@ -1702,6 +2235,7 @@ func (policy *EnnPolicy) dispatchNamespaceSelector(ruleType         int,
 			writeLine(policy.filterChains, utiliptables.MakeChainLine(chainName))
 		}
 		policy.activeFilterChains[chainName] = true
+		policy.indexPolicyChain(chainName, networkPolicy, ruleType)
 
 		comment := fmt.Sprintf(`"policy %s:%s entry for namespaceSelector"`,
 			networkPolicy.Namespace,
@@ -1857,6 +2391,7 @@ func (policy *EnnPolicy) dispatchIPBlock(ruleType         int,
 		writeLine(policy.filterChains, utiliptables.MakeChainLine(chainName))
 	}
 	policy.activeFilterChains[chainName] = true
+	policy.indexPolicyChain(chainName, networkPolicy, ruleType)
 
 
 	chainName = utiliptables.Chain(ipBlockChainName)
@@ -1866,6 +2401,7 @@ func (policy *EnnPolicy) dispatchIPBlock(ruleType         int,
 		writeLine(policy.filterChains, utiliptables.MakeChainLine(chainName))
 	}
 	policy.activeFilterChains[chainName] = true
+	policy.indexPolicyChain(chainName, networkPolicy, ruleType)
 
 	comment := fmt.Sprintf(`"policy %s:%s entry for ipBlock"`,
 		networkPolicy.Namespace,
@@ -1995,6 +2531,7 @@ func (policy *EnnPolicy) handleIPBlockChain(ruleType         int,
 			ipBlock.CIDR,
 			err,
 		)
+		policy.events.policyError(networkPolicy, "create ipset for except cidr of %s err %v", ipBlock.CIDR, err)
 		return
 	}
 
@@ -2003,6 +2540,7 @@ func (policy *EnnPolicy) handleIPBlockChain(ruleType         int,
 	err = policy.syncIPSetEntryForNet(exceptCIDRIPSet, ipBlock.ExceptCIDR)
 	if err != nil{
 		glog.Errorf("sync cidr ipset: %s err: %v", exceptCIDRSetName, err)
+		policy.events.policyError(networkPolicy, "sync except cidr of %s err %v", ipBlock.CIDR, err)
 	}
 
 	// create corresponding iptables rule
@@ -2012,14 +2550,16 @@ func (policy *EnnPolicy) handleIPBlockChain(ruleType         int,
 		cidrDirect,
 	)
 
-	args = []string{
-		"-A", ipBlockChainName,
-		"-m", "comment", "--comment", comment,
-		"-m", "set", "--match-set", exceptCIDRSetName, cidrDirect,
-		"-j", "REJECT",
+	flowDirection := flowDirectionIngress
+	if ruleType == TYPE_EGRESS{
+		flowDirection = flowDirectionEgress
 	}
-
-	writeLine(policy.filterRules, args...)
+	if networkPolicy.HostEndpoint{
+		flowDirection = "H" + flowDirection
+	}
+	policy.writeDenyRules(networkPolicy.Namespace, ipBlockChainName, flowDirection, networkPolicy.Name, comment,
+		"-m", "set", "--match-set", exceptCIDRSetName, cidrDirect,
+	)
 
 	comment = fmt.Sprintf(`"accept default traffic of cidr %s"`, ipBlock.CIDR)
 
@@ -2047,7 +2587,8 @@ func (policy *EnnPolicy) syncAllPodSets() error{
 		if !ok{
 			glog.Errorf("cannot find any pod in namespace %s", namespace)
 		} else{
-			err := policy.syncIPSetEntry(ipset, podInfoMap)
+			// namespace ipset is the target of policies in this namespace, so hostNetwork pods are excluded
+			err := policy.syncIPSetEntry(ipset, utilpolicy.PodInfoMapWithoutHostNetwork(podInfoMap))
 			if err != nil{
 				glog.Errorf("sync entry for ipset:%s of namespace %s failed %s", ipset.Name, namespace, err)
 			}
@@ -2067,7 +2608,7 @@ func (policy *EnnPolicy) syncAllPodSets() error{
 				namespacedLabel.LabelValue,
 			)
 		} else{
-			err := policy.syncIPSetEntry(ipset, podInfoMap)
+			err := policy.syncIPSetEntry(ipset, policy.peerPodInfoMap(podInfoMap))
 			if err != nil{
 				glog.Errorf("sync entry for ipset:%s of namespace %s label %s=%s failed %s",
 					ipset.Name,
@@ -2092,7 +2633,7 @@ func (policy *EnnPolicy) syncAllPodSets() error{
 				label.LabelValue,
 			)
 		} else{
-			err := policy.syncIPSetEntry(ipset, podInfoMap)
+			err := policy.syncIPSetEntry(ipset, policy.peerPodInfoMap(podInfoMap))
 			if err != nil{
 				glog.Errorf("sync entry for ipset:%s of namespace label %s=%s failed %s",
 					ipset.Name,
@@ -2161,7 +2702,8 @@ func (policy *EnnPolicy) syncAllPodSets() error{
 			}
 		}
 
-		err := policy.syncIPSetEntry(ipset, podInfoMap)
+		// spec.podSelector ipset is the target of the policy, so hostNetwork pods are excluded
+		err := policy.syncIPSetEntry(ipset, utilpolicy.PodInfoMapWithoutHostNetwork(podInfoMap))
 		if err != nil{
 			glog.Errorf("sync entry for ipset:%s of namespaceName %s:%s failed %s",
 				ipset.Name,
@@ -2319,6 +2861,10 @@ func (policy *EnnPolicy) syncNamespaceSets() error{
 
 				policy.trySyncNamespacePodLabelSet(label.LabelKey, label.LabelValue)
 			}
+			// podSelector ipsets of this namespace depend on annotation enn-policy/terminating-pods
+			if namespaceChange.Current != nil && namespaceChange.Previous.TerminatingPods != namespaceChange.Current.TerminatingPods{
+				policy.trySyncPodLabelSetsOfNamespace(namespaceChange.Current.Name)
+			}
 		} else{
 			if namespaceChange.Current == nil{
 				glog.Errorf("invalid namespaceChange Map namespace:%s, both privous and current is nil", namespacedName.Name)
@@ -2455,6 +3001,129 @@ func (policy *EnnPolicy) syncIPSetEntryForNet(ipset *utilIPSet.IPSet, nets []str
 	return nil
 }
 
+func (policy *EnnPolicy) syncIPSetEntryForIP(ipset *utilIPSet.IPSet, ips []string) error{
+
+	glog.V(4).Infof("start to sync entry for ipset %s:%s", ipset.Name, ipset.Type)
+	kernelSet, err := policy.ipsetInterface.GetIPSet(ipset.Name)
+	if err!= nil{
+		return err
+	}
+	kernelEntries, err := policy.ipsetInterface.ListEntry(kernelSet)
+	if err!= nil{
+		return err
+	}
+
+	ipsMap := make(map[string]bool)
+	for _, ip := range ips{
+		ipsMap[ip] = true
+	}
+	kernelEntryIPMap := make(map[string]bool)
+	for _, kernelEntry := range kernelEntries{
+		kernelEntryIPMap[kernelEntry.IP] = true
+	}
+
+	//delete unused entries
+	for _, kernelEntry := range kernelEntries{
+		glog.V(7).Infof("kernel entry is type:%s, ip:%s, port:%s, net:%s",
+			kernelEntry.Type, kernelEntry.IP, kernelEntry.Port, kernelEntry.Net)
+		ip, err := utilIPSet.EntryToString(kernelEntry)
+		if err!= nil{
+			glog.Errorf("get entry err ipset:%s, entry type:%s err:%v", kernelSet.Name, kernelEntry.Type, err)
+			continue
+		}
+		_, ok := ipsMap[ip]
+		if !ok{
+			glog.V(6).Infof("find unused entry: %s of ipset %s:%s so delete it", ip, kernelSet.Name, kernelSet.Type)
+			err := policy.ipsetInterface.DelEntry(kernelSet, kernelEntry, false)
+			if err != nil{
+				glog.Errorf("syncIPSetEntry error : %v", err)
+				continue
+			}
+		}
+	}
+
+	// add new entries
+	for ip := range ipsMap{
+		glog.V(7).Infof("new hash/ip is %s", ip)
+		_, ok := kernelEntryIPMap[ip]
+		if !ok{
+			glog.V(6).Infof("find new entry: %s of ipset %s:%s so add it", ip, kernelSet.Name, kernelSet.Type)
+			entry := &utilIPSet.Entry{
+				IP:    ip,
+				Type:  utilIPSet.TypeHashIP,
+			}
+			err := policy.ipsetInterface.AddEntry(kernelSet, entry, true)
+			if err != nil{
+				glog.Errorf("syncIPSetEntry error : %v", err)
+				continue
+			}
+		}
+	}
+
+	return nil
+}
+
+// syncIPSetEntryForIPPort syncs entries of hash:ip,port ipset, entries are like 10.0.0.1,tcp:80
+func (policy *EnnPolicy) syncIPSetEntryForIPPort(ipset *utilIPSet.IPSet, entries []string) error{
+
+	glog.V(4).Infof("start to sync entry for ipset %s:%s", ipset.Name, ipset.Type)
+	kernelSet, err := policy.ipsetInterface.GetIPSet(ipset.Name)
+	if err!= nil{
+		return err
+	}
+	kernelEntries, err := policy.ipsetInterface.ListEntry(kernelSet)
+	if err!= nil{
+		return err
+	}
+
+	entriesMap := make(map[string]bool)
+	for _, entry := range entries{
+		entriesMap[entry] = true
+	}
+	kernelEntryMap := make(map[string]bool)
+
+	//delete unused entries
+	for _, kernelEntry := range kernelEntries{
+		glog.V(7).Infof("kernel entry is type:%s, ip:%s, port:%s, net:%s",
+			kernelEntry.Type, kernelEntry.IP, kernelEntry.Port, kernelEntry.Net)
+		entry, err := utilIPSet.EntryToString(kernelEntry)
+		if err!= nil{
+			glog.Errorf("get entry err ipset:%s, entry type:%s err:%v", kernelSet.Name, kernelEntry.Type, err)
+			continue
+		}
+		kernelEntryMap[entry] = true
+		_, ok := entriesMap[entry]
+		if !ok{
+			glog.V(6).Infof("find unused entry: %s of ipset %s:%s so delete it", entry, kernelSet.Name, kernelSet.Type)
+			err := policy.ipsetInterface.DelEntry(kernelSet, kernelEntry, false)
+			if err != nil{
+				glog.Errorf("syncIPSetEntry error : %v", err)
+				continue
+			}
+		}
+	}
+
+	// add new entries
+	for entry := range entriesMap{
+		_, ok := kernelEntryMap[entry]
+		if !ok{
+			glog.V(6).Infof("find new entry: %s of ipset %s:%s so add it", entry, kernelSet.Name, kernelSet.Type)
+			newEntry, err := utilIPSet.StringToEntry(utilIPSet.TypeHashIPPort, entry)
+			if err != nil{
+				glog.Errorf("syncIPSetEntry error : %v", err)
+				continue
+			}
+			err = policy.ipsetInterface.AddEntry(kernelSet, newEntry, true)
+			if err != nil{
+				glog.Errorf("syncIPSetEntry error : %v", err)
+				continue
+			}
+		}
+	}
+
+	return nil
+}
+
 // trySyncPodXLabelSet will try sync ipset entries with given namespacedLabel
 // when a pod is added/deleted/updated, trySyncPodXLabelSet will scan the whole podXLabelMap
 // and find whether there is a namespacedLabelMap item contains corresponding namespacedLabel
@@ -2543,8 +3212,8 @@ func (policy *EnnPolicy) trySyncPodXLabelSet(namespaceLabel utilpolicy.Namespace
 				}
 			}
 
-			// 4. sync corresponding ipset
-			err := policy.syncIPSetEntry(ipset, podInfoMap)
+			// 4. sync corresponding ipset, hostNetwork pods are never the target of a policy
+			err := policy.syncIPSetEntry(ipset, utilpolicy.PodInfoMapWithoutHostNetwork(podInfoMap))
 			if err != nil{
 				glog.Errorf("trySyncPodXLabelSet: sync entry for ipset:%s of namespaceName %s:%s failed %s",
 					ipset.Name,
@@ -2588,7 +3257,8 @@ func (policy *EnnPolicy) trySyncPodLabelSet(namespaceLabel utilpolicy.Namespaced
 			namespaceLabel.LabelValue,
 		)
 	}else{
-		err := policy.syncIPSetEntry(ipset, podInfoMap)
+		// podSelector ipset is a peer set, so terminating pods are handled by terminatingPodsMode
+		err := policy.syncIPSetEntry(ipset, policy.peerPodInfoMap(podInfoMap))
 		if err != nil{
 			glog.Errorf("sync entry for ipset:%s of namespace %s label %s=%s failed %s",
 				ipset.Name,
@@ -2634,7 +3304,8 @@ func (policy *EnnPolicy) trySyncNamespacePodLabelSet(k, v string){
 			label.LabelValue,
 		)
 	}else{
-		err := policy.syncIPSetEntry(ipset, podInfoMap)
+		// namespaceSelector ipset is a peer set, so terminating pods are handled by terminatingPodsMode
+		err := policy.syncIPSetEntry(ipset, policy.peerPodInfoMap(podInfoMap))
 		if err != nil{
 			glog.Errorf("sync entry for ipset:%s of namespace label %s=%s failed %s",
 				ipset.Name,
@@ -2691,7 +3362,7 @@ func (policy *EnnPolicy) trySyncNamespacePodSet(namespace string){
 	if !ok{
 		glog.Errorf("cannot find any pod in namespace %s", namespace)
 	} else{
-		err := policy.syncIPSetEntry(ipset, podInfoMap)
+		err := policy.syncIPSetEntry(ipset, utilpolicy.PodInfoMapWithoutHostNetwork(podInfoMap))
 		if err != nil{
 			glog.Errorf("sync entry for ipset:%s of namespace %s failed %s", ipset.Name, namespace, err)
 		}
@@ -3049,6 +3720,12 @@ func ennIPRangeIPSetName(ipRange string) string{
 	return "ENN-RANGEIP-" + encoded[:16]
 }
 
+func ennExcludeIPRangeIPSetName(ipRange string) string{
+	hash := sha256.Sum256([]byte(ipRange))
+	encoded := base32.StdEncoding.EncodeToString(hash[:])
+	return "ENN-RANGEEX-" + encoded[:16]
+}
+
 // [kind] separate namespacedLabel from different kind (pod/namespace)
 func ennLabelIPSetName(namespace string, kind string, labelKey string, labelValue string) string{
 	hash := sha256.Sum256([]byte(namespace + kind + labelKey + labelValue))
@@ -3056,13 +3733,6 @@ func ennLabelIPSetName(namespace string, kind string, labelKey string, labelValu
 	return "ENN-PODSET-" + encoded[:16]
 }
 
-// ipset name for possible flannel ips and docker ips
-func ennFlannelIPSetName(flannelNet string, flannelLen string) string{
-	hash := sha256.Sum256([]byte(flannelNet + flannelLen))
-	encoded := base32.StdEncoding.EncodeToString(hash[:])
-	return "ENN-FLANNEL-" + encoded[:16]
-}
-
 // [kind] separate namespacedLabel from different kind (pod/namespace)
 // [labels] should come in pairs (key/value)
 func ennXLabelIPSetName(namespace string, kind string, labels []string) string{
@@ -17,8 +17,9 @@ import (
 
 	"strings"
 	"bytes"
+	"net"
+	"time"
 	//"strconv"
-	"fmt"
 	"strconv"
 )
 
@@ -233,13 +234,15 @@ func NewFakeEnnPolicy(ipRange string) *EnnPolicy{
 		client:                  nil,
 		hostName:                "",
 		clusterCIDR:             "",
-		iPRange:                 ipRange,
-		acceptFlannel:           false,
-		flannelNet:              "0.0.0.0/0",
-		flannelLen:              8,
+		iPRanges:                []string{ipRange},
+		acceptNodeGateway:       false,
+		proxyMode:               ProxyModeIPTables,
 		networkPolicySynced:     true,
 		podSynced:               true,
 		namespaceSynced:         true,
+		nodeSynced:              true,
+		serviceSynced:           true,
+		endpointsSynced:         true,
 		initAllSynced:           false,
 		execInterface:           execInterface,
 		ipsetInterface:          ipsetInterface,
@@ -248,11 +251,15 @@ func NewFakeEnnPolicy(ipRange string) *EnnPolicy{
 		networkPolicyChanges:    utilpolicy.NewNetworkPolicyChangeMap(),
 		podChanges:              utilpolicy.NewPodLabelChangeMap(),
 		namespaceChanges:        utilpolicy.NewNamespaceChangeMap(),
+		nodeChanges:             utilpolicy.NewNodeChangeMap(),
 		networkPolicyMap:        make(utilpolicy.NetworkPolicyMap),
 		podMatchLabelMap:        make(utilpolicy.PodMatchLabelMap),
 		namespaceMatchLabelMap:  make(utilpolicy.NamespaceMatchLabelMap),
 		namespacePodMap:         make(utilpolicy.NamespacePodMap),
 		namespaceInfoMap:        make(utilpolicy.NamespaceInfoMap),
+		nodeInfoMap:             make(utilpolicy.NodeInfoMap),
+		serviceInfoMap:          make(utilpolicy.ServiceInfoMap),
+		endpointsInfoMap:        make(utilpolicy.EndpointsInfoMap),
 		activeIPSets:            make(map[string]*utilIPSet.IPSet),
 		podXLabelMap:            make(map[types.NamespacedName]*utilpolicy.NamespacedLabelMap),
 		podXLabelSet:            make(map[types.NamespacedName]*utilIPSet.IPSet),
@@ -266,7 +273,7 @@ func NewFakeEnnPolicy(ipRange string) *EnnPolicy{
 		filterRules:             bytes.NewBuffer(nil),
 	}
 
-	ennpolicy.setInitialized(ennpolicy.networkPolicySynced && ennpolicy.podSynced && ennpolicy.namespaceSynced)
+	ennpolicy.setInitialized(ennpolicy.allSynced())
 
 	return &ennpolicy
 }
@@ -291,38 +298,202 @@ func TestIPRangeSet(t *testing.T){
 	}
 }
 
-// test whether FlannelNet IPSet entry is correct, acceptFlannel should be true
-func TestFlannelNetSet(t *testing.T){
+// test whether IPRange IPSet entries are correct when several ranges are set
+func TestMultipleIPRangeSet(t *testing.T){
 
 	fnp := NewFakeEnnPolicy("10.244.0.0/16")
-	fnp.acceptFlannel = true
-	fnp.flannelNet = "172.16.0.0/12"
-	fnp.flannelLen = 8
+	fnp.iPRanges = []string{"10.244.0.0/16", "192.168.10.0/24"}
+	fnp.excludeIPRanges = []string{"10.244.255.0/24"}
 
-	// build expected flannelNet ip map
-	expectedMap := make(map[string]bool)
+	fnp.syncEnnPolicy(SYNCALL)
+	ok := checkIPRangeIPSet(t, fnp, fnp.ipRangeKey(), "10.244.0.0/16", "192.168.10.0/24")
+	if !ok{
+		t.Errorf("check ipRange %v IPSet fail", fnp.iPRanges)
+	}
 
-	for a2 := 16; a2 < 32; a2 ++{
-		for a1 := 0; a1 < 256; a1 = a1 + 16{
-			flannelIp := fmt.Sprintf("172.%d.%d.0",a2,a1)
-			dockerIp := fmt.Sprintf("172.%d.%d.1",a2,a1)
-			expectedMap[flannelIp] = true
-			expectedMap[dockerIp] = true
-		}
+	// 0.0.0.0/0 together with other ranges is stored as two halves
+	fnp.iPRanges = []string{"0.0.0.0/0", "10.244.0.0/16"}
+	fnp.syncEnnPolicy(SYNCALL)
+	ok = checkIPRangeIPSet(t, fnp, fnp.ipRangeKey(), "0.0.0.0/1", "128.0.0.0/1")
+	if !ok{
+		t.Errorf("check ipRange %v IPSet fail", fnp.iPRanges)
 	}
+}
+
+// test whether node gateway IPSet entry is correct, acceptNodeGateway should be true
+func TestNodeGatewaySet(t *testing.T){
+
+	fnp := NewFakeEnnPolicy("10.244.0.0/16")
+	fnp.acceptNodeGateway = true
+
+	node1 := makeTestNode("node1", "10.244.1.0/24", "192.168.1.10")
+	node2 := makeTestNode("node2", "10.244.2.0/23", "192.168.1.11")
 
 	// first time sync will add entry to ipset
-	fnp.syncEnnPolicy(SYNCALL)
-	ok := checkFlannelNetIPSet(t, fnp, "172.16.0.0/12", "8", expectedMap)
+	fnp.OnNodeAdd(node1)
+	fnp.OnNodeAdd(node2)
+	expectedMap := map[string]bool{
+		"10.244.1.0":   true,
+		"10.244.1.1":   true,
+		"192.168.1.10": true,
+		"10.244.2.0":   true,
+		"10.244.2.1":   true,
+		"192.168.1.11": true,
+	}
+	ok := checkNodeGatewayIPSet(t, fnp, expectedMap)
+	if !ok{
+		t.Errorf("check node gateway IPSet fail")
+	}
+
+	// node leaves cluster, its entries should be deleted
+	fnp.OnNodeDelete(node1)
+	delete(expectedMap, "10.244.1.0")
+	delete(expectedMap, "10.244.1.1")
+	delete(expectedMap, "192.168.1.10")
+	ok = checkNodeGatewayIPSet(t, fnp, expectedMap)
 	if !ok{
-		t.Errorf("check FlannelNet %s IPSet fail", "172.16.0.0/12")
+		t.Errorf("check node gateway IPSet fail")
 	}
 
 	// second time sync no more entry will be added
 	fnp.syncEnnPolicy(SYNCALL)
-	ok = checkFlannelNetIPSet(t, fnp, "172.16.0.0/12", "8", expectedMap)
+	ok = checkNodeGatewayIPSet(t, fnp, expectedMap)
 	if !ok{
-		t.Errorf("check FlannelNet %s IPSet fail", "172.16.0.0/12")
+		t.Errorf("check node gateway IPSet fail")
+	}
+}
+
+// test whether local node IPSet entry is correct, acceptLocalNode should be true
+// only the node ip and bridge gateway of this node are added
+func TestLocalNodeSet(t *testing.T){
+
+	fnp := NewFakeEnnPolicy("10.244.0.0/16")
+	fnp.acceptLocalNode = true
+	fnp.hostName = "node1"
+
+	node1 := makeTestNode("node1", "10.244.1.0/24", "192.168.1.10")
+	node2 := makeTestNode("node2", "10.244.2.0/24", "192.168.1.11")
+
+	fnp.OnNodeAdd(node1)
+	fnp.OnNodeAdd(node2)
+	expectedMap := map[string]bool{
+		"192.168.1.10": true,
+		"10.244.1.1":   true,
+	}
+	ok := checkLocalNodeIPSet(t, fnp, expectedMap)
+	if !ok{
+		t.Errorf("check local node IPSet fail")
+	}
+
+	// podCIDR of this node changes, bridge gateway should be updated
+	node1Updated := makeTestNode("node1", "10.244.8.0/24", "192.168.1.10")
+	fnp.OnNodeUpdate(node1, node1Updated)
+	delete(expectedMap, "10.244.1.1")
+	expectedMap["10.244.8.1"] = true
+	ok = checkLocalNodeIPSet(t, fnp, expectedMap)
+	if !ok{
+		t.Errorf("check local node IPSet fail")
+	}
+
+	// disable accept local node, set should be empty
+	fnp.acceptLocalNode = false
+	fnp.syncEnnPolicy(SYNCALL)
+	ok = checkLocalNodeIPSet(t, fnp, map[string]bool{})
+	if !ok{
+		t.Errorf("check local node IPSet fail")
+	}
+}
+
+// test whether cluster node IPSet entry is correct
+// and clusterCIDR/nodeIP are refreshed when local node is changed
+func TestClusterNodeSet(t *testing.T){
+
+	fnp := NewFakeEnnPolicy("10.244.0.0/16")
+	fnp.hostName = "node1"
+
+	node1 := makeTestNode("node1", "10.244.1.0/24", "192.168.1.10")
+	node2 := makeTestNode("node2", "10.244.2.0/24", "192.168.1.11")
+
+	fnp.OnNodeAdd(node1)
+	fnp.OnNodeAdd(node2)
+	ok := checkClusterNodeIPSet(t, fnp, "192.168.1.10", "10.244.1.0/24", "192.168.1.11", "10.244.2.0/24")
+	if !ok{
+		t.Errorf("check cluster node IPSet fail")
+	}
+	if fnp.clusterCIDR != "10.244.1.0/24" || !fnp.nodeIP.Equal(net.ParseIP("192.168.1.10")){
+		t.Errorf("expected clusterCIDR 10.244.1.0/24 nodeIP 192.168.1.10, get %s %v", fnp.clusterCIDR, fnp.nodeIP)
+	}
+
+	// local node changes podCIDR and InternalIP
+	node1Updated := makeTestNode("node1", "10.244.8.0/24", "192.168.1.20")
+	fnp.OnNodeUpdate(node1, node1Updated)
+	ok = checkClusterNodeIPSet(t, fnp, "192.168.1.20", "10.244.8.0/24", "192.168.1.11", "10.244.2.0/24")
+	if !ok{
+		t.Errorf("check cluster node IPSet fail")
+	}
+	if fnp.clusterCIDR != "10.244.8.0/24" || !fnp.nodeIP.Equal(net.ParseIP("192.168.1.20")){
+		t.Errorf("expected clusterCIDR 10.244.8.0/24 nodeIP 192.168.1.20, get %s %v", fnp.clusterCIDR, fnp.nodeIP)
+	}
+
+	// other node leaves cluster
+	fnp.OnNodeDelete(node2)
+	ok = checkClusterNodeIPSet(t, fnp, "192.168.1.20", "10.244.8.0/24")
+	if !ok{
+		t.Errorf("check cluster node IPSet fail")
+	}
+}
+
+// test host endpoint policy is rendered into ENN-INPUT for the selected node
+// and rules are removed when node labels do not match any more
+func TestHostEndpointPolicy(t *testing.T){
+
+	fnp := NewFakeEnnPolicy("10.244.0.0/16")
+	fnp.hostName = "node1"
+	fnp.hostEndpointNamespace = "host-endpoint"
+	fnp.failsafeInbound = []utilpolicy.PolicyPort{{Protocol: "TCP", Port: "22"}}
+
+	node1 := makeTestNode("node1", "10.244.1.0/24", "192.168.1.10")
+	node1.Labels = map[string]string{"role": "worker"}
+	fnp.OnNodeAdd(node1)
+
+	tcp := coreApi.ProtocolTCP
+	kubeletPort := intstr.FromInt(10250)
+	networkPolicy := makeTestNetworkPolicy("host-endpoint", "kubelet", func(np *api.NetworkPolicy){
+		np.Annotations = map[string]string{utilpolicy.HostEndpointAnnotation: "true"}
+		np.Spec.PodSelector.MatchLabels = map[string]string{"role": "worker"}
+		np.Spec.PolicyTypes = []api.PolicyType{api.PolicyTypeIngress}
+		np.Spec.Ingress = []api.NetworkPolicyIngressRule{
+			{
+				Ports: []api.NetworkPolicyPort{{Protocol: &tcp, Port: &kubeletPort}},
+				From:  []api.NetworkPolicyPeer{{IPBlock: &api.IPBlock{CIDR: "192.168.0.0/16"}}},
+			},
+		}
+	})
+	fnp.OnNetworkPolicyAdd(networkPolicy)
+
+	hostIngressChain := ennHostEndpointIngressChainName("node1")
+	if !checkHostEndpointEntry(t, fnp, hostIngressChain, true){
+		t.Errorf("check host endpoint entry fail")
+	}
+	dispatchEntry, ok := checkPolicyChain(t, fnp, hostIngressChain)
+	if !ok || len(dispatchEntry) != 1{
+		t.Errorf("expected 1 dispatch entry in %s, get %v", hostIngressChain, dispatchEntry)
+	}
+
+	// host endpoint policy is never rendered as a pod policy
+	lists, _ := fnp.iptablesInterface.List(FILTER_TABLE, ENN_FORWARD_CHAIN)
+	for _, rule := range lists{
+		if strings.Contains(rule, ennNamespaceIPSetName("host-endpoint")){
+			t.Errorf("unexpected pod rule for host endpoint policy: %s", rule)
+		}
+	}
+
+	// node is not selected any more
+	node1Updated := makeTestNode("node1", "10.244.1.0/24", "192.168.1.10")
+	node1Updated.Labels = map[string]string{"role": "master"}
+	fnp.OnNodeUpdate(node1, node1Updated)
+	if !checkHostEndpointEntry(t, fnp, hostIngressChain, false){
+		t.Errorf("check host endpoint entry fail")
 	}
 }
 
@@ -374,9 +545,7 @@ func TestNetworkPolicyAddIngressPodSelector(t *testing.T){
 func TestNetworkPolicyAddIngressNamespaceSelector(t *testing.T){
 
 	fnp := NewFakeEnnPolicy("0.0.0.0/0")
-	fnp.acceptFlannel = true
-	fnp.flannelNet = "172.16.0.0/12"
-	fnp.flannelLen = 8
+	fnp.acceptNodeGateway = true
 
 	fnp.OnNetworkPolicyAdd(networkPolicies[1])
 
@@ -465,9 +634,7 @@ func TestNetworkPolicyAddIngressIPBlock(t *testing.T){
 func TestNetworkPolicyAddIngressPort(t *testing.T){
 
 	fnp := NewFakeEnnPolicy("10.244.0.0/16")
-	fnp.acceptFlannel = true
-	fnp.flannelNet = "172.16.0.0/12"
-	fnp.flannelLen = 8
+	fnp.acceptNodeGateway = true
 
 	fnp.OnNetworkPolicyAdd(networkPolicies[3])
 
@@ -587,9 +754,7 @@ func TestNetworkPolicyAddEgressPodSelector(t *testing.T){
 func TestNetworkPolicyAddEgressNamespaceSelector(t *testing.T){
 
 	fnp := NewFakeEnnPolicy("10.244.0.0/16")
-	fnp.acceptFlannel = true
-	fnp.flannelNet = "172.16.0.0/12"
-	fnp.flannelLen = 8
+	fnp.acceptNodeGateway = true
 
 	fnp.OnNetworkPolicyAdd(networkPolicies[5])
 
@@ -691,9 +856,7 @@ func TestNetworkPolicyAddEgressNamespaceSelector(t *testing.T){
 func TestNetworkPolicyAddEgressIPBlock(t *testing.T){
 
 	fnp := NewFakeEnnPolicy("10.244.0.0/16")
-	fnp.acceptFlannel = true
-	fnp.flannelNet = "172.16.0.0/12"
-	fnp.flannelLen = 8
+	fnp.acceptNodeGateway = true
 
 	fnp.OnNetworkPolicyAdd(networkPolicies[6])
 
@@ -797,9 +960,7 @@ func TestNetworkPolicyAddEgressPort(t *testing.T){
 // 2. delete some networkPolicies in different namespaces, then check whether iptables is correct
 func TestNetworkPolicyAddDelete(t *testing.T){
 	fnp := NewFakeEnnPolicy("10.244.0.0/16")
-	fnp.acceptFlannel = true
-	fnp.flannelNet = "172.16.0.0/12"
-	fnp.flannelLen = 8
+	fnp.acceptNodeGateway = true
 
 	for i := 0; i < 11; i++{
 		fnp.OnNetworkPolicyAdd(networkPolicies[i])
@@ -981,9 +1142,7 @@ func TestNetworkPolicyAddDelete(t *testing.T){
 func TestNetworkPolicyUpdate(t *testing.T){
 
 	fnp := NewFakeEnnPolicy("10.244.0.0/16")
-	fnp.acceptFlannel = true
-	fnp.flannelNet = "172.16.0.0/12"
-	fnp.flannelLen = 8
+	fnp.acceptNodeGateway = true
 
 	fnp.OnNetworkPolicyAdd(networkPolicies[10])
 
@@ -1906,6 +2065,106 @@ func TestPodHostNetwork(t *testing.T){
 	}
 }
 
+// TestPodHostNetworkPeers will test ipset rules when hostNetwork pods are used as peers
+// node ip of a hostNetwork pod is added to podSelector peer set but never to spec.podSelector target set
+func TestPodHostNetworkPeers(t *testing.T){
+
+	namespace := makeTestNamespace(namespaceName[3], func(namespace *coreApi.Namespace) {
+		namespace.Labels = map[string]string{"ns2":"ns2"}
+	})
+
+	pods := []*coreApi.Pod{
+		makeTestPod(namespaceName[3], "pod1", func(pod *coreApi.Pod) {
+			pod.Labels = map[string]string{"run2":"test2"}
+			pod.Status.Conditions = []coreApi.PodCondition{{Type: coreApi.PodReady, Status: coreApi.ConditionTrue}}
+			pod.Status.Phase = coreApi.PodRunning
+			pod.Status.PodIP = "192.168.1.10"
+			pod.Spec.HostNetwork = true
+		}),
+		makeTestPod(namespaceName[3], "pod4", func(pod *coreApi.Pod) {
+			pod.Labels = map[string]string{"run2":"test2"}
+			pod.Status.Conditions = []coreApi.PodCondition{{Type: coreApi.PodReady, Status: coreApi.ConditionTrue}}
+			pod.Status.Phase = coreApi.PodRunning
+			pod.Status.PodIP = "10.0.0.2"
+		}),
+	}
+
+	fnp := NewFakeEnnPolicy("10.244.0.0/16")
+	fnp.podChanges.HostNetworkPeers = true
+
+	fnp.OnNamespaceAdd(namespace)
+	fnp.OnNetworkPolicyAdd(networkPolicies[8])
+
+	fnp.OnPodAdd(pods[0])
+	fnp.OnPodAdd(pods[1])
+
+	xLabel := map[string]string{"run2": "test2"}
+
+	ok := checkPodLabelIPSet(t, fnp, namespaceName[3], "run2", "test2", "192.168.1.10", "10.0.0.2")
+	if !ok{
+		t.Errorf("check pod label set %s:%s=%s IPSet fail", namespaceName[3],"run2","test2")
+	}
+	ok = checkPodXLabelIPSet(t, fnp, namespaceName[3], xLabel, "10.0.0.2")
+	if !ok{
+		t.Errorf("check pod xLabel set namespace:%s, label:%v IPSet fail", namespaceName[3], xLabel)
+	}
+	ok = checkNamespacePodIPSet(t, fnp, namespaceName[3], "10.0.0.2")
+	if !ok{
+		t.Errorf("check namespace set %s IPSet fail", namespaceName[3])
+	}
+}
+
+// TestTerminatingPod will test terminating pods in peer sets
+// terminating pod is kept by default and dropped when namespace annotation is drop
+func TestTerminatingPod(t *testing.T){
+
+	namespace := makeTestNamespace(namespaceName[3], func(namespace *coreApi.Namespace) {
+		namespace.Labels = map[string]string{"ns2":"ns2"}
+	})
+	namespaceDrop := makeTestNamespace(namespaceName[3], func(namespace *coreApi.Namespace) {
+		namespace.Labels = map[string]string{"ns2":"ns2"}
+		namespace.Annotations = map[string]string{utilpolicy.TerminatingPodsAnnotation: utilpolicy.TerminatingPodsDrop}
+	})
+
+	pods := []*coreApi.Pod{
+		makeTestPod(namespaceName[3], "pod1", func(pod *coreApi.Pod) {
+			pod.Labels = map[string]string{"run2":"test2"}
+			pod.Status.Phase = coreApi.PodRunning
+			pod.Status.PodIP = "10.0.0.1"
+			pod.DeletionTimestamp = &metav1.Time{Time: time.Now().Add(time.Hour)}
+		}),
+		makeTestPod(namespaceName[3], "pod4", func(pod *coreApi.Pod) {
+			pod.Labels = map[string]string{"run2":"test2"}
+			pod.Status.Phase = coreApi.PodRunning
+			pod.Status.PodIP = "10.0.0.2"
+		}),
+	}
+
+	fnp := NewFakeEnnPolicy("10.244.0.0/16")
+
+	fnp.OnNamespaceAdd(namespace)
+	fnp.OnNetworkPolicyAdd(networkPolicies[8])
+
+	fnp.OnPodAdd(pods[0])
+	fnp.OnPodAdd(pods[1])
+
+	ok := checkPodLabelIPSet(t, fnp, namespaceName[3], "run2", "test2", "10.0.0.1", "10.0.0.2")
+	if !ok{
+		t.Errorf("check pod label set %s:%s=%s IPSet fail", namespaceName[3],"run2","test2")
+	}
+
+	fnp.OnNamespaceUpdate(namespace, namespaceDrop)
+	ok = checkPodLabelIPSet(t, fnp, namespaceName[3], "run2", "test2", "10.0.0.2")
+	if !ok{
+		t.Errorf("check pod label set %s:%s=%s IPSet fail", namespaceName[3],"run2","test2")
+	}
+	// terminating pod is still the target of policy
+	ok = checkPodXLabelIPSet(t, fnp, namespaceName[3], map[string]string{"run2": "test2"}, "10.0.0.1", "10.0.0.2")
+	if !ok{
+		t.Errorf("check pod xLabel set namespace:%s IPSet fail", namespaceName[3])
+	}
+}
+
 // this test case will add some namespace and delete some namespace, then check whether corresponding ipset is correct
 // ipset include namespace ipset and namespace label ipset
 // when we delete a namespace, we must first delete all pods in this namespace
@@ -2257,7 +2516,7 @@ func getDispatchEntry(t *testing.T, fnp *EnnPolicy, namespace, InOrE string) ([]
 		return dispatchEntry, false
 	}
 
-	policyEntry, ok := checkNamespaceChain(t, fnp, namespaceEntry, fnp.iPRange, InOrE)
+	policyEntry, ok := checkNamespaceChain(t, fnp, namespaceEntry, fnp.ipRangeKey(), InOrE)
 	if !ok{
 		t.Errorf("check namespace entry fail")
 		return dispatchEntry, false
@@ -2412,6 +2671,31 @@ func checkEnnOutput(t *testing.T, fnp *EnnPolicy, namespace string, InOrE string
 	return entry, true
 }
 
+func checkHostEndpointEntry(t *testing.T, fnp *EnnPolicy, hostChain string, expected bool) bool{
+
+	var failsafe, entry bool
+	lists, _ := fnp.iptablesInterface.List(FILTER_TABLE, ENN_INPUT_CHAIN)
+	for _, rule := range lists{
+		if strings.Contains(rule, "--dport 22") && strings.Contains(rule, "ACCEPT"){
+			failsafe = true
+		}
+		if strings.HasSuffix(rule, hostChain){
+			entry = true
+			// failsafe rule must be written before host endpoint entry
+			if !failsafe{
+				t.Errorf("failsafe rule is not before host endpoint entry in ENN-INPUT chain")
+				return false
+			}
+		}
+	}
+
+	if entry != expected{
+		t.Errorf("expected host endpoint entry %s in ENN-INPUT chain is %v, get %v", hostChain, expected, entry)
+		return false
+	}
+	return true
+}
+
 func checkEnnForward(t *testing.T, fnp *EnnPolicy, namespace string, InOrE string) (string, bool){
 
 	var namespaceEntry string
@@ -2469,7 +2753,7 @@ func checkNamespaceChain(t *testing.T, fnp *EnnPolicy, namespaceChain string, ip
 	}
 
 	// -N ENN-INGRESS-MYHOMZGODZAKSXF7
-	// -A ENN-INGRESS-MYHOMZGODZAKSXF7 -m set --match-set ENN-FLANNEL-PUQSI3TYGKKXTCCD src -m comment --comment "match flannel ip net: 10.244.0.0/16" -j ACCEPT
+	// -A ENN-INGRESS-MYHOMZGODZAKSXF7 -m set --match-set ENN-NODE-GATEWAY src -m comment --comment "match node gateway ip" -j ACCEPT
 	// -A ENN-INGRESS-MYHOMZGODZAKSXF7 -m set --match-set ENN-RANGEIP-CISAOGDXR7V5L4LB src -m comment --comment "match ip range 10.244.0.0/16" -j ENN-PLY-IN-KK2G2CFELVWPDXUK
 	// -A ENN-INGRESS-MYHOMZGODZAKSXF7 -m comment --comment "accept other traffic beyond ip range" -j ACCEPT
 
@@ -2480,12 +2764,12 @@ func checkNamespaceChain(t *testing.T, fnp *EnnPolicy, namespaceChain string, ip
 		return "", false
 	}
 
-	if fnp.acceptFlannel{
+	if fnp.acceptNodeGateway{
 
-		if !strings.Contains(lists[1], "ENN-FLANNEL") ||
+		if !strings.Contains(lists[1], "ENN-NODE-GATEWAY") ||
 			!strings.Contains(lists[1], direction) ||
 			!strings.Contains(lists[1], "ACCEPT"){
-			t.Errorf("cannot find flannelNet accept chain in namespaceChain: %s", namespaceChain)
+			t.Errorf("cannot find node gateway accept chain in namespaceChain: %s", namespaceChain)
 			for _, list := range lists{
 				t.Errorf("%s", list)
 			}
@@ -2966,7 +3250,16 @@ func checkDispatchChainPort(t *testing.T, dispatchChain, namespace, InOrE, specK
 
 func checkIPRangeIPSet(t *testing.T, fnp *EnnPolicy, ipRange string, nets ...string) bool{
 
-	ipsetName := ennIPRangeIPSetName(ipRange)
+	return checkHashNetIPSet(t, fnp, ennIPRangeIPSetName(ipRange), nets...)
+}
+
+func checkClusterNodeIPSet(t *testing.T, fnp *EnnPolicy, nets ...string) bool{
+
+	return checkHashNetIPSet(t, fnp, ENN_CLUSTER_NODE_SET, nets...)
+}
+
+func checkHashNetIPSet(t *testing.T, fnp *EnnPolicy, ipsetName string, nets ...string) bool{
+
 	ipset, err := fnp.ipsetInterface.GetIPSet(ipsetName)
 	if err != nil{
 		t.Errorf("get ipset %s error: %v", ipsetName, err)
@@ -3010,9 +3303,18 @@ func checkIPRangeIPSet(t *testing.T, fnp *EnnPolicy, ipRange string, nets ...str
 	return true
 }
 
-func checkFlannelNetIPSet(t *testing.T, fnp *EnnPolicy, flannelNet string, flannelLen string, expectedMap map[string]bool) bool{
+func checkNodeGatewayIPSet(t *testing.T, fnp *EnnPolicy, expectedMap map[string]bool) bool{
+
+	return checkHashIPSet(t, fnp, ENN_NODE_GATEWAY_SET, expectedMap)
+}
+
+func checkLocalNodeIPSet(t *testing.T, fnp *EnnPolicy, expectedMap map[string]bool) bool{
+
+	return checkHashIPSet(t, fnp, ENN_LOCAL_NODE_SET, expectedMap)
+}
+
+func checkHashIPSet(t *testing.T, fnp *EnnPolicy, ipsetName string, expectedMap map[string]bool) bool{
 
-	ipsetName := ennFlannelIPSetName(flannelNet, flannelLen)
 	ipset, err := fnp.ipsetInterface.GetIPSet(ipsetName)
 	if err != nil{
 		t.Errorf("get ipset %s error: %v", ipsetName, err)
@@ -3309,4 +3611,19 @@ func makeTestPod(namespace, name string, podFunc func(*coreApi.Pod)) *coreApi.Po
 	}
 	podFunc(pod)
 	return pod
-}
\ No newline at end of file
+}
+func makeTestNode(name, podCIDR string, internalIPs ...string) *coreApi.Node{
+
+	node := &coreApi.Node{
+		ObjectMeta:  metav1.ObjectMeta{
+			Name: name,
+		},
+		Spec:  coreApi.NodeSpec{
+			PodCIDR: podCIDR,
+		},
+	}
+	for _, ip := range internalIPs{
+		node.Status.Addresses = append(node.Status.Addresses, coreApi.NodeAddress{Type: coreApi.NodeInternalIP, Address: ip})
+	}
+	return node
+}
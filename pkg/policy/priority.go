@@ -0,0 +1,202 @@
+package policy
+
+import (
+	"github.com/golang/glog"
+	utilpolicy "enn-policy/pkg/policy/util"
+	utiliptables "enn-policy/pkg/util/k8siptables"
+
+	"crypto/sha256"
+	"encoding/base32"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// ENN_PRIORITY_CHAIN holds explicit rules of all globalNetworkPolicies ordered by priority,
+// ENN-FORWARD and ENN-OUTPUT jump to it before the entries of namespaces, so its rules are evaluated before any networkPolicy
+const ENN_PRIORITY_CHAIN = "ENN-PRIORITY"
+
+// priorityRule is an explicit rule of a globalNetworkPolicy rendered for the selected pods of one namespace
+type priorityRule struct {
+	namespace   string
+	policyName  string
+	// index is the index of the rule in spec.rules of the globalNetworkPolicy
+	index       int
+	// targetSet is the ipset of the selected pods
+	targetSet   string
+	rule        utilpolicy.ExplicitRule
+}
+
+// hasExplicitRules returns true if any globalNetworkPolicy has explicit rules, ENN-PRIORITY is only created in this case
+func (policy *EnnPolicy) hasExplicitRules() bool{
+	for _, globalNetworkPolicy := range policy.globalNetworkPolicyMap{
+		if len(globalNetworkPolicy.Policy.ExplicitRules) > 0{
+			return true
+		}
+	}
+	return false
+}
+
+// writePriorityEntry creates ENN-PRIORITY and jumps to it from ENN-FORWARD and ENN-OUTPUT,
+// it must be called before entries of namespaces are written
+func (policy *EnnPolicy) writePriorityEntry(){
+
+	policy.priorityRules = nil
+	if !policy.hasExplicitRules(){
+		return
+	}
+	chainName := utiliptables.Chain(ENN_PRIORITY_CHAIN)
+	if chain, ok := policy.existingFilterChains[chainName]; ok {
+		writeLine(policy.filterChains, chain)
+	} else {
+		writeLine(policy.filterChains, utiliptables.MakeChainLine(chainName))
+	}
+	policy.activeFilterChains[chainName] = true
+
+	for _, entryChain := range []string{ENN_FORWARD_CHAIN, ENN_OUTPUT_CHAIN}{
+		writeLine(policy.filterRules,
+			"-A", entryChain,
+			"-m", "comment", "--comment", `"explicit rules of global policies"`,
+			"-j", ENN_PRIORITY_CHAIN,
+		)
+	}
+}
+
+// collectPriorityRules records explicit rules of networkPolicy for its selected pods in targetSet,
+// they are written by writePriorityRules after all networkPolicies are rendered
+func (policy *EnnPolicy) collectPriorityRules(networkPolicy *utilpolicy.NetworkPolicyInfo, targetSet string){
+
+	// pods selected by a policy which is not supported at all are unknown, see enforcedNetworkPolicy
+	if networkPolicy.Support == utilpolicy.SupportNone{
+		return
+	}
+	for i, rule := range networkPolicy.ExplicitRules{
+		policy.priorityRules = append(policy.priorityRules, priorityRule{
+			namespace:   networkPolicy.Namespace,
+			policyName:  networkPolicy.Name,
+			index:       i,
+			targetSet:   targetSet,
+			rule:        rule,
+		})
+	}
+}
+
+// sortPriorityRules orders rules by priority, then by name of their policy, index and namespace
+func sortPriorityRules(rules []priorityRule){
+	sort.SliceStable(rules, func(i, j int) bool{
+		return priorityRuleLess(rules[i], rules[j])
+	})
+}
+
+func priorityRuleLess(a, b priorityRule) bool{
+	if a.rule.Priority != b.rule.Priority{
+		return a.rule.Priority < b.rule.Priority
+	}
+	if a.policyName != b.policyName{
+		return a.policyName < b.policyName
+	}
+	if a.index != b.index{
+		return a.index < b.index
+	}
+	return a.namespace < b.namespace
+}
+
+// writePriorityRules writes the collected explicit rules into ENN-PRIORITY, e.g
+// -A ENN-PRIORITY -m mark ! --mark 0x20000/0x20000 -m set --match-set ENN-PODSET-X src -d 203.0.113.0/24 -j REJECT
+// -A ENN-PRIORITY -m mark ! --mark 0x10000/0x10000 -m set --match-set ENN-PODSET-Y dst -s 10.0.0.0/8 -j MARK --set-xmark 0x10000/0x10000
+// an Allow rule never accepts the packet, it sets the allow mark of its direction like an AdminNetworkPolicy,
+// so only the entries of that direction are skipped, and rules of that direction with lower priority do not match any more,
+// while the other direction, AdminNetworkPolicies and explicit rules of the other direction are still evaluated
+// an ipBlock with except cidrs jumps to its own ENN-PRIORITY-* chain, which returns for the except cidrs
+// Deny rules use the deny action of the namespace but ignore audit mode, a namespace can not opt out of global rules
+func (policy *EnnPolicy) writePriorityRules(){
+
+	sortPriorityRules(policy.priorityRules)
+
+	for _, priorityRule := range policy.priorityRules{
+		rule := priorityRule.rule
+
+		targetDirect, cidrDirect, flowDirection, allowMark := "dst", "-s", flowDirectionIngress, adminAllowIngressMark
+		if rule.Direction == utilpolicy.TypeEgress{
+			targetDirect, cidrDirect, flowDirection, allowMark = "src", "-d", flowDirectionEgress, adminAllowEgressMark
+		}
+		comment := fmt.Sprintf(`"%s rule %d of policy %s/%s"`, rule.Action, priorityRule.index,
+			priorityRule.namespace, priorityRule.policyName)
+		writeAction := func(chain string, match ...string){
+			if rule.Action == utilpolicy.ExplicitRuleActionAllow{
+				args := []string{"-A", chain, "-m", "comment", "--comment", comment}
+				writeLine(policy.filterRules, append(append(args, match...), "-j", "MARK", "--set-xmark", allowMark + "/" + allowMark)...)
+				return
+			}
+			if flowLogRule := policy.flowLogRule(chain, policy.flowLogPrefix(flowLogTagDeny, flowDirection,
+				priorityRule.namespace, priorityRule.policyName), comment, match...); flowLogRule != nil{
+				writeLine(policy.filterRules, flowLogRule...)
+			}
+			for _, denyRule := range denyRules(policy.denyActionMode(priorityRule.namespace), chain, comment, match...){
+				writeLine(policy.filterRules, denyRule...)
+			}
+		}
+
+		ipBlocks := rule.IPBlock
+		if len(ipBlocks) == 0{
+			// no peer matches all traffic
+			ipBlocks = []utilpolicy.CIDRRange{{}}
+		}
+		ports := rule.Ports
+		if len(ports) == 0{
+			ports = []utilpolicy.PolicyPort{{}}
+		}
+
+		for _, ipBlock := range ipBlocks{
+			// a direction which is already allowed by a rule with higher priority is not evaluated again
+			match := []string{"-m", "mark", "!", "--mark", allowMark + "/" + allowMark,
+				"-m", "set", "--match-set", priorityRule.targetSet, targetDirect}
+			if ipBlock.CIDR != ""{
+				match = append(match, cidrDirect, ipBlock.CIDR)
+			}
+
+			var exceptChain string
+			if len(ipBlock.ExceptCIDR) > 0{
+				exceptChain = ennPriorityChainName(priorityRule.namespace, priorityRule.policyName,
+					strconv.Itoa(priorityRule.index), ipBlock.CIDR)
+				chainName := utiliptables.Chain(exceptChain)
+				if chain, ok := policy.existingFilterChains[chainName]; ok {
+					writeLine(policy.filterChains, chain)
+				} else {
+					writeLine(policy.filterChains, utiliptables.MakeChainLine(chainName))
+				}
+				policy.activeFilterChains[chainName] = true
+
+				for _, except := range ipBlock.ExceptCIDR{
+					writeLine(policy.filterRules,
+						"-A", exceptChain,
+						"-m", "comment", "--comment", `"except cidr of explicit rule"`,
+						cidrDirect, except,
+						"-j", "RETURN",
+					)
+				}
+				writeAction(exceptChain)
+			}
+
+			for _, port := range ports{
+				portMatch := match
+				if port.Port != ""{
+					portMatch = append(append([]string{}, match...), "-p", port.Protocol, "--dport", port.Port)
+				}
+				if exceptChain != ""{
+					args := []string{"-A", ENN_PRIORITY_CHAIN, "-m", "comment", "--comment", comment}
+					writeLine(policy.filterRules, append(append(args, portMatch...), "-j", exceptChain)...)
+					continue
+				}
+				writeAction(ENN_PRIORITY_CHAIN, portMatch...)
+			}
+		}
+	}
+	glog.V(4).Infof("%d explicit rules are written into %s", len(policy.priorityRules), ENN_PRIORITY_CHAIN)
+}
+
+func ennPriorityChainName(namespace string, policyName string, index string, cidr string) string{
+	hash := sha256.Sum256([]byte(namespace + policyName + index + cidr))
+	encoded := base32.StdEncoding.EncodeToString(hash[:])
+	return ENN_PRIORITY_CHAIN + "-" + encoded[:16]
+}
@@ -0,0 +1,154 @@
+package policy
+
+import (
+	utilpolicy "enn-policy/pkg/policy/util"
+	fakeIPSet "enn-policy/pkg/util/ipset/testing"
+	utiliptables "enn-policy/pkg/util/k8siptables"
+
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWritePriorityRules(t *testing.T){
+
+	policy := &EnnPolicy{
+		denyAction:           utilpolicy.DenyActionDrop,
+		existingFilterChains: make(map[utiliptables.Chain]string),
+		activeFilterChains:   make(map[utiliptables.Chain]bool),
+		filterChains:         bytes.NewBuffer(nil),
+		filterRules:          bytes.NewBuffer(nil),
+		namespaceInfoMap: utilpolicy.NamespaceInfoMap{
+			// audit mode does not apply to explicit rules
+			"payment": &utilpolicy.NamespaceInfo{Name: "payment", PolicyMode: utilpolicy.PolicyModeAudit},
+		},
+		globalNetworkPolicyMap: utilpolicy.GlobalNetworkPolicyMap{
+			"block": &utilpolicy.GlobalNetworkPolicyInfo{
+				Name:   "block",
+				Policy: &utilpolicy.NetworkPolicyInfo{Name: "global:block", ExplicitRules: []utilpolicy.ExplicitRule{{}}},
+			},
+		},
+	}
+	policy.writePriorityEntry()
+
+	policy.collectPriorityRules(&utilpolicy.NetworkPolicyInfo{
+		Namespace: "payment",
+		Name:      "global:allow-scan",
+		ExplicitRules: []utilpolicy.ExplicitRule{
+			{Action: utilpolicy.ExplicitRuleActionAllow, Priority: 200, Direction: utilpolicy.TypeIngress,
+				IPBlock: []utilpolicy.CIDRRange{{CIDR: "10.0.0.0/8"}}},
+		},
+	}, "ENN-NS-PAYMENT")
+	policy.collectPriorityRules(&utilpolicy.NetworkPolicyInfo{
+		Namespace: "payment",
+		Name:      "global:block",
+		ExplicitRules: []utilpolicy.ExplicitRule{
+			{Action: utilpolicy.ExplicitRuleActionDeny, Priority: 100, Direction: utilpolicy.TypeEgress,
+				Ports:   []utilpolicy.PolicyPort{{Protocol: "TCP", Port: "443"}},
+				IPBlock: []utilpolicy.CIDRRange{{CIDR: "203.0.113.0/24", ExceptCIDR: []string{"203.0.113.1/32"}}}},
+			{Action: utilpolicy.ExplicitRuleActionDeny, Priority: 300, Direction: utilpolicy.TypeIngress},
+		},
+	}, "ENN-PODSET-WEB")
+	// explicit rules of a policy which is not supported are skipped
+	policy.collectPriorityRules(&utilpolicy.NetworkPolicyInfo{
+		Namespace:     "payment",
+		Name:          "global:unsupported",
+		Support:       utilpolicy.SupportNone,
+		ExplicitRules: []utilpolicy.ExplicitRule{{Action: utilpolicy.ExplicitRuleActionDeny}},
+	}, "ENN-NS-PAYMENT")
+	policy.writePriorityRules()
+
+	exceptChain := ennPriorityChainName("payment", "global:block", "0", "203.0.113.0/24")
+	expected := []string{
+		`-A ENN-FORWARD -m comment --comment "explicit rules of global policies" -j ENN-PRIORITY`,
+		`-A ENN-OUTPUT -m comment --comment "explicit rules of global policies" -j ENN-PRIORITY`,
+		`-A ` + exceptChain + ` -m comment --comment "except cidr of explicit rule" -d 203.0.113.1/32 -j RETURN`,
+		`-A ` + exceptChain + ` -m comment --comment "Deny rule 0 of policy payment/global:block" -j DROP`,
+		`-A ENN-PRIORITY -m comment --comment "Deny rule 0 of policy payment/global:block" -m mark ! --mark 0x20000/0x20000 -m set --match-set ENN-PODSET-WEB src -d 203.0.113.0/24 -p TCP --dport 443 -j ` + exceptChain,
+		`-A ENN-PRIORITY -m comment --comment "Allow rule 0 of policy payment/global:allow-scan" -m mark ! --mark 0x10000/0x10000 -m set --match-set ENN-NS-PAYMENT dst -s 10.0.0.0/8 -j MARK --set-xmark 0x10000/0x10000`,
+		`-A ENN-PRIORITY -m comment --comment "Deny rule 1 of policy payment/global:block" -m mark ! --mark 0x10000/0x10000 -m set --match-set ENN-PODSET-WEB dst -j DROP`,
+	}
+	rules := strings.Split(strings.TrimSpace(policy.filterRules.String()), "\n")
+	if !reflect.DeepEqual(rules, expected){
+		t.Errorf("expected rules:\n%s\nget:\n%s", strings.Join(expected, "\n"), strings.Join(rules, "\n"))
+	}
+	if !policy.activeFilterChains[ENN_PRIORITY_CHAIN] || !policy.activeFilterChains[utiliptables.Chain(exceptChain)]{
+		t.Errorf("expected %s and %s to be active", ENN_PRIORITY_CHAIN, exceptChain)
+	}
+
+	// ENN-PRIORITY is not created without explicit rules
+	policy.globalNetworkPolicyMap = utilpolicy.GlobalNetworkPolicyMap{}
+	policy.filterRules.Reset()
+	policy.activeFilterChains = make(map[utiliptables.Chain]bool)
+	policy.writePriorityEntry()
+	policy.writePriorityRules()
+	if policy.filterRules.Len() != 0 || policy.activeFilterChains[ENN_PRIORITY_CHAIN]{
+		t.Errorf("expected no rules without explicit rules, get %s", policy.filterRules.String())
+	}
+}
+
+func TestPriorityAllowRules(t *testing.T){
+
+	faker := fakeIPSet.NewFaker()
+	policy := newAdminTestPolicy(faker)
+	policy.globalNetworkPolicyMap = utilpolicy.GlobalNetworkPolicyMap{
+		"guardrails": &utilpolicy.GlobalNetworkPolicyInfo{
+			Name:   "guardrails",
+			Policy: &utilpolicy.NetworkPolicyInfo{Name: "global:guardrails", ExplicitRules: []utilpolicy.ExplicitRule{{}}},
+		},
+	}
+	policy.writeAllowMarkReset()
+	policy.writePriorityEntry()
+	policy.writeAdminPolicyRules()
+
+	policy.collectPriorityRules(&utilpolicy.NetworkPolicyInfo{
+		Namespace: "tenant-a",
+		Name:      "global:guardrails",
+		ExplicitRules: []utilpolicy.ExplicitRule{
+			{Action: utilpolicy.ExplicitRuleActionAllow, Priority: 100, Direction: utilpolicy.TypeIngress},
+			{Action: utilpolicy.ExplicitRuleActionDeny, Priority: 300, Direction: utilpolicy.TypeIngress,
+				IPBlock: []utilpolicy.CIDRRange{{CIDR: monitoring + "/32"}}},
+		},
+	}, "ENN-NS-TENANT-A")
+	policy.collectPriorityRules(&utilpolicy.NetworkPolicyInfo{
+		Namespace: "tenant-b",
+		Name:      "global:guardrails",
+		ExplicitRules: []utilpolicy.ExplicitRule{
+			{Action: utilpolicy.ExplicitRuleActionDeny, Priority: 200, Direction: utilpolicy.TypeEgress,
+				IPBlock: []utilpolicy.CIDRRange{{CIDR: tenantADB + "/32"}}},
+		},
+	}, "ENN-NS-TENANT-B")
+
+	// tenant-a denies all ingress, tenant-b only allows egress to monitoring
+	writeAdminTestIngressPolicy(policy)
+	args := []string{"-A", ENN_FORWARD_CHAIN, "-m", "set", "--match-set", "ENN-NS-TENANT-B", "src"}
+	args = append(args, policy.adminAllowedMatch(adminAllowEgressMark)...)
+	writeLine(policy.filterRules, append(args, "-j", "ENN-EGRESS-TENANT-B")...)
+	writeLine(policy.filterRules, "-A", "ENN-EGRESS-TENANT-B", "-d", monitoring, "-j", "ACCEPT")
+	writeLine(policy.filterRules, "-A", "ENN-EGRESS-TENANT-B", "-j", "REJECT")
+	policy.writePriorityRules()
+	policy.writeBaselineAdminPolicyRules()
+
+	testCases := []struct {
+		packet   adminTestPacket
+		expected string
+	}{
+		// ingress of tenant-a is allowed without evaluating its NetworkPolicy and ingress rules with lower priority
+		{adminTestPacket{src: monitoring, dst: tenantAWeb, protocol: "TCP", port: "80"}, "ACCEPT"},
+		// the ingress Allow does not skip the egress NetworkPolicy of the peer
+		{adminTestPacket{src: tenantBWeb, dst: tenantAWeb, protocol: "TCP", port: "80"}, "REJECT"},
+		// nor egress rules of the peer with lower priority
+		{adminTestPacket{src: tenantBWeb, dst: tenantADB, protocol: "TCP", port: "5432"}, "DROP"},
+		{adminTestPacket{src: tenantBWeb, dst: monitoring, protocol: "TCP", port: "9090"}, "ACCEPT"},
+	}
+	chains := newAdminTestChains(policy, faker, map[string][]string{
+		"ENN-NS-TENANT-A": {tenantAWeb, tenantADB},
+		"ENN-NS-TENANT-B": {tenantBWeb},
+	})
+	for _, testCase := range testCases{
+		if verdict := chains.evaluate(t, testCase.packet); verdict != testCase.expected{
+			t.Errorf("expected %s for %+v, get %s\nrules:\n%s", testCase.expected, testCase.packet, verdict, policy.filterRules.String())
+		}
+	}
+}
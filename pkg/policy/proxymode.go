@@ -0,0 +1,109 @@
+package policy
+
+import (
+	"github.com/golang/glog"
+	utilIPSet "enn-policy/pkg/util/ipset"
+
+	"net"
+)
+
+const (
+	ProxyModeAuto      = "auto"
+	ProxyModeIPTables  = "iptables"
+	ProxyModeIPVS      = "ipvs"
+)
+
+const (
+	// KUBE_IPVS_INTERFACE is the dummy interface which kube-proxy binds service addresses to in ipvs mode
+	KUBE_IPVS_INTERFACE = "kube-ipvs0"
+	// KUBE_CLUSTER_IP_SET is the ipset of cluster ip:port which kube-proxy creates in ipvs mode
+	KUBE_CLUSTER_IP_SET = "KUBE-CLUSTER-IP"
+)
+
+// detectProxyMode returns ipvs if kube-ipvs0 or ipset KUBE-CLUSTER-IP is found on this node,
+// otherwise returns iptables
+// ipsets and chains created by kube-proxy are only read and never changed by enn-policy
+func detectProxyMode(ipsetInterface utilIPSet.Interface, interfaceExists func(name string) bool) string{
+
+	if interfaceExists(KUBE_IPVS_INTERFACE){
+		glog.V(2).Infof("find interface %s, so kube-proxy is in ipvs mode", KUBE_IPVS_INTERFACE)
+		return ProxyModeIPVS
+	}
+	if _, err := ipsetInterface.GetIPSet(KUBE_CLUSTER_IP_SET); err == nil{
+		glog.V(2).Infof("find ipset %s, so kube-proxy is in ipvs mode", KUBE_CLUSTER_IP_SET)
+		return ProxyModeIPVS
+	}
+	glog.V(2).Infof("cannot find interface %s or ipset %s, so kube-proxy is in iptables mode", KUBE_IPVS_INTERFACE, KUBE_CLUSTER_IP_SET)
+	return ProxyModeIPTables
+}
+
+func interfaceExists(name string) bool{
+	_, err := net.InterfaceByName(name)
+	return err == nil
+}
+
+// resolveProxyMode returns the proxy mode used by enn-policy, auto is detected from this node
+func resolveProxyMode(proxyMode string, ipsetInterface utilIPSet.Interface) string{
+	if proxyMode == ProxyModeIPTables || proxyMode == ProxyModeIPVS{
+		return proxyMode
+	}
+	return detectProxyMode(ipsetInterface, interfaceExists)
+}
+
+// refreshProxyMode detects the proxy mode again if proxy mode of config is auto,
+// it is called on each full sync, including periodic syncs
+func (policy *EnnPolicy) refreshProxyMode(){
+
+	if policy.configuredProxyMode != ProxyModeAuto{
+		return
+	}
+	proxyMode := detectProxyMode(policy.ipsetInterface, policy.interfaceExists)
+	if proxyMode != policy.proxyMode{
+		glog.V(0).Infof("kube-proxy mode is changed from %s to %s", policy.proxyMode, proxyMode)
+		policy.proxyMode = proxyMode
+	}
+}
+
+// writeProxyModeRules writes rules of proxyModeRules into filterRules
+// ipset KUBE-CLUSTER-IP is created by kube-proxy, iptables-restore fails if the rule refers to it before it exists,
+// so rules for ipvs mode are skipped until the ipset is found
+func (policy *EnnPolicy) writeProxyModeRules(){
+
+	proxyRules := proxyModeRules(policy.proxyMode)
+	if policy.proxyMode == ProxyModeIPVS{
+		if _, err := policy.ipsetInterface.GetIPSet(KUBE_CLUSTER_IP_SET); err != nil{
+			glog.Warningf("proxy mode is ipvs but ipset %s is not found, skip rules for ipvs mode: %v", KUBE_CLUSTER_IP_SET, err)
+			proxyRules = nil
+		}
+	}
+	for _, rule := range proxyRules{
+		writeLine(policy.filterRules, rule...)
+	}
+}
+
+// proxyModeRules returns rules which should be the first rules of ENN-INPUT/ENN-OUTPUT/ENN-FORWARD
+//
+// in iptables mode, traffic to a cluster ip is DNATed in PREROUTING, so pod traffic goes through
+// FORWARD with the real pod ip, and no extra rule is needed
+//
+// in ipvs mode, cluster ips are bound to kube-ipvs0, traffic to a cluster ip goes through INPUT with the cluster ip,
+// then ipvs DNATs it and sends it through OUTPUT with the real pod ip, so policy is enforced by the namespace entries in ENN-OUTPUT, e.g
+// -A ENN-INPUT -m set --match-set KUBE-CLUSTER-IP dst,dst -m comment --comment "..." -j RETURN
+// -A ENN-OUTPUT -m set --match-set [namespaceIPSet] dst -j ENN-INGRESS-xxxxxx
+// -A ENN-OUTPUT -m set --match-set [namespaceIPSet] src -j ENN-EGRESS-xxxxxx
+// the RETURN rule makes sure rules in ENN-INPUT never judge service traffic before DNAT
+func proxyModeRules(proxyMode string) [][]string{
+
+	switch proxyMode {
+	case ProxyModeIPVS:
+		return [][]string{
+			{
+				"-A", ENN_INPUT_CHAIN,
+				"-m", "set", "--match-set", KUBE_CLUSTER_IP_SET, "dst,dst",
+				"-m", "comment", "--comment", `"ipvs service traffic is checked in ENN-OUTPUT after DNAT"`,
+				"-j", "RETURN",
+			},
+		}
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package policy
+
+import (
+	utilIPSet "enn-policy/pkg/util/ipset"
+	fakeIPSet "enn-policy/pkg/util/ipset/testing"
+
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDetectProxyMode(t *testing.T){
+
+	noInterface := func(name string) bool{ return false }
+	ipvsInterface := func(name string) bool{ return name == KUBE_IPVS_INTERFACE }
+
+	ipset := fakeIPSet.NewFaker()
+	if mode := detectProxyMode(ipset, noInterface); mode != ProxyModeIPTables{
+		t.Errorf("expected proxy mode %s, get %s", ProxyModeIPTables, mode)
+	}
+	if mode := detectProxyMode(ipset, ipvsInterface); mode != ProxyModeIPVS{
+		t.Errorf("expected proxy mode %s when %s exists, get %s", ProxyModeIPVS, KUBE_IPVS_INTERFACE, mode)
+	}
+
+	ipset.CreateIPSet(&utilIPSet.IPSet{Name: KUBE_CLUSTER_IP_SET, Type: utilIPSet.TypeHashIPPort}, true)
+	if mode := detectProxyMode(ipset, noInterface); mode != ProxyModeIPVS{
+		t.Errorf("expected proxy mode %s when ipset %s exists, get %s", ProxyModeIPVS, KUBE_CLUSTER_IP_SET, mode)
+	}
+
+	// user defined proxy mode is never detected
+	if mode := resolveProxyMode(ProxyModeIPTables, ipset); mode != ProxyModeIPTables{
+		t.Errorf("expected proxy mode %s, get %s", ProxyModeIPTables, mode)
+	}
+}
+
+func TestProxyModeRules(t *testing.T){
+
+	if rules := proxyModeRules(ProxyModeIPTables); len(rules) != 0{
+		t.Errorf("expected no rule in iptables mode, get %v", rules)
+	}
+
+	rules := proxyModeRules(ProxyModeIPVS)
+	if len(rules) != 1{
+		t.Fatalf("expected 1 rule in ipvs mode, get %d", len(rules))
+	}
+	expected := []string{
+		"-A", "ENN-INPUT",
+		"-m", "set", "--match-set", "KUBE-CLUSTER-IP", "dst,dst",
+		"-m", "comment", "--comment", `"ipvs service traffic is checked in ENN-OUTPUT after DNAT"`,
+		"-j", "RETURN",
+	}
+	if !reflect.DeepEqual(rules[0], expected){
+		t.Errorf("expected rule %s, get %s", strings.Join(expected, " "), strings.Join(rules[0], " "))
+	}
+}
+
+func TestWriteProxyModeRules(t *testing.T){
+
+	ipvsInterface := false
+	ipset := fakeIPSet.NewFaker()
+	policy := &EnnPolicy{
+		proxyMode:           ProxyModeIPTables,
+		configuredProxyMode: ProxyModeAuto,
+		interfaceExists:     func(name string) bool{ return ipvsInterface && name == KUBE_IPVS_INTERFACE },
+		ipsetInterface:      ipset,
+		filterRules:         bytes.NewBuffer(nil),
+	}
+	clusterIPRule := "-A ENN-INPUT -m set --match-set KUBE-CLUSTER-IP dst,dst"
+	sync := func() string{
+		policy.filterRules.Reset()
+		policy.refreshProxyMode()
+		policy.writeProxyModeRules()
+		return policy.filterRules.String()
+	}
+
+	if rules := sync(); policy.proxyMode != ProxyModeIPTables || len(rules) != 0{
+		t.Errorf("expected no rule in proxy mode %s, get proxy mode %s and rules\n%s", ProxyModeIPTables, policy.proxyMode, rules)
+	}
+
+	// kube-proxy is switched to ipvs mode, but ipset KUBE-CLUSTER-IP is not created yet
+	ipvsInterface = true
+	if rules := sync(); policy.proxyMode != ProxyModeIPVS || len(rules) != 0{
+		t.Errorf("expected no rule in proxy mode %s without ipset %s, get proxy mode %s and rules\n%s", ProxyModeIPVS, KUBE_CLUSTER_IP_SET, policy.proxyMode, rules)
+	}
+
+	clusterIPSet := &utilIPSet.IPSet{Name: KUBE_CLUSTER_IP_SET, Type: utilIPSet.TypeHashIPPort}
+	ipset.CreateIPSet(clusterIPSet, true)
+	if rules := sync(); !strings.Contains(rules, clusterIPRule){
+		t.Errorf("expected rule %s in proxy mode %s, get\n%s", clusterIPRule, policy.proxyMode, rules)
+	}
+
+	// kube-proxy is switched back to iptables mode
+	ipvsInterface = false
+	ipset.DestroyIPSet(clusterIPSet)
+	if rules := sync(); policy.proxyMode != ProxyModeIPTables || len(rules) != 0{
+		t.Errorf("expected no rule after switching back to proxy mode %s, get proxy mode %s and rules\n%s", ProxyModeIPTables, policy.proxyMode, rules)
+	}
+
+	// user defined proxy mode is never detected again
+	policy.configuredProxyMode = ProxyModeIPVS
+	policy.proxyMode = ProxyModeIPVS
+	if rules := sync(); policy.proxyMode != ProxyModeIPVS || len(rules) != 0{
+		t.Errorf("expected no rule in user defined proxy mode %s without ipset %s, get proxy mode %s and rules\n%s", ProxyModeIPVS, KUBE_CLUSTER_IP_SET, policy.proxyMode, rules)
+	}
+}
@@ -0,0 +1,213 @@
+package policy
+
+import (
+	api "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"github.com/golang/glog"
+	utilpolicy "enn-policy/pkg/policy/util"
+	utilIPSet "enn-policy/pkg/util/ipset"
+	utiliptables "enn-policy/pkg/util/k8siptables"
+
+	"crypto/sha256"
+	"encoding/base32"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+func (policy *EnnPolicy) OnServiceAdd(service *api.Service){
+	glog.V(6).Infof("OnServiceAdd service name: %s/%s", service.Namespace, service.Name)
+	namespacedName := types.NamespacedName{Namespace: service.Namespace, Name: service.Name}
+	if policy.serviceChanges.Update(&namespacedName, nil, service) && policy.isInitialized() {
+		policy.syncEnnPolicy(SYNCSERVICE)
+	}
+}
+
+func (policy *EnnPolicy) OnServiceUpdate(oldService, service *api.Service){
+	glog.V(6).Infof("OnServiceUpdate old service name: %s/%s; new service name: %s/%s",
+		oldService.Namespace, oldService.Name, service.Namespace, service.Name)
+	namespacedName := types.NamespacedName{Namespace: service.Namespace, Name: service.Name}
+	if policy.serviceChanges.Update(&namespacedName, oldService, service) && policy.isInitialized() {
+		policy.syncEnnPolicy(SYNCSERVICE)
+	}
+}
+
+func (policy *EnnPolicy) OnServiceDelete(service *api.Service){
+	glog.V(6).Infof("OnServiceDelete service name: %s/%s", service.Namespace, service.Name)
+	namespacedName := types.NamespacedName{Namespace: service.Namespace, Name: service.Name}
+	if policy.serviceChanges.Update(&namespacedName, service, nil) && policy.isInitialized() {
+		policy.syncEnnPolicy(SYNCSERVICE)
+	}
+}
+
+func (policy *EnnPolicy) OnServiceSynced(){
+	glog.V(6).Infof("OnServiceSynced")
+	policy.mu.Lock()
+	policy.serviceSynced = true
+	policy.setInitialized(policy.allSynced())
+	policy.mu.Unlock()
+
+	policy.syncEnnPolicy(SYNCSERVICE)
+}
+
+func (policy *EnnPolicy) OnEndpointsAdd(endpoints *api.Endpoints){
+	glog.V(6).Infof("OnEndpointsAdd endpoints name: %s/%s", endpoints.Namespace, endpoints.Name)
+	namespacedName := types.NamespacedName{Namespace: endpoints.Namespace, Name: endpoints.Name}
+	if policy.endpointsChanges.Update(&namespacedName, nil, endpoints) && policy.isInitialized() {
+		policy.syncEnnPolicy(SYNCSERVICE)
+	}
+}
+
+func (policy *EnnPolicy) OnEndpointsUpdate(oldEndpoints, endpoints *api.Endpoints){
+	glog.V(6).Infof("OnEndpointsUpdate old endpoints name: %s/%s; new endpoints name: %s/%s",
+		oldEndpoints.Namespace, oldEndpoints.Name, endpoints.Namespace, endpoints.Name)
+	namespacedName := types.NamespacedName{Namespace: endpoints.Namespace, Name: endpoints.Name}
+	if policy.endpointsChanges.Update(&namespacedName, oldEndpoints, endpoints) && policy.isInitialized() {
+		policy.syncEnnPolicy(SYNCSERVICE)
+	}
+}
+
+func (policy *EnnPolicy) OnEndpointsDelete(endpoints *api.Endpoints){
+	glog.V(6).Infof("OnEndpointsDelete endpoints name: %s/%s", endpoints.Namespace, endpoints.Name)
+	namespacedName := types.NamespacedName{Namespace: endpoints.Namespace, Name: endpoints.Name}
+	if policy.endpointsChanges.Update(&namespacedName, endpoints, nil) && policy.isInitialized() {
+		policy.syncEnnPolicy(SYNCSERVICE)
+	}
+}
+
+func (policy *EnnPolicy) OnEndpointsSynced(){
+	glog.V(6).Infof("OnEndpointsSynced")
+	policy.mu.Lock()
+	policy.endpointsSynced = true
+	policy.setInitialized(policy.allSynced())
+	policy.mu.Unlock()
+
+	policy.syncEnnPolicy(SYNCSERVICE)
+}
+
+// updateServiceMaps applies changes of services and endpoints
+func (policy *EnnPolicy) updateServiceMaps(){
+	policy.serviceChanges.Lock.Lock()
+	utilpolicy.UpdateServiceInfoMap(policy.serviceInfoMap, &policy.serviceChanges)
+	policy.serviceChanges.CleanUpItem()
+	policy.serviceChanges.Lock.Unlock()
+	policy.endpointsChanges.Lock.Lock()
+	utilpolicy.UpdateEndpointsInfoMap(policy.endpointsInfoMap, &policy.endpointsChanges)
+	policy.endpointsChanges.CleanUpItem()
+	policy.endpointsChanges.Lock.Unlock()
+}
+
+// dispatchServices creates a dispatch chain for every service of EgressServices of networkPolicy e.g
+// iptables -t filter -A ENN-PLY-E-xxxxxx -j ENN-DPATCH-xxxxxx
+// iptables -t filter -A ENN-DPATCH-xxxxxx -m set --match-set ENN-PODSET-xxxxxx src -m set --match-set ENN-SVC-xxxxxx dst,dst -j ACCEPT
+// ENN-SVC-xxxxxx has the cluster ip and the endpoints of the service with their ports, so ports are always restricted
+func (policy *EnnPolicy) dispatchServices(networkPolicy *utilpolicy.NetworkPolicyInfo, iPRangeChainName string){
+
+	if len(networkPolicy.EgressServices) > 0 && !policy.egressServices{
+		glog.V(4).Infof("services are not watched, so egress services of networkPolicy %s/%s allow nothing", networkPolicy.Namespace, networkPolicy.Name)
+		return
+	}
+	var podMatch []string
+	if len(networkPolicy.PodSelector) > 0{
+		var xLabel []string
+		for labelKey, labelValue := range networkPolicy.PodSelector{
+			xLabel = append(xLabel, labelKey)
+			xLabel = append(xLabel, labelValue)
+		}
+		podMatch = []string{"-m", "set", "--match-set", ennXLabelIPSetName(networkPolicy.Namespace, "pod", xLabel), "src"}
+	}
+
+	for _, ref := range networkPolicy.EgressServices{
+		namespacedName := types.NamespacedName{Namespace: ref.Namespace, Name: ref.Name}
+		if namespacedName.Namespace == ""{
+			namespacedName.Namespace = networkPolicy.Namespace
+		}
+		glog.V(4).Infof("process sync service %s policy rules for networkPolicy %s/%s", namespacedName.String(), networkPolicy.Namespace, networkPolicy.Name)
+		serviceSetName := policy.serviceSetName(namespacedName)
+		if serviceSetName == ""{
+			continue
+		}
+
+		dispatchChainName := ennDispatchChainName(
+			networkPolicy.Namespace,
+			networkPolicy.Name,
+			strconv.Itoa(TYPE_EGRESS),
+			"service",
+			namespacedName.String(),
+			"",
+			"",
+		)
+		chainName := utiliptables.Chain(dispatchChainName)
+		if chain, ok := policy.existingFilterChains[chainName]; ok {
+			writeLine(policy.filterChains, chain)
+		} else {
+			writeLine(policy.filterChains, utiliptables.MakeChainLine(chainName))
+		}
+		policy.activeFilterChains[chainName] = true
+		policy.indexPolicyChain(chainName, networkPolicy, TYPE_EGRESS)
+
+		comment := fmt.Sprintf(`"policy %s:%s entry for service %s"`,
+			networkPolicy.Namespace,
+			networkPolicy.Name,
+			namespacedName.String(),
+		)
+		args := []string{
+			"-A", iPRangeChainName,
+			"-m", "comment", "--comment", comment,
+		}
+		writeLine(policy.filterRules, append(args, "-j", dispatchChainName)...)
+
+		comment = fmt.Sprintf(`"accept rule selected by policy %s/%s: dst match service %s"`,
+			networkPolicy.Namespace,
+			networkPolicy.Name,
+			namespacedName.String(),
+		)
+		args = []string{
+			"-A", dispatchChainName,
+			"-m", "comment", "--comment", comment,
+		}
+		args = append(args, podMatch...)
+		args = append(args, "-m", "set", "--match-set", serviceSetName, "dst,dst", "-j", "ACCEPT")
+		writeLine(policy.filterRules, args...)
+	}
+}
+
+// serviceSetName returns the name of the ipset of the endpoints of service, it is created if necessary,
+// empty if it can not be created, entries are synced by syncServiceSets
+func (policy *EnnPolicy) serviceSetName(service types.NamespacedName) string{
+
+	if set, ok := policy.serviceSets[service]; ok{
+		return set.Name
+	}
+	ipset := &utilIPSet.IPSet{
+		Name:    ennServiceIPSetName(service.String()),
+		Type:    utilIPSet.TypeHashIPPort,
+	}
+	if err := policy.ipsetInterface.CreateIPSet(ipset, true); err != nil{
+		glog.Errorf("create ipset %s for service %s err %v", ipset.Name, service.String(), err)
+		return ""
+	}
+	policy.activeIPSets[ipset.Name] = ipset
+	policy.serviceSets[service] = ipset
+	return ipset.Name
+}
+
+// syncServiceSets syncs entries of all ipsets of services used by networkPolicies,
+// they are synced after every change of services and endpoints
+func (policy *EnnPolicy) syncServiceSets(){
+	for service, ipset := range policy.serviceSets{
+		var entries []string
+		for _, endpoint := range utilpolicy.ServiceEndpoints(policy.serviceInfoMap[service], policy.endpointsInfoMap[service]){
+			entries = append(entries, fmt.Sprintf("%s,%s:%s", endpoint.IP, strings.ToLower(endpoint.Port.Protocol), endpoint.Port.Port))
+		}
+		if err := policy.syncIPSetEntryForIPPort(ipset, entries); err != nil{
+			glog.Errorf("sync entry for ipset %s of service %s failed %v", ipset.Name, service.String(), err)
+		}
+	}
+}
+
+func ennServiceIPSetName(service string) string{
+	hash := sha256.Sum256([]byte(service))
+	encoded := base32.StdEncoding.EncodeToString(hash[:])
+	return "ENN-SVC-" + encoded[:16]
+}
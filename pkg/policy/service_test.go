@@ -0,0 +1,179 @@
+package policy
+
+import (
+	api "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	utilpolicy "enn-policy/pkg/policy/util"
+	utilIPSet "enn-policy/pkg/util/ipset"
+	fakeIPSet "enn-policy/pkg/util/ipset/testing"
+	utiliptables "enn-policy/pkg/util/k8siptables"
+
+	"testing"
+)
+
+const (
+	paymentsClusterIP = "10.96.0.10"
+	paymentsPod1      = "10.0.2.10"
+	paymentsPod2      = "10.0.2.11"
+	serviceTestChain  = "ENN-PLY-E-TEST"
+)
+
+func newServiceTestPolicy(faker *fakeIPSet.Faker) *EnnPolicy{
+	policy := newAdminTestPolicy(faker)
+	policy.policyChainOwners = make(map[utiliptables.Chain]policyCounterOwner)
+	policy.fqdnSets = make(map[string]*fqdnSet)
+	policy.serviceChanges = utilpolicy.NewServiceChangeMap()
+	policy.endpointsChanges = utilpolicy.NewEndpointsChangeMap()
+	policy.serviceInfoMap = make(utilpolicy.ServiceInfoMap)
+	policy.endpointsInfoMap = make(utilpolicy.EndpointsInfoMap)
+	policy.egressServices = true
+	return policy
+}
+
+// writeServiceTestRules renders networkPolicies like syncPolicyRules, egress not allowed by them is rejected
+func writeServiceTestRules(policy *EnnPolicy, networkPolicies ...*utilpolicy.NetworkPolicyInfo){
+	policy.filterChains.Reset()
+	policy.filterRules.Reset()
+	policy.serviceSets = make(map[types.NamespacedName]*utilIPSet.IPSet)
+	writeLine(policy.filterRules, "-A", ENN_FORWARD_CHAIN, "-j", serviceTestChain)
+	for _, networkPolicy := range networkPolicies{
+		policy.dispatchEgressRules(networkPolicy, serviceTestChain)
+	}
+	writeLine(policy.filterRules, "-A", serviceTestChain, "-j", "REJECT")
+	policy.syncServiceSets()
+}
+
+func makeTestPaymentsEndpoints(ips ...string) *api.Endpoints{
+	var addresses []api.EndpointAddress
+	for _, ip := range ips{
+		addresses = append(addresses, api.EndpointAddress{IP: ip})
+	}
+	return &api.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "tenant-b", Name: "payments"},
+		Subsets: []api.EndpointSubset{{
+			Addresses: addresses,
+			Ports:     []api.EndpointPort{{Name: "http", Port: 8080, Protocol: api.ProtocolTCP}},
+		}},
+	}
+}
+
+func TestServiceRules(t *testing.T){
+
+	faker := fakeIPSet.NewFaker()
+	policy := newServiceTestPolicy(faker)
+	service := &api.Service{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "tenant-b", Name: "payments"},
+		Spec: api.ServiceSpec{
+			ClusterIP: paymentsClusterIP,
+			Ports:     []api.ServicePort{{Name: "http", Port: 80, Protocol: api.ProtocolTCP}},
+		},
+	}
+	namespacedName := types.NamespacedName{Namespace: "tenant-b", Name: "payments"}
+	policy.serviceChanges.Update(&namespacedName, nil, service)
+	policy.endpointsChanges.Update(&namespacedName, nil, makeTestPaymentsEndpoints(paymentsPod1))
+	policy.updateServiceMaps()
+
+	networkPolicy := &utilpolicy.NetworkPolicyInfo{
+		Name:           "payments",
+		Namespace:      "tenant-a",
+		PodSelector:    map[string]string{"app": "web"},
+		PolicyType:     []string{utilpolicy.TypeEgress},
+		EgressServices: []utilpolicy.ServiceRef{{Namespace: "tenant-b", Name: "payments"}},
+	}
+	writeServiceTestRules(policy, networkPolicy)
+
+	setName := ennServiceIPSetName("tenant-b/payments")
+	if set, ok := policy.activeIPSets[setName]; !ok || set.Type != utilIPSet.TypeHashIPPort{
+		t.Fatalf("expected active hash:ip,port ipset %s, get %+v", setName, set)
+	}
+
+	podSetName := ennXLabelIPSetName("tenant-a", "pod", []string{"app", "web"})
+	testCases := []struct {
+		packet   adminTestPacket
+		expected string
+	}{
+		{adminTestPacket{src: tenantAWeb, dst: paymentsClusterIP, protocol: "TCP", port: "80"}, "ACCEPT"},
+		{adminTestPacket{src: tenantAWeb, dst: paymentsPod1, protocol: "TCP", port: "8080"}, "ACCEPT"},
+		// ports are restricted to the ports of the service
+		{adminTestPacket{src: tenantAWeb, dst: paymentsClusterIP, protocol: "TCP", port: "8080"}, "REJECT"},
+		{adminTestPacket{src: tenantAWeb, dst: paymentsPod1, protocol: "UDP", port: "8080"}, "REJECT"},
+		{adminTestPacket{src: tenantAWeb, dst: paymentsPod2, protocol: "TCP", port: "8080"}, "REJECT"},
+		// db is not selected by spec.podSelector
+		{adminTestPacket{src: tenantADB, dst: paymentsPod1, protocol: "TCP", port: "8080"}, "REJECT"},
+	}
+	chains := newAdminTestChains(policy, faker, map[string][]string{podSetName: {tenantAWeb}})
+	for _, testCase := range testCases{
+		if verdict := chains.evaluate(t, testCase.packet); verdict != testCase.expected{
+			t.Errorf("expected %s for %+v, get %s\nrules:\n%s", testCase.expected, testCase.packet, verdict, policy.filterRules.String())
+		}
+	}
+
+	// the ipset follows the endpoints as the service scales, rules are not rendered again
+	policy.endpointsChanges.Update(&namespacedName, makeTestPaymentsEndpoints(paymentsPod1), makeTestPaymentsEndpoints(paymentsPod2))
+	policy.updateServiceMaps()
+	policy.syncServiceSets()
+	chains = newAdminTestChains(policy, faker, map[string][]string{podSetName: {tenantAWeb}})
+	if verdict := chains.evaluate(t, adminTestPacket{src: tenantAWeb, dst: paymentsPod2, protocol: "TCP", port: "8080"}); verdict != "ACCEPT"{
+		t.Errorf("expected ACCEPT to the new endpoint %s, get %s", paymentsPod2, verdict)
+	}
+	if verdict := chains.evaluate(t, adminTestPacket{src: tenantAWeb, dst: paymentsPod1, protocol: "TCP", port: "8080"}); verdict != "REJECT"{
+		t.Errorf("expected REJECT to the removed endpoint %s, get %s", paymentsPod1, verdict)
+	}
+
+	// the service is deleted, the ipset only keeps the endpoints
+	policy.serviceChanges.Update(&namespacedName, service, nil)
+	policy.updateServiceMaps()
+	policy.syncServiceSets()
+	chains = newAdminTestChains(policy, faker, map[string][]string{podSetName: {tenantAWeb}})
+	if verdict := chains.evaluate(t, adminTestPacket{src: tenantAWeb, dst: paymentsClusterIP, protocol: "TCP", port: "80"}); verdict != "REJECT"{
+		t.Errorf("expected REJECT to the cluster ip of deleted service, get %s", verdict)
+	}
+}
+
+func TestServiceRulesPolicyNamespace(t *testing.T){
+
+	faker := fakeIPSet.NewFaker()
+	policy := newServiceTestPolicy(faker)
+	networkPolicy := &utilpolicy.NetworkPolicyInfo{
+		Name:           "payments",
+		Namespace:      "tenant-b",
+		PolicyType:     []string{utilpolicy.TypeEgress},
+		EgressServices: []utilpolicy.ServiceRef{{Name: "payments"}},
+	}
+	writeServiceTestRules(policy, networkPolicy)
+
+	// a service without namespace is in the namespace of the policy
+	namespacedName := types.NamespacedName{Namespace: "tenant-b", Name: "payments"}
+	if set, ok := policy.serviceSets[namespacedName]; !ok || set.Name != ennServiceIPSetName("tenant-b/payments"){
+		t.Errorf("expected ipset of service %s, get %v", namespacedName.String(), policy.serviceSets)
+	}
+	// the service does not exist yet, so the ipset is empty and nothing is allowed
+	chains := newAdminTestChains(policy, faker, nil)
+	if verdict := chains.evaluate(t, adminTestPacket{src: tenantBWeb, dst: paymentsPod1, protocol: "TCP", port: "8080"}); verdict != "REJECT"{
+		t.Errorf("expected REJECT to service without endpoints, get %s", verdict)
+	}
+}
+
+func TestServiceRulesDisabled(t *testing.T){
+
+	faker := fakeIPSet.NewFaker()
+	policy := newServiceTestPolicy(faker)
+	policy.egressServices = false
+	networkPolicy := &utilpolicy.NetworkPolicyInfo{
+		Name:           "payments",
+		Namespace:      "tenant-b",
+		PolicyType:     []string{utilpolicy.TypeEgress},
+		EgressServices: []utilpolicy.ServiceRef{{Name: "payments"}},
+	}
+	writeServiceTestRules(policy, networkPolicy)
+
+	// services are not watched, so no ipset is created and nothing is allowed
+	if len(policy.serviceSets) != 0{
+		t.Errorf("expected no ipset of services, get %v", policy.serviceSets)
+	}
+	chains := newAdminTestChains(policy, faker, nil)
+	if verdict := chains.evaluate(t, adminTestPacket{src: tenantBWeb, dst: paymentsPod1, protocol: "TCP", port: "8080"}); verdict != "REJECT"{
+		t.Errorf("expected REJECT to service which is not watched, get %s", verdict)
+	}
+}
@@ -0,0 +1,64 @@
+package policy
+
+import (
+	"github.com/golang/glog"
+	utilpolicy "enn-policy/pkg/policy/util"
+
+	"time"
+)
+
+// terminatingPodsMode returns how terminating pods of namespace are handled in peer ipsets,
+// annotation enn-policy/terminating-pods of namespace overrides --terminating-pods
+func (policy *EnnPolicy) terminatingPodsMode(namespace string) string{
+
+	if namespaceInfo, ok := policy.namespaceInfoMap[namespace]; ok && namespaceInfo.TerminatingPods != ""{
+		if utilpolicy.IsValidTerminatingPods(namespaceInfo.TerminatingPods){
+			return namespaceInfo.TerminatingPods
+		}
+		glog.V(2).Infof("namespace %s has invalid annotation %s=%q, use default %s",
+			namespace, utilpolicy.TerminatingPodsAnnotation, namespaceInfo.TerminatingPods, policy.terminatingPods)
+	}
+	if policy.terminatingPods == utilpolicy.TerminatingPodsDrop{
+		return utilpolicy.TerminatingPodsDrop
+	}
+	return utilpolicy.TerminatingPodsKeep
+}
+
+// peerPodInfoMap returns pods which are allowed in peer ipsets (podSelector and namespaceSelector),
+// terminating pods are dropped or kept until their grace period ends, see utilpolicy.PeerPodInfoMap
+// ipsets for policy targets are not filtered, a terminating pod is still protected by its policy
+func (policy *EnnPolicy) peerPodInfoMap(podInfoMap utilpolicy.PodInfoMap) utilpolicy.PodInfoMap{
+
+	peers, deadline := utilpolicy.PeerPodInfoMap(podInfoMap, policy.terminatingPodsMode, time.Now())
+	if !deadline.IsZero(){
+		policy.scheduleTerminatingSync(deadline)
+	}
+	return peers
+}
+
+// scheduleTerminatingSync triggers a full sync after deadline, so a kept terminating pod
+// is removed from peer ipsets when its grace period ends even if no pod event comes
+// only the earliest deadline is scheduled, the next one is scheduled by that sync
+func (policy *EnnPolicy) scheduleTerminatingSync(deadline time.Time){
+
+	now := time.Now()
+	if policy.terminatingSync != nil && policy.terminatingSyncAt.After(now) && !policy.terminatingSyncAt.After(deadline){
+		return
+	}
+	if policy.terminatingSync != nil{
+		policy.terminatingSync.Stop()
+	}
+	glog.V(4).Infof("grace period of terminating pod ends at %v, schedule a sync", deadline)
+	policy.terminatingSyncAt = deadline
+	// wait one more second so the deadline has passed when the sync runs
+	policy.terminatingSync = time.AfterFunc(deadline.Sub(now) + time.Second, policy.Sync)
+}
+
+// trySyncPodLabelSetsOfNamespace syncs all podSelector ipsets of namespace
+func (policy *EnnPolicy) trySyncPodLabelSetsOfNamespace(namespace string){
+	for namespacedLabel := range policy.podLabelSet{
+		if namespacedLabel.Namespace == namespace{
+			policy.trySyncPodLabelSet(namespacedLabel)
+		}
+	}
+}
@@ -0,0 +1,318 @@
+package util
+
+import (
+	adminApi "enn-policy/pkg/apis/policy/v1alpha1"
+	coreApi "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"github.com/golang/glog"
+
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	AdminPolicyActionAllow = string(adminApi.AdminNetworkPolicyRuleActionAllow)
+	AdminPolicyActionDeny  = string(adminApi.AdminNetworkPolicyRuleActionDeny)
+	AdminPolicyActionPass  = string(adminApi.AdminNetworkPolicyRuleActionPass)
+)
+
+// AdminNetworkPolicyMap stores AdminNetworkPolicies or BaselineAdminNetworkPolicies by name
+type AdminNetworkPolicyMap map[string]*AdminNetworkPolicyInfo
+
+// AdminNetworkPolicyInfo will collect useful information from the spec of an AdminNetworkPolicy or a BaselineAdminNetworkPolicy
+type AdminNetworkPolicyInfo struct {
+
+	Name              string
+	UID               types.UID
+	// Baseline is true for a BaselineAdminNetworkPolicy, which has no priority and no Pass action
+	Baseline          bool
+	Priority          int32
+	Subject           AdminSelector
+	// MatchNone is true if spec.subject is not supported, so no pod is selected
+	MatchNone         bool
+	// Ingress and Egress only contain supported rules in the order of spec
+	Ingress           []AdminRule
+	Egress            []AdminRule
+}
+
+// AdminSelector selects pods by labels of their namespace and labels of pods, labels are ANDed, empty labels select all
+type AdminSelector struct {
+	NamespaceSelector map[string]string
+	PodSelector       map[string]string
+}
+
+// AdminRule is a supported rule of an AdminNetworkPolicy or a BaselineAdminNetworkPolicy
+type AdminRule struct {
+	Name              string
+	// Action is AdminPolicyActionAllow, AdminPolicyActionDeny or AdminPolicyActionPass
+	Action            string
+	Peers             []AdminPeer
+	// Ports is empty if the rule matches all ports, Port of a port range is start:end
+	Ports             []PolicyPort
+}
+
+// AdminPeer is pods selected by Pods, or networks in CIDRs
+type AdminPeer struct {
+	Pods              *AdminSelector
+	CIDRs             []string
+}
+
+// Key returns a string which is the same for selectors selecting the same pods
+func (selector AdminSelector) Key() string{
+	return labelsKey(selector.NamespaceSelector) + "/" + labelsKey(selector.PodSelector)
+}
+
+func labelsKey(labels map[string]string) string{
+	pairs := make([]string, 0, len(labels))
+	for key, value := range labels{
+		pairs = append(pairs, key + "=" + value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// SelectsNamespace returns true if labels of namespace match NamespaceSelector
+func (selector AdminSelector) SelectsNamespace(namespace *NamespaceInfo) bool{
+	if namespace == nil{
+		return false
+	}
+	return matchLabels(selector.NamespaceSelector, namespace.Labels)
+}
+
+// SelectsPod returns true if labels of pod match PodSelector, its namespace is checked by SelectsNamespace
+func (selector AdminSelector) SelectsPod(pod *PodInfo) bool{
+	return pod != nil && matchLabels(selector.PodSelector, pod.Labels)
+}
+
+func matchLabels(selector map[string]string, labels map[string]string) bool{
+	for key, value := range selector{
+		if labels[key] != value{
+			return false
+		}
+	}
+	return true
+}
+
+type AdminNetworkPolicyChangeMap struct {
+	Lock  sync.Mutex
+	Items map[string]*AdminNetworkPolicyChange
+}
+
+type AdminNetworkPolicyChange struct {
+	Previous *AdminNetworkPolicyInfo
+	Current  *AdminNetworkPolicyInfo
+}
+
+func NewAdminNetworkPolicyChangeMap() AdminNetworkPolicyChangeMap {
+	return AdminNetworkPolicyChangeMap{
+		Items: make(map[string]*AdminNetworkPolicyChange),
+	}
+}
+
+// UpdateAdmin records a change of an AdminNetworkPolicy
+func (acm *AdminNetworkPolicyChangeMap) UpdateAdmin(name string, previous, current *adminApi.AdminNetworkPolicy) bool{
+	return acm.update(name, buildAdminNetworkPolicyInfo(previous), buildAdminNetworkPolicyInfo(current))
+}
+
+// UpdateBaseline records a change of a BaselineAdminNetworkPolicy
+func (acm *AdminNetworkPolicyChangeMap) UpdateBaseline(name string, previous, current *adminApi.BaselineAdminNetworkPolicy) bool{
+	return acm.update(name, buildBaselineAdminNetworkPolicyInfo(previous), buildBaselineAdminNetworkPolicyInfo(current))
+}
+
+func (acm *AdminNetworkPolicyChangeMap) update(name string, previous, current *AdminNetworkPolicyInfo) bool{
+	glog.V(3).Infof("UpdateAdminNetworkPolicyChangeMap start")
+
+	acm.Lock.Lock()
+	defer acm.Lock.Unlock()
+
+	change, exists := acm.Items[name]
+
+	if !exists{
+		change = &AdminNetworkPolicyChange{}
+		change.Previous = previous
+		acm.Items[name] = change
+	}
+	change.Current = current
+	if reflect.DeepEqual(change.Previous, change.Current) {
+		delete(acm.Items, name)
+	}
+	glog.V(6).Infof("AdminNetworkPolicyChangeMap changed item number is %d", len(acm.Items))
+	return len(acm.Items) > 0
+}
+
+func UpdateAdminNetworkPolicyMap(adminNetworkPolicyMap AdminNetworkPolicyMap, changes *AdminNetworkPolicyChangeMap) {
+
+	changes.Lock.Lock()
+	defer changes.Lock.Unlock()
+
+	for name, change := range changes.Items{
+		if change.Previous != nil{
+			delete(adminNetworkPolicyMap, name)
+		}
+		if change.Current != nil{
+			adminNetworkPolicyMap[name] = change.Current
+		}
+	}
+	changes.Items = make(map[string]*AdminNetworkPolicyChange)
+}
+
+func buildAdminNetworkPolicyInfo(adminNetworkPolicy *adminApi.AdminNetworkPolicy) *AdminNetworkPolicyInfo{
+
+	if adminNetworkPolicy == nil{
+		return nil
+	}
+	info := &AdminNetworkPolicyInfo{
+		Name:     adminNetworkPolicy.Name,
+		UID:      adminNetworkPolicy.UID,
+		Priority: adminNetworkPolicy.Spec.Priority,
+	}
+	buildAdminSubject(info, adminNetworkPolicy.Spec.Subject)
+
+	for i, specRule := range adminNetworkPolicy.Spec.Ingress{
+		var peers []adminApi.AdminNetworkPolicyEgressPeer
+		for _, from := range specRule.From{
+			peers = append(peers, adminApi.AdminNetworkPolicyEgressPeer{Namespaces: from.Namespaces, Pods: from.Pods})
+		}
+		if rule, ok := buildAdminRule(info, fmt.Sprintf("ingress[%d]", i), specRule.Name, string(specRule.Action), peers, specRule.Ports); ok{
+			info.Ingress = append(info.Ingress, rule)
+		}
+	}
+	for i, specRule := range adminNetworkPolicy.Spec.Egress{
+		if rule, ok := buildAdminRule(info, fmt.Sprintf("egress[%d]", i), specRule.Name, string(specRule.Action), specRule.To, specRule.Ports); ok{
+			info.Egress = append(info.Egress, rule)
+		}
+	}
+	return info
+}
+
+func buildBaselineAdminNetworkPolicyInfo(baselineAdminNetworkPolicy *adminApi.BaselineAdminNetworkPolicy) *AdminNetworkPolicyInfo{
+
+	if baselineAdminNetworkPolicy == nil{
+		return nil
+	}
+	info := &AdminNetworkPolicyInfo{
+		Name:     baselineAdminNetworkPolicy.Name,
+		UID:      baselineAdminNetworkPolicy.UID,
+		Baseline: true,
+	}
+	buildAdminSubject(info, baselineAdminNetworkPolicy.Spec.Subject)
+
+	for i, specRule := range baselineAdminNetworkPolicy.Spec.Ingress{
+		var peers []adminApi.AdminNetworkPolicyEgressPeer
+		for _, from := range specRule.From{
+			peers = append(peers, adminApi.AdminNetworkPolicyEgressPeer{Namespaces: from.Namespaces, Pods: from.Pods})
+		}
+		if rule, ok := buildAdminRule(info, fmt.Sprintf("ingress[%d]", i), specRule.Name, string(specRule.Action), peers, specRule.Ports); ok{
+			info.Ingress = append(info.Ingress, rule)
+		}
+	}
+	for i, specRule := range baselineAdminNetworkPolicy.Spec.Egress{
+		if rule, ok := buildAdminRule(info, fmt.Sprintf("egress[%d]", i), specRule.Name, string(specRule.Action), specRule.To, specRule.Ports); ok{
+			info.Egress = append(info.Egress, rule)
+		}
+	}
+	return info
+}
+
+func buildAdminSubject(info *AdminNetworkPolicyInfo, subject adminApi.AdminNetworkPolicySubject){
+	selector, reason := buildAdminSelector(subject.Namespaces, subject.Pods)
+	if selector == nil{
+		glog.Warningf("adminNetworkPolicy %s has unsupported spec.subject: %s, so it selects no pod", info.Name, reason)
+		info.MatchNone = true
+		return
+	}
+	info.Subject = *selector
+}
+
+// buildAdminSelector returns the selector of namespaces or pods, exactly one of them must be set, matchExpressions are not supported
+func buildAdminSelector(namespaces *metav1.LabelSelector, pods *adminApi.NamespacedPod) (*AdminSelector, string){
+	switch {
+	case namespaces != nil && pods != nil:
+		return nil, "both namespaces and pods are set"
+	case namespaces != nil:
+		if len(namespaces.MatchExpressions) > 0{
+			return nil, "namespaces.matchExpressions"
+		}
+		return &AdminSelector{NamespaceSelector: namespaces.MatchLabels}, ""
+	case pods != nil:
+		if len(pods.NamespaceSelector.MatchExpressions) > 0 || len(pods.PodSelector.MatchExpressions) > 0{
+			return nil, "pods.matchExpressions"
+		}
+		return &AdminSelector{NamespaceSelector: pods.NamespaceSelector.MatchLabels, PodSelector: pods.PodSelector.MatchLabels}, ""
+	}
+	return nil, "neither namespaces nor pods is set"
+}
+
+// buildAdminRule builds a rule of info, ok is false if the rule is invalid or if none of its peers or ports is supported,
+// so a rule never matches more traffic than specified
+func buildAdminRule(info *AdminNetworkPolicyInfo, field string, name string, action string,
+	specPeers []adminApi.AdminNetworkPolicyEgressPeer, specPorts *[]adminApi.AdminNetworkPolicyPort) (AdminRule, bool){
+
+	rule := AdminRule{
+		Name:    name,
+		Action:  action,
+	}
+	switch {
+	case action == AdminPolicyActionAllow || action == AdminPolicyActionDeny:
+	case action == AdminPolicyActionPass && !info.Baseline:
+	default:
+		glog.Warningf("adminNetworkPolicy %s spec.%s has invalid action %q, skip it", info.Name, field, action)
+		return rule, false
+	}
+
+	for _, specPeer := range specPeers{
+		if specPeer.Nodes != nil{
+			glog.Warningf("adminNetworkPolicy %s spec.%s has unsupported peer nodes", info.Name, field)
+			continue
+		}
+		if len(specPeer.Networks) > 0{
+			rule.Peers = append(rule.Peers, AdminPeer{CIDRs: specPeer.Networks})
+			continue
+		}
+		selector, reason := buildAdminSelector(specPeer.Namespaces, specPeer.Pods)
+		if selector == nil{
+			glog.Warningf("adminNetworkPolicy %s spec.%s has unsupported peer: %s", info.Name, field, reason)
+			continue
+		}
+		rule.Peers = append(rule.Peers, AdminPeer{Pods: selector})
+	}
+
+	var numPorts int
+	if specPorts != nil{
+		numPorts = len(*specPorts)
+		for _, specPort := range *specPorts{
+			switch {
+			case specPort.PortNumber != nil:
+				rule.Ports = append(rule.Ports, PolicyPort{
+					Protocol: adminProtocol(specPort.PortNumber.Protocol),
+					Port:     fmt.Sprintf("%d", specPort.PortNumber.Port),
+				})
+			case specPort.PortRange != nil:
+				rule.Ports = append(rule.Ports, PolicyPort{
+					Protocol: adminProtocol(specPort.PortRange.Protocol),
+					Port:     fmt.Sprintf("%d:%d", specPort.PortRange.Start, specPort.PortRange.End),
+				})
+			default:
+				glog.Warningf("adminNetworkPolicy %s spec.%s has unsupported port, only portNumber and portRange are supported", info.Name, field)
+			}
+		}
+	}
+
+	// peers are required, a rule without peers matches no traffic
+	if len(specPeers) == 0 || !ruleSupported(len(specPeers), len(rule.Peers), numPorts, len(rule.Ports)){
+		glog.Warningf("adminNetworkPolicy %s spec.%s has no supported peer or port, skip it", info.Name, field)
+		return rule, false
+	}
+	return rule, true
+}
+
+func adminProtocol(protocol coreApi.Protocol) string{
+	if protocol == ""{
+		return string(coreApi.ProtocolTCP)
+	}
+	return string(protocol)
+}
@@ -0,0 +1,185 @@
+package util
+
+import (
+	adminApi "enn-policy/pkg/apis/policy/v1alpha1"
+	coreApi "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"reflect"
+	"testing"
+)
+
+func TestBuildAdminNetworkPolicyInfo(t *testing.T){
+
+	namedPort := "http"
+	ports := []adminApi.AdminNetworkPolicyPort{
+		{PortNumber: &adminApi.Port{Protocol: coreApi.ProtocolUDP, Port: 53}},
+		{PortRange: &adminApi.PortRange{Start: 8000, End: 9000}},
+		{NamedPort: &namedPort},
+	}
+	adminNetworkPolicy := &adminApi.AdminNetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "tenant"},
+		Spec: adminApi.AdminNetworkPolicySpec{
+			Priority: 10,
+			Subject: adminApi.AdminNetworkPolicySubject{
+				Namespaces: &metav1.LabelSelector{MatchLabels: map[string]string{"tenant": "true"}},
+			},
+			Ingress: []adminApi.AdminNetworkPolicyIngressRule{
+				{
+					Name:   "allow-monitoring",
+					Action: adminApi.AdminNetworkPolicyRuleActionAllow,
+					From:   []adminApi.AdminNetworkPolicyIngressPeer{{Namespaces: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "monitoring"}}}},
+				},
+				{
+					Name:   "invalid-action",
+					Action: "Drop",
+					From:   []adminApi.AdminNetworkPolicyIngressPeer{{Namespaces: &metav1.LabelSelector{}}},
+				},
+			},
+			Egress: []adminApi.AdminNetworkPolicyEgressRule{
+				{
+					Name:   "deny-dns",
+					Action: adminApi.AdminNetworkPolicyRuleActionDeny,
+					To: []adminApi.AdminNetworkPolicyEgressPeer{
+						{Networks: []string{"10.0.0.0/8"}},
+						{Nodes: &metav1.LabelSelector{}},
+						{Pods: &adminApi.NamespacedPod{PodSelector: metav1.LabelSelector{MatchLabels: map[string]string{"app": "dns"}}}},
+					},
+					Ports: &ports,
+				},
+				{
+					// only nodes peers are set, so the rule is skipped
+					Name:   "pass-nodes",
+					Action: adminApi.AdminNetworkPolicyRuleActionPass,
+					To:     []adminApi.AdminNetworkPolicyEgressPeer{{Nodes: &metav1.LabelSelector{}}},
+				},
+			},
+		},
+	}
+	info := buildAdminNetworkPolicyInfo(adminNetworkPolicy)
+	if info.Name != "tenant" || info.Priority != 10 || info.Baseline || info.MatchNone{
+		t.Errorf("unexpected policy info %+v", info)
+	}
+	if !reflect.DeepEqual(info.Subject, AdminSelector{NamespaceSelector: map[string]string{"tenant": "true"}}){
+		t.Errorf("unexpected subject %+v", info.Subject)
+	}
+	if len(info.Ingress) != 1 || info.Ingress[0].Action != AdminPolicyActionAllow || len(info.Ingress[0].Ports) != 0{
+		t.Errorf("expected one ingress rule allowing all ports, get %+v", info.Ingress)
+	}
+	if len(info.Egress) != 1{
+		t.Fatalf("expected one egress rule, get %+v", info.Egress)
+	}
+	egress := info.Egress[0]
+	expectedPeers := []AdminPeer{
+		{CIDRs: []string{"10.0.0.0/8"}},
+		{Pods: &AdminSelector{PodSelector: map[string]string{"app": "dns"}}},
+	}
+	if egress.Action != AdminPolicyActionDeny || !reflect.DeepEqual(egress.Peers, expectedPeers){
+		t.Errorf("unexpected egress rule %+v", egress)
+	}
+	expectedPorts := []PolicyPort{{Protocol: "UDP", Port: "53"}, {Protocol: "TCP", Port: "8000:9000"}}
+	if !reflect.DeepEqual(egress.Ports, expectedPorts){
+		t.Errorf("expected ports %+v, get %+v", expectedPorts, egress.Ports)
+	}
+
+	// a subject with matchExpressions selects no pod
+	adminNetworkPolicy.Spec.Subject.Namespaces.MatchExpressions = []metav1.LabelSelectorRequirement{
+		{Key: "tenant", Operator: metav1.LabelSelectorOpExists},
+	}
+	if info := buildAdminNetworkPolicyInfo(adminNetworkPolicy); !info.MatchNone{
+		t.Errorf("expected subject with matchExpressions to select no pod")
+	}
+}
+
+func TestBuildBaselineAdminNetworkPolicyInfo(t *testing.T){
+
+	baselineAdminNetworkPolicy := &adminApi.BaselineAdminNetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "default"},
+		Spec: adminApi.BaselineAdminNetworkPolicySpec{
+			Subject: adminApi.AdminNetworkPolicySubject{Namespaces: &metav1.LabelSelector{}},
+			Ingress: []adminApi.BaselineAdminNetworkPolicyIngressRule{
+				{
+					Name:   "deny-all",
+					Action: adminApi.BaselineAdminNetworkPolicyRuleActionDeny,
+					From:   []adminApi.AdminNetworkPolicyIngressPeer{{Namespaces: &metav1.LabelSelector{}}},
+				},
+				{
+					// Pass is not an action of BaselineAdminNetworkPolicy
+					Name:   "pass",
+					Action: "Pass",
+					From:   []adminApi.AdminNetworkPolicyIngressPeer{{Namespaces: &metav1.LabelSelector{}}},
+				},
+			},
+		},
+	}
+	info := buildBaselineAdminNetworkPolicyInfo(baselineAdminNetworkPolicy)
+	if !info.Baseline || info.MatchNone{
+		t.Errorf("unexpected policy info %+v", info)
+	}
+	if len(info.Ingress) != 1 || info.Ingress[0].Name != "deny-all"{
+		t.Errorf("expected only rule deny-all, get %+v", info.Ingress)
+	}
+}
+
+func TestAdminSelector(t *testing.T){
+
+	selector := AdminSelector{
+		NamespaceSelector: map[string]string{"tenant": "true"},
+		PodSelector:       map[string]string{"app": "web"},
+	}
+	if !selector.SelectsNamespace(&NamespaceInfo{Name: "a", Labels: map[string]string{"tenant": "true"}}){
+		t.Errorf("expected namespace with label tenant=true to be selected")
+	}
+	if selector.SelectsNamespace(&NamespaceInfo{Name: "b"}){
+		t.Errorf("expected namespace without label tenant=true not to be selected")
+	}
+	if !selector.SelectsPod(&PodInfo{Labels: map[string]string{"app": "web", "version": "v1"}}) ||
+		selector.SelectsPod(&PodInfo{Labels: map[string]string{"app": "db"}}){
+		t.Errorf("unexpected pods selected by %+v", selector)
+	}
+
+	same := AdminSelector{
+		NamespaceSelector: map[string]string{"tenant": "true"},
+		PodSelector:       map[string]string{"app": "web"},
+	}
+	if selector.Key() != same.Key(){
+		t.Errorf("expected the same key for the same selector, get %s and %s", selector.Key(), same.Key())
+	}
+	swapped := AdminSelector{
+		NamespaceSelector: map[string]string{"app": "web"},
+		PodSelector:       map[string]string{"tenant": "true"},
+	}
+	if selector.Key() == swapped.Key(){
+		t.Errorf("expected different keys for namespace and pod selectors, get %s", selector.Key())
+	}
+}
+
+func TestAdminNetworkPolicyChangeMap(t *testing.T){
+
+	adminNetworkPolicy := &adminApi.AdminNetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "tenant"},
+		Spec: adminApi.AdminNetworkPolicySpec{
+			Priority: 10,
+			Subject:  adminApi.AdminNetworkPolicySubject{Namespaces: &metav1.LabelSelector{}},
+		},
+	}
+	changes := NewAdminNetworkPolicyChangeMap()
+	adminNetworkPolicyMap := make(AdminNetworkPolicyMap)
+
+	if !changes.UpdateAdmin("tenant", nil, adminNetworkPolicy){
+		t.Errorf("expected change when policy is added")
+	}
+	UpdateAdminNetworkPolicyMap(adminNetworkPolicyMap, &changes)
+	if info, ok := adminNetworkPolicyMap["tenant"]; !ok || info.Priority != 10{
+		t.Errorf("expected policy tenant with priority 10 in map, get %+v", adminNetworkPolicyMap)
+	}
+
+	if changes.UpdateAdmin("tenant", adminNetworkPolicy, adminNetworkPolicy.DeepCopy()){
+		t.Errorf("expected no change when policy is not changed")
+	}
+	changes.UpdateAdmin("tenant", adminNetworkPolicy, nil)
+	UpdateAdminNetworkPolicyMap(adminNetworkPolicyMap, &changes)
+	if len(adminNetworkPolicyMap) != 0{
+		t.Errorf("expected empty map after policy is deleted, get %+v", adminNetworkPolicyMap)
+	}
+}
@@ -0,0 +1,142 @@
+package util
+
+import (
+	policyApi "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	"fmt"
+	"strconv"
+)
+
+const (
+	// SupportFull means every field of the networkPolicy is enforced
+	SupportFull        = "full"
+	// SupportPartial means some peers or ports are not enforced, the targets of the networkPolicy are still known
+	SupportPartial     = "partial"
+	// SupportNone means spec.podSelector is not supported, so enn-policy does not know which pods are protected
+	SupportNone        = "unsupported"
+)
+
+// UnsupportedPolicyModeAnnotation on a NetworkPolicy overrides --unsupported-policy-mode for that policy
+const UnsupportedPolicyModeAnnotation = "enn-policy/unsupported-policy-mode"
+
+const (
+	// UnsupportedPolicyModeBestEffort enforces the supported part of a policy,
+	// a policy which is not supported at all is ignored
+	UnsupportedPolicyModeBestEffort = "best-effort"
+	// UnsupportedPolicyModeFailClosed denies all traffic of the policy types to the targets of a policy which is not fully supported,
+	// targets are all pods of the namespace if spec.podSelector is not supported
+	UnsupportedPolicyModeFailClosed = "fail-closed"
+)
+
+func IsValidUnsupportedPolicyMode(mode string) bool{
+	return mode == UnsupportedPolicyModeBestEffort || mode == UnsupportedPolicyModeFailClosed
+}
+
+// PolicyCapability is the result of ValidateNetworkPolicy
+type PolicyCapability struct {
+	// Support is SupportFull, SupportPartial or SupportNone
+	Support           string
+	// Fields lists every construct which is not enforced, e.g
+	// spec.ingress[0].from[1]: podSelector.matchExpressions
+	Fields            []string
+}
+
+// ValidateNetworkPolicy classifies networkPolicy by the constructs enn-policy can enforce:
+// - matchExpressions of spec.podSelector makes the whole policy unsupported
+// - a peer with matchExpressions, or with both podSelector and namespaceSelector, is not enforced
+// - a named port or a port without port number is not enforced
+// - a rule is not enforced at all if none of its peers or none of its ports is enforced,
+//   since the rule would allow all peers or all ports otherwise
+// an empty rule, e.g ingress: [{}], allows all traffic and is fully supported
+// endPort is not a field of the networking/v1 api enn-policy is built with, so it can not be detected
+func ValidateNetworkPolicy(networkPolicy *policyApi.NetworkPolicy) *PolicyCapability{
+
+	capability := &PolicyCapability{Support: SupportFull}
+	if networkPolicy == nil{
+		return capability
+	}
+
+	if len(networkPolicy.Spec.PodSelector.MatchExpressions) > 0{
+		capability.Fields = append(capability.Fields, "spec.podSelector: matchExpressions")
+	}
+	for i, ingress := range networkPolicy.Spec.Ingress{
+		capability.Fields = append(capability.Fields,
+			validateRule(fmt.Sprintf("spec.ingress[%d]", i), "from", ingress.From, ingress.Ports)...)
+	}
+	for i, egress := range networkPolicy.Spec.Egress{
+		capability.Fields = append(capability.Fields,
+			validateRule(fmt.Sprintf("spec.egress[%d]", i), "to", egress.To, egress.Ports)...)
+	}
+
+	if len(networkPolicy.Spec.PodSelector.MatchExpressions) > 0{
+		capability.Support = SupportNone
+	} else if len(capability.Fields) > 0{
+		capability.Support = SupportPartial
+	}
+	return capability
+}
+
+func validateRule(path, peerField string, peers []policyApi.NetworkPolicyPeer, ports []policyApi.NetworkPolicyPort) []string{
+
+	var fields []string
+	supportedPeers := 0
+	for i, peer := range peers{
+		if reason := unsupportedPeer(peer); reason != ""{
+			fields = append(fields, fmt.Sprintf("%s.%s[%d]: %s", path, peerField, i, reason))
+		} else {
+			supportedPeers++
+		}
+	}
+	supportedPorts := 0
+	for i, port := range ports{
+		if reason := unsupportedPort(port); reason != ""{
+			fields = append(fields, fmt.Sprintf("%s.ports[%d]: %s", path, i, reason))
+		} else {
+			supportedPorts++
+		}
+	}
+	if !ruleSupported(len(peers), supportedPeers, len(ports), supportedPorts){
+		fields = append(fields, fmt.Sprintf("%s: whole rule since none of its %s or ports is supported", path, peerField))
+	}
+	return fields
+}
+
+// ruleSupported returns false if removing unsupported peers or ports would widen the rule,
+// an empty peer list allows all peers and an empty port list allows all ports
+func ruleSupported(peers, supportedPeers, ports, supportedPorts int) bool{
+	return !(peers > 0 && supportedPeers == 0) && !(ports > 0 && supportedPorts == 0)
+}
+
+// unsupportedPeer returns the reason why peer can not be enforced, empty if it is supported
+func unsupportedPeer(peer policyApi.NetworkPolicyPeer) string{
+
+	if peer.PodSelector != nil && peer.NamespaceSelector != nil{
+		return "podSelector combined with namespaceSelector"
+	}
+	if peer.PodSelector != nil && len(peer.PodSelector.MatchExpressions) > 0{
+		return "podSelector.matchExpressions"
+	}
+	if peer.NamespaceSelector != nil && len(peer.NamespaceSelector.MatchExpressions) > 0{
+		return "namespaceSelector.matchExpressions"
+	}
+	if peer.PodSelector == nil && peer.NamespaceSelector == nil && peer.IPBlock == nil{
+		return "empty peer"
+	}
+	return ""
+}
+
+// unsupportedPort returns the reason why port can not be enforced, empty if it is supported
+func unsupportedPort(port policyApi.NetworkPolicyPort) string{
+
+	if port.Port == nil{
+		return "port without port number"
+	}
+	if port.Port.Type == intstr.String{
+		// a numeric string is rendered as the port number
+		if _, err := strconv.Atoi(port.Port.StrVal); err != nil{
+			return fmt.Sprintf("named port %q", port.Port.StrVal)
+		}
+	}
+	return ""
+}
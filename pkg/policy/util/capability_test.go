@@ -0,0 +1,114 @@
+package util
+
+import (
+	api "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	"reflect"
+	"testing"
+)
+
+func TestValidateNetworkPolicy(t *testing.T){
+
+	expression := metav1.LabelSelectorRequirement{Key: "run", Operator: metav1.LabelSelectorOpExists}
+	port80 := intstr.FromInt(80)
+	portHTTP := intstr.FromString("http")
+	podPeer := api.NetworkPolicyPeer{PodSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"run": "client"}}}
+
+	testCases := []struct {
+		name     string
+		npFunc   func(*api.NetworkPolicy)
+		support  string
+		fields   []string
+	}{
+		{
+			name:    "fully supported",
+			npFunc:  func(np *api.NetworkPolicy){
+				np.Spec.PodSelector.MatchLabels = map[string]string{"run": "nginx"}
+				np.Spec.Ingress = []api.NetworkPolicyIngressRule{{
+					From:  []api.NetworkPolicyPeer{podPeer, {IPBlock: &api.IPBlock{CIDR: "10.0.0.0/8"}}},
+					Ports: []api.NetworkPolicyPort{{Port: &port80}},
+				}}
+			},
+			support: SupportFull,
+		},
+		{
+			name:    "default deny without rules",
+			npFunc:  func(np *api.NetworkPolicy){},
+			support: SupportFull,
+		},
+		{
+			name:    "matchExpressions of spec.podSelector",
+			npFunc:  func(np *api.NetworkPolicy){
+				np.Spec.PodSelector.MatchExpressions = []metav1.LabelSelectorRequirement{expression}
+			},
+			support: SupportNone,
+			fields:  []string{"spec.podSelector: matchExpressions"},
+		},
+		{
+			name:    "combined peer and named port",
+			npFunc:  func(np *api.NetworkPolicy){
+				np.Spec.Ingress = []api.NetworkPolicyIngressRule{{
+					From: []api.NetworkPolicyPeer{podPeer, {
+						PodSelector:       &metav1.LabelSelector{},
+						NamespaceSelector: &metav1.LabelSelector{},
+					}},
+					Ports: []api.NetworkPolicyPort{{Port: &port80}, {Port: &portHTTP}},
+				}}
+			},
+			support: SupportPartial,
+			fields:  []string{
+				"spec.ingress[0].from[1]: podSelector combined with namespaceSelector",
+				`spec.ingress[0].ports[1]: named port "http"`,
+			},
+		},
+		{
+			name:    "rule without supported port",
+			npFunc:  func(np *api.NetworkPolicy){
+				np.Spec.Egress = []api.NetworkPolicyEgressRule{{
+					To:    []api.NetworkPolicyPeer{podPeer},
+					Ports: []api.NetworkPolicyPort{{Port: &portHTTP}, {}},
+				}}
+			},
+			support: SupportPartial,
+			fields:  []string{
+				`spec.egress[0].ports[0]: named port "http"`,
+				"spec.egress[0].ports[1]: port without port number",
+				"spec.egress[0]: whole rule since none of its to or ports is supported",
+			},
+		},
+		{
+			name:    "empty rule",
+			npFunc:  func(np *api.NetworkPolicy){
+				np.Spec.Ingress = []api.NetworkPolicyIngressRule{{}}
+			},
+			support: SupportFull,
+		},
+	}
+
+	for _, testCase := range testCases{
+		capability := ValidateNetworkPolicy(makeTestNetworkPolicy("ns1", "np1", testCase.npFunc))
+		if capability.Support != testCase.support{
+			t.Errorf("%s: expected support %s, get %s", testCase.name, testCase.support, capability.Support)
+		}
+		if !reflect.DeepEqual(capability.Fields, testCase.fields){
+			t.Errorf("%s: expected fields %v, get %v", testCase.name, testCase.fields, capability.Fields)
+		}
+	}
+}
+
+func TestUnsupportedPolicyModeAnnotation(t *testing.T){
+
+	networkPolicy := makeTestNetworkPolicy("ns1", "np1", func(np *api.NetworkPolicy){
+		np.Annotations = map[string]string{UnsupportedPolicyModeAnnotation: UnsupportedPolicyModeFailClosed}
+	})
+	if mode := buildNetworkPolicyInfo(networkPolicy).UnsupportedPolicyMode; mode != UnsupportedPolicyModeFailClosed{
+		t.Errorf("expected unsupported policy mode %s, get %q", UnsupportedPolicyModeFailClosed, mode)
+	}
+
+	networkPolicy.Annotations[UnsupportedPolicyModeAnnotation] = "fail-open"
+	if mode := buildNetworkPolicyInfo(networkPolicy).UnsupportedPolicyMode; mode != ""{
+		t.Errorf("expected invalid annotation to be ignored, get %q", mode)
+	}
+}
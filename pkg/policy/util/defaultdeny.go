@@ -0,0 +1,76 @@
+package util
+
+import (
+	"github.com/golang/glog"
+
+	"encoding/json"
+	"fmt"
+)
+
+// DefaultDenyAnnotation is the namespace annotation which expressed isolation before NetworkPolicy v1,
+// e.g net.beta.kubernetes.io/network-policy: '{"ingress": {"isolation": "DefaultDeny"}}',
+// enn-policy also accepts "egress" in the same form
+const DefaultDenyAnnotation = "net.beta.kubernetes.io/network-policy"
+
+// DefaultDenyPolicyName is the name of the networkPolicy rendered for DefaultDenyAnnotation of a namespace,
+// ':' is not allowed in names of NetworkPolicies, so chains never conflict with a namespaced policy
+const DefaultDenyPolicyName = "legacy:default-deny"
+
+const defaultDenyIsolation = "DefaultDeny"
+
+type defaultDenyIsolationSpec struct {
+	Isolation string `json:"isolation"`
+}
+
+type defaultDenySpec struct {
+	Ingress *defaultDenyIsolationSpec `json:"ingress,omitempty"`
+	Egress  *defaultDenyIsolationSpec `json:"egress,omitempty"`
+}
+
+// ParseDefaultDenyAnnotation returns the policy types isolated by value of DefaultDenyAnnotation,
+// an isolation other than DefaultDeny does not isolate that direction
+func ParseDefaultDenyAnnotation(value string) ([]string, error){
+
+	var spec defaultDenySpec
+	if err := json.Unmarshal([]byte(value), &spec); err != nil{
+		return nil, fmt.Errorf("invalid annotation %s: %v", DefaultDenyAnnotation, err)
+	}
+	var policyTypes []string
+	if spec.Ingress != nil && spec.Ingress.Isolation == defaultDenyIsolation{
+		policyTypes = append(policyTypes, TypeIngress)
+	}
+	if spec.Egress != nil && spec.Egress.Isolation == defaultDenyIsolation{
+		policyTypes = append(policyTypes, TypeEgress)
+	}
+	return policyTypes, nil
+}
+
+func buildNamespaceDefaultDeny(namespace string, annotations map[string]string) []string{
+
+	value, ok := annotations[DefaultDenyAnnotation]
+	if !ok{
+		return nil
+	}
+	policyTypes, err := ParseDefaultDenyAnnotation(value)
+	if err != nil{
+		glog.Warningf("namespace %s has %v, ignore it", namespace, err)
+		return nil
+	}
+	return policyTypes
+}
+
+// DefaultDenyPolicy returns the networkPolicy which selects all pods of the namespace without any rule
+// for the directions isolated by DefaultDenyAnnotation, nil if the namespace is not isolated
+func (info *NamespaceInfo) DefaultDenyPolicy() *NetworkPolicyInfo{
+
+	if info == nil || len(info.DefaultDeny) == 0{
+		return nil
+	}
+	return &NetworkPolicyInfo{
+		Name:        DefaultDenyPolicyName,
+		Namespace:   info.Name,
+		PodSelector: map[string]string{},
+		PolicyType:  append([]string{}, info.DefaultDeny...),
+		Support:     SupportFull,
+	}
+}
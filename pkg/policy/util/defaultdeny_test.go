@@ -0,0 +1,58 @@
+package util
+
+import (
+	api "k8s.io/api/core/v1"
+
+	"reflect"
+	"testing"
+)
+
+func TestParseDefaultDenyAnnotation(t *testing.T){
+
+	testCases := []struct {
+		value    string
+		expected []string
+		err      bool
+	}{
+		{`{"ingress": {"isolation": "DefaultDeny"}}`, []string{TypeIngress}, false},
+		{`{"ingress": {"isolation": "DefaultDeny"}, "egress": {"isolation": "DefaultDeny"}}`, []string{TypeIngress, TypeEgress}, false},
+		{`{"egress": {"isolation": "DefaultDeny"}}`, []string{TypeEgress}, false},
+		{`{"ingress": {"isolation": "None"}}`, nil, false},
+		{`{}`, nil, false},
+		{`DefaultDeny`, nil, true},
+	}
+	for _, testCase := range testCases{
+		policyTypes, err := ParseDefaultDenyAnnotation(testCase.value)
+		if (err != nil) != testCase.err{
+			t.Errorf("expected error %v for %s, get %v", testCase.err, testCase.value, err)
+		}
+		if !reflect.DeepEqual(policyTypes, testCase.expected){
+			t.Errorf("expected policy types %v for %s, get %v", testCase.expected, testCase.value, policyTypes)
+		}
+	}
+}
+
+func TestNamespaceDefaultDenyPolicy(t *testing.T){
+
+	namespace := makeTestNamespace("legacy", func(ns *api.Namespace){
+		ns.Annotations = map[string]string{DefaultDenyAnnotation: `{"ingress": {"isolation": "DefaultDeny"}}`}
+	})
+	info := buildNamespaceInfo(namespace)
+	networkPolicy := info.DefaultDenyPolicy()
+	expected := &NetworkPolicyInfo{
+		Name:        DefaultDenyPolicyName,
+		Namespace:   "legacy",
+		PodSelector: map[string]string{},
+		PolicyType:  []string{TypeIngress},
+		Support:     SupportFull,
+	}
+	if !reflect.DeepEqual(networkPolicy, expected){
+		t.Errorf("expected default deny policy %+v, get %+v", expected, networkPolicy)
+	}
+
+	// an invalid annotation does not isolate the namespace
+	namespace.Annotations[DefaultDenyAnnotation] = "DefaultDeny"
+	if networkPolicy := buildNamespaceInfo(namespace).DefaultDenyPolicy(); networkPolicy != nil{
+		t.Errorf("expected no default deny policy for invalid annotation, get %+v", networkPolicy)
+	}
+}
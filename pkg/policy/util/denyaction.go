@@ -0,0 +1,48 @@
+package util
+
+import (
+	"strings"
+)
+
+// DenyActionAnnotation selects how traffic denied by policies of a namespace is handled,
+// value is one of the deny actions, e.g enn-policy/deny-action: drop
+const DenyActionAnnotation = "enn-policy/deny-action"
+
+const (
+	// DenyActionReject rejects with icmp-port-unreachable, the default of iptables REJECT
+	DenyActionReject                = "reject"
+	// DenyActionRejectTCPReset rejects tcp with tcp-reset so clients fail fast, other protocols with icmp-port-unreachable
+	DenyActionRejectTCPReset        = "reject-tcp-reset"
+	// DenyActionRejectAdminProhibited rejects with icmp-admin-prohibited
+	DenyActionRejectAdminProhibited = "reject-admin-prohibited"
+	// DenyActionDrop drops silently so nothing is leaked to the client
+	DenyActionDrop                  = "drop"
+	// DenyActionLogReject logs denied traffic then rejects like reject
+	DenyActionLogReject             = "log-reject"
+	// DenyActionLogDrop logs denied traffic then drops like drop
+	DenyActionLogDrop               = "log-drop"
+)
+
+var denyActions = []string{
+	DenyActionReject,
+	DenyActionRejectTCPReset,
+	DenyActionRejectAdminProhibited,
+	DenyActionDrop,
+	DenyActionLogReject,
+	DenyActionLogDrop,
+}
+
+// IsValidDenyAction returns true if action is one of the deny actions
+func IsValidDenyAction(action string) bool {
+	for _, denyAction := range denyActions{
+		if action == denyAction{
+			return true
+		}
+	}
+	return false
+}
+
+// DenyActions returns all deny actions separated by comma, used in messages
+func DenyActions() string {
+	return strings.Join(denyActions, ", ")
+}
@@ -0,0 +1,98 @@
+package util
+
+import (
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	"fmt"
+	"strings"
+)
+
+// Exemptions select pods which are never enforced by any policy, e.g CoreDNS or the monitoring stack,
+// a pod is exempted if its namespace or the pod itself matches any item
+type Exemptions struct {
+	Namespaces        map[string]bool
+	NamespaceLabels   []Label
+	PodLabels         []Label
+	PriorityClasses   map[string]bool
+}
+
+// ParseExemptions parses names of namespaces, key=value labels of namespaces and pods, and names of priorityClasses
+func ParseExemptions(namespaces, namespaceLabels, podLabels, priorityClasses []string) (*Exemptions, error){
+
+	exemptions := &Exemptions{
+		Namespaces:      make(map[string]bool),
+		PriorityClasses: make(map[string]bool),
+	}
+	for _, namespace := range namespaces{
+		if errs := validation.IsDNS1123Label(namespace); len(errs) > 0{
+			return nil, fmt.Errorf("invalid namespace %q: %s", namespace, strings.Join(errs, "; "))
+		}
+		exemptions.Namespaces[namespace] = true
+	}
+	var err error
+	if exemptions.NamespaceLabels, err = parseExemptionLabels(namespaceLabels); err != nil{
+		return nil, err
+	}
+	if exemptions.PodLabels, err = parseExemptionLabels(podLabels); err != nil{
+		return nil, err
+	}
+	for _, priorityClass := range priorityClasses{
+		if errs := validation.IsDNS1123Subdomain(priorityClass); len(errs) > 0{
+			return nil, fmt.Errorf("invalid priorityClass %q: %s", priorityClass, strings.Join(errs, "; "))
+		}
+		exemptions.PriorityClasses[priorityClass] = true
+	}
+	return exemptions, nil
+}
+
+func parseExemptionLabels(values []string) ([]Label, error){
+
+	var result []Label
+	for _, value := range values{
+		strs := strings.SplitN(value, "=", 2)
+		if len(strs) != 2{
+			return nil, fmt.Errorf("invalid label %q, expected format is key=value", value)
+		}
+		if errs := validation.IsQualifiedName(strs[0]); len(errs) > 0{
+			return nil, fmt.Errorf("invalid label key %q: %s", strs[0], strings.Join(errs, "; "))
+		}
+		if errs := validation.IsValidLabelValue(strs[1]); len(errs) > 0{
+			return nil, fmt.Errorf("invalid label value %q: %s", strs[1], strings.Join(errs, "; "))
+		}
+		result = append(result, Label{LabelKey: strs[0], LabelValue: strs[1]})
+	}
+	return result, nil
+}
+
+// IsEmpty returns true if no pod can be exempted
+func (exemptions *Exemptions) IsEmpty() bool{
+	return exemptions == nil || (len(exemptions.Namespaces) == 0 && len(exemptions.NamespaceLabels) == 0 &&
+		len(exemptions.PodLabels) == 0 && len(exemptions.PriorityClasses) == 0)
+}
+
+// ExemptsNamespace returns true if all pods of namespace are exempted
+func (exemptions *Exemptions) ExemptsNamespace(namespace *NamespaceInfo) bool{
+	if exemptions == nil || namespace == nil{
+		return false
+	}
+	return exemptions.Namespaces[namespace.Name] || matchExemptionLabels(exemptions.NamespaceLabels, namespace.Labels)
+}
+
+// ExemptsPod returns true if pod is exempted by itself or by namespace, hostNetwork pods are never exempted
+// since their ip is the ip of the node
+func (exemptions *Exemptions) ExemptsPod(namespace *NamespaceInfo, pod *PodInfo) bool{
+	if exemptions == nil || pod == nil || pod.HostNetwork{
+		return false
+	}
+	return exemptions.ExemptsNamespace(namespace) || exemptions.PriorityClasses[pod.PriorityClassName] ||
+		matchExemptionLabels(exemptions.PodLabels, pod.Labels)
+}
+
+func matchExemptionLabels(exemptionLabels []Label, labels map[string]string) bool{
+	for _, label := range exemptionLabels{
+		if value, ok := labels[label.LabelKey]; ok && value == label.LabelValue{
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,67 @@
+package util
+
+import (
+	"testing"
+)
+
+func TestParseExemptions(t *testing.T){
+
+	testCases := []struct {
+		name            string
+		namespaces      []string
+		namespaceLabels []string
+		podLabels       []string
+		priorityClasses []string
+		valid           bool
+	}{
+		{name: "empty", valid: true},
+		{name: "all", namespaces: []string{"kube-system"}, namespaceLabels: []string{"team=monitoring"},
+			podLabels: []string{"k8s-app=kube-dns", "example.com/critical="}, priorityClasses: []string{"system-node-critical"}, valid: true},
+		{name: "invalid namespace", namespaces: []string{"kube_system"}, valid: false},
+		{name: "label without value", podLabels: []string{"k8s-app"}, valid: false},
+		{name: "invalid label key", namespaceLabels: []string{"-team=monitoring"}, valid: false},
+		{name: "invalid label value", podLabels: []string{"app=kube dns"}, valid: false},
+		{name: "invalid priorityClass", priorityClasses: []string{"System_Critical"}, valid: false},
+	}
+	for _, testCase := range testCases{
+		_, err := ParseExemptions(testCase.namespaces, testCase.namespaceLabels, testCase.podLabels, testCase.priorityClasses)
+		if (err == nil) != testCase.valid{
+			t.Errorf("case %s: expected valid %v, get err %v", testCase.name, testCase.valid, err)
+		}
+	}
+}
+
+func TestExemptsPod(t *testing.T){
+
+	exemptions, err := ParseExemptions([]string{"kube-system"}, []string{"team=monitoring"}, []string{"k8s-app=kube-dns"}, []string{"system-cluster-critical"})
+	if err != nil{
+		t.Fatalf("parse exemptions error %v", err)
+	}
+	kubeSystem := &NamespaceInfo{Name: "kube-system"}
+	monitoring := &NamespaceInfo{Name: "monitoring", Labels: map[string]string{"team": "monitoring"}}
+	tenant := &NamespaceInfo{Name: "tenant", Labels: map[string]string{"team": "tenant"}}
+
+	testCases := []struct {
+		name      string
+		namespace *NamespaceInfo
+		pod       *PodInfo
+		expected  bool
+	}{
+		{"namespace name", kubeSystem, &PodInfo{IP: "10.0.0.1"}, true},
+		{"namespace label", monitoring, &PodInfo{IP: "10.0.0.2"}, true},
+		{"pod label", tenant, &PodInfo{IP: "10.0.0.3", Labels: map[string]string{"k8s-app": "kube-dns"}}, true},
+		{"priorityClass", tenant, &PodInfo{IP: "10.0.0.4", PriorityClassName: "system-cluster-critical"}, true},
+		{"not exempted", tenant, &PodInfo{IP: "10.0.0.5", Labels: map[string]string{"k8s-app": "web"}}, false},
+		{"hostNetwork", kubeSystem, &PodInfo{IP: "192.168.1.10", HostNetwork: true}, false},
+	}
+	for _, testCase := range testCases{
+		if result := exemptions.ExemptsPod(testCase.namespace, testCase.pod); result != testCase.expected{
+			t.Errorf("case %s: expected exempted %v, get %v", testCase.name, testCase.expected, result)
+		}
+	}
+
+	var empty *Exemptions
+	if !empty.IsEmpty() || empty.ExemptsPod(kubeSystem, &PodInfo{IP: "10.0.0.1"}){
+		t.Errorf("expected nil exemptions to exempt nothing")
+	}
+}
@@ -0,0 +1,88 @@
+package util
+
+import (
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// EgressFQDNsAnnotation on a NetworkPolicy or a GlobalNetworkPolicy allows egress of the selected pods to the ips of names,
+// value is a comma separated list of name[:port[/protocol]], protocol defaults to TCP and no port allows all ports,
+// e.g enn-policy/egress-fqdns: "api.partner.com:443,dns.partner.com:53/UDP,pypi.org"
+const EgressFQDNsAnnotation = "enn-policy/egress-fqdns"
+
+// FQDNRule allows egress to the ips of Name on Ports, no port allows all ports
+type FQDNRule struct {
+	Name              string
+	Ports             []PolicyPort
+}
+
+// ParseEgressFQDNs parses the value of EgressFQDNsAnnotation, ports of the same name are merged into one rule,
+// rules are in the order their names first appear, invalid items are returned in the error and skipped
+func ParseEgressFQDNs(value string) ([]FQDNRule, error){
+
+	var rules []FQDNRule
+	var invalid []string
+	index := make(map[string]int)
+	allPorts := make(map[string]bool)
+	for _, item := range strings.Split(value, ","){
+		item = strings.TrimSpace(item)
+		if item == ""{
+			continue
+		}
+		name, port, err := parseEgressFQDN(item)
+		if err != nil{
+			invalid = append(invalid, fmt.Sprintf("%q: %v", item, err))
+			continue
+		}
+		i, ok := index[name]
+		if !ok{
+			i = len(rules)
+			index[name] = i
+			rules = append(rules, FQDNRule{Name: name})
+		}
+		if port == nil{
+			allPorts[name] = true
+			continue
+		}
+		rules[i].Ports = append(rules[i].Ports, *port)
+	}
+	// a name allowed on all ports is not limited by ports of other items
+	for i := range rules{
+		if allPorts[rules[i].Name]{
+			rules[i].Ports = nil
+		}
+	}
+	if len(invalid) > 0{
+		return rules, fmt.Errorf("invalid fqdn %s", strings.Join(invalid, ", "))
+	}
+	return rules, nil
+}
+
+func parseEgressFQDN(item string) (string, *PolicyPort, error){
+
+	strs := strings.SplitN(item, ":", 2)
+	name := strings.TrimSuffix(strings.ToLower(strs[0]), ".")
+	if errs := validation.IsDNS1123Subdomain(name); len(errs) > 0{
+		return "", nil, fmt.Errorf("name must be a dns subdomain without wildcard: %s", strings.Join(errs, "; "))
+	}
+	if len(strs) == 1{
+		return name, nil, nil
+	}
+
+	portProtocol := strings.SplitN(strs[1], "/", 2)
+	port, err := strconv.Atoi(portProtocol[0])
+	if err != nil || port < 1 || port > 65535{
+		return "", nil, fmt.Errorf("port must be between 1 and 65535")
+	}
+	protocol := "TCP"
+	if len(portProtocol) == 2{
+		protocol = strings.ToUpper(portProtocol[1])
+		if protocol != "TCP" && protocol != "UDP" && protocol != "SCTP"{
+			return "", nil, fmt.Errorf("protocol must be tcp, udp or sctp")
+		}
+	}
+	return name, &PolicyPort{Protocol: protocol, Port: strconv.Itoa(port)}, nil
+}
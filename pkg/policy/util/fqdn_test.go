@@ -0,0 +1,56 @@
+package util
+
+import (
+	api "k8s.io/api/networking/v1"
+
+	"reflect"
+	"testing"
+)
+
+func TestParseEgressFQDNs(t *testing.T){
+
+	rules, err := ParseEgressFQDNs(" API.partner.com.:443, dns.partner.com:53/udp,api.partner.com:8443/TCP,pypi.org,pypi.org:443")
+	if err != nil{
+		t.Fatalf("parse egress fqdns error %v", err)
+	}
+	expected := []FQDNRule{
+		{Name: "api.partner.com", Ports: []PolicyPort{{Protocol: "TCP", Port: "443"}, {Protocol: "TCP", Port: "8443"}}},
+		{Name: "dns.partner.com", Ports: []PolicyPort{{Protocol: "UDP", Port: "53"}}},
+		// pypi.org is allowed on all ports by the item without port
+		{Name: "pypi.org"},
+	}
+	if !reflect.DeepEqual(rules, expected){
+		t.Errorf("expected rules %+v, get %+v", expected, rules)
+	}
+
+	testCases := []string{
+		"*.partner.com",
+		"api.partner.com:0",
+		"api.partner.com:https",
+		"api.partner.com:443/icmp",
+		"api_partner.com",
+	}
+	for _, value := range testCases{
+		rules, err := ParseEgressFQDNs("pypi.org," + value)
+		if err == nil{
+			t.Errorf("expected error for %q", value)
+		}
+		// valid items are kept
+		if len(rules) != 1 || rules[0].Name != "pypi.org"{
+			t.Errorf("expected only rule pypi.org for %q, get %+v", value, rules)
+		}
+	}
+}
+
+func TestNetworkPolicyEgressFQDNs(t *testing.T){
+
+	networkPolicy := makeTestNetworkPolicy("default", "partner", func(np *api.NetworkPolicy){
+		np.Annotations = map[string]string{EgressFQDNsAnnotation: "api.partner.com:443,*.partner.com"}
+		np.Spec.PolicyTypes = []api.PolicyType{api.PolicyTypeEgress}
+	})
+	info := buildNetworkPolicyInfo(networkPolicy)
+	expected := []FQDNRule{{Name: "api.partner.com", Ports: []PolicyPort{{Protocol: "TCP", Port: "443"}}}}
+	if !reflect.DeepEqual(info.EgressFQDNs, expected){
+		t.Errorf("expected egress fqdns %+v, get %+v", expected, info.EgressFQDNs)
+	}
+}
@@ -0,0 +1,244 @@
+package util
+
+import (
+	globalApi "enn-policy/pkg/apis/networking/v1alpha1"
+	policyApi "k8s.io/api/networking/v1"
+	coreApi "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"github.com/golang/glog"
+	"sync"
+	"reflect"
+)
+
+// GlobalNetworkPolicyPrefix starts names of networkPolicies rendered from a GlobalNetworkPolicy, e.g global:deny-metadata
+// ':' is not allowed in names of NetworkPolicies, so chains and ipsets never conflict with a namespaced policy of the same name
+const GlobalNetworkPolicyPrefix = "global:"
+
+const (
+	ExplicitRuleActionAllow  = string(globalApi.ExplicitRuleActionAllow)
+	ExplicitRuleActionDeny   = string(globalApi.ExplicitRuleActionDeny)
+	// DefaultExplicitRulePriority is the priority of an explicit rule without spec.rules[].priority
+	DefaultExplicitRulePriority int32 = 1000
+)
+
+type GlobalNetworkPolicyMap map[string]*GlobalNetworkPolicyInfo
+
+// GlobalNetworkPolicyInfo will collect useful information from globalNetworkPolicy spec
+type GlobalNetworkPolicyInfo struct {
+
+	Name              string
+	UID               types.UID
+
+	// NamespaceSelector selects namespaces the policy applies to, empty selects all namespaces
+	NamespaceSelector map[string]string
+	// MatchNone is true if spec.namespaceSelector uses matchExpressions, which is not supported, so no namespace is selected
+	MatchNone         bool
+	// Policy is rendered as a networkPolicy in every selected namespace, its Namespace is empty
+	Policy            *NetworkPolicyInfo
+}
+
+// SelectsNamespace returns true if labels of namespace match spec.namespaceSelector, labels are ANDed
+func (info *GlobalNetworkPolicyInfo) SelectsNamespace(namespace *NamespaceInfo) bool{
+	if namespace == nil || info.MatchNone{
+		return false
+	}
+	for key, value := range info.NamespaceSelector{
+		if namespace.Labels[key] != value{
+			return false
+		}
+	}
+	return true
+}
+
+// ForNamespace returns the networkPolicy which is rendered in namespace
+func (info *GlobalNetworkPolicyInfo) ForNamespace(namespace string) *NetworkPolicyInfo{
+	policy := *info.Policy
+	policy.Namespace = namespace
+	return &policy
+}
+
+// ExplicitRule is an Allow or Deny rule of a GlobalNetworkPolicy, which is evaluated before all networkPolicies
+type ExplicitRule struct {
+
+	// Action is ExplicitRuleActionAllow or ExplicitRuleActionDeny
+	Action            string
+	Priority          int32
+	// Direction is TypeIngress or TypeEgress
+	Direction         string
+	Ports             []PolicyPort
+	// IPBlock is empty if the rule matches all peers
+	IPBlock           []CIDRRange
+}
+
+type GlobalNetworkPolicyChangeMap struct {
+	Lock  sync.Mutex
+	Items map[string]*GlobalNetworkPolicyChange
+}
+
+type GlobalNetworkPolicyChange struct {
+	Previous *GlobalNetworkPolicyInfo
+	Current  *GlobalNetworkPolicyInfo
+}
+
+func NewGlobalNetworkPolicyChangeMap() GlobalNetworkPolicyChangeMap {
+	return GlobalNetworkPolicyChangeMap{
+		Items: make(map[string]*GlobalNetworkPolicyChange),
+	}
+}
+
+func (gcm *GlobalNetworkPolicyChangeMap) Update(name string, previous, current *globalApi.GlobalNetworkPolicy) bool{
+	glog.V(3).Infof("UpdateGlobalNetworkPolicyChangeMap start")
+
+	gcm.Lock.Lock()
+	defer gcm.Lock.Unlock()
+
+	change, exists := gcm.Items[name]
+
+	if !exists{
+		change = &GlobalNetworkPolicyChange{}
+		change.Previous = buildGlobalNetworkPolicyInfo(previous)
+		gcm.Items[name] = change
+	}
+	change.Current = buildGlobalNetworkPolicyInfo(current)
+	if reflect.DeepEqual(change.Previous, change.Current) {
+		delete(gcm.Items, name)
+	}
+	glog.V(6).Infof("GlobalNetworkPolicyChangeMap changed item number is %d", len(gcm.Items))
+	return len(gcm.Items) > 0
+}
+
+func UpdateGlobalNetworkPolicyMap(globalNetworkPolicyMap GlobalNetworkPolicyMap, changes *GlobalNetworkPolicyChangeMap) {
+
+	changes.Lock.Lock()
+	defer changes.Lock.Unlock()
+
+	for name, change := range changes.Items{
+		if change.Previous != nil{
+			delete(globalNetworkPolicyMap, name)
+		}
+		if change.Current != nil{
+			globalNetworkPolicyMap[name] = change.Current
+		}
+	}
+	changes.Items = make(map[string]*GlobalNetworkPolicyChange)
+}
+
+// buildGlobalNetworkPolicyInfo builds the policy like a NetworkPolicy with the same spec,
+// so unsupported fields are handled the same way as NetworkPolicy
+func buildGlobalNetworkPolicyInfo(globalNetworkPolicy *globalApi.GlobalNetworkPolicy) *GlobalNetworkPolicyInfo{
+
+	if globalNetworkPolicy == nil{
+		return nil
+	}
+
+	// policyTypes of NetworkPolicy are defaulted by apiserver, but a custom resource is not
+	// a policy with only explicit rules does not isolate the selected pods
+	spec := globalNetworkPolicy.Spec
+	policyTypes := spec.PolicyTypes
+	if len(policyTypes) == 0{
+		if len(spec.Rules) == 0 || len(spec.Ingress) > 0{
+			policyTypes = append(policyTypes, policyApi.PolicyTypeIngress)
+		}
+		if len(spec.Egress) > 0{
+			policyTypes = append(policyTypes, policyApi.PolicyTypeEgress)
+		}
+	}
+	networkPolicy := &policyApi.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        GlobalNetworkPolicyPrefix + globalNetworkPolicy.Name,
+			UID:         globalNetworkPolicy.UID,
+			Annotations: globalNetworkPolicy.Annotations,
+		},
+		Spec: policyApi.NetworkPolicySpec{
+			PodSelector: globalNetworkPolicy.Spec.PodSelector,
+			Ingress:     globalNetworkPolicy.Spec.Ingress,
+			Egress:      globalNetworkPolicy.Spec.Egress,
+			PolicyTypes: policyTypes,
+		},
+	}
+	policy := buildNetworkPolicyInfo(networkPolicy)
+	// global policies always protect pods
+	policy.HostEndpoint = false
+	policy.ExplicitRules = buildExplicitRules(globalNetworkPolicy)
+
+	info := &GlobalNetworkPolicyInfo{
+		Name:              globalNetworkPolicy.Name,
+		UID:               globalNetworkPolicy.UID,
+		NamespaceSelector: globalNetworkPolicy.Spec.NamespaceSelector.MatchLabels,
+		Policy:            policy,
+	}
+	if len(globalNetworkPolicy.Spec.NamespaceSelector.MatchExpressions) > 0{
+		glog.Warningf("globalNetworkPolicy %s uses spec.namespaceSelector.matchExpressions which is not supported, so it selects no namespace",
+			globalNetworkPolicy.Name)
+		info.MatchNone = true
+	}
+	return info
+}
+
+// buildExplicitRules builds spec.rules of globalNetworkPolicy, a rule is skipped if it is invalid,
+// or if it has peers or ports but none of them is supported, so it never matches more traffic than specified
+func buildExplicitRules(globalNetworkPolicy *globalApi.GlobalNetworkPolicy) []ExplicitRule{
+
+	var rules []ExplicitRule
+	for i, specRule := range globalNetworkPolicy.Spec.Rules{
+
+		rule := ExplicitRule{
+			Action:    string(specRule.Action),
+			Priority:  DefaultExplicitRulePriority,
+		}
+		if specRule.Priority != nil{
+			rule.Priority = *specRule.Priority
+		}
+		if rule.Action != ExplicitRuleActionAllow && rule.Action != ExplicitRuleActionDeny{
+			glog.Warningf("globalNetworkPolicy %s spec.rules[%d] has invalid action %q, expected %s or %s, skip it",
+				globalNetworkPolicy.Name, i, specRule.Action, ExplicitRuleActionAllow, ExplicitRuleActionDeny)
+			continue
+		}
+		switch specRule.Direction{
+		case policyApi.PolicyTypeIngress:
+			rule.Direction = TypeIngress
+		case policyApi.PolicyTypeEgress:
+			rule.Direction = TypeEgress
+		default:
+			glog.Warningf("globalNetworkPolicy %s spec.rules[%d] has invalid direction %q, expected %s or %s, skip it",
+				globalNetworkPolicy.Name, i, specRule.Direction, policyApi.PolicyTypeIngress, policyApi.PolicyTypeEgress)
+			continue
+		}
+
+		for _, specPort := range specRule.Ports{
+			if reason := unsupportedPort(specPort); reason != ""{
+				glog.Warningf("globalNetworkPolicy %s spec.rules[%d] has unsupported port: %s", globalNetworkPolicy.Name, i, reason)
+				continue
+			}
+			protocol := string(coreApi.ProtocolTCP)
+			if specPort.Protocol != nil{
+				protocol = string(*specPort.Protocol)
+			}
+			rule.Ports = append(rule.Ports, PolicyPort{
+				Port:      specPort.Port.String(),
+				Protocol:  protocol,
+			})
+		}
+
+		for _, specPeer := range specRule.Peers{
+			if specPeer.IPBlock == nil || specPeer.PodSelector != nil || specPeer.NamespaceSelector != nil{
+				glog.Warningf("globalNetworkPolicy %s spec.rules[%d] has unsupported peer, only ipBlock is supported", globalNetworkPolicy.Name, i)
+				continue
+			}
+			cidrRange := CIDRRange{
+				CIDR:        specPeer.IPBlock.CIDR,
+				ExceptCIDR:  make([]string, 0),
+			}
+			cidrRange.ExceptCIDR = append(cidrRange.ExceptCIDR, specPeer.IPBlock.Except...)
+			rule.IPBlock = append(rule.IPBlock, cidrRange)
+		}
+
+		if !ruleSupported(len(specRule.Peers), len(rule.IPBlock), len(specRule.Ports), len(rule.Ports)){
+			glog.Warningf("globalNetworkPolicy %s spec.rules[%d] has no supported peer or port, skip it", globalNetworkPolicy.Name, i)
+			continue
+		}
+		rules = append(rules, rule)
+	}
+	return rules
+}
@@ -0,0 +1,148 @@
+package util
+
+import (
+	globalApi "enn-policy/pkg/apis/networking/v1alpha1"
+	policyApi "k8s.io/api/networking/v1"
+	coreApi "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	"reflect"
+	"testing"
+)
+
+func TestBuildGlobalNetworkPolicyInfo(t *testing.T){
+
+	globalNetworkPolicy := &globalApi.GlobalNetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "deny-metadata",
+			Annotations: map[string]string{HostEndpointAnnotation: "true"},
+		},
+		Spec: globalApi.GlobalNetworkPolicySpec{
+			NamespaceSelector: metav1.LabelSelector{MatchLabels: map[string]string{"tenant": "true"}},
+			PodSelector:       metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}},
+			Egress: []policyApi.NetworkPolicyEgressRule{
+				{
+					To: []policyApi.NetworkPolicyPeer{{IPBlock: &policyApi.IPBlock{CIDR: "0.0.0.0/0", Except: []string{"169.254.169.254/32"}}}},
+				},
+			},
+		},
+	}
+	info := buildGlobalNetworkPolicyInfo(globalNetworkPolicy)
+	if info.Name != "deny-metadata" || info.Policy.Name != "global:deny-metadata" || info.Policy.Namespace != ""{
+		t.Errorf("unexpected names %s %s/%s", info.Name, info.Policy.Namespace, info.Policy.Name)
+	}
+	// policyTypes are defaulted like NetworkPolicy
+	if !reflect.DeepEqual(info.Policy.PolicyType, []string{TypeIngress, TypeEgress}){
+		t.Errorf("expected policy types [ingress egress], get %v", info.Policy.PolicyType)
+	}
+	if info.Policy.HostEndpoint{
+		t.Errorf("expected global policy not to be a host endpoint policy")
+	}
+	if len(info.Policy.Egress) != 1 || !reflect.DeepEqual(info.Policy.Egress[0].IPBlock[0].ExceptCIDR, []string{"169.254.169.254/32"}){
+		t.Errorf("unexpected egress rules %+v", info.Policy.Egress)
+	}
+
+	if !info.SelectsNamespace(&NamespaceInfo{Name: "a", Labels: map[string]string{"tenant": "true", "team": "a"}}){
+		t.Errorf("expected namespace with label tenant=true to be selected")
+	}
+	if info.SelectsNamespace(&NamespaceInfo{Name: "kube-system"}) || info.SelectsNamespace(nil){
+		t.Errorf("expected namespace without label tenant=true not to be selected")
+	}
+	policy := info.ForNamespace("a")
+	if policy.Namespace != "a" || info.Policy.Namespace != ""{
+		t.Errorf("expected policy in namespace a without changing the global policy, get %s and %s", policy.Namespace, info.Policy.Namespace)
+	}
+
+	// empty namespaceSelector selects all namespaces, matchExpressions selects none
+	globalNetworkPolicy.Spec.NamespaceSelector = metav1.LabelSelector{}
+	if info := buildGlobalNetworkPolicyInfo(globalNetworkPolicy); !info.SelectsNamespace(&NamespaceInfo{Name: "kube-system"}){
+		t.Errorf("expected empty namespaceSelector to select all namespaces")
+	}
+	globalNetworkPolicy.Spec.NamespaceSelector = metav1.LabelSelector{
+		MatchExpressions: []metav1.LabelSelectorRequirement{{Key: "tenant", Operator: metav1.LabelSelectorOpExists}},
+	}
+	if info := buildGlobalNetworkPolicyInfo(globalNetworkPolicy); info.SelectsNamespace(&NamespaceInfo{Name: "a", Labels: map[string]string{"tenant": "true"}}){
+		t.Errorf("expected namespaceSelector with matchExpressions to select no namespace")
+	}
+}
+
+func TestBuildExplicitRules(t *testing.T){
+
+	priority := int32(100)
+	udp := coreApi.ProtocolUDP
+	port := intstr.FromInt(53)
+	namedPort := intstr.FromString("dns")
+	globalNetworkPolicy := &globalApi.GlobalNetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "block-bad-cidr"},
+		Spec: globalApi.GlobalNetworkPolicySpec{
+			Rules: []globalApi.ExplicitRule{
+				{
+					Action:    globalApi.ExplicitRuleActionDeny,
+					Priority:  &priority,
+					Direction: policyApi.PolicyTypeEgress,
+					Peers:     []policyApi.NetworkPolicyPeer{{IPBlock: &policyApi.IPBlock{CIDR: "203.0.113.0/24", Except: []string{"203.0.113.1/32"}}}},
+					Ports:     []policyApi.NetworkPolicyPort{{Protocol: &udp, Port: &port}},
+				},
+				{Action: globalApi.ExplicitRuleActionAllow, Direction: policyApi.PolicyTypeIngress},
+				// invalid action and direction
+				{Action: "Log", Direction: policyApi.PolicyTypeIngress},
+				{Action: globalApi.ExplicitRuleActionDeny, Direction: "Both"},
+				// a rule without supported peer or port would match more traffic than specified
+				{
+					Action:    globalApi.ExplicitRuleActionAllow,
+					Direction: policyApi.PolicyTypeIngress,
+					Peers:     []policyApi.NetworkPolicyPeer{{PodSelector: &metav1.LabelSelector{}}},
+				},
+				{
+					Action:    globalApi.ExplicitRuleActionAllow,
+					Direction: policyApi.PolicyTypeIngress,
+					Ports:     []policyApi.NetworkPolicyPort{{Port: &namedPort}},
+				},
+			},
+		},
+	}
+
+	expected := []ExplicitRule{
+		{
+			Action:    ExplicitRuleActionDeny,
+			Priority:  100,
+			Direction: TypeEgress,
+			Ports:     []PolicyPort{{Protocol: "UDP", Port: "53"}},
+			IPBlock:   []CIDRRange{{CIDR: "203.0.113.0/24", ExceptCIDR: []string{"203.0.113.1/32"}}},
+		},
+		{Action: ExplicitRuleActionAllow, Priority: DefaultExplicitRulePriority, Direction: TypeIngress},
+	}
+	info := buildGlobalNetworkPolicyInfo(globalNetworkPolicy)
+	if !reflect.DeepEqual(info.Policy.ExplicitRules, expected){
+		t.Errorf("expected explicit rules %+v, get %+v", expected, info.Policy.ExplicitRules)
+	}
+	// a policy with only explicit rules does not isolate pods
+	if len(info.Policy.PolicyType) != 0{
+		t.Errorf("expected no policy type, get %v", info.Policy.PolicyType)
+	}
+}
+
+func TestUpdateGlobalNetworkPolicyMap(t *testing.T){
+
+	globalNetworkPolicyMap := make(GlobalNetworkPolicyMap)
+	changes := NewGlobalNetworkPolicyChangeMap()
+	allowDNS := &globalApi.GlobalNetworkPolicy{ObjectMeta: metav1.ObjectMeta{Name: "allow-dns"}}
+
+	if !changes.Update("allow-dns", nil, allowDNS){
+		t.Errorf("expected change of new global policy")
+	}
+	UpdateGlobalNetworkPolicyMap(globalNetworkPolicyMap, &changes)
+	if _, ok := globalNetworkPolicyMap["allow-dns"]; !ok || len(changes.Items) != 0{
+		t.Errorf("expected global policy allow-dns in map and no change left, get %v %v", globalNetworkPolicyMap, changes.Items)
+	}
+	if changes.Update("allow-dns", allowDNS, allowDNS.DeepCopy()){
+		t.Errorf("expected no change of the same global policy")
+	}
+	changes.Update("allow-dns", allowDNS, nil)
+	UpdateGlobalNetworkPolicyMap(globalNetworkPolicyMap, &changes)
+	if len(globalNetworkPolicyMap) != 0{
+		t.Errorf("expected global policy to be deleted, get %v", globalNetworkPolicyMap)
+	}
+}
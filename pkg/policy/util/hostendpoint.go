@@ -0,0 +1,41 @@
+package util
+
+import (
+	"k8s.io/apimachinery/pkg/labels"
+
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// HostEndpointAnnotation marks a NetworkPolicy in the host endpoint namespace as a policy for nodes,
+// spec.podSelector of such policy selects nodes by node labels, and ingress/egress rules protect the node itself
+const HostEndpointAnnotation = "enn-policy/host-endpoint"
+
+// ParseProtocolPorts parses failsafe ports like "tcp:22" or "udp:53"
+func ParseProtocolPorts(protocolPorts []string) ([]PolicyPort, error){
+
+	var ports []PolicyPort
+	for _, protocolPort := range protocolPorts{
+		strs := strings.Split(protocolPort, ":")
+		if len(strs) != 2{
+			return nil, fmt.Errorf("invalid port %q, expected format is protocol:port, e.g tcp:22", protocolPort)
+		}
+		protocol := strings.ToUpper(strs[0])
+		if protocol != "TCP" && protocol != "UDP" && protocol != "SCTP"{
+			return nil, fmt.Errorf("invalid port %q, protocol must be tcp, udp or sctp", protocolPort)
+		}
+		port, err := strconv.Atoi(strs[1])
+		if err != nil || port < 1 || port > 65535{
+			return nil, fmt.Errorf("invalid port %q, port must be between 1 and 65535", protocolPort)
+		}
+		ports = append(ports, PolicyPort{Protocol: protocol, Port: strs[1]})
+	}
+	return ports, nil
+}
+
+// HostEndpointSelectsNode returns true if spec.podSelector of a host endpoint policy matches node labels,
+// empty podSelector selects all nodes
+func HostEndpointSelectsNode(networkPolicy *NetworkPolicyInfo, nodeLabels map[string]string) bool{
+	return labels.SelectorFromSet(labels.Set(networkPolicy.PodSelector)).Matches(labels.Set(nodeLabels))
+}
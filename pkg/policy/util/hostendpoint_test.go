@@ -0,0 +1,54 @@
+package util
+
+import (
+	api "k8s.io/api/networking/v1"
+
+	"reflect"
+	"testing"
+)
+
+func TestParseProtocolPorts(t *testing.T){
+
+	ports, err := ParseProtocolPorts([]string{"tcp:22", "UDP:53"})
+	if err != nil{
+		t.Fatalf("parse ports error %v", err)
+	}
+	expected := []PolicyPort{{Protocol: "TCP", Port: "22"}, {Protocol: "UDP", Port: "53"}}
+	if !reflect.DeepEqual(ports, expected){
+		t.Errorf("expected ports %v, get %v", expected, ports)
+	}
+
+	for _, invalid := range []string{"22", "icmp:22", "tcp:0", "tcp:65536", "tcp:ssh", "tcp:22:23"}{
+		if _, err := ParseProtocolPorts([]string{invalid}); err == nil{
+			t.Errorf("expected error for port %q", invalid)
+		}
+	}
+}
+
+func TestHostEndpointSelectsNode(t *testing.T){
+
+	networkPolicy := makeTestNetworkPolicy("host-endpoint", "ssh", func(np *api.NetworkPolicy){
+		np.Annotations = map[string]string{HostEndpointAnnotation: "true"}
+		np.Spec.PodSelector.MatchLabels = map[string]string{"role": "worker"}
+	})
+	info := buildNetworkPolicyInfo(networkPolicy)
+	if !info.HostEndpoint{
+		t.Errorf("expected host endpoint policy for annotation %s", HostEndpointAnnotation)
+	}
+	if !HostEndpointSelectsNode(info, map[string]string{"role": "worker", "zone": "a"}){
+		t.Errorf("expected policy to select node with label role=worker")
+	}
+	if HostEndpointSelectsNode(info, map[string]string{"role": "master"}){
+		t.Errorf("expected policy not to select node with label role=master")
+	}
+
+	info.PodSelector = nil
+	if !HostEndpointSelectsNode(info, nil){
+		t.Errorf("expected empty podSelector to select all nodes")
+	}
+
+	networkPolicy.Annotations[HostEndpointAnnotation] = "false"
+	if buildNetworkPolicyInfo(networkPolicy).HostEndpoint{
+		t.Errorf("expected normal policy when annotation is false")
+	}
+}
@@ -0,0 +1,60 @@
+package util
+
+import (
+	"net"
+	"sort"
+	"strings"
+)
+
+const DefaultIPRange = "0.0.0.0/0"
+
+// ipset hash:net cannot store 0.0.0.0/0, so the whole ipv4 space is stored as two halves
+var defaultIPRangeHalves = []string{"0.0.0.0/1", "128.0.0.0/1"}
+
+// ContainsDefaultIPRange returns true if 0.0.0.0/0 is one of ipRanges
+func ContainsDefaultIPRange(ipRanges []string) bool{
+	for _, ipRange := range ipRanges{
+		if ipRange == DefaultIPRange{
+			return true
+		}
+	}
+	return false
+}
+
+// IPRangeSetEntries returns the sorted hash:net entries which represent ipRanges
+// duplicated ranges are removed, and 0.0.0.0/0 replaces all other ranges by its two halves
+func IPRangeSetEntries(ipRanges []string) []string{
+	if ContainsDefaultIPRange(ipRanges){
+		return append([]string{}, defaultIPRangeHalves...)
+	}
+
+	entryMap := make(map[string]bool)
+	for _, ipRange := range ipRanges{
+		_, ipNet, err := net.ParseCIDR(ipRange)
+		if err != nil{
+			continue
+		}
+		entryMap[ipNet.String()] = true
+	}
+	entries := make([]string, 0, len(entryMap))
+	for entry := range entryMap{
+		entries = append(entries, entry)
+	}
+	sort.Strings(entries)
+	return entries
+}
+
+// IPRangeKey identifies a group of included and excluded ip ranges,
+// it is used to build ipset and chain names, a single included range keeps the range itself as key
+// so names are the same as enn-policy with one --ip-range
+func IPRangeKey(ipRanges []string, excludeIPRanges []string) string{
+	includes := append([]string{}, ipRanges...)
+	sort.Strings(includes)
+	key := strings.Join(includes, ",")
+	if len(excludeIPRanges) > 0{
+		excludes := append([]string{}, excludeIPRanges...)
+		sort.Strings(excludes)
+		key += "!" + strings.Join(excludes, ",")
+	}
+	return key
+}
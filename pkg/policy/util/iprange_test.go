@@ -0,0 +1,54 @@
+package util
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestIPRangeSetEntries(t *testing.T){
+	testCases := []struct {
+		name     string
+		ipRanges []string
+		expected []string
+	}{
+		{
+			name:     "single range",
+			ipRanges: []string{"10.244.0.0/16"},
+			expected: []string{"10.244.0.0/16"},
+		},
+		{
+			name:     "several ranges with duplication",
+			ipRanges: []string{"192.168.10.0/24", "10.244.0.0/16", "192.168.10.0/24"},
+			expected: []string{"10.244.0.0/16", "192.168.10.0/24"},
+		},
+		{
+			name:     "default range only",
+			ipRanges: []string{"0.0.0.0/0"},
+			expected: []string{"0.0.0.0/1", "128.0.0.0/1"},
+		},
+		{
+			name:     "default range with specific ranges",
+			ipRanges: []string{"10.244.0.0/16", "0.0.0.0/0"},
+			expected: []string{"0.0.0.0/1", "128.0.0.0/1"},
+		},
+	}
+
+	for _, tc := range testCases{
+		entries := IPRangeSetEntries(tc.ipRanges)
+		if !reflect.DeepEqual(entries, tc.expected){
+			t.Errorf("case %s: expected entries %v, get %v", tc.name, tc.expected, entries)
+		}
+	}
+}
+
+func TestIPRangeKey(t *testing.T){
+	if key := IPRangeKey([]string{"10.244.0.0/16"}, nil); key != "10.244.0.0/16"{
+		t.Errorf("single range should keep the range as key, get %s", key)
+	}
+	if IPRangeKey([]string{"10.244.0.0/16", "192.168.0.0/16"}, nil) != IPRangeKey([]string{"192.168.0.0/16", "10.244.0.0/16"}, nil){
+		t.Errorf("key should not depend on the order of ranges")
+	}
+	if IPRangeKey([]string{"10.244.0.0/16"}, []string{"10.244.1.0/24"}) == IPRangeKey([]string{"10.244.0.0/16"}, nil){
+		t.Errorf("key should change when excluded ranges are set")
+	}
+}
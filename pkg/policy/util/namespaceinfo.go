@@ -19,6 +19,14 @@ type NamespaceInfo struct {
 
 	Name     string
 	Labels   map[string]string
+	// TerminatingPods is the value of annotation enn-policy/terminating-pods, empty means the default of enn-policy
+	TerminatingPods string
+	// DenyAction is the value of annotation enn-policy/deny-action, empty means the default of enn-policy
+	DenyAction      string
+	// PolicyMode is the value of annotation enn-policy/policy-mode, empty means the default of enn-policy
+	PolicyMode      string
+	// DefaultDeny is the policy types isolated by annotation net.beta.kubernetes.io/network-policy, see DefaultDenyPolicy
+	DefaultDeny     []string
 }
 
 type NamespaceChangeMap struct {
@@ -76,6 +84,10 @@ func buildNamespaceInfo(namespace *api.Namespace) *NamespaceInfo{
 	namespaceInfo := &NamespaceInfo{
 		Name:    namespace.Name,
 		Labels:  namespace.Labels,
+		TerminatingPods: namespace.Annotations[TerminatingPodsAnnotation],
+		DenyAction:      namespace.Annotations[DenyActionAnnotation],
+		PolicyMode:      namespace.Annotations[PolicyModeAnnotation],
+		DefaultDeny:     buildNamespaceDefaultDeny(namespace.Name, namespace.Annotations),
 	}
 	return namespaceInfo
 }
@@ -118,7 +130,7 @@ func (nmlm *NamespaceMatchLabelMap) merge(namespacePodMap NamespacePodMap, other
 			tmpInfoMap := make(PodInfoMap)
 			for ip, podInfo := range infoMap{
 				glog.V(4).Infof("add pod %s to new pod set", ip)
-				tmpInfoMap[ip] = podInfo
+				tmpInfoMap.addPod(ip, podInfo)
 			}
 			(*nmlm)[label] = tmpInfoMap
 		} else {
@@ -129,7 +141,7 @@ func (nmlm *NamespaceMatchLabelMap) merge(namespacePodMap NamespacePodMap, other
 			)
 			for ip, podInfo := range infoMap{
 				glog.V(4).Infof("add pod %s to exists pod set", ip)
-				oldInfoMap[ip] = podInfo
+				oldInfoMap.addPod(ip, podInfo)
 			}
 			(*nmlm)[label] = oldInfoMap
 		}
@@ -171,9 +183,9 @@ func (nmlm *NamespaceMatchLabelMap) unmerge(namespacePodMap NamespacePodMap, oth
 				label.LabelKey,
 				label.LabelValue,
 			)
-			for ip, _ := range infoMap {
+			for ip, podInfo := range infoMap {
 				glog.V(4).Infof("del pod %s to exists pod set", ip)
-				delete(oldInfoMap, ip)
+				oldInfoMap.removePod(ip, podInfo)
 			}
 			(*nmlm)[label] = oldInfoMap
 		}
@@ -206,7 +218,7 @@ func (nmlm *NamespaceMatchLabelMap) mergePodInfoMap(podInfoMap PodInfoMap, other
 			tmpInfoMap := make(PodInfoMap)
 			for ip, podInfo := range podInfoMap{
 				glog.V(4).Infof("add pod %s to new pod set", ip)
-				tmpInfoMap[ip] = podInfo
+				tmpInfoMap.addPod(ip, podInfo)
 			}
 			(*nmlm)[label] = tmpInfoMap
 		} else {
@@ -218,7 +230,7 @@ func (nmlm *NamespaceMatchLabelMap) mergePodInfoMap(podInfoMap PodInfoMap, other
 
 			for ip, podInfo := range podInfoMap{
 				glog.V(4).Infof("add pod %s to exists pod set", ip)
-				oldInfoMap[ip] = podInfo
+				oldInfoMap.addPod(ip, podInfo)
 			}
 			(*nmlm)[label] = oldInfoMap
 		}
@@ -253,9 +265,9 @@ func (nmlm *NamespaceMatchLabelMap) unmergePodInfoMap(podInfoMap PodInfoMap, oth
 				label.LabelKey,
 				label.LabelValue,
 			)
-			for ip, _ := range podInfoMap {
+			for ip, podInfo := range podInfoMap {
 				glog.V(4).Infof("del pod %s to exists pod set", ip)
-				delete(oldInfoMap, ip)
+				oldInfoMap.removePod(ip, podInfo)
 			}
 			(*nmlm)[label] = oldInfoMap
 		}
@@ -0,0 +1,231 @@
+package util
+
+import (
+	api "k8s.io/api/core/v1"
+	"github.com/golang/glog"
+
+	"sync"
+	"reflect"
+	"net"
+	"sort"
+)
+
+// NodeInfoMap stores NodeInfo of all nodes, key is node name
+type NodeInfoMap map[string]*NodeInfo
+
+// NodeInfo will collect useful information from Node spec and status
+type NodeInfo struct {
+
+	Name         string
+	Labels       map[string]string
+	PodCIDR      string
+	InternalIPs  []string
+	ExternalIPs  []string
+}
+
+type NodeChangeMap struct {
+	Lock   sync.Mutex
+	Items  map[string]*NodeChange
+}
+
+type NodeChange struct {
+	Previous *NodeInfo
+	Current  *NodeInfo
+}
+
+func NewNodeChangeMap() NodeChangeMap {
+	return NodeChangeMap{
+		Items:   make(map[string]*NodeChange),
+	}
+}
+
+func (ncm *NodeChangeMap) CleanUpItem(){
+	ncm.Items = make(map[string]*NodeChange)
+}
+
+func (ncm *NodeChangeMap) Update(nodeName string, previous, current *api.Node) bool{
+
+	glog.V(3).Infof("UpdateNodeChangeMap start")
+
+	ncm.Lock.Lock()
+	defer ncm.Lock.Unlock()
+
+	change, exists := ncm.Items[nodeName]
+	if !exists{
+		change = &NodeChange{}
+		change.Previous = buildNodeInfo(previous)
+		ncm.Items[nodeName] = change
+	}
+	change.Current = buildNodeInfo(current)
+	if reflect.DeepEqual(change.Previous, change.Current) {
+		delete(ncm.Items, nodeName)
+	}
+
+	glog.V(6).Infof("NodeChangeMap changed item number is %d", len(ncm.Items))
+	return len(ncm.Items) > 0
+}
+
+func (ncm *NodeChangeMap) Changed() bool{
+	return len(ncm.Items) > 0
+}
+
+func buildNodeInfo(node *api.Node) *NodeInfo{
+
+	if node == nil{
+		return nil
+	}
+
+	nodeInfo := &NodeInfo{
+		Name:     node.Name,
+		Labels:   node.Labels,
+		PodCIDR:  node.Spec.PodCIDR,
+	}
+	for _, address := range node.Status.Addresses{
+		switch address.Type {
+		case api.NodeInternalIP:
+			nodeInfo.InternalIPs = append(nodeInfo.InternalIPs, address.Address)
+		case api.NodeExternalIP:
+			nodeInfo.ExternalIPs = append(nodeInfo.ExternalIPs, address.Address)
+		}
+	}
+	return nodeInfo
+}
+
+// HostIP returns the first InternalIP of node, or the first ExternalIP if there is no InternalIP,
+// it is the same as InternalGetNodeHostIP
+func (info *NodeInfo) HostIP() net.IP{
+	if len(info.InternalIPs) > 0{
+		return net.ParseIP(info.InternalIPs[0])
+	}
+	if len(info.ExternalIPs) > 0{
+		return net.ParseIP(info.ExternalIPs[0])
+	}
+	return nil
+}
+
+func UpdateNodeInfoMap(nodeInfoMap NodeInfoMap, changes *NodeChangeMap) {
+
+	for _, change := range changes.Items {
+		nodeInfoMap.unmerge(change.Previous)
+		nodeInfoMap.merge(change.Current)
+	}
+}
+
+func (nim *NodeInfoMap) merge(other *NodeInfo){
+	if other == nil{
+		return
+	}
+	(*nim)[other.Name] = other
+}
+
+func (nim *NodeInfoMap) unmerge(other *NodeInfo){
+	if other == nil{
+		return
+	}
+	delete(*nim, other.Name)
+}
+
+// NodeGatewayIPs returns the addresses which a bridge based cni uses on each node, e.g
+// node podCIDR 10.244.1.0/24 gives the network address 10.244.1.0 (flannel.1) and the first address 10.244.1.1 (cni0/docker0)
+// node InternalIPs are also returned since host traffic may use them as source address
+// the result is sorted and has no duplication
+func NodeGatewayIPs(nodeInfoMap NodeInfoMap) []string{
+
+	ipMap := make(map[string]bool)
+	for _, nodeInfo := range nodeInfoMap{
+		if nodeInfo.PodCIDR != ""{
+			gatewayIPs, err := PodCIDRGatewayIPs(nodeInfo.PodCIDR)
+			if err != nil{
+				glog.Errorf("node %s has invalid podCIDR %s: %v", nodeInfo.Name, nodeInfo.PodCIDR, err)
+			}
+			for _, ip := range gatewayIPs{
+				ipMap[ip] = true
+			}
+		}
+		for _, ip := range nodeInfo.InternalIPs{
+			if net.ParseIP(ip).To4() == nil{
+				glog.V(4).Infof("skip non ipv4 internal ip %s of node %s", ip, nodeInfo.Name)
+				continue
+			}
+			ipMap[ip] = true
+		}
+	}
+
+	ips := make([]string, 0, len(ipMap))
+	for ip := range ipMap{
+		ips = append(ips, ip)
+	}
+	sort.Strings(ips)
+	return ips
+}
+
+// LocalNodeIPs returns the addresses which traffic from this node itself uses, e.g
+// kubelet health probes use node ip 192.168.1.10 or bridge gateway 10.244.1.1 of node podCIDR 10.244.1.0/24
+// nil nodeIP or empty podCIDR is skipped
+func LocalNodeIPs(nodeIP net.IP, podCIDR string) []string{
+
+	var ips []string
+	if nodeIP != nil && nodeIP.To4() != nil{
+		ips = append(ips, nodeIP.String())
+	}
+	if podCIDR != ""{
+		gatewayIPs, err := PodCIDRGatewayIPs(podCIDR)
+		if err != nil{
+			glog.Errorf("local node has invalid podCIDR %s: %v", podCIDR, err)
+		} else {
+			ips = append(ips, gatewayIPs[1])
+		}
+	}
+	return ips
+}
+
+// NodeNetEntries returns the hash:net entries of all nodes in cluster, e.g
+// node addresses 192.168.1.10 (InternalIP) and 10.19.138.91 (ExternalIP), and node podCIDR 10.244.1.0/24
+// node address is returned without /32 since kernel lists such entry of hash:net as a single ip
+// the result is sorted and has no duplication
+func NodeNetEntries(nodeInfoMap NodeInfoMap) []string{
+
+	entryMap := make(map[string]bool)
+	for _, nodeInfo := range nodeInfoMap{
+		if nodeInfo.PodCIDR != ""{
+			_, ipNet, err := net.ParseCIDR(nodeInfo.PodCIDR)
+			if err != nil || ipNet.IP.To4() == nil{
+				glog.Errorf("node %s has invalid podCIDR %s", nodeInfo.Name, nodeInfo.PodCIDR)
+			} else {
+				entryMap[ipNet.String()] = true
+			}
+		}
+		addresses := append(append([]string{}, nodeInfo.InternalIPs...), nodeInfo.ExternalIPs...)
+		for _, address := range addresses{
+			ip := net.ParseIP(address)
+			if ip == nil || ip.To4() == nil{
+				glog.V(4).Infof("skip non ipv4 address %s of node %s", address, nodeInfo.Name)
+				continue
+			}
+			entryMap[ip.String()] = true
+		}
+	}
+
+	entries := make([]string, 0, len(entryMap))
+	for entry := range entryMap{
+		entries = append(entries, entry)
+	}
+	sort.Strings(entries)
+	return entries
+}
+
+// PodCIDRGatewayIPs returns the network address and the first address of podCIDR
+func PodCIDRGatewayIPs(podCIDR string) ([]string, error){
+	_, ipNet, err := net.ParseCIDR(podCIDR)
+	if err != nil{
+		return nil, err
+	}
+	network := ipNet.IP.To4()
+	if network == nil{
+		return nil, &net.ParseError{Type: "ipv4 CIDR address", Text: podCIDR}
+	}
+	first := make(net.IP, len(network))
+	copy(first, network)
+	first[3]++
+	return []string{network.String(), first.String()}, nil
+}
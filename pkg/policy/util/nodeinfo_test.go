@@ -0,0 +1,130 @@
+package util
+
+import (
+	api "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"net"
+	"reflect"
+	"testing"
+)
+
+func makeTestNode(name, podCIDR string, internalIPs ...string) *api.Node{
+	node := &api.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+		},
+		Spec: api.NodeSpec{
+			PodCIDR: podCIDR,
+		},
+	}
+	for _, ip := range internalIPs{
+		node.Status.Addresses = append(node.Status.Addresses, api.NodeAddress{Type: api.NodeInternalIP, Address: ip})
+	}
+	node.Status.Addresses = append(node.Status.Addresses, api.NodeAddress{Type: api.NodeHostName, Address: name})
+	return node
+}
+
+func TestNodeInfoMapUpdate(t *testing.T){
+
+	nodeChanges := NewNodeChangeMap()
+	nodeInfoMap := make(NodeInfoMap)
+
+	node1 := makeTestNode("node1", "10.244.1.0/24", "192.168.1.10")
+	node2 := makeTestNode("node2", "10.244.2.0/23", "192.168.1.11")
+
+	nodeChanges.Update(node1.Name, nil, node1)
+	nodeChanges.Update(node2.Name, nil, node2)
+	UpdateNodeInfoMap(nodeInfoMap, &nodeChanges)
+	nodeChanges.CleanUpItem()
+
+	expected := []string{"10.244.1.0", "10.244.1.1", "10.244.2.0", "10.244.2.1", "192.168.1.10", "192.168.1.11"}
+	if ips := NodeGatewayIPs(nodeInfoMap); !reflect.DeepEqual(ips, expected){
+		t.Errorf("expected node gateway ips %v, get %v", expected, ips)
+	}
+
+	// update node2 podCIDR and delete node1
+	node2Updated := makeTestNode("node2", "10.244.4.0/22", "192.168.1.11")
+	nodeChanges.Update(node2.Name, node2, node2Updated)
+	nodeChanges.Update(node1.Name, node1, nil)
+	UpdateNodeInfoMap(nodeInfoMap, &nodeChanges)
+	nodeChanges.CleanUpItem()
+
+	expected = []string{"10.244.4.0", "10.244.4.1", "192.168.1.11"}
+	if ips := NodeGatewayIPs(nodeInfoMap); !reflect.DeepEqual(ips, expected){
+		t.Errorf("expected node gateway ips %v, get %v", expected, ips)
+	}
+}
+
+func TestNodeChangeMapIgnoreSameNode(t *testing.T){
+
+	nodeChanges := NewNodeChangeMap()
+	node1 := makeTestNode("node1", "10.244.1.0/24", "192.168.1.10")
+	node1Copy := makeTestNode("node1", "10.244.1.0/24", "192.168.1.10")
+	node1Copy.Annotations = map[string]string{"foo": "bar"}
+
+	if nodeChanges.Update(node1.Name, node1, node1Copy){
+		t.Errorf("node change should be ignored when labels, podCIDR and addresses are not changed")
+	}
+
+	node1Copy.Labels = map[string]string{"role": "worker"}
+	if !nodeChanges.Update(node1.Name, node1, node1Copy){
+		t.Errorf("node change should not be ignored when labels are changed")
+	}
+}
+
+func TestNodeGatewayIPsWithoutPodCIDR(t *testing.T){
+
+	nodeInfoMap := NodeInfoMap{
+		"node1": buildNodeInfo(makeTestNode("node1", "", "192.168.1.10", "fd00::10")),
+		"node2": buildNodeInfo(makeTestNode("node2", "invalid", "192.168.1.11")),
+	}
+	expected := []string{"192.168.1.10", "192.168.1.11"}
+	if ips := NodeGatewayIPs(nodeInfoMap); !reflect.DeepEqual(ips, expected){
+		t.Errorf("expected node gateway ips %v, get %v", expected, ips)
+	}
+}
+
+func TestLocalNodeIPs(t *testing.T){
+
+	testCases := []struct {
+		nodeIP   net.IP
+		podCIDR  string
+		expected []string
+	}{
+		{net.ParseIP("192.168.1.10"), "10.244.1.0/24", []string{"192.168.1.10", "10.244.1.1"}},
+		{nil, "10.244.1.0/24", []string{"10.244.1.1"}},
+		{net.ParseIP("192.168.1.10"), "", []string{"192.168.1.10"}},
+		{net.ParseIP("fd00::10"), "invalid", nil},
+	}
+	for _, tc := range testCases{
+		if ips := LocalNodeIPs(tc.nodeIP, tc.podCIDR); !reflect.DeepEqual(ips, tc.expected){
+			t.Errorf("nodeIP %v podCIDR %s: expected local node ips %v, get %v", tc.nodeIP, tc.podCIDR, tc.expected, ips)
+		}
+	}
+}
+
+func TestNodeNetEntries(t *testing.T){
+
+	node1 := makeTestNode("node1", "10.244.1.0/24", "192.168.1.10")
+	node1.Status.Addresses = append(node1.Status.Addresses, api.NodeAddress{Type: api.NodeExternalIP, Address: "10.19.138.91"})
+	node2 := makeTestNode("node2", "", "192.168.1.11", "fd00::11")
+	node3 := makeTestNode("node3", "invalid")
+
+	nodeInfoMap := NodeInfoMap{
+		"node1": buildNodeInfo(node1),
+		"node2": buildNodeInfo(node2),
+		"node3": buildNodeInfo(node3),
+	}
+	expected := []string{"10.19.138.91", "10.244.1.0/24", "192.168.1.10", "192.168.1.11"}
+	if entries := NodeNetEntries(nodeInfoMap); !reflect.DeepEqual(entries, expected){
+		t.Errorf("expected node net entries %v, get %v", expected, entries)
+	}
+
+	if ip := nodeInfoMap["node1"].HostIP(); !ip.Equal(net.ParseIP("192.168.1.10")){
+		t.Errorf("expected host ip 192.168.1.10, get %v", ip)
+	}
+	if ip := nodeInfoMap["node3"].HostIP(); ip != nil{
+		t.Errorf("expected nil host ip, get %v", ip)
+	}
+}
@@ -6,6 +6,8 @@ import (
 	"github.com/golang/glog"
 	"sync"
 	"reflect"
+	"sort"
+	"time"
 )
 
 type PodInfoMap map[string]*PodInfo
@@ -22,14 +24,130 @@ type NamespacePodMap map[string]PodInfoMap
 // PodInfo will collect useful information from Pod spec
 type PodInfo struct {
 
+	UID               types.UID
 	IP                string
 	Name              string
 	Namespace         string
 	Labels            map[string]string
+	// HostNetwork is true if IP is the node ip of a hostNetwork pod,
+	// such pod is only added to peer ipsets and never becomes the target of a policy
+	HostNetwork       bool
+	// PriorityClassName is spec.priorityClassName of pod, it is used by exemptions
+	PriorityClassName string
+	// Terminating is true if pod has deletionTimestamp, DeletionDeadline is the time the pod is killed
+	Terminating       bool
+	DeletionDeadline  time.Time
+
+	// owners stores all pods which own IP, key is pod uid (namespace/name if uid is empty)
+	// it is only set for podInfo stored in PodMatchLabelMap, NamespacePodMap and NamespaceMatchLabelMap,
+	// an ip can be owned by several pods for a while, e.g a deleted pod whose delete event is not handled yet
+	// and a new pod which reuses its ip, so the ip is only removed when the last owner is removed
+	owners            map[string]*PodInfo
+}
+
+func (info *PodInfo) ownerKey() string{
+	if info.UID != ""{
+		return string(info.UID)
+	}
+	return info.Namespace + "/" + info.Name
+}
+
+// pods returns the pods which podInfo stands for, podInfo built from a pod stands for itself
+func (info *PodInfo) pods() []*PodInfo{
+	if info.owners == nil{
+		return []*PodInfo{info}
+	}
+	result := make([]*PodInfo, 0, len(info.owners))
+	for _, owner := range info.owners{
+		result = append(result, owner)
+	}
+	return result
+}
+
+// Owners returns the number of pods which own the ip of podInfo
+func (info *PodInfo) Owners() int{
+	if info.owners == nil{
+		return 1
+	}
+	return len(info.owners)
+}
+
+func (info *PodInfo) setOwner(owner *PodInfo){
+	info.UID         = owner.UID
+	info.IP          = owner.IP
+	info.Name        = owner.Name
+	info.Namespace   = owner.Namespace
+	info.Labels      = owner.Labels
+	info.HostNetwork = owner.HostNetwork
+	info.Terminating = owner.Terminating
+	info.DeletionDeadline = owner.DeletionDeadline
+}
+
+// addPod adds all pods of podInfo as owners of ip, the latest pod gives name and labels of the entry
+// returns true if ip is new in the map
+func (pim PodInfoMap) addPod(ip string, podInfo *PodInfo) bool{
+
+	entry, has := pim[ip]
+	if !has{
+		entry = &PodInfo{}
+		pim[ip] = entry
+	}
+	if entry.owners == nil{
+		entry.owners = make(map[string]*PodInfo)
+		if has{
+			owner := &PodInfo{}
+			owner.setOwner(entry)
+			entry.owners[entry.ownerKey()] = owner
+		}
+	}
+	for _, pod := range podInfo.pods(){
+		entry.owners[pod.ownerKey()] = pod
+		entry.setOwner(pod)
+	}
+	return !has
+}
+
+// removePod removes all pods of podInfo from owners of ip, ip is deleted from the map when it has no owner
+// returns false if none of the pods owns ip
+func (pim PodInfoMap) removePod(ip string, podInfo *PodInfo) bool{
+
+	entry, has := pim[ip]
+	if !has{
+		return false
+	}
+	owners := entry.owners
+	if owners == nil{
+		owners = map[string]*PodInfo{entry.ownerKey(): entry}
+	}
+	found := false
+	for _, pod := range podInfo.pods(){
+		key := pod.ownerKey()
+		if _, ok := owners[key]; ok{
+			delete(owners, key)
+			found = true
+		}
+	}
+	if len(owners) == 0{
+		delete(pim, ip)
+		return found
+	}
+	if _, ok := owners[entry.ownerKey()]; !ok{
+		// the pod which gives name and labels of the entry is removed, so use another owner
+		keys := make([]string, 0, len(owners))
+		for key := range owners{
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		entry.setOwner(owners[keys[0]])
+		glog.V(4).Infof("ip %s is still owned by pod %s/%s", ip, entry.Namespace, entry.Name)
+	}
+	return found
 }
 
 type PodChangeMap struct {
 	Lock                sync.Mutex
+	// HostNetworkPeers adds hostNetwork pods with their node ip, otherwise hostNetwork pods are skipped
+	HostNetworkPeers    bool
 	PodItems            map[types.NamespacedName]*PodLabelChange
 	NamespacePodItems   map[types.NamespacedName]*NamespacePodChange
 	NamespaceLabelItems map[types.NamespacedName]*NamespacePodChange
@@ -71,10 +189,10 @@ func (pcm *PodChangeMap) Update(namespacedName *types.NamespacedName, previous,
 
 	if !exists{
 		podChange = &PodLabelChange{}
-		podChange.Previous = PodToPodMatchLabelMap(previous)
+		podChange.Previous = PodToPodMatchLabelMap(previous, pcm.HostNetworkPeers)
 		pcm.PodItems[*namespacedName] = podChange
 	}
-	podChange.Current = PodToPodMatchLabelMap(current)
+	podChange.Current = PodToPodMatchLabelMap(current, pcm.HostNetworkPeers)
 	if reflect.DeepEqual(podChange.Previous, podChange.Current) {
 		delete(pcm.PodItems, *namespacedName)
 	}
@@ -85,10 +203,10 @@ func (pcm *PodChangeMap) Update(namespacedName *types.NamespacedName, previous,
 
 	if !exists{
 		namespacePodChange = &NamespacePodChange{}
-		namespacePodChange.Previous = PodToNamespacePodMap(previous)
+		namespacePodChange.Previous = PodToNamespacePodMap(previous, pcm.HostNetworkPeers)
 		pcm.NamespacePodItems[*namespacedName] = namespacePodChange
 	}
-	namespacePodChange.Current = PodToNamespacePodMap(current)
+	namespacePodChange.Current = PodToNamespacePodMap(current, pcm.HostNetworkPeers)
 	if reflect.DeepEqual(namespacePodChange.Previous, namespacePodChange.Current){
 		delete(pcm.NamespacePodItems, *namespacedName)
 	}
@@ -98,10 +216,10 @@ func (pcm *PodChangeMap) Update(namespacedName *types.NamespacedName, previous,
 	namespaceLabelChange, exists := pcm.NamespaceLabelItems[*namespacedName]
 	if !exists{
 		namespaceLabelChange = &NamespacePodChange{}
-		namespaceLabelChange.Previous = PodToNamespacePodMap(previous)
+		namespaceLabelChange.Previous = PodToNamespacePodMap(previous, pcm.HostNetworkPeers)
 		pcm.NamespaceLabelItems[*namespacedName] = namespaceLabelChange
 	}
-	namespaceLabelChange.Current = PodToNamespacePodMap(current)
+	namespaceLabelChange.Current = PodToNamespacePodMap(current, pcm.HostNetworkPeers)
 	if reflect.DeepEqual(namespaceLabelChange.Previous, namespaceLabelChange.Current){
 		delete(pcm.NamespaceLabelItems, *namespacedName)
 	}
@@ -115,7 +233,9 @@ func (pcm *PodChangeMap) Changed() bool{
 	return len(pcm.PodItems) > 0 || len(pcm.NamespacePodItems) > 0 || len(pcm.NamespaceLabelItems) > 0
 }
 
-func PodToPodMatchLabelMap(pod *api.Pod) PodMatchLabelMap {
+// PodToPodMatchLabelMap builds the label map of a running pod,
+// hostNetwork pod is added with its node ip only if hostNetworkPeers is true
+func PodToPodMatchLabelMap(pod *api.Pod, hostNetworkPeers bool) PodMatchLabelMap {
 
 	if pod == nil{
 		return nil
@@ -143,7 +263,7 @@ func PodToPodMatchLabelMap(pod *api.Pod) PodMatchLabelMap {
 		return nil
 	}
 
-	if pod.Spec.HostNetwork{
+	if pod.Spec.HostNetwork && !hostNetworkPeers{
 		glog.V(6).Infof("skip build pod map because pod: %s/%s host network is true", pod.Namespace, pod.Name)
 		return nil
 	}
@@ -163,11 +283,15 @@ func PodToPodMatchLabelMap(pod *api.Pod) PodMatchLabelMap {
 		}
 		infoMap := make(PodInfoMap)
 		podInfo := &PodInfo{
+			UID:          pod.UID,
 			IP:           pod.Status.PodIP,
 			Name:         pod.Name,
 			Namespace:    pod.Namespace,
 			Labels:       pod.Labels,
+			HostNetwork:  pod.Spec.HostNetwork,
+			PriorityClassName: pod.Spec.PriorityClassName,
 		}
+		setPodDeletion(podInfo, pod)
 
 		infoMap[pod.Status.PodIP] = podInfo
 		podMatchLabelMap[namespacedLabel] = infoMap
@@ -176,7 +300,9 @@ func PodToPodMatchLabelMap(pod *api.Pod) PodMatchLabelMap {
 	return podMatchLabelMap
 }
 
-func PodToNamespacePodMap(pod *api.Pod) NamespacePodMap {
+// PodToNamespacePodMap builds the namespace map of a running pod,
+// hostNetwork pod is added with its node ip only if hostNetworkPeers is true
+func PodToNamespacePodMap(pod *api.Pod, hostNetworkPeers bool) NamespacePodMap {
 
 	if pod == nil{
 		return nil
@@ -194,7 +320,7 @@ func PodToNamespacePodMap(pod *api.Pod) NamespacePodMap {
 		return nil
 	}
 
-	if pod.Spec.HostNetwork{
+	if pod.Spec.HostNetwork && !hostNetworkPeers{
 		glog.V(6).Infof("skip build pod map because pod: %s/%s host network is true", pod.Namespace, pod.Name)
 		return nil
 	}
@@ -208,11 +334,15 @@ func PodToNamespacePodMap(pod *api.Pod) NamespacePodMap {
 
 	infoMap := make(PodInfoMap)
 	podInfo := &PodInfo{
+		UID:          pod.UID,
 		IP:           pod.Status.PodIP,
 		Name:         pod.Name,
 		Namespace:    pod.Namespace,
 		Labels:       pod.Labels,
+		HostNetwork:  pod.Spec.HostNetwork,
+		PriorityClassName: pod.Spec.PriorityClassName,
 	}
+	setPodDeletion(podInfo, pod)
 
 	infoMap[pod.Status.PodIP] = podInfo
 	namespacePodMap[pod.Namespace] = infoMap
@@ -220,6 +350,20 @@ func PodToNamespacePodMap(pod *api.Pod) NamespacePodMap {
 	return namespacePodMap
 }
 
+// PodInfoMapWithoutHostNetwork returns pods which are not hostNetwork pods,
+// it is used for ipsets of policy targets, so traffic of a node is never judged by pod policy
+func PodInfoMapWithoutHostNetwork(podInfoMap PodInfoMap) PodInfoMap{
+
+	result := make(PodInfoMap)
+	for ip, podInfo := range podInfoMap{
+		if podInfo.HostNetwork{
+			continue
+		}
+		result[ip] = podInfo
+	}
+	return result
+}
+
 func UpdatePodMatchLabelMap(podMatchLabelMap PodMatchLabelMap, changes *PodChangeMap){
 
 	for _, change := range changes.PodItems {
@@ -244,7 +388,7 @@ func (pmlm *PodMatchLabelMap) merge(other PodMatchLabelMap){
 					portInfo.Name,
 					portInfo.IP,
 				)
-				tempInfoMap[ip] = portInfo
+				tempInfoMap.addPod(ip, portInfo)
 			}
 			(*pmlm)[namespaceLabel] = tempInfoMap
 		} else {
@@ -261,12 +405,12 @@ func (pmlm *PodMatchLabelMap) merge(other PodMatchLabelMap){
 						portInfo.IP,
 					)
 				} else {
-					glog.V(1).Infof("exist pod ip, so update pod %s:%s",
+					glog.V(1).Infof("exist pod ip, so add owner pod %s:%s",
 						portInfo.Name,
 						portInfo.IP,
 					)
 				}
-				oldInfoMap[ip] = portInfo
+				oldInfoMap.addPod(ip, portInfo)
 			}
 			(*pmlm)[namespaceLabel] = oldInfoMap
 		}
@@ -286,8 +430,8 @@ func (pmlm *PodMatchLabelMap) unmerge(other PodMatchLabelMap){
 			continue
 		} else {
 			for ip, portInfo := range infoMap{
-				_, hasPod := oldInfoMap[ip]
-				if !hasPod{
+				// ip is kept if it is still owned by another pod
+				if !oldInfoMap.removePod(ip, portInfo){
 					glog.Errorf("try to remove pod from PodMatchLabelMap %s:%s=%s, but pod %s:%s do not exists",
 						namespaceLabel.Namespace,
 						namespaceLabel.LabelKey,
@@ -303,7 +447,6 @@ func (pmlm *PodMatchLabelMap) unmerge(other PodMatchLabelMap){
 						namespaceLabel.LabelKey,
 						namespaceLabel.LabelValue,
 					)
-					delete(oldInfoMap, ip)
 				}
 			}
 		}
@@ -333,7 +476,7 @@ func (npm *NamespacePodMap) merge(other NamespacePodMap){
 					portInfo.Name,
 					portInfo.IP,
 				)
-				tempInfoMap[ip] = portInfo
+				tempInfoMap.addPod(ip, portInfo)
 			}
 			(*npm)[namespace] = tempInfoMap
 		} else {
@@ -346,12 +489,12 @@ func (npm *NamespacePodMap) merge(other NamespacePodMap){
 						portInfo.IP,
 					)
 				} else {
-					glog.V(1).Infof("exist pod ip, so update pod %s:%s",
+					glog.V(1).Infof("exist pod ip, so add owner pod %s:%s",
 						portInfo.Name,
 						portInfo.IP,
 					)
 				}
-				oldInfoMap[ip] = portInfo
+				oldInfoMap.addPod(ip, portInfo)
 			}
 			(*npm)[namespace] = oldInfoMap
 		}
@@ -368,8 +511,8 @@ func (npm *NamespacePodMap) unmerge(other NamespacePodMap){
 			continue
 		}else{
 			for ip, portInfo := range infoMap {
-				_, hasPod := oldInfoMap[ip]
-				if !hasPod{
+				// ip is kept if it is still owned by another pod
+				if !oldInfoMap.removePod(ip, portInfo){
 					glog.Errorf("try to remove pod from PodMatchLabelMap namespace %s, but pod %s:%s do not exists",
 						namespace,
 						portInfo.Name,
@@ -381,7 +524,6 @@ func (npm *NamespacePodMap) unmerge(other NamespacePodMap){
 						portInfo.IP,
 						namespace,
 					)
-					delete(oldInfoMap, ip)
 				}
 			}
 		}
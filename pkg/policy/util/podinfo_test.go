@@ -5,6 +5,7 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"testing"
+	"time"
 )
 
 var podNamespace = []string{
@@ -1426,4 +1427,229 @@ func checkNamespaceMatchLabelMapValid(t *testing.T, nmlMapm, expectedNMLMap Name
 	}
 
 	return true
-}
\ No newline at end of file
+}
+
+// hostNetwork pod is only added to maps when host network peers is enabled
+// and it is filtered out for target pod sets
+func TestPodHostNetworkPeers(t *testing.T){
+
+	hostPod := makeTestPod(podNamespace[0], podName[0], func(pod *api.Pod){
+		pod.Labels = map[string]string{"app": "monitor"}
+		pod.Status.Phase = api.PodRunning
+		pod.Status.PodIP = "192.168.1.10"
+		pod.Spec.HostNetwork = true
+	})
+
+	if PodToPodMatchLabelMap(hostPod, false) != nil || PodToNamespacePodMap(hostPod, false) != nil{
+		t.Errorf("expected hostNetwork pod is skipped when host network peers is disabled")
+	}
+
+	namespacedLabel := NamespacedLabel{Namespace: podNamespace[0], LabelKey: "app", LabelValue: "monitor"}
+	podInfo, ok := PodToPodMatchLabelMap(hostPod, true)[namespacedLabel]["192.168.1.10"]
+	if !ok || !podInfo.HostNetwork{
+		t.Errorf("expected hostNetwork pod with node ip 192.168.1.10 in PodMatchLabelMap")
+	}
+	namespacePodMap := PodToNamespacePodMap(hostPod, true)
+	if _, ok := namespacePodMap[podNamespace[0]]["192.168.1.10"]; !ok{
+		t.Errorf("expected hostNetwork pod with node ip 192.168.1.10 in NamespacePodMap")
+	}
+
+	podInfoMap := PodInfoMap{
+		"192.168.1.10": podInfo,
+		podIP[1]:       &PodInfo{IP: podIP[1], Name: podName[1], Namespace: podNamespace[0]},
+	}
+	targets := PodInfoMapWithoutHostNetwork(podInfoMap)
+	if len(targets) != 1 || targets[podIP[1]] == nil{
+		t.Errorf("expected only pod %s in target pods, get %v", podIP[1], targets)
+	}
+}
+
+type podEvent struct {
+	previous *api.Pod
+	current  *api.Pod
+}
+
+// replayPodEvents applies each batch of pod events as one sync,
+// events in a batch are merged by PodChangeMap and applied in random order like informer events between syncs
+func replayPodEvents(podChanges *PodChangeMap,
+                     podMatchLabelMap PodMatchLabelMap,
+                     namespacePodMap NamespacePodMap,
+                     namespaceMatchLabelMap NamespaceMatchLabelMap,
+                     namespaceInfoMap NamespaceInfoMap,
+                     batches ...[]podEvent){
+
+	for _, batch := range batches{
+		for _, event := range batch{
+			pod := event.current
+			if pod == nil{
+				pod = event.previous
+			}
+			podChanges.Update(&types.NamespacedName{Namespace: pod.Namespace, Name: pod.Name}, event.previous, event.current)
+		}
+		podChanges.Lock.Lock()
+		UpdatePodMatchLabelMap(podMatchLabelMap, podChanges)
+		UpdateNamespacePodMap(namespacePodMap, podChanges)
+		UpdateNamespaceMatchLabelMapByPod(namespaceMatchLabelMap, namespaceInfoMap, podChanges)
+		podChanges.CleanUpItem()
+		podChanges.Lock.Unlock()
+	}
+}
+
+// a deleted pod and a new pod reusing its ip, delayed events of the deleted pod must not
+// remove the ip of the new pod or leave labels of the deleted pod
+func TestPodInfoReuseIP(t *testing.T){
+
+	makePod := func(namespace, name, uid, ip string, labels map[string]string) *api.Pod{
+		return makeTestPod(namespace, name, func(pod *api.Pod){
+			pod.UID = types.UID(uid)
+			pod.Labels = labels
+			pod.Status.Phase = api.PodRunning
+			pod.Status.PodIP = ip
+		})
+	}
+	ip := podIP[0]
+	oldPod := makePod(podNamespace[0], podName[0], "uid-old", ip, map[string]string{"app": "old"})
+	oldPodUpdated := makePod(podNamespace[0], podName[0], "uid-old", ip, map[string]string{"app": "updated"})
+	newPodSameNamespace := makePod(podNamespace[0], podName[1], "uid-new", ip, map[string]string{"app": "old"})
+	newPodOtherNamespace := makePod(podNamespace[1], podName[1], "uid-new", ip, map[string]string{"app": "new"})
+
+	oldLabel := NamespacedLabel{Namespace: podNamespace[0], LabelKey: "app", LabelValue: "old"}
+	updatedLabel := NamespacedLabel{Namespace: podNamespace[0], LabelKey: "app", LabelValue: "updated"}
+	newLabel := NamespacedLabel{Namespace: podNamespace[1], LabelKey: "app", LabelValue: "new"}
+	teamLabel := Label{LabelKey: "team", LabelValue: "a"}
+
+	testCases := []struct {
+		name                    string
+		batches                 [][]podEvent
+		expectedPodMatchLabel   map[NamespacedLabel]string
+		expectedNamespacePod    map[string]string
+	}{
+		{
+			name: "delete event of old pod comes after new pod in other namespace",
+			batches: [][]podEvent{
+				{{nil, oldPod}},
+				{{nil, newPodOtherNamespace}},
+				{{oldPod, nil}},
+			},
+			expectedPodMatchLabel: map[NamespacedLabel]string{newLabel: podName[1]},
+			expectedNamespacePod:  map[string]string{podNamespace[1]: podName[1]},
+		},
+		{
+			name: "delete event of old pod comes after new pod with same labels",
+			batches: [][]podEvent{
+				{{nil, oldPod}},
+				{{nil, newPodSameNamespace}},
+				{{oldPod, nil}},
+			},
+			expectedPodMatchLabel: map[NamespacedLabel]string{oldLabel: podName[1]},
+			expectedNamespacePod:  map[string]string{podNamespace[0]: podName[1]},
+		},
+		{
+			name: "add new pod and delete old pod in one sync",
+			batches: [][]podEvent{
+				{{nil, oldPod}},
+				{{nil, newPodSameNamespace}, {oldPod, nil}},
+			},
+			expectedPodMatchLabel: map[NamespacedLabel]string{oldLabel: podName[1]},
+			expectedNamespacePod:  map[string]string{podNamespace[0]: podName[1]},
+		},
+		{
+			name: "update event of old pod comes after new pod, then old pod is deleted",
+			batches: [][]podEvent{
+				{{nil, oldPod}},
+				{{nil, newPodSameNamespace}},
+				{{oldPod, oldPodUpdated}},
+				{{oldPodUpdated, nil}},
+			},
+			expectedPodMatchLabel: map[NamespacedLabel]string{oldLabel: podName[1]},
+			expectedNamespacePod:  map[string]string{podNamespace[0]: podName[1]},
+		},
+		{
+			name: "new pod is deleted before old pod",
+			batches: [][]podEvent{
+				{{nil, oldPod}, {nil, newPodOtherNamespace}},
+				{{newPodOtherNamespace, nil}},
+			},
+			expectedPodMatchLabel: map[NamespacedLabel]string{oldLabel: podName[0]},
+			expectedNamespacePod:  map[string]string{podNamespace[0]: podName[0]},
+		},
+	}
+
+	for _, tc := range testCases{
+		// events in one batch are applied in random order, so replay several times
+		for i := 0; i < 10; i++{
+			podChanges := NewPodLabelChangeMap()
+			podMatchLabelMap := make(PodMatchLabelMap)
+			namespacePodMap := make(NamespacePodMap)
+			namespaceMatchLabelMap := make(NamespaceMatchLabelMap)
+			namespaceInfoMap := NamespaceInfoMap{
+				podNamespace[0]: {Name: podNamespace[0], Labels: map[string]string{"team": "a"}},
+				podNamespace[1]: {Name: podNamespace[1], Labels: map[string]string{"team": "a"}},
+			}
+
+			replayPodEvents(&podChanges, podMatchLabelMap, namespacePodMap, namespaceMatchLabelMap, namespaceInfoMap, tc.batches...)
+
+			for _, namespacedLabel := range []NamespacedLabel{oldLabel, updatedLabel, newLabel}{
+				podInfo, has := podMatchLabelMap[namespacedLabel][ip]
+				expectedName, expected := tc.expectedPodMatchLabel[namespacedLabel]
+				if has != expected || (has && podInfo.Name != expectedName){
+					t.Errorf("%s: ip %s in PodMatchLabelMap %s:%s=%s is %v %v, expected %v %s", tc.name, ip,
+						namespacedLabel.Namespace, namespacedLabel.LabelKey, namespacedLabel.LabelValue, has, podInfo, expected, expectedName)
+				}
+			}
+			for _, namespace := range []string{podNamespace[0], podNamespace[1]}{
+				podInfo, has := namespacePodMap[namespace][ip]
+				expectedName, expected := tc.expectedNamespacePod[namespace]
+				if has != expected || (has && podInfo.Name != expectedName){
+					t.Errorf("%s: ip %s in NamespacePodMap %s is %v %v, expected %v %s", tc.name, ip, namespace, has, podInfo, expected, expectedName)
+				}
+			}
+			// both namespaces have label team=a, ip is kept until the last pod is deleted
+			podInfo, has := namespaceMatchLabelMap[teamLabel][ip]
+			if !has || podInfo.Owners() != 1{
+				t.Errorf("%s: expected ip %s is owned by 1 pod in NamespaceMatchLabelMap team=a, get %v", tc.name, ip, podInfo)
+			}
+		}
+	}
+}
+
+// terminating pods are kept in peer sets until the grace period ends or dropped at once
+func TestPeerPodInfoMap(t *testing.T){
+
+	now := time.Now()
+	deadline := now.Add(30 * time.Second)
+	terminatingPod := makeTestPod(podNamespace[0], podName[0], func(pod *api.Pod){
+		pod.Status.Phase = api.PodRunning
+		pod.Status.PodIP = podIP[0]
+		pod.DeletionTimestamp = &metav1.Time{Time: deadline}
+	})
+	podInfo := PodToNamespacePodMap(terminatingPod, false)[podNamespace[0]][podIP[0]]
+	if !podInfo.Terminating || !podInfo.DeletionDeadline.Equal(deadline){
+		t.Fatalf("expected terminating pod with deadline %v, get %v", deadline, podInfo)
+	}
+	podInfoMap := PodInfoMap{
+		podIP[0]: podInfo,
+		podIP[1]: &PodInfo{IP: podIP[1], Name: podName[1], Namespace: podNamespace[1]},
+	}
+
+	keep := func(string) string{ return TerminatingPodsKeep }
+	drop := func(namespace string) string{
+		if namespace == podNamespace[0]{
+			return TerminatingPodsDrop
+		}
+		return TerminatingPodsKeep
+	}
+
+	peers, nextDeadline := PeerPodInfoMap(podInfoMap, keep, now)
+	if len(peers) != 2 || !nextDeadline.Equal(deadline){
+		t.Errorf("expected terminating pod is kept until %v, get %v %v", deadline, peers, nextDeadline)
+	}
+	peers, nextDeadline = PeerPodInfoMap(podInfoMap, keep, deadline)
+	if _, ok := peers[podIP[0]]; ok || !nextDeadline.IsZero(){
+		t.Errorf("expected terminating pod is removed after grace period, get %v %v", peers, nextDeadline)
+	}
+	peers, nextDeadline = PeerPodInfoMap(podInfoMap, drop, now)
+	if _, ok := peers[podIP[0]]; ok || len(peers) != 1 || !nextDeadline.IsZero(){
+		t.Errorf("expected terminating pod is dropped at once, get %v %v", peers, nextDeadline)
+	}
+}
@@ -2,6 +2,8 @@ package util
 
 import (
 	api "k8s.io/api/core/v1"
+
+	"time"
 )
 
 // IsPodReady returns true if a pod is ready; false otherwise.
@@ -57,4 +59,56 @@ func IsPodNotReady(pod *api.Pod) bool {
 	default:
 		return true
 	}
-}
\ No newline at end of file
+}
+
+// TerminatingPodsAnnotation selects how terminating pods of a namespace are handled in peer ipsets,
+// value is keep or drop, e.g enn-policy/terminating-pods: drop
+const TerminatingPodsAnnotation = "enn-policy/terminating-pods"
+
+const (
+	// TerminatingPodsKeep keeps a terminating pod allowed until its grace period ends, so connections can be drained
+	TerminatingPodsKeep = "keep"
+	// TerminatingPodsDrop removes a terminating pod from peer ipsets as soon as it has deletionTimestamp
+	TerminatingPodsDrop = "drop"
+)
+
+// IsValidTerminatingPods returns true if mode is keep or drop
+func IsValidTerminatingPods(mode string) bool {
+	return mode == TerminatingPodsKeep || mode == TerminatingPodsDrop
+}
+
+// setPodDeletion records deletionTimestamp of pod, apiserver sets it to the time
+// the grace period ends, so it is the deadline of a terminating pod
+func setPodDeletion(podInfo *PodInfo, pod *api.Pod) {
+	if pod.DeletionTimestamp == nil {
+		return
+	}
+	podInfo.Terminating = true
+	podInfo.DeletionDeadline = pod.DeletionTimestamp.Time
+}
+
+// PeerPodInfoMap returns pods of podInfoMap which are allowed as policy peers at now
+// terminating pod is dropped at once if terminatingPods of its namespace is drop, otherwise it is kept until DeletionDeadline
+// an ip owned by several pods is kept if any of them is allowed
+// nextDeadline is the earliest deadline of kept terminating pods, zero if there is none
+func PeerPodInfoMap(podInfoMap PodInfoMap, terminatingPods func(namespace string) string, now time.Time) (PodInfoMap, time.Time) {
+
+	var nextDeadline time.Time
+	result := make(PodInfoMap)
+	for ip, podInfo := range podInfoMap {
+		for _, pod := range podInfo.pods() {
+			if !pod.Terminating {
+				result[ip] = podInfo
+				continue
+			}
+			if terminatingPods(pod.Namespace) == TerminatingPodsDrop || !now.Before(pod.DeletionDeadline) {
+				continue
+			}
+			result[ip] = podInfo
+			if nextDeadline.IsZero() || pod.DeletionDeadline.Before(nextDeadline) {
+				nextDeadline = pod.DeletionDeadline
+			}
+		}
+	}
+	return result, nextDeadline
+}
@@ -2,6 +2,7 @@ package util
 
 import (
 	policyApi "k8s.io/api/networking/v1"
+	coreApi "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"github.com/golang/glog"
 	"sync"
@@ -38,6 +39,7 @@ type NetworkPolicyInfo struct {
 
 	Name              string
 	Namespace         string
+	UID               types.UID
 
 	// Selects the pods to which this NetworkPolicy object applies.
 	PodSelector       map[string]string
@@ -50,6 +52,22 @@ type NetworkPolicyInfo struct {
 	// List of rule types that the NetworkPolicy relates to.
 	// Valid options are Ingress, Egress, or Ingress,Egress.
 	PolicyType        []string
+	// HostEndpoint is true if the networkPolicy is annotated with HostEndpointAnnotation,
+	// such policy protects nodes instead of pods
+	HostEndpoint      bool
+	// Support is the result of ValidateNetworkPolicy, SupportFull, SupportPartial or SupportNone,
+	// unsupported peers, ports and rules are already removed from Ingress and Egress
+	Support           string
+	// Unsupported lists fields of the networkPolicy which are not enforced by enn-policy, e.g matchExpressions
+	Unsupported       []string
+	// UnsupportedPolicyMode is the value of UnsupportedPolicyModeAnnotation, empty means --unsupported-policy-mode is used
+	UnsupportedPolicyMode string
+	// ExplicitRules are spec.rules of a GlobalNetworkPolicy, always empty for a namespaced networkPolicy
+	ExplicitRules     []ExplicitRule
+	// EgressFQDNs are parsed from EgressFQDNsAnnotation, they are enforced only if PolicyType contains egress
+	EgressFQDNs       []FQDNRule
+	// EgressServices are parsed from EgressServicesAnnotation, they are enforced only if PolicyType contains egress
+	EgressServices    []ServiceRef
 }
 
 // IngressRule describes a particular set of traffic that is allowed to the pods
@@ -144,11 +162,13 @@ func buildNetworkPolicyInfo(networkPolicy *policyApi.NetworkPolicy) *NetworkPoli
 	policy := &NetworkPolicyInfo{
 		Name:         networkPolicy.Name,
 		Namespace:    networkPolicy.Namespace,
+		UID:          networkPolicy.UID,
 		PodSelector:  networkPolicy.Spec.PodSelector.MatchLabels,
 		TargetPods:   make(map[string]PodInfo),
 		Ingress:      make([]IngressRule,0),
 		Egress:       make([]EgressRule,0),
 		PolicyType:   make([]string, 0),
+		HostEndpoint: networkPolicy.Annotations[HostEndpointAnnotation] == "true",
 	}
 
 	for _, policyType := range networkPolicy.Spec.PolicyTypes{
@@ -159,6 +179,36 @@ func buildNetworkPolicyInfo(networkPolicy *policyApi.NetworkPolicy) *NetworkPoli
 		}
 	}
 
+	capability := ValidateNetworkPolicy(networkPolicy)
+	policy.Support = capability.Support
+	policy.Unsupported = capability.Fields
+	if mode, ok := networkPolicy.Annotations[UnsupportedPolicyModeAnnotation]; ok{
+		if IsValidUnsupportedPolicyMode(mode){
+			policy.UnsupportedPolicyMode = mode
+		} else {
+			glog.Warningf("networkPolicy %s/%s has invalid annotation %s=%s, expected %s or %s",
+				networkPolicy.Namespace, networkPolicy.Name, UnsupportedPolicyModeAnnotation, mode,
+				UnsupportedPolicyModeBestEffort, UnsupportedPolicyModeFailClosed)
+		}
+	}
+
+	if value, ok := networkPolicy.Annotations[EgressFQDNsAnnotation]; ok{
+		var err error
+		policy.EgressFQDNs, err = ParseEgressFQDNs(value)
+		if err != nil{
+			glog.Warningf("networkPolicy %s/%s has annotation %s with %v, skip them",
+				networkPolicy.Namespace, networkPolicy.Name, EgressFQDNsAnnotation, err)
+		}
+	}
+	if value, ok := networkPolicy.Annotations[EgressServicesAnnotation]; ok{
+		var err error
+		policy.EgressServices, err = ParseEgressServices(value)
+		if err != nil{
+			glog.Warningf("networkPolicy %s/%s has annotation %s with %v, skip them",
+				networkPolicy.Namespace, networkPolicy.Name, EgressServicesAnnotation, err)
+		}
+	}
+
 	//todo: add targetPods
 
 	// handlle ingress rule map
@@ -171,15 +221,26 @@ func buildNetworkPolicyInfo(networkPolicy *policyApi.NetworkPolicy) *NetworkPoli
 			IPBlock:            make([]CIDRRange, 0),
 		}
 
+		// unsupported ports and peers are not enforced, see ValidateNetworkPolicy
 		for _, specPorts := range specIngress.Ports{
+			if unsupportedPort(specPorts) != ""{
+				continue
+			}
+			protocol := string(coreApi.ProtocolTCP)
+			if specPorts.Protocol != nil{
+				protocol = string(*specPorts.Protocol)
+			}
 			port := PolicyPort{
 				Port:      specPorts.Port.String(),
-				Protocol:  string(*specPorts.Protocol),
+				Protocol:  protocol,
 			}
 			InfoIngress.Ports = append(InfoIngress.Ports, port)
 		}
 
 		for _, specPeer := range specIngress.From{
+			if unsupportedPeer(specPeer) != ""{
+				continue
+			}
 
 			if specPeer.PodSelector != nil{
 				podSelect := LabelSelector{
@@ -215,6 +276,10 @@ func buildNetworkPolicyInfo(networkPolicy *policyApi.NetworkPolicy) *NetworkPoli
 			}
 		}
 
+		if !ruleSupported(len(specIngress.From), len(InfoIngress.PodSelector) + len(InfoIngress.NamespaceSelector) + len(InfoIngress.IPBlock),
+			len(specIngress.Ports), len(InfoIngress.Ports)){
+			continue
+		}
 
 		policy.Ingress = append(policy.Ingress, InfoIngress)
 	}
@@ -229,15 +294,26 @@ func buildNetworkPolicyInfo(networkPolicy *policyApi.NetworkPolicy) *NetworkPoli
 			IPBlock:            make([]CIDRRange, 0),
 		}
 
+		// unsupported ports and peers are not enforced, see ValidateNetworkPolicy
 		for _, specPorts := range specEgress.Ports{
+			if unsupportedPort(specPorts) != ""{
+				continue
+			}
+			protocol := string(coreApi.ProtocolTCP)
+			if specPorts.Protocol != nil{
+				protocol = string(*specPorts.Protocol)
+			}
 			port := PolicyPort{
 				Port:      specPorts.Port.String(),
-				Protocol:  string(*specPorts.Protocol),
+				Protocol:  protocol,
 			}
 			InfoEgress.Ports = append(InfoEgress.Ports, port)
 		}
 
 		for _, specPeer := range specEgress.To{
+			if unsupportedPeer(specPeer) != ""{
+				continue
+			}
 
 			if specPeer.PodSelector != nil {
 				podSelect := LabelSelector{
@@ -274,6 +350,11 @@ func buildNetworkPolicyInfo(networkPolicy *policyApi.NetworkPolicy) *NetworkPoli
 			}
 		}
 
+		if !ruleSupported(len(specEgress.To), len(InfoEgress.PodSelector) + len(InfoEgress.NamespaceSelector) + len(InfoEgress.IPBlock),
+			len(specEgress.Ports), len(InfoEgress.Ports)){
+			continue
+		}
+
 		policy.Egress = append(policy.Egress, InfoEgress)
 	}
 
@@ -6,6 +6,7 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/apimachinery/pkg/types"
+	"fmt"
 	"testing"
 	"reflect"
 	"strings"
@@ -342,6 +343,11 @@ func TestNetworkPolicyMapMultiAdd(t *testing.T){
 	if !ok{
 		t.Errorf("case %d invalid networkPolicy %s:%s", 2, namespace[2], name[2])
 	}
+	// the peers of networkPolicy2 combine podSelector and namespaceSelector, so its rules are reported and not enforced
+	ok = checkCombinedPeersReported(t, networkPolicyMap, networkPolicies[2])
+	if !ok{
+		t.Errorf("case %d unsupported peers are not reported for networkPolicy %s:%s", 2, namespace[2], name[2])
+	}
 
 	// add networkPolicy with multi ingress rule
 	namespaceName = types.NamespacedName{Namespace: networkPolicies[3].Namespace, Name: networkPolicies[0].Name}
@@ -507,6 +513,11 @@ func TestNetworkPolicyMapDelete(t *testing.T){
 			t.Errorf("init add: invalid networkPolicy %s:%s", namespace[i], name[i])
 		}
 	}
+	// the peers of networkPolicy2 combine podSelector and namespaceSelector, so its rules are reported and not enforced
+	ok = checkCombinedPeersReported(t, networkPolicyMap, networkPolicies[2])
+	if !ok{
+		t.Errorf("init add: unsupported peers are not reported for networkPolicy %s:%s", namespace[2], name[2])
+	}
 
 	// 2. delete 4 networkPolicy one by one
 	for i := 0; i < 4; i++{
@@ -700,7 +711,12 @@ func TestNetworkPolicyMapUpdate(t *testing.T){
 	}
 	ok = checkNetworkPolicyValid(t, networkPolicyMap, networkPolicies[1])
 	if !ok{
-		t.Errorf("update networkPolicy to new: invalid networkPolicy %s:%s", namespace[1], name[1])
+		t.Errorf("update networkPolicy to new: invalid networkPolicy %s:%s", namespace[0], name[0])
+	}
+	// the ingress peer of the new networkPolicy combines podSelector and namespaceSelector, so the rule is reported and not enforced
+	ok = checkCombinedPeersReported(t, networkPolicyMap, networkPolicies[1])
+	if !ok{
+		t.Errorf("update networkPolicy to new: unsupported peers are not reported for networkPolicy %s:%s", namespace[0], name[0])
 	}
 
 	// 3. update networkPolicy to initial
@@ -732,8 +748,99 @@ func checkNetworkPolicyNumber(t *testing.T, npMap NetworkPolicyMap, expectNumber
 	return true
 }
 
+// enforcedTestNetworkPolicy returns a copy of networkPolicy without the peers, ports and rules which are not enforced,
+// see ValidateNetworkPolicy
+func enforcedTestNetworkPolicy(networkPolicy *api.NetworkPolicy) *api.NetworkPolicy{
+
+	enforced := networkPolicy.DeepCopy()
+	enforced.Spec.Ingress = nil
+	enforced.Spec.Egress = nil
+	for _, ingress := range networkPolicy.Spec.Ingress{
+		rule := api.NetworkPolicyIngressRule{}
+		for _, peer := range ingress.From{
+			if unsupportedPeer(peer) == ""{
+				rule.From = append(rule.From, peer)
+			}
+		}
+		for _, port := range ingress.Ports{
+			if unsupportedPort(port) == ""{
+				rule.Ports = append(rule.Ports, port)
+			}
+		}
+		if ruleSupported(len(ingress.From), len(rule.From), len(ingress.Ports), len(rule.Ports)){
+			enforced.Spec.Ingress = append(enforced.Spec.Ingress, rule)
+		}
+	}
+	for _, egress := range networkPolicy.Spec.Egress{
+		rule := api.NetworkPolicyEgressRule{}
+		for _, peer := range egress.To{
+			if unsupportedPeer(peer) == ""{
+				rule.To = append(rule.To, peer)
+			}
+		}
+		for _, port := range egress.Ports{
+			if unsupportedPort(port) == ""{
+				rule.Ports = append(rule.Ports, port)
+			}
+		}
+		if ruleSupported(len(egress.To), len(rule.To), len(egress.Ports), len(rule.Ports)){
+			enforced.Spec.Egress = append(enforced.Spec.Egress, rule)
+		}
+	}
+	return enforced
+}
+
+// checkCombinedPeersReported checks every peer of networkPolicy with both podSelector and namespaceSelector
+// is reported as unsupported, checkNetworkPolicyValid checks they are not enforced
+func checkCombinedPeersReported(t *testing.T, npMap NetworkPolicyMap, networkPolicy *api.NetworkPolicy) bool{
+
+	var np *NetworkPolicyInfo
+	for _, info := range npMap{
+		if info.Namespace == networkPolicy.Namespace && info.Name == networkPolicy.Name{
+			np = info
+			break
+		}
+	}
+	if np == nil{
+		t.Errorf("cannot find namespaceName %s:%s", networkPolicy.Namespace, networkPolicy.Name)
+		return false
+	}
+	reported := make(map[string]bool)
+	for _, field := range np.Unsupported{
+		reported[field] = true
+	}
+	var expected []string
+	for i, ingress := range networkPolicy.Spec.Ingress{
+		for j, peer := range ingress.From{
+			if peer.PodSelector != nil && peer.NamespaceSelector != nil{
+				expected = append(expected, fmt.Sprintf("spec.ingress[%d].from[%d]: podSelector combined with namespaceSelector", i, j))
+			}
+		}
+	}
+	for i, egress := range networkPolicy.Spec.Egress{
+		for j, peer := range egress.To{
+			if peer.PodSelector != nil && peer.NamespaceSelector != nil{
+				expected = append(expected, fmt.Sprintf("spec.egress[%d].to[%d]: podSelector combined with namespaceSelector", i, j))
+			}
+		}
+	}
+	if len(expected) == 0 || np.Support != SupportPartial{
+		t.Errorf("expected partially supported policy with combined peers, get support %s", np.Support)
+		return false
+	}
+	for _, field := range expected{
+		if !reported[field]{
+			t.Errorf("expected unsupported field %q, get %v", field, np.Unsupported)
+			return false
+		}
+	}
+	return true
+}
+
 func checkNetworkPolicyValid(t *testing.T, npMap NetworkPolicyMap, networkPolicy *api.NetworkPolicy) bool{
 
+	// unsupported peers, ports and rules are not enforced
+	networkPolicy = enforcedTestNetworkPolicy(networkPolicy)
 	validNamespaceName := false
 	for _, np := range npMap{
 		if np.Namespace == networkPolicy.Namespace && np.Name == networkPolicy.Name{
@@ -956,4 +1063,70 @@ func checkNetworkPolicyValid(t *testing.T, npMap NetworkPolicyMap, networkPolicy
 	}
 
 	return true
-}
\ No newline at end of file
+}
+
+func TestNetworkPolicyUnsupportedFields(t *testing.T){
+
+	expression := metav1.LabelSelectorRequirement{Key: "run", Operator: metav1.LabelSelectorOpIn, Values: []string{"nginx"}}
+	networkPolicy := makeTestNetworkPolicy("ns1", "np1", func(np *api.NetworkPolicy){
+		np.UID = types.UID("uid1")
+		np.Spec.PodSelector.MatchExpressions = []metav1.LabelSelectorRequirement{expression}
+		np.Spec.Ingress = []api.NetworkPolicyIngressRule{{
+			From: []api.NetworkPolicyPeer{
+				{PodSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"run": "client"}}},
+				{NamespaceSelector: &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{expression}}},
+			},
+		}}
+		np.Spec.Egress = []api.NetworkPolicyEgressRule{{
+			To: []api.NetworkPolicyPeer{
+				{PodSelector: &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{expression}}},
+			},
+		}}
+	})
+
+	info := buildNetworkPolicyInfo(networkPolicy)
+	if info.UID != "uid1"{
+		t.Errorf("expected uid uid1, get %s", info.UID)
+	}
+	expected := []string{
+		"spec.podSelector: matchExpressions",
+		"spec.ingress[0].from[1]: namespaceSelector.matchExpressions",
+		"spec.egress[0].to[0]: podSelector.matchExpressions",
+		"spec.egress[0]: whole rule since none of its to or ports is supported",
+	}
+	if !reflect.DeepEqual(info.Unsupported, expected){
+		t.Errorf("expected unsupported fields %v, get %v", expected, info.Unsupported)
+	}
+	if info.Support != SupportNone{
+		t.Errorf("expected support %s, get %s", SupportNone, info.Support)
+	}
+	// unsupported peers and rules are not enforced
+	if len(info.Ingress) != 1 || len(info.Ingress[0].PodSelector) != 1 || len(info.Ingress[0].NamespaceSelector) != 0{
+		t.Errorf("expected ingress rule with only the podSelector peer, get %+v", info.Ingress)
+	}
+	if len(info.Egress) != 0{
+		t.Errorf("expected no egress rule, get %+v", info.Egress)
+	}
+
+	if unsupported := buildNetworkPolicyInfo(makeTestNetworkPolicy("ns1", "np2", func(np *api.NetworkPolicy){})).Unsupported; len(unsupported) != 0{
+		t.Errorf("expected no unsupported field, get %v", unsupported)
+	}
+}
+
+func TestNetworkPolicyEmptyRule(t *testing.T){
+
+	networkPolicy := makeTestNetworkPolicy("ns1", "np1", func(np *api.NetworkPolicy){
+		np.Spec.PolicyTypes = []api.PolicyType{api.PolicyTypeIngress}
+		np.Spec.Ingress = []api.NetworkPolicyIngressRule{{}}
+	})
+
+	info := buildNetworkPolicyInfo(networkPolicy)
+	if info.Support != SupportFull || len(info.Unsupported) != 0{
+		t.Errorf("expected fully supported policy, get support %s with %v", info.Support, info.Unsupported)
+	}
+	// the empty rule is kept, it allows all traffic
+	if len(info.Ingress) != 1 || len(info.Ingress[0].Ports) != 0 || len(info.Ingress[0].PodSelector) != 0 ||
+		len(info.Ingress[0].NamespaceSelector) != 0 || len(info.Ingress[0].IPBlock) != 0{
+		t.Errorf("expected one empty ingress rule, get %+v", info.Ingress)
+	}
+}
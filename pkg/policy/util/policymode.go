@@ -0,0 +1,17 @@
+package util
+
+// PolicyModeAnnotation selects whether policies of a namespace are enforced or only audited,
+// value is enforce or audit, e.g enn-policy/policy-mode: audit
+const PolicyModeAnnotation = "enn-policy/policy-mode"
+
+const (
+	// PolicyModeEnforce denies traffic which is not allowed by policies
+	PolicyModeEnforce = "enforce"
+	// PolicyModeAudit logs and accepts traffic which would be denied, so the effect of policies can be checked before they are enforced
+	PolicyModeAudit   = "audit"
+)
+
+// IsValidPolicyMode returns true if mode is enforce or audit
+func IsValidPolicyMode(mode string) bool {
+	return mode == PolicyModeEnforce || mode == PolicyModeAudit
+}
@@ -0,0 +1,295 @@
+package util
+
+import (
+	api "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"github.com/golang/glog"
+
+	"fmt"
+	"net"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// EgressServicesAnnotation on a NetworkPolicy or a GlobalNetworkPolicy allows egress of the selected pods to services,
+// value is a comma separated list of [namespace/]name, a service without namespace is in the namespace of the policy,
+// e.g enn-policy/egress-services: "payments,kube-system/kube-dns"
+const EgressServicesAnnotation = "enn-policy/egress-services"
+
+// ServiceRef is a service referred by EgressServicesAnnotation, empty Namespace means the namespace of the policy
+type ServiceRef struct {
+	Namespace         string
+	Name              string
+}
+
+// ParseEgressServices parses the value of EgressServicesAnnotation, duplicated services are removed,
+// invalid items are returned in the error and skipped
+func ParseEgressServices(value string) ([]ServiceRef, error){
+
+	var refs []ServiceRef
+	var invalid []string
+	seen := make(map[ServiceRef]bool)
+	for _, item := range strings.Split(value, ","){
+		item = strings.TrimSpace(item)
+		if item == ""{
+			continue
+		}
+		ref := ServiceRef{Name: item}
+		if strs := strings.SplitN(item, "/", 2); len(strs) == 2{
+			ref = ServiceRef{Namespace: strs[0], Name: strs[1]}
+			if errs := validation.IsDNS1123Label(ref.Namespace); len(errs) > 0{
+				invalid = append(invalid, fmt.Sprintf("%q: invalid namespace: %s", item, strings.Join(errs, "; ")))
+				continue
+			}
+		}
+		if errs := validation.IsDNS1035Label(ref.Name); len(errs) > 0{
+			invalid = append(invalid, fmt.Sprintf("%q: invalid service name: %s", item, strings.Join(errs, "; ")))
+			continue
+		}
+		if seen[ref]{
+			continue
+		}
+		seen[ref] = true
+		refs = append(refs, ref)
+	}
+	if len(invalid) > 0{
+		return refs, fmt.Errorf("invalid service %s", strings.Join(invalid, ", "))
+	}
+	return refs, nil
+}
+
+// ServiceInfoMap stores ServiceInfo of all services, key is namespace/name of service
+type ServiceInfoMap map[types.NamespacedName]*ServiceInfo
+
+// ServiceInfo will collect useful information from Service spec
+type ServiceInfo struct {
+
+	Namespace    string
+	Name         string
+	// ClusterIP is empty for headless and ExternalName services
+	ClusterIP    string
+	Ports        []PolicyPort
+}
+
+// EndpointsInfoMap stores EndpointsInfo of all services, key is namespace/name of service
+type EndpointsInfoMap map[types.NamespacedName]*EndpointsInfo
+
+// EndpointsInfo will collect ready addresses and ports from Endpoints subsets
+type EndpointsInfo struct {
+
+	Namespace    string
+	Name         string
+	Endpoints    []ServiceEndpoint
+}
+
+// ServiceEndpoint is an ip and a port which traffic to a service is sent to
+type ServiceEndpoint struct {
+	IP           string
+	Port         PolicyPort
+}
+
+type ServiceChangeMap struct {
+	Lock   sync.Mutex
+	Items  map[types.NamespacedName]*ServiceChange
+}
+
+type ServiceChange struct {
+	Previous *ServiceInfo
+	Current  *ServiceInfo
+}
+
+func NewServiceChangeMap() ServiceChangeMap {
+	return ServiceChangeMap{
+		Items:   make(map[types.NamespacedName]*ServiceChange),
+	}
+}
+
+func (scm *ServiceChangeMap) CleanUpItem(){
+	scm.Items = make(map[types.NamespacedName]*ServiceChange)
+}
+
+func (scm *ServiceChangeMap) Update(namespacedName *types.NamespacedName, previous, current *api.Service) bool{
+
+	glog.V(3).Infof("UpdateServiceChangeMap start")
+
+	scm.Lock.Lock()
+	defer scm.Lock.Unlock()
+
+	change, exists := scm.Items[*namespacedName]
+	if !exists{
+		change = &ServiceChange{}
+		change.Previous = buildServiceInfo(previous)
+		scm.Items[*namespacedName] = change
+	}
+	change.Current = buildServiceInfo(current)
+	if reflect.DeepEqual(change.Previous, change.Current) {
+		delete(scm.Items, *namespacedName)
+	}
+
+	glog.V(6).Infof("ServiceChangeMap changed item number is %d", len(scm.Items))
+	return len(scm.Items) > 0
+}
+
+func buildServiceInfo(service *api.Service) *ServiceInfo{
+
+	if service == nil{
+		return nil
+	}
+
+	serviceInfo := &ServiceInfo{
+		Namespace:  service.Namespace,
+		Name:       service.Name,
+	}
+	if ip := net.ParseIP(service.Spec.ClusterIP); ip != nil && ip.To4() != nil{
+		serviceInfo.ClusterIP = ip.String()
+	}
+	for _, port := range service.Spec.Ports{
+		serviceInfo.Ports = append(serviceInfo.Ports, PolicyPort{
+			Protocol: servicePortProtocol(port.Protocol),
+			Port:     strconv.Itoa(int(port.Port)),
+		})
+	}
+	return serviceInfo
+}
+
+func UpdateServiceInfoMap(serviceInfoMap ServiceInfoMap, changes *ServiceChangeMap) {
+
+	for namespacedName, change := range changes.Items {
+		delete(serviceInfoMap, namespacedName)
+		if change.Current != nil{
+			serviceInfoMap[namespacedName] = change.Current
+		}
+	}
+}
+
+type EndpointsChangeMap struct {
+	Lock   sync.Mutex
+	Items  map[types.NamespacedName]*EndpointsChange
+}
+
+type EndpointsChange struct {
+	Previous *EndpointsInfo
+	Current  *EndpointsInfo
+}
+
+func NewEndpointsChangeMap() EndpointsChangeMap {
+	return EndpointsChangeMap{
+		Items:   make(map[types.NamespacedName]*EndpointsChange),
+	}
+}
+
+func (ecm *EndpointsChangeMap) CleanUpItem(){
+	ecm.Items = make(map[types.NamespacedName]*EndpointsChange)
+}
+
+func (ecm *EndpointsChangeMap) Update(namespacedName *types.NamespacedName, previous, current *api.Endpoints) bool{
+
+	glog.V(3).Infof("UpdateEndpointsChangeMap start")
+
+	ecm.Lock.Lock()
+	defer ecm.Lock.Unlock()
+
+	change, exists := ecm.Items[*namespacedName]
+	if !exists{
+		change = &EndpointsChange{}
+		change.Previous = buildEndpointsInfo(previous)
+		ecm.Items[*namespacedName] = change
+	}
+	change.Current = buildEndpointsInfo(current)
+	if reflect.DeepEqual(change.Previous, change.Current) {
+		delete(ecm.Items, *namespacedName)
+	}
+
+	glog.V(6).Infof("EndpointsChangeMap changed item number is %d", len(ecm.Items))
+	return len(ecm.Items) > 0
+}
+
+// buildEndpointsInfo only keeps ready ipv4 addresses, endpoints are sorted so that a reordered subset is not a change
+func buildEndpointsInfo(endpoints *api.Endpoints) *EndpointsInfo{
+
+	if endpoints == nil{
+		return nil
+	}
+
+	endpointsInfo := &EndpointsInfo{
+		Namespace:  endpoints.Namespace,
+		Name:       endpoints.Name,
+	}
+	for _, subset := range endpoints.Subsets{
+		for _, address := range subset.Addresses{
+			ip := net.ParseIP(address.IP)
+			if ip == nil || ip.To4() == nil{
+				glog.V(4).Infof("skip non ipv4 address %s of endpoints %s/%s", address.IP, endpoints.Namespace, endpoints.Name)
+				continue
+			}
+			for _, port := range subset.Ports{
+				endpointsInfo.Endpoints = append(endpointsInfo.Endpoints, ServiceEndpoint{
+					IP:   ip.String(),
+					Port: PolicyPort{Protocol: servicePortProtocol(port.Protocol), Port: strconv.Itoa(int(port.Port))},
+				})
+			}
+		}
+	}
+	sortServiceEndpoints(endpointsInfo.Endpoints)
+	return endpointsInfo
+}
+
+func UpdateEndpointsInfoMap(endpointsInfoMap EndpointsInfoMap, changes *EndpointsChangeMap) {
+
+	for namespacedName, change := range changes.Items {
+		delete(endpointsInfoMap, namespacedName)
+		if change.Current != nil{
+			endpointsInfoMap[namespacedName] = change.Current
+		}
+	}
+}
+
+// ServiceEndpoints returns the cluster ip with every port of service and the ready endpoints of service,
+// service or endpoints can be nil, the result is sorted and has no duplication
+func ServiceEndpoints(service *ServiceInfo, endpoints *EndpointsInfo) []ServiceEndpoint{
+
+	seen := make(map[ServiceEndpoint]bool)
+	var result []ServiceEndpoint
+	add := func(endpoint ServiceEndpoint){
+		if !seen[endpoint]{
+			seen[endpoint] = true
+			result = append(result, endpoint)
+		}
+	}
+	if service != nil && service.ClusterIP != ""{
+		for _, port := range service.Ports{
+			add(ServiceEndpoint{IP: service.ClusterIP, Port: port})
+		}
+	}
+	if endpoints != nil{
+		for _, endpoint := range endpoints.Endpoints{
+			add(endpoint)
+		}
+	}
+	sortServiceEndpoints(result)
+	return result
+}
+
+// servicePortProtocol returns TCP for ports without protocol, like the defaulting of apiserver
+func servicePortProtocol(protocol api.Protocol) string{
+	if protocol == ""{
+		return string(api.ProtocolTCP)
+	}
+	return string(protocol)
+}
+
+func sortServiceEndpoints(endpoints []ServiceEndpoint){
+	sort.Slice(endpoints, func(i, j int) bool{
+		if endpoints[i].IP != endpoints[j].IP{
+			return endpoints[i].IP < endpoints[j].IP
+		}
+		if endpoints[i].Port.Protocol != endpoints[j].Port.Protocol{
+			return endpoints[i].Port.Protocol < endpoints[j].Port.Protocol
+		}
+		return endpoints[i].Port.Port < endpoints[j].Port.Port
+	})
+}
@@ -0,0 +1,102 @@
+package util
+
+import (
+	api "k8s.io/api/core/v1"
+	networking "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"reflect"
+	"testing"
+)
+
+func TestParseEgressServices(t *testing.T){
+
+	refs, err := ParseEgressServices(" payments, kube-system/kube-dns,payments,Payments,kube_system/dns,kube-system/")
+	if err == nil{
+		t.Errorf("expected error for invalid services")
+	}
+	expected := []ServiceRef{
+		{Name: "payments"},
+		{Namespace: "kube-system", Name: "kube-dns"},
+	}
+	if !reflect.DeepEqual(refs, expected){
+		t.Errorf("expected services %+v, get %+v", expected, refs)
+	}
+}
+
+func TestNetworkPolicyEgressServices(t *testing.T){
+
+	networkPolicy := makeTestNetworkPolicy("default", "payments", func(np *networking.NetworkPolicy){
+		np.Annotations = map[string]string{EgressServicesAnnotation: "payments,kube-system/kube-dns"}
+		np.Spec.PolicyTypes = []networking.PolicyType{networking.PolicyTypeEgress}
+	})
+	info := buildNetworkPolicyInfo(networkPolicy)
+	expected := []ServiceRef{{Name: "payments"}, {Namespace: "kube-system", Name: "kube-dns"}}
+	if !reflect.DeepEqual(info.EgressServices, expected){
+		t.Errorf("expected egress services %+v, get %+v", expected, info.EgressServices)
+	}
+}
+
+func TestServiceEndpoints(t *testing.T){
+
+	namespacedName := types.NamespacedName{Namespace: "default", Name: "payments"}
+	service := &api.Service{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "payments"},
+		Spec: api.ServiceSpec{
+			ClusterIP: "10.96.0.10",
+			Ports: []api.ServicePort{
+				{Name: "http", Port: 80},
+				{Name: "dns", Port: 53, Protocol: api.ProtocolUDP},
+			},
+		},
+	}
+	endpoints := &api.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "payments"},
+		Subsets: []api.EndpointSubset{{
+			Addresses:         []api.EndpointAddress{{IP: "10.0.1.2"}, {IP: "fd00::2"}},
+			NotReadyAddresses: []api.EndpointAddress{{IP: "10.0.1.3"}},
+			Ports:             []api.EndpointPort{{Name: "http", Port: 8080, Protocol: api.ProtocolTCP}},
+		}},
+	}
+
+	serviceChanges := NewServiceChangeMap()
+	endpointsChanges := NewEndpointsChangeMap()
+	if !serviceChanges.Update(&namespacedName, nil, service) || !endpointsChanges.Update(&namespacedName, nil, endpoints){
+		t.Fatalf("expected changes of service and endpoints")
+	}
+	serviceInfoMap := make(ServiceInfoMap)
+	endpointsInfoMap := make(EndpointsInfoMap)
+	UpdateServiceInfoMap(serviceInfoMap, &serviceChanges)
+	UpdateEndpointsInfoMap(endpointsInfoMap, &endpointsChanges)
+
+	// not ready and ipv6 addresses are skipped, ports without protocol are TCP
+	expected := []ServiceEndpoint{
+		{IP: "10.0.1.2", Port: PolicyPort{Protocol: "TCP", Port: "8080"}},
+		{IP: "10.96.0.10", Port: PolicyPort{Protocol: "TCP", Port: "80"}},
+		{IP: "10.96.0.10", Port: PolicyPort{Protocol: "UDP", Port: "53"}},
+	}
+	result := ServiceEndpoints(serviceInfoMap[namespacedName], endpointsInfoMap[namespacedName])
+	if !reflect.DeepEqual(result, expected){
+		t.Errorf("expected endpoints %+v, get %+v", expected, result)
+	}
+
+	// headless service only has its endpoints
+	headless := service.DeepCopy()
+	headless.Spec.ClusterIP = api.ClusterIPNone
+	serviceChanges.CleanUpItem()
+	serviceChanges.Update(&namespacedName, service, headless)
+	UpdateServiceInfoMap(serviceInfoMap, &serviceChanges)
+	result = ServiceEndpoints(serviceInfoMap[namespacedName], endpointsInfoMap[namespacedName])
+	if !reflect.DeepEqual(result, expected[:1]){
+		t.Errorf("expected endpoints %+v of headless service, get %+v", expected[:1], result)
+	}
+
+	// reordered addresses are not a change
+	reordered := endpoints.DeepCopy()
+	reordered.Subsets[0].Addresses = []api.EndpointAddress{{IP: "fd00::2"}, {IP: "10.0.1.2"}}
+	endpointsChanges.CleanUpItem()
+	if endpointsChanges.Update(&namespacedName, endpoints, reordered){
+		t.Errorf("expected no change of reordered endpoints")
+	}
+}
@@ -0,0 +1,264 @@
+package preflight
+
+import (
+	utilexec "k8s.io/utils/exec"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	utilversion "enn-policy/pkg/util/version"
+
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const (
+	// MinIPTablesVersion is the minimum iptables version which supports iptables -C, see k8siptables.MinCheckVersion
+	MinIPTablesVersion = "1.4.11"
+	// MinIPSetVersion is the minimum ipset version which supports hash:ip and hash:net with -exist
+	MinIPSetVersion    = "6.0"
+)
+
+// Checker is a single preflight check, warnings are reported and enn-policy keeps running,
+// errors stop enn-policy at startup unless --ignore-preflight-errors is set
+type Checker interface {
+	Name() string
+	Check() (warnings, errorList []error)
+}
+
+// Result is the result of one Checker
+type Result struct {
+	Name      string
+	Warnings  []error
+	Errors    []error
+}
+
+// RunChecks runs all checks and returns their results in the same order
+func RunChecks(checks []Checker) []Result{
+	results := make([]Result, 0, len(checks))
+	for _, check := range checks{
+		warnings, errorList := check.Check()
+		results = append(results, Result{Name: check.Name(), Warnings: warnings, Errors: errorList})
+	}
+	return results
+}
+
+// Errors returns an aggregate of all errors of results, nil if there is no error
+func Errors(results []Result) error{
+	var errs []error
+	for _, result := range results{
+		for _, err := range result.Errors{
+			errs = append(errs, fmt.Errorf("%s: %v", result.Name, err))
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// DefaultChecks returns all checks of enn-policy, root is the prefix of /proc, /sys and /lib/modules,
+// e.g /host when enn-policy runs in a container with host paths mounted, empty means /
+func DefaultChecks(exec utilexec.Interface, root string) []Checker{
+	return []Checker{
+		BinaryCheck{Exec: exec, Binary: "iptables"},
+		BinaryCheck{Exec: exec, Binary: "iptables-save"},
+		BinaryCheck{Exec: exec, Binary: "iptables-restore"},
+		BinaryCheck{Exec: exec, Binary: "ipset"},
+		VersionCheck{Exec: exec, Binary: "iptables", MinVersion: MinIPTablesVersion},
+		VersionCheck{Exec: exec, Binary: "ipset", MinVersion: MinIPSetVersion},
+		IPTablesModeCheck{Exec: exec},
+		KernelModuleCheck{Root: root, Module: "ip_set"},
+		KernelModuleCheck{Root: root, Module: "xt_set"},
+		// br_netfilter is only needed when pods are connected by a linux bridge, e.g flannel with cni0
+		KernelModuleCheck{Root: root, Module: "br_netfilter", Optional: true},
+		SysctlCheck{Root: root, Sysctl: "net.bridge.bridge-nf-call-iptables", Expected: "1",
+			Reason: "traffic between pods on the same bridge bypasses iptables"},
+		SysctlCheck{Root: root, Sysctl: "net.ipv4.ip_forward", Expected: "1",
+			Reason: "traffic of pods is not forwarded"},
+	}
+}
+
+// BinaryCheck checks if Binary is in PATH
+type BinaryCheck struct {
+	Exec      utilexec.Interface
+	Binary    string
+}
+
+func (c BinaryCheck) Name() string{
+	return "binary " + c.Binary
+}
+
+func (c BinaryCheck) Check() (warnings, errorList []error){
+	if _, err := c.Exec.LookPath(c.Binary); err != nil{
+		return nil, []error{fmt.Errorf("%s is not found in PATH: %v", c.Binary, err)}
+	}
+	return nil, nil
+}
+
+var versionMatcher = regexp.MustCompile("v([0-9]+(\\.[0-9]+)+)")
+
+// VersionCheck checks the version printed by "Binary --version" is at least MinVersion
+type VersionCheck struct {
+	Exec       utilexec.Interface
+	Binary     string
+	MinVersion string
+}
+
+func (c VersionCheck) Name() string{
+	return "version " + c.Binary
+}
+
+func (c VersionCheck) Check() (warnings, errorList []error){
+	if _, err := c.Exec.LookPath(c.Binary); err != nil{
+		// already reported by BinaryCheck
+		return nil, nil
+	}
+	output, err := c.Exec.Command(c.Binary, "--version").CombinedOutput()
+	if err != nil{
+		return []error{fmt.Errorf("can not get version of %s: %v", c.Binary, err)}, nil
+	}
+	match := versionMatcher.FindStringSubmatch(string(output))
+	if match == nil{
+		return []error{fmt.Errorf("no version found in %q", strings.TrimSpace(string(output)))}, nil
+	}
+	version, err := utilversion.ParseGeneric(match[1])
+	if err != nil{
+		return []error{fmt.Errorf("can not parse version %s: %v", match[1], err)}, nil
+	}
+	if version.LessThan(utilversion.MustParseGeneric(c.MinVersion)){
+		return nil, []error{fmt.Errorf("%s version %s is older than %s", c.Binary, version, c.MinVersion)}
+	}
+	return nil, nil
+}
+
+// IPTablesModeCheck checks that enn-policy and kube-proxy use the same iptables backend,
+// iptables 1.8+ is either legacy or nf_tables, and rules of one backend are not seen by the other,
+// so enn-policy rules would never be evaluated together with KUBE-* rules if they differ,
+// like iptables-wrapper, kube-proxy is assumed to use the backend with more KUBE-* rules,
+// KUBE-* rules of the other backend are only a warning if there are at least as many in this backend, e.g stale rules after switching
+type IPTablesModeCheck struct {
+	Exec      utilexec.Interface
+}
+
+func (c IPTablesModeCheck) Name() string{
+	return "iptables mode"
+}
+
+func (c IPTablesModeCheck) Check() (warnings, errorList []error){
+	if _, err := c.Exec.LookPath("iptables"); err != nil{
+		return nil, nil
+	}
+	output, err := c.Exec.Command("iptables", "--version").CombinedOutput()
+	if err != nil{
+		return []error{fmt.Errorf("can not get iptables version: %v", err)}, nil
+	}
+
+	// iptables older than 1.8 does not print the backend and is always legacy
+	mode, other := "legacy", "nft"
+	if strings.Contains(string(output), "nf_tables"){
+		mode, other = "nft", "legacy"
+	}
+	otherSave := "iptables-" + other + "-save"
+	if _, err := c.Exec.LookPath(otherSave); err != nil{
+		return nil, nil
+	}
+	otherRules, err := c.Exec.Command(otherSave).CombinedOutput()
+	if err != nil{
+		return []error{fmt.Errorf("can not run %s: %v", otherSave, err)}, nil
+	}
+	otherCount := bytes.Count(otherRules, []byte("KUBE-"))
+	if otherCount == 0{
+		return nil, nil
+	}
+	rules, err := c.Exec.Command("iptables-save").CombinedOutput()
+	if err != nil{
+		return []error{fmt.Errorf("can not run iptables-save: %v", err)}, nil
+	}
+	if count := bytes.Count(rules, []byte("KUBE-")); count < otherCount{
+		return nil, []error{fmt.Errorf("iptables is in %s mode but more kube-proxy rules (KUBE-*) are found by %s (%d) than by iptables-save (%d), enn-policy must use the same iptables mode as kube-proxy",
+			mode, otherSave, otherCount, count)}
+	}
+	return []error{fmt.Errorf("kube-proxy rules (KUBE-*) are found by both iptables-save and %s, rules of %s mode may be stale", otherSave, other)}, nil
+}
+
+// KernelModuleCheck checks if Module is loaded or can be loaded,
+// a missing Optional module is a warning
+type KernelModuleCheck struct {
+	Root      string
+	Module    string
+	Optional  bool
+}
+
+func (c KernelModuleCheck) Name() string{
+	return "kernel module " + c.Module
+}
+
+func (c KernelModuleCheck) Check() (warnings, errorList []error){
+	// both loaded and built-in modules are in /sys/module
+	if _, err := os.Stat(filepath.Join(c.Root, "/sys/module", c.Module)); err == nil{
+		return nil, nil
+	}
+
+	release, err := ioutil.ReadFile(filepath.Join(c.Root, "/proc/sys/kernel/osrelease"))
+	if err != nil{
+		return []error{fmt.Errorf("%s is not loaded and kernel release is unknown: %v", c.Module, err)}, nil
+	}
+	modulesDir := filepath.Join(c.Root, "/lib/modules", strings.TrimSpace(string(release)))
+	if _, err := os.Stat(modulesDir); err != nil{
+		// e.g enn-policy runs in a container without /lib/modules, the module may still be loaded on demand
+		return []error{fmt.Errorf("%s is not loaded and %s is not found to check if it is available", c.Module, modulesDir)}, nil
+	}
+	for _, file := range []string{"modules.dep", "modules.builtin"}{
+		data, err := ioutil.ReadFile(filepath.Join(modulesDir, file))
+		if err != nil{
+			continue
+		}
+		if moduleListed(data, c.Module){
+			return []error{fmt.Errorf("%s is not loaded, it is loaded on demand or by modprobe %s", c.Module, c.Module)}, nil
+		}
+	}
+
+	err = fmt.Errorf("%s is not loaded and not found in %s", c.Module, modulesDir)
+	if c.Optional{
+		return []error{err}, nil
+	}
+	return nil, []error{err}
+}
+
+// moduleListed returns true if modules.dep or modules.builtin contains module,
+// e.g kernel/net/netfilter/xt_set.ko: kernel/net/netfilter/ipset/ip_set.ko
+func moduleListed(data []byte, module string) bool{
+	for _, line := range strings.Split(string(data), "\n"){
+		path := strings.SplitN(line, ":", 2)[0]
+		name := strings.SplitN(filepath.Base(path), ".", 2)[0]
+		if strings.Replace(name, "-", "_", -1) == module{
+			return true
+		}
+	}
+	return false
+}
+
+// SysctlCheck checks the value of Sysctl is Expected, a different value is a warning
+type SysctlCheck struct {
+	Root      string
+	Sysctl    string
+	Expected  string
+	// Reason is what happens if the value is not expected
+	Reason    string
+}
+
+func (c SysctlCheck) Name() string{
+	return "sysctl " + c.Sysctl
+}
+
+func (c SysctlCheck) Check() (warnings, errorList []error){
+	path := filepath.Join(c.Root, "/proc/sys", strings.Replace(c.Sysctl, ".", "/", -1))
+	data, err := ioutil.ReadFile(path)
+	if err != nil{
+		return []error{fmt.Errorf("%s is not found, %s: %v", c.Sysctl, c.Reason, err)}, nil
+	}
+	if value := strings.TrimSpace(string(data)); value != c.Expected{
+		return []error{fmt.Errorf("%s is %s instead of %s, %s", c.Sysctl, value, c.Expected, c.Reason)}, nil
+	}
+	return nil, nil
+}
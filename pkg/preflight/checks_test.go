@@ -0,0 +1,171 @@
+package preflight
+
+import (
+	"k8s.io/utils/exec"
+	fakeexec "k8s.io/utils/exec/testing"
+
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// newFakeExec returns a FakeExec which finds binaries in paths and prints outputs in order
+func newFakeExec(paths map[string]bool, outputs ...string) *fakeexec.FakeExec{
+	fexec := &fakeexec.FakeExec{
+		LookPathFunc: func(file string) (string, error){
+			if paths[file]{
+				return "/sbin/" + file, nil
+			}
+			return "", fmt.Errorf("executable file not found in $PATH")
+		},
+	}
+	for i := range outputs{
+		output := outputs[i]
+		fcmd := &fakeexec.FakeCmd{
+			CombinedOutputScript: []fakeexec.FakeCombinedOutputAction{
+				func() ([]byte, error){ return []byte(output), nil },
+			},
+		}
+		fexec.CommandScript = append(fexec.CommandScript, func(cmd string, args ...string) exec.Cmd{
+			return fakeexec.InitFakeCmd(fcmd, cmd, args...)
+		})
+	}
+	return fexec
+}
+
+func writeFile(t *testing.T, root, path, data string){
+	path = filepath.Join(root, path)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil{
+		t.Fatalf("create dir error %v", err)
+	}
+	if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil{
+		t.Fatalf("write file error %v", err)
+	}
+}
+
+func checkResult(t *testing.T, name string, check Checker, expectedWarnings, expectedErrors int){
+	warnings, errorList := check.Check()
+	if len(warnings) != expectedWarnings || len(errorList) != expectedErrors{
+		t.Errorf("%s: expected %d warnings and %d errors, get warnings %v errors %v",
+			name, expectedWarnings, expectedErrors, warnings, errorList)
+	}
+}
+
+func TestBinaryAndVersionCheck(t *testing.T){
+
+	paths := map[string]bool{"iptables": true, "ipset": true}
+	checkResult(t, "iptables found", BinaryCheck{Exec: newFakeExec(paths), Binary: "iptables"}, 0, 0)
+	checkResult(t, "iptables-restore not found", BinaryCheck{Exec: newFakeExec(paths), Binary: "iptables-restore"}, 0, 1)
+
+	testCases := []struct {
+		name       string
+		binary     string
+		minVersion string
+		output     string
+		warnings   int
+		errors     int
+	}{
+		{"iptables nft", "iptables", MinIPTablesVersion, "iptables v1.8.4 (nf_tables)", 0, 0},
+		{"iptables too old", "iptables", MinIPTablesVersion, "iptables v1.4.7", 0, 1},
+		{"ipset", "ipset", MinIPSetVersion, "ipset v6.29, protocol version: 6", 0, 0},
+		{"ipset too old", "ipset", MinIPSetVersion, "ipset v4.5, protocol version: 4", 0, 1},
+		{"unknown output", "ipset", MinIPSetVersion, "command not supported", 1, 0},
+	}
+	for _, testCase := range testCases{
+		check := VersionCheck{Exec: newFakeExec(paths, testCase.output), Binary: testCase.binary, MinVersion: testCase.minVersion}
+		checkResult(t, testCase.name, check, testCase.warnings, testCase.errors)
+	}
+	checkResult(t, "missing binary", VersionCheck{Exec: newFakeExec(paths), Binary: "ip6tables", MinVersion: "1.0"}, 0, 0)
+}
+
+func TestIPTablesModeCheck(t *testing.T){
+
+	testCases := []struct {
+		name     string
+		paths    map[string]bool
+		outputs  []string
+		warnings int
+		errors   int
+	}{
+		{
+			name:    "nft without legacy rules",
+			paths:   map[string]bool{"iptables": true, "iptables-legacy-save": true},
+			outputs: []string{"iptables v1.8.4 (nf_tables)", "*filter\n:INPUT ACCEPT [0:0]\nCOMMIT\n"},
+		},
+		{
+			name:    "nft while kube-proxy uses legacy",
+			paths:   map[string]bool{"iptables": true, "iptables-legacy-save": true},
+			outputs: []string{"iptables v1.8.4 (nf_tables)", "*nat\n:KUBE-SERVICES - [0:0]\nCOMMIT\n", "*filter\n:INPUT ACCEPT [0:0]\nCOMMIT\n"},
+			errors:  1,
+		},
+		{
+			name:    "legacy while kube-proxy uses nft",
+			paths:   map[string]bool{"iptables": true, "iptables-nft-save": true},
+			outputs: []string{"iptables v1.8.4 (legacy)", "*nat\n:KUBE-SERVICES - [0:0]\nCOMMIT\n", "*filter\n:INPUT ACCEPT [0:0]\nCOMMIT\n"},
+			errors:  1,
+		},
+		{
+			name:    "stale legacy rules while kube-proxy uses nft",
+			paths:   map[string]bool{"iptables": true, "iptables-legacy-save": true},
+			outputs: []string{"iptables v1.8.4 (nf_tables)", "*nat\n:KUBE-SERVICES - [0:0]\nCOMMIT\n",
+				"*nat\n:KUBE-SERVICES - [0:0]\n:KUBE-NODEPORTS - [0:0]\n-A PREROUTING -j KUBE-SERVICES\nCOMMIT\n"},
+			warnings: 1,
+		},
+		{
+			name:    "old iptables",
+			paths:   map[string]bool{"iptables": true},
+			outputs: []string{"iptables v1.6.1"},
+		},
+	}
+	for _, testCase := range testCases{
+		checkResult(t, testCase.name, IPTablesModeCheck{Exec: newFakeExec(testCase.paths, testCase.outputs...)}, testCase.warnings, testCase.errors)
+	}
+}
+
+func TestKernelModuleAndSysctlCheck(t *testing.T){
+
+	root, err := ioutil.TempDir("", "preflight")
+	if err != nil{
+		t.Fatalf("create temp dir error %v", err)
+	}
+	defer os.RemoveAll(root)
+
+	checkResult(t, "no /lib/modules", KernelModuleCheck{Root: root, Module: "xt_set"}, 1, 0)
+
+	writeFile(t, root, "/sys/module/ip_set/refcnt", "1")
+	writeFile(t, root, "/proc/sys/kernel/osrelease", "4.19.0\n")
+	writeFile(t, root, "/lib/modules/4.19.0/modules.dep",
+		"kernel/net/netfilter/xt_set.ko: kernel/net/netfilter/ipset/ip_set.ko\nkernel/net/bridge/br_netfilter.ko.xz: kernel/net/bridge/bridge.ko\n")
+
+	checkResult(t, "loaded", KernelModuleCheck{Root: root, Module: "ip_set"}, 0, 0)
+	checkResult(t, "available", KernelModuleCheck{Root: root, Module: "xt_set"}, 1, 0)
+	checkResult(t, "compressed module available", KernelModuleCheck{Root: root, Module: "br_netfilter"}, 1, 0)
+	checkResult(t, "missing", KernelModuleCheck{Root: root, Module: "xt_foo"}, 0, 1)
+	checkResult(t, "missing optional", KernelModuleCheck{Root: root, Module: "xt_foo", Optional: true}, 1, 0)
+
+	writeFile(t, root, "/proc/sys/net/ipv4/ip_forward", "1\n")
+	writeFile(t, root, "/proc/sys/net/bridge/bridge-nf-call-iptables", "0\n")
+	checkResult(t, "expected sysctl", SysctlCheck{Root: root, Sysctl: "net.ipv4.ip_forward", Expected: "1"}, 0, 0)
+	checkResult(t, "unexpected sysctl", SysctlCheck{Root: root, Sysctl: "net.bridge.bridge-nf-call-iptables", Expected: "1"}, 1, 0)
+	checkResult(t, "missing sysctl", SysctlCheck{Root: root, Sysctl: "net.ipv6.conf.all.forwarding", Expected: "1"}, 1, 0)
+}
+
+func TestRunChecks(t *testing.T){
+
+	checks := []Checker{
+		BinaryCheck{Exec: newFakeExec(map[string]bool{"ipset": true}), Binary: "ipset"},
+		BinaryCheck{Exec: newFakeExec(nil), Binary: "iptables"},
+	}
+	results := RunChecks(checks)
+	if len(results) != 2 || results[0].Name != "binary ipset" || len(results[1].Errors) != 1{
+		t.Errorf("unexpected results %+v", results)
+	}
+	if err := Errors(results); err == nil{
+		t.Errorf("expected error of missing iptables")
+	}
+	if err := Errors(results[:1]); err != nil{
+		t.Errorf("expected no error, get %v", err)
+	}
+}
@@ -0,0 +1,225 @@
+package conntrack
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"unsafe"
+)
+
+// netlink constants of nfnetlink_conntrack, see linux/netfilter/nfnetlink_conntrack.h
+const (
+	nfnlSubsysCTNetlink = 1
+	ipctnlMsgCTGet      = 1
+	ipctnlMsgCTDelete   = 2
+
+	ctaTupleOrig  = 1
+	ctaTupleReply = 2
+
+	ctaTupleIP    = 1
+	ctaTupleProto = 2
+
+	ctaIPV4Src = 1
+	ctaIPV4Dst = 2
+
+	ctaProtoNum     = 1
+	ctaProtoSrcPort = 2
+	ctaProtoDstPort = 3
+
+	nlaFNested   = 0x8000
+	nlaTypeMask  = 0x3fff
+	nlaHeaderLen = 4
+
+	nfgenmsgLen  = 4
+	afInet       = 2
+)
+
+const (
+	ProtocolTCP  = 6
+	ProtocolUDP  = 17
+	ProtocolSCTP = 132
+)
+
+// Tuple is one direction of a connection
+type Tuple struct {
+	Src      net.IP
+	Dst      net.IP
+	SrcPort  uint16
+	DstPort  uint16
+}
+
+// Flow is an ipv4 conntrack entry
+// Orig is the direction of the first packet, Reply is the expected direction of reply packets,
+// e.g for a connection to a service, Orig.Dst is the cluster ip and Reply.Src is the endpoint after DNAT
+type Flow struct {
+	Protocol uint8
+	Orig     Tuple
+	Reply    Tuple
+}
+
+func (f *Flow) String() string{
+	return fmt.Sprintf("proto=%d src=%s dst=%s sport=%d dport=%d reply-src=%s reply-dst=%s reply-sport=%d reply-dport=%d",
+		f.Protocol, f.Orig.Src, f.Orig.Dst, f.Orig.SrcPort, f.Orig.DstPort,
+		f.Reply.Src, f.Reply.Dst, f.Reply.SrcPort, f.Reply.DstPort)
+}
+
+// Interface is an injectable interface for conntrack table of the node
+type Interface interface {
+	// ListFlows lists ipv4 tcp, udp and sctp conntrack entries
+	ListFlows() ([]Flow, error)
+	// DeleteFlow deletes the conntrack entry of flow by its original tuple
+	DeleteFlow(flow *Flow) error
+}
+
+var nativeEndian binary.ByteOrder
+
+func init(){
+	i := uint16(1)
+	if *(*byte)(unsafe.Pointer(&i)) == 1{
+		nativeEndian = binary.LittleEndian
+	} else {
+		nativeEndian = binary.BigEndian
+	}
+}
+
+// attribute is a netlink attribute, value of a nested attribute is built from children
+type attribute struct {
+	attrType uint16
+	value    []byte
+	children []*attribute
+}
+
+func (a *attribute) encode() []byte{
+	value := a.value
+	attrType := a.attrType
+	if a.children != nil{
+		attrType |= nlaFNested
+		value = nil
+		for _, child := range a.children{
+			value = append(value, child.encode()...)
+		}
+	}
+	length := nlaHeaderLen + len(value)
+	buf := make([]byte, align(length))
+	nativeEndian.PutUint16(buf[0:2], uint16(length))
+	nativeEndian.PutUint16(buf[2:4], attrType)
+	copy(buf[nlaHeaderLen:], value)
+	return buf
+}
+
+func align(length int) int{
+	return (length + 3) &^ 3
+}
+
+func uint16Value(value uint16) []byte{
+	buf := make([]byte, 2)
+	binary.BigEndian.PutUint16(buf, value)
+	return buf
+}
+
+// parseAttributes returns attributes in data by type, nested flag is removed from the type
+func parseAttributes(data []byte) (map[uint16][]byte, error){
+	attrs := make(map[uint16][]byte)
+	for len(data) >= nlaHeaderLen{
+		length := int(nativeEndian.Uint16(data[0:2]))
+		attrType := nativeEndian.Uint16(data[2:4]) & nlaTypeMask
+		if length < nlaHeaderLen || length > len(data){
+			return nil, fmt.Errorf("invalid netlink attribute length %d", length)
+		}
+		attrs[attrType] = data[nlaHeaderLen:length]
+		if align(length) >= len(data){
+			break
+		}
+		data = data[align(length):]
+	}
+	return attrs, nil
+}
+
+// encodeDeleteRequest builds the payload of IPCTNL_MSG_CT_DELETE which matches the original tuple of flow
+func encodeDeleteRequest(flow *Flow) []byte{
+	orig := &attribute{
+		attrType: ctaTupleOrig,
+		children: []*attribute{
+			{
+				attrType: ctaTupleIP,
+				children: []*attribute{
+					{attrType: ctaIPV4Src, value: []byte(flow.Orig.Src.To4())},
+					{attrType: ctaIPV4Dst, value: []byte(flow.Orig.Dst.To4())},
+				},
+			},
+			{
+				attrType: ctaTupleProto,
+				children: []*attribute{
+					{attrType: ctaProtoNum, value: []byte{flow.Protocol}},
+					{attrType: ctaProtoSrcPort, value: uint16Value(flow.Orig.SrcPort)},
+					{attrType: ctaProtoDstPort, value: uint16Value(flow.Orig.DstPort)},
+				},
+			},
+		},
+	}
+	return append(nfgenmsg(), orig.encode()...)
+}
+
+// nfgenmsg is the header of nfnetlink messages: family, version and resource id
+func nfgenmsg() []byte{
+	return []byte{afInet, 0, 0, 0}
+}
+
+// decodeFlow parses the payload of a IPCTNL_MSG_CT_NEW message, ok is false if flow is not tcp, udp or sctp
+func decodeFlow(data []byte) (flow *Flow, ok bool, err error){
+	if len(data) < nfgenmsgLen{
+		return nil, false, fmt.Errorf("conntrack message is too short")
+	}
+	if data[0] != afInet{
+		return nil, false, nil
+	}
+	attrs, err := parseAttributes(data[nfgenmsgLen:])
+	if err != nil{
+		return nil, false, err
+	}
+	flow = &Flow{}
+	var protocol uint8
+	if flow.Orig, protocol, err = decodeTuple(attrs[ctaTupleOrig]); err != nil{
+		return nil, false, err
+	}
+	if flow.Reply, _, err = decodeTuple(attrs[ctaTupleReply]); err != nil{
+		return nil, false, err
+	}
+	flow.Protocol = protocol
+	if protocol != ProtocolTCP && protocol != ProtocolUDP && protocol != ProtocolSCTP{
+		return nil, false, nil
+	}
+	return flow, true, nil
+}
+
+func decodeTuple(data []byte) (tuple Tuple, protocol uint8, err error){
+	attrs, err := parseAttributes(data)
+	if err != nil{
+		return tuple, 0, err
+	}
+	ipAttrs, err := parseAttributes(attrs[ctaTupleIP])
+	if err != nil{
+		return tuple, 0, err
+	}
+	if len(ipAttrs[ctaIPV4Src]) != net.IPv4len || len(ipAttrs[ctaIPV4Dst]) != net.IPv4len{
+		return tuple, 0, fmt.Errorf("conntrack tuple without ipv4 address")
+	}
+	tuple.Src = net.IP(append([]byte{}, ipAttrs[ctaIPV4Src]...))
+	tuple.Dst = net.IP(append([]byte{}, ipAttrs[ctaIPV4Dst]...))
+
+	protoAttrs, err := parseAttributes(attrs[ctaTupleProto])
+	if err != nil{
+		return tuple, 0, err
+	}
+	if len(protoAttrs[ctaProtoNum]) != 1{
+		return tuple, 0, fmt.Errorf("conntrack tuple without protocol")
+	}
+	protocol = protoAttrs[ctaProtoNum][0]
+	if port := protoAttrs[ctaProtoSrcPort]; len(port) == 2{
+		tuple.SrcPort = binary.BigEndian.Uint16(port)
+	}
+	if port := protoAttrs[ctaProtoDstPort]; len(port) == 2{
+		tuple.DstPort = binary.BigEndian.Uint16(port)
+	}
+	return tuple, protocol, nil
+}
@@ -0,0 +1,117 @@
+// +build linux
+
+package conntrack
+
+import (
+	"github.com/golang/glog"
+
+	"fmt"
+	"sync/atomic"
+	"syscall"
+)
+
+// EnnConntrack talks to ctnetlink of the kernel, so the conntrack binary is not needed
+type EnnConntrack struct {
+	seq uint32
+}
+
+func NewEnnConntrack() Interface{
+	return &EnnConntrack{}
+}
+
+func (c *EnnConntrack) ListFlows() ([]Flow, error){
+
+	var flows []Flow
+	err := c.request(ipctnlMsgCTGet, syscall.NLM_F_DUMP, nfgenmsg(), func(message syscall.NetlinkMessage) error{
+		flow, ok, err := decodeFlow(message.Data)
+		if err != nil{
+			glog.V(4).Infof("skip conntrack entry: %v", err)
+			return nil
+		}
+		if ok{
+			flows = append(flows, *flow)
+		}
+		return nil
+	})
+	if err != nil{
+		return nil, fmt.Errorf("list conntrack entries error %v", err)
+	}
+	return flows, nil
+}
+
+func (c *EnnConntrack) DeleteFlow(flow *Flow) error{
+
+	err := c.request(ipctnlMsgCTDelete, syscall.NLM_F_ACK, encodeDeleteRequest(flow), nil)
+	if err == syscall.ENOENT{
+		// the entry is already gone, e.g the connection is closed
+		return nil
+	}
+	if err != nil{
+		return fmt.Errorf("delete conntrack entry %s error %v", flow.String(), err)
+	}
+	return nil
+}
+
+// request sends one ctnetlink message and handles responses until the dump is done or the request is acked
+func (c *EnnConntrack) request(msgType uint16, flags uint16, payload []byte, handle func(syscall.NetlinkMessage) error) error{
+
+	fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_RAW|syscall.SOCK_CLOEXEC, syscall.NETLINK_NETFILTER)
+	if err != nil{
+		return err
+	}
+	defer syscall.Close(fd)
+	if err := syscall.Bind(fd, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK}); err != nil{
+		return err
+	}
+
+	seq := atomic.AddUint32(&c.seq, 1)
+	length := syscall.NLMSG_HDRLEN + len(payload)
+	buf := make([]byte, length)
+	nativeEndian.PutUint32(buf[0:4], uint32(length))
+	nativeEndian.PutUint16(buf[4:6], nfnlSubsysCTNetlink<<8|msgType)
+	nativeEndian.PutUint16(buf[6:8], syscall.NLM_F_REQUEST|flags)
+	nativeEndian.PutUint32(buf[8:12], seq)
+	copy(buf[syscall.NLMSG_HDRLEN:], payload)
+	if err := syscall.Sendto(fd, buf, 0, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK}); err != nil{
+		return err
+	}
+
+	recvBuf := make([]byte, 1<<16)
+	for {
+		n, _, err := syscall.Recvfrom(fd, recvBuf, 0)
+		if err != nil{
+			return err
+		}
+		messages, err := syscall.ParseNetlinkMessage(recvBuf[:n])
+		if err != nil{
+			return err
+		}
+		for _, message := range messages{
+			if message.Header.Seq != seq{
+				continue
+			}
+			switch message.Header.Type{
+			case syscall.NLMSG_DONE:
+				return nil
+			case syscall.NLMSG_ERROR:
+				if len(message.Data) < 4{
+					return fmt.Errorf("invalid netlink error message")
+				}
+				if errno := int32(nativeEndian.Uint32(message.Data[0:4])); errno != 0{
+					return syscall.Errno(-errno)
+				}
+				// ack of a request without dump
+				return nil
+			default:
+				if handle != nil{
+					if err := handle(message); err != nil{
+						return err
+					}
+				}
+			}
+		}
+		if flags&syscall.NLM_F_DUMP == 0 && flags&syscall.NLM_F_ACK == 0{
+			return nil
+		}
+	}
+}
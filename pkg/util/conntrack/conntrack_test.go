@@ -0,0 +1,90 @@
+package conntrack
+
+import (
+	"net"
+	"reflect"
+	"testing"
+)
+
+func tupleAttribute(attrType uint16, protocol uint8, tuple Tuple) *attribute{
+	return &attribute{
+		attrType: attrType,
+		children: []*attribute{
+			{
+				attrType: ctaTupleIP,
+				children: []*attribute{
+					{attrType: ctaIPV4Src, value: []byte(tuple.Src.To4())},
+					{attrType: ctaIPV4Dst, value: []byte(tuple.Dst.To4())},
+				},
+			},
+			{
+				attrType: ctaTupleProto,
+				children: []*attribute{
+					{attrType: ctaProtoNum, value: []byte{protocol}},
+					{attrType: ctaProtoSrcPort, value: uint16Value(tuple.SrcPort)},
+					{attrType: ctaProtoDstPort, value: uint16Value(tuple.DstPort)},
+				},
+			},
+		},
+	}
+}
+
+func TestDecodeFlow(t *testing.T){
+
+	expected := &Flow{
+		Protocol: ProtocolTCP,
+		Orig:     Tuple{Src: net.ParseIP("10.244.1.11").To4(), Dst: net.ParseIP("10.96.0.10").To4(), SrcPort: 40000, DstPort: 8080},
+		Reply:    Tuple{Src: net.ParseIP("10.244.1.10").To4(), Dst: net.ParseIP("10.244.1.11").To4(), SrcPort: 80, DstPort: 40000},
+	}
+	data := nfgenmsg()
+	data = append(data, tupleAttribute(ctaTupleOrig, expected.Protocol, expected.Orig).encode()...)
+	data = append(data, tupleAttribute(ctaTupleReply, expected.Protocol, expected.Reply).encode()...)
+	// attributes which are not used, e.g CTA_STATUS
+	data = append(data, (&attribute{attrType: 3, value: []byte{0, 0, 1, 0x8e}}).encode()...)
+
+	flow, ok, err := decodeFlow(data)
+	if err != nil || !ok{
+		t.Fatalf("expected flow, get ok %v err %v", ok, err)
+	}
+	if !reflect.DeepEqual(flow, expected){
+		t.Errorf("expected flow %s, get %s", expected.String(), flow.String())
+	}
+
+	icmp := nfgenmsg()
+	icmp = append(icmp, tupleAttribute(ctaTupleOrig, 1, expected.Orig).encode()...)
+	icmp = append(icmp, tupleAttribute(ctaTupleReply, 1, expected.Reply).encode()...)
+	if _, ok, err := decodeFlow(icmp); ok || err != nil{
+		t.Errorf("expected icmp flow to be skipped, get ok %v err %v", ok, err)
+	}
+
+	if _, _, err := decodeFlow(append(nfgenmsg(), 0xff, 0, 1, 0)); err == nil{
+		t.Errorf("expected error of invalid attribute length")
+	}
+}
+
+func TestEncodeDeleteRequest(t *testing.T){
+
+	flow := &Flow{
+		Protocol: ProtocolUDP,
+		Orig:     Tuple{Src: net.ParseIP("10.244.1.11"), Dst: net.ParseIP("10.244.1.10"), SrcPort: 5353, DstPort: 53},
+	}
+	data := encodeDeleteRequest(flow)
+	if len(data) % 4 != 0{
+		t.Errorf("expected aligned request, get length %d", len(data))
+	}
+	attrs, err := parseAttributes(data[nfgenmsgLen:])
+	if err != nil{
+		t.Fatalf("parse request error %v", err)
+	}
+	if _, ok := attrs[ctaTupleReply]; ok{
+		t.Errorf("expected only original tuple in request")
+	}
+	tuple, protocol, err := decodeTuple(attrs[ctaTupleOrig])
+	if err != nil{
+		t.Fatalf("decode tuple error %v", err)
+	}
+	if protocol != ProtocolUDP || !tuple.Src.Equal(flow.Orig.Src) || !tuple.Dst.Equal(flow.Orig.Dst) ||
+		tuple.SrcPort != 5353 || tuple.DstPort != 53{
+		t.Errorf("unexpected tuple %+v protocol %d", tuple, protocol)
+	}
+}
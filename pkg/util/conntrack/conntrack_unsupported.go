@@ -0,0 +1,21 @@
+// +build !linux
+
+package conntrack
+
+import (
+	"fmt"
+)
+
+type EnnConntrack struct{}
+
+func NewEnnConntrack() Interface{
+	return &EnnConntrack{}
+}
+
+func (c *EnnConntrack) ListFlows() ([]Flow, error){
+	return nil, fmt.Errorf("conntrack unsupported on this platform")
+}
+
+func (c *EnnConntrack) DeleteFlow(flow *Flow) error{
+	return fmt.Errorf("conntrack unsupported on this platform")
+}
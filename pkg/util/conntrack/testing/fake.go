@@ -0,0 +1,54 @@
+package testing
+
+import (
+	utilconntrack "enn-policy/pkg/util/conntrack"
+	"net"
+)
+
+type Faker struct {
+	Flows    []utilconntrack.Flow
+	// Deleted stores flows deleted by DeleteFlow in order
+	Deleted  []utilconntrack.Flow
+}
+
+func NewFaker(flows ...utilconntrack.Flow) *Faker{
+	return &Faker{
+		Flows: flows,
+	}
+}
+
+func (f *Faker) ListFlows() ([]utilconntrack.Flow, error){
+	return append([]utilconntrack.Flow{}, f.Flows...), nil
+}
+
+func (f *Faker) DeleteFlow(flow *utilconntrack.Flow) error{
+
+	for i := range f.Flows{
+		if f.Flows[i].Protocol == flow.Protocol &&
+			f.Flows[i].Orig.Src.Equal(flow.Orig.Src) && f.Flows[i].Orig.Dst.Equal(flow.Orig.Dst) &&
+			f.Flows[i].Orig.SrcPort == flow.Orig.SrcPort && f.Flows[i].Orig.DstPort == flow.Orig.DstPort{
+			f.Deleted = append(f.Deleted, f.Flows[i])
+			f.Flows = append(f.Flows[:i], f.Flows[i+1:]...)
+			return nil
+		}
+	}
+	return nil
+}
+
+// FlowFrom returns a flow without NAT
+func FlowFrom(protocol uint8, src string, sport uint16, dst string, dport uint16) utilconntrack.Flow{
+	return FlowWithDNAT(protocol, src, sport, dst, dport, dst, dport)
+}
+
+// FlowWithDNAT returns a flow whose destination is translated to endpoint, e.g a connection to a service
+func FlowWithDNAT(protocol uint8, src string, sport uint16, dst string, dport uint16, endpoint string, endpointPort uint16) utilconntrack.Flow{
+	return utilconntrack.Flow{
+		Protocol: protocol,
+		Orig:     utilconntrack.Tuple{Src: parseIP(src), Dst: parseIP(dst), SrcPort: sport, DstPort: dport},
+		Reply:    utilconntrack.Tuple{Src: parseIP(endpoint), Dst: parseIP(src), SrcPort: endpointPort, DstPort: sport},
+	}
+}
+
+func parseIP(ip string) net.IP{
+	return net.ParseIP(ip).To4()
+}
@@ -0,0 +1,166 @@
+package dns
+
+import (
+	"golang.org/x/net/dns/dnsmessage"
+	"github.com/golang/glog"
+
+	"bufio"
+	"fmt"
+	"math/rand"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultResolvConf is read for nameservers if no nameserver is configured
+	DefaultResolvConf = "/etc/resolv.conf"
+	defaultPort       = "53"
+	queryTimeout      = 2 * time.Second
+	// maxUDPSize is the size of the buffer of a response, responses larger than 512 bytes are truncated without edns
+	maxUDPSize        = 512
+)
+
+// Record is an ipv4 address of a name, TTL is how long the answer can be cached
+type Record struct {
+	IP  string
+	TTL time.Duration
+}
+
+// Interface is an injectable interface for resolving names
+type Interface interface {
+	// LookupIPv4 returns the A records of name, including A records of its CNAMEs in the same answer
+	LookupIPv4(name string) ([]Record, error)
+}
+
+// EnnResolver sends A queries over udp to its nameservers in order until one of them answers
+type EnnResolver struct {
+	servers []string
+	timeout time.Duration
+}
+
+func NewEnnResolver(servers []string) Interface{
+	return &EnnResolver{
+		servers: servers,
+		timeout: queryTimeout,
+	}
+}
+
+// ParseNameservers returns nameservers like 10.96.0.10 or 10.96.0.10:53 as ip:port
+func ParseNameservers(nameservers []string) ([]string, error){
+	var servers []string
+	for _, nameserver := range nameservers{
+		host, port, err := net.SplitHostPort(nameserver)
+		if err != nil{
+			host, port = nameserver, defaultPort
+		}
+		if net.ParseIP(host) == nil{
+			return nil, fmt.Errorf("invalid nameserver %q, expected ip or ip:port", nameserver)
+		}
+		servers = append(servers, net.JoinHostPort(host, port))
+	}
+	return servers, nil
+}
+
+// ReadResolvConf returns the nameservers in the resolv.conf file of path as ip:port
+func ReadResolvConf(path string) ([]string, error){
+	file, err := os.Open(path)
+	if err != nil{
+		return nil, err
+	}
+	defer file.Close()
+
+	var nameservers []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan(){
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "nameserver"{
+			nameservers = append(nameservers, fields[1])
+		}
+	}
+	if err := scanner.Err(); err != nil{
+		return nil, err
+	}
+	if len(nameservers) == 0{
+		return nil, fmt.Errorf("no nameserver in %s", path)
+	}
+	return ParseNameservers(nameservers)
+}
+
+func (r *EnnResolver) LookupIPv4(name string) ([]Record, error){
+	if len(r.servers) == 0{
+		return nil, fmt.Errorf("no nameserver to resolve %s", name)
+	}
+	var err error
+	for _, server := range r.servers{
+		var records []Record
+		records, err = r.exchange(server, name)
+		if err == nil{
+			return records, nil
+		}
+		glog.V(4).Infof("resolve %s by nameserver %s failed: %v", name, server, err)
+	}
+	return nil, err
+}
+
+func (r *EnnResolver) exchange(server string, name string) ([]Record, error){
+
+	if !strings.HasSuffix(name, "."){
+		name += "."
+	}
+	questionName, err := dnsmessage.NewName(name)
+	if err != nil{
+		return nil, fmt.Errorf("invalid name %s: %v", name, err)
+	}
+	id := uint16(rand.Intn(1 << 16))
+	query := dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: id, RecursionDesired: true},
+		Questions: []dnsmessage.Question{{Name: questionName, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET}},
+	}
+	packed, err := query.Pack()
+	if err != nil{
+		return nil, err
+	}
+
+	conn, err := net.DialTimeout("udp", server, r.timeout)
+	if err != nil{
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(r.timeout))
+	if _, err := conn.Write(packed); err != nil{
+		return nil, err
+	}
+
+	buf := make([]byte, maxUDPSize)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil{
+			return nil, err
+		}
+		var response dnsmessage.Message
+		if err := response.Unpack(buf[:n]); err != nil || response.ID != id || !response.Response{
+			// not the response of this query, wait for the next one until timeout
+			continue
+		}
+		if response.RCode != dnsmessage.RCodeSuccess{
+			return nil, fmt.Errorf("nameserver %s answers %s with rcode %d", server, name, response.RCode)
+		}
+		if response.Truncated{
+			return nil, fmt.Errorf("nameserver %s answers %s with a truncated response", server, name)
+		}
+		var records []Record
+		for _, answer := range response.Answers{
+			a, ok := answer.Body.(*dnsmessage.AResource)
+			if !ok || answer.Header.Type != dnsmessage.TypeA{
+				continue
+			}
+			records = append(records, Record{
+				IP:  net.IP(a.A[:]).String(),
+				TTL: time.Duration(answer.Header.TTL) * time.Second,
+			})
+		}
+		return records, nil
+	}
+}
@@ -0,0 +1,158 @@
+package dns
+
+import (
+	"golang.org/x/net/dns/dnsmessage"
+
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// testServer is a local nameserver answering A queries from records and cnames
+type testServer struct {
+	conn    net.PacketConn
+	records map[string][]Record
+	cnames  map[string]string
+}
+
+func newTestServer(t *testing.T, records map[string][]Record, cnames map[string]string) *testServer{
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil{
+		t.Fatalf("listen udp error %v", err)
+	}
+	server := &testServer{conn: conn, records: records, cnames: cnames}
+	go server.serve()
+	return server
+}
+
+func (s *testServer) addr() string{
+	return s.conn.LocalAddr().String()
+}
+
+func (s *testServer) serve(){
+	buf := make([]byte, maxUDPSize)
+	for {
+		n, addr, err := s.conn.ReadFrom(buf)
+		if err != nil{
+			return
+		}
+		var query dnsmessage.Message
+		if err := query.Unpack(buf[:n]); err != nil || len(query.Questions) != 1{
+			continue
+		}
+		question := query.Questions[0]
+		response := dnsmessage.Message{
+			Header:    dnsmessage.Header{ID: query.ID, Response: true, RecursionAvailable: true},
+			Questions: query.Questions,
+		}
+		name := question.Name.String()
+		if cname, ok := s.cnames[name]; ok{
+			target, _ := dnsmessage.NewName(cname)
+			response.Answers = append(response.Answers, dnsmessage.Resource{
+				Header: dnsmessage.ResourceHeader{Name: question.Name, Type: dnsmessage.TypeCNAME, Class: dnsmessage.ClassINET, TTL: 3600},
+				Body:   &dnsmessage.CNAMEResource{CNAME: target},
+			})
+			name = cname
+		}
+		records, ok := s.records[name]
+		if !ok{
+			response.RCode = dnsmessage.RCodeNameError
+		}
+		for _, record := range records{
+			resourceName, _ := dnsmessage.NewName(name)
+			var a [4]byte
+			copy(a[:], net.ParseIP(record.IP).To4())
+			response.Answers = append(response.Answers, dnsmessage.Resource{
+				Header: dnsmessage.ResourceHeader{Name: resourceName, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET,
+					TTL: uint32(record.TTL / time.Second)},
+				Body:   &dnsmessage.AResource{A: a},
+			})
+		}
+		packed, err := response.Pack()
+		if err != nil{
+			continue
+		}
+		s.conn.WriteTo(packed, addr)
+	}
+}
+
+func TestLookupIPv4(t *testing.T){
+
+	records := map[string][]Record{
+		"api.partner.com.":    {{IP: "203.0.113.10", TTL: 60 * time.Second}, {IP: "203.0.113.11", TTL: 60 * time.Second}},
+		"edge.cdn.example.":   {{IP: "198.51.100.7", TTL: 20 * time.Second}},
+	}
+	server := newTestServer(t, records, map[string]string{"www.partner.com.": "edge.cdn.example."})
+	defer server.conn.Close()
+
+	// nobody listens on the first nameserver, so the second one answers
+	closed, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil{
+		t.Fatalf("listen udp error %v", err)
+	}
+	closedAddr := closed.LocalAddr().String()
+	closed.Close()
+
+	resolver := NewEnnResolver([]string{closedAddr, server.addr()})
+	got, err := resolver.LookupIPv4("api.partner.com")
+	if err != nil{
+		t.Fatalf("lookup api.partner.com error %v", err)
+	}
+	if !reflect.DeepEqual(got, records["api.partner.com."]){
+		t.Errorf("expected records %v, get %v", records["api.partner.com."], got)
+	}
+
+	// A records of the cname are returned with their own ttl
+	got, err = resolver.LookupIPv4("www.partner.com.")
+	if err != nil || !reflect.DeepEqual(got, records["edge.cdn.example."]){
+		t.Errorf("expected records %v of cname, get %v err %v", records["edge.cdn.example."], got, err)
+	}
+
+	if _, err := resolver.LookupIPv4("missing.partner.com"); err == nil{
+		t.Errorf("expected error for a name which does not exist")
+	}
+	if _, err := NewEnnResolver(nil).LookupIPv4("api.partner.com"); err == nil{
+		t.Errorf("expected error without nameserver")
+	}
+}
+
+func TestReadResolvConf(t *testing.T){
+
+	dir, err := ioutil.TempDir("", "enn-policy-dns")
+	if err != nil{
+		t.Fatalf("create temp dir error %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "resolv.conf")
+	content := "search default.svc.cluster.local svc.cluster.local\nnameserver 10.96.0.10\nnameserver 8.8.8.8\noptions ndots:5\n"
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil{
+		t.Fatalf("write resolv.conf error %v", err)
+	}
+	servers, err := ReadResolvConf(path)
+	if err != nil || !reflect.DeepEqual(servers, []string{"10.96.0.10:53", "8.8.8.8:53"}){
+		t.Errorf("expected nameservers 10.96.0.10:53 and 8.8.8.8:53, get %v err %v", servers, err)
+	}
+
+	if err := ioutil.WriteFile(path, []byte("search local\n"), 0644); err != nil{
+		t.Fatalf("write resolv.conf error %v", err)
+	}
+	if _, err := ReadResolvConf(path); err == nil{
+		t.Errorf("expected error for resolv.conf without nameserver")
+	}
+}
+
+func TestParseNameservers(t *testing.T){
+
+	servers, err := ParseNameservers([]string{"10.96.0.10", "127.0.0.1:5353"})
+	if err != nil || !reflect.DeepEqual(servers, []string{"10.96.0.10:53", "127.0.0.1:5353"}){
+		t.Errorf("unexpected nameservers %v err %v", servers, err)
+	}
+	if _, err := ParseNameservers([]string{"dns.example"}); err == nil{
+		t.Errorf("expected error for nameserver which is not an ip")
+	}
+}
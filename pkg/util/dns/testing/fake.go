@@ -0,0 +1,52 @@
+package testing
+
+import (
+	utildns "enn-policy/pkg/util/dns"
+
+	"fmt"
+	"sync"
+)
+
+// Faker answers LookupIPv4 from Records, a name without records does not exist
+type Faker struct {
+	mu      sync.Mutex
+	Records map[string][]utildns.Record
+	// Lookups counts LookupIPv4 of each name
+	Lookups map[string]int
+}
+
+func NewFaker() *Faker{
+	return &Faker{
+		Records: make(map[string][]utildns.Record),
+		Lookups: make(map[string]int),
+	}
+}
+
+// SetRecords replaces the records of name, no record means the name does not exist
+func (f *Faker) SetRecords(name string, records ...utildns.Record){
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(records) == 0{
+		delete(f.Records, name)
+		return
+	}
+	f.Records[name] = records
+}
+
+// LookupCount returns how many times name is resolved
+func (f *Faker) LookupCount(name string) int{
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.Lookups[name]
+}
+
+func (f *Faker) LookupIPv4(name string) ([]utildns.Record, error){
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.Lookups[name]++
+	records, ok := f.Records[name]
+	if !ok{
+		return nil, fmt.Errorf("name %s does not exist", name)
+	}
+	return append([]utildns.Record{}, records...), nil
+}
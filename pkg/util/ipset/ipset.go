@@ -50,6 +50,8 @@ type IPSet struct {
 	HashSize    int
 	MaxElem     int
 	Reference   int
+	// Timeout is the default timeout in seconds of entries, 0 means the set is created without timeout and entries never expire
+	Timeout     int
 
 }
 
@@ -57,7 +59,11 @@ type Entry struct {
 	Type        string
 	IP          string
 	Port        string
+	// Protocol is the protocol of Port of hash:ip,port and hash:net,port entries, e.g udp, empty means tcp
+	Protocol    string
 	Net         string
+	// Timeout is the timeout in seconds of the entry in a set created with timeout, 0 means the default timeout of the set
+	Timeout     int
 }
 
 type EnnIPSet struct {
@@ -132,6 +138,9 @@ func (e *EnnIPSet) FlushIPSet(set *IPSet) error{
 func (e *EnnIPSet) CreateIPSet(set *IPSet, ignoreExitErr bool) error{
 
 	args := []string{"create", set.Name, set.Type}
+	if set.Timeout > 0{
+		args = append(args, "timeout", strconv.Itoa(set.Timeout))
+	}
 	if ignoreExitErr{
 		args = append(args, "-exist")
 	}
@@ -210,6 +219,9 @@ func (e *EnnIPSet) GetIPSet(name string) (*IPSet, error){
 			if err!= nil{
 				glog.Errorf("get maxelem of ipset %s fail %v", name, err)
 			}
+			if len(str_head_info) > 7 && str_head_info[6] == "timeout"{
+				ipSet.Timeout, _ = strconv.Atoi(str_head_info[7])
+			}
 		}else if strings.HasPrefix(str, "Reference"){
 			str_reference := strings.Split(str,": ")
 			ipSet.Reference, _ = strconv.Atoi(str_reference[1])
@@ -229,6 +241,10 @@ func (e *EnnIPSet) AddEntry(set *IPSet, entry *Entry, ignoreExitErr bool) error{
 		return fmt.Errorf("addEntry fail %v", err)
 	}
 	args := []string{"add", set.Name, entry_string}
+	// ipset -exist add updates the timeout of an existing entry
+	if entry.Timeout > 0{
+		args = append(args, "timeout", strconv.Itoa(entry.Timeout))
+	}
 	if ignoreExitErr{
 		args = append(args, "-exist")
 	}
@@ -277,11 +293,18 @@ func (e *EnnIPSet) ListEntry(set *IPSet) ([]*Entry, error){
 				// if string spilt by "\n", should notice that the last element could be ""
 				continue
 			}
-			entry, err := StringToEntry(set.Type, str)
+			// member of a set with timeout is like 10.0.0.1 timeout 299
+			member, timeout := str, 0
+			if fields := strings.Fields(str); len(fields) == 3 && fields[1] == "timeout"{
+				member = fields[0]
+				timeout, _ = strconv.Atoi(fields[2])
+			}
+			entry, err := StringToEntry(set.Type, member)
 			if err!= nil{
 				glog.Errorf("list entry fail because invalid entry %s : %v", str, err)
 				continue
 			}
+			entry.Timeout = timeout
 			entries = append(entries, entry)
 		}else{
 			if strings.HasPrefix(str, "Members"){
@@ -301,9 +324,9 @@ func EntryToString(entry *Entry) (string, error){
 	case TypeHashNet:
 		return fmt.Sprintf("%s",entry.Net), nil
 	case TypeHashIPPort:
-		return fmt.Sprintf("%s,%s",entry.IP,entry.Port), nil
+		return fmt.Sprintf("%s,%s",entry.IP,entryPortString(entry)), nil
 	case TypeHashNetPort:
-		return fmt.Sprintf("%s,%s",entry.Net,entry.Port), nil
+		return fmt.Sprintf("%s,%s",entry.Net,entryPortString(entry)), nil
 	}
 
 	return "", fmt.Errorf("invalid entry type")
@@ -330,6 +353,7 @@ func StringToEntry(entryType string, entryElem string) (*Entry, error){
 		if len(str) != 2{
 			return nil, fmt.Errorf("invalid entry type:%s, member:%s", entryType, entryElem)
 		}
+		entry.Protocol = str[0]
 		entry.Port = str[1]
 	case TypeHashNetPort:
 		str := strings.Split(entryElem, ",")
@@ -341,10 +365,19 @@ func StringToEntry(entryType string, entryElem string) (*Entry, error){
 		if len(str) != 2{
 			return nil, fmt.Errorf("invalid entry type:%s, member:%s", entryType, entryElem)
 		}
+		entry.Protocol = str[0]
 		entry.Port = str[1]
 	default:
 		return nil, fmt.Errorf("invalid entry type")
 	}
 
 	return entry, nil
-}
\ No newline at end of file
+}
+
+// entryPortString returns the port of entry as ipset lists it, e.g tcp:80
+func entryPortString(entry *Entry) string{
+	if entry.Protocol == ""{
+		return entry.Port
+	}
+	return fmt.Sprintf("%s:%s", entry.Protocol, entry.Port)
+}
@@ -523,4 +523,60 @@ func isCorrectEntry(t *testing.T, testEntry []*Entry, kernelEntry []*Entry, entr
 			t.Errorf("can not find expect entry ip:%s port:%s net:%s type:%s", entry.IP, entry.Port, entry.Net, entryType)
 		}
 	}
-}
\ No newline at end of file
+}
+
+func TestEnnIPSet_Timeout(t *testing.T) {
+
+	execer := exec.New()
+	ipset := NewEnnIPSet(execer)
+
+	set := &IPSet{
+		Name:    "testSetTimeout",
+		Type:    TypeHashIP,
+		Timeout: 300,
+	}
+	err := ipset.CreateIPSet(set, true)
+	if err != nil{
+		t.Fatalf("create ipset fail name:%s type:%s err:%v", set.Name, set.Type, err)
+	}
+	defer ipset.DestroyIPSet(set)
+
+	kernelSet, err := ipset.GetIPSet(set.Name)
+	if err != nil || kernelSet.Timeout != 300{
+		t.Errorf("expected ipset %s with timeout 300, get %+v err %v", set.Name, kernelSet, err)
+	}
+
+	entry := &Entry{Type: TypeHashIP, IP: "10.0.0.1", Timeout: 100}
+	if err := ipset.AddEntry(set, entry, true); err != nil{
+		t.Errorf("add entry fail %v", err)
+	}
+	// adding the entry again updates its timeout
+	entry.Timeout = 200
+	if err := ipset.AddEntry(set, entry, true); err != nil{
+		t.Errorf("add entry again fail %v", err)
+	}
+	kernelEntry, err := ipset.ListEntry(set)
+	if err != nil || len(kernelEntry) != 1{
+		t.Fatalf("expected one entry in %s, get %v err %v", set.Name, kernelEntry, err)
+	}
+	if kernelEntry[0].IP != "10.0.0.1" || kernelEntry[0].Timeout <= 100 || kernelEntry[0].Timeout > 200{
+		t.Errorf("expected entry 10.0.0.1 with timeout in (100, 200], get %+v", kernelEntry[0])
+	}
+}
+
+func TestEntryString(t *testing.T){
+
+	entry := &Entry{Type: TypeHashIPPort, IP: "10.0.0.1", Port: "53", Protocol: ProtocolUDP}
+	member, err := EntryToString(entry)
+	if err != nil || member != "10.0.0.1,udp:53"{
+		t.Fatalf("expected member 10.0.0.1,udp:53, get %s err %v", member, err)
+	}
+	// kernel lists the protocol of a port, so the listed entry gives the same member
+	listed, err := StringToEntry(TypeHashIPPort, member)
+	if err != nil || listed.Protocol != ProtocolUDP || listed.Port != "53"{
+		t.Fatalf("expected entry with port udp:53, get %+v err %v", listed, err)
+	}
+	if listedMember, _ := EntryToString(listed); listedMember != member{
+		t.Errorf("expected member %s of listed entry, get %s", member, listedMember)
+	}
+}
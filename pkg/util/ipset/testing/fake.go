@@ -93,6 +93,15 @@ func (f *Faker) AddEntry(set *utilIPSet.IPSet, entry *utilIPSet.Entry, ignoreExi
 		if reflect.DeepEqual(fakeEntry, entry){
 			return nil
 		}
+		// like ipset -exist add, the timeout of an existing entry is updated
+		if fakeEntry.Timeout != entry.Timeout{
+			existing := *fakeEntry
+			existing.Timeout = entry.Timeout
+			if reflect.DeepEqual(&existing, entry){
+				fakeEntry.Timeout = entry.Timeout
+				return nil
+			}
+		}
 	}
 	entries = append(entries, entry)
 	f.FakeSet[set] = entries
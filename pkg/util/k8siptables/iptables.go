@@ -56,6 +56,9 @@ type Interface interface {
 	IsIpv6() bool
 	// SaveInto calls `iptables-save` for table and stores result in a given buffer.
 	SaveInto(table Table, buffer *bytes.Buffer) error
+	// SaveCountersInto is the same as SaveInto except that packet and byte counters of rules are saved too, e.g
+	// [10:600] -A chain -j ACCEPT
+	SaveCountersInto(table Table, buffer *bytes.Buffer) error
 	// Restore runs `iptables-restore` passing data through []byte.
 	// table is the Table to restore
 	// data should be formatted like the output of SaveInto()
@@ -312,12 +315,20 @@ func (runner *runner) IsIpv6() bool {
 
 // SaveInto is part of Interface.
 func (runner *runner) SaveInto(table Table, buffer *bytes.Buffer) error {
+	return runner.saveInto([]string{"-t", string(table)}, buffer)
+}
+
+// SaveCountersInto is part of Interface.
+func (runner *runner) SaveCountersInto(table Table, buffer *bytes.Buffer) error {
+	return runner.saveInto([]string{"-c", "-t", string(table)}, buffer)
+}
+
+func (runner *runner) saveInto(args []string, buffer *bytes.Buffer) error {
 	runner.mu.Lock()
 	defer runner.mu.Unlock()
 
 	// run and return
 	iptablesSaveCmd := iptablesSaveCommand(runner.protocol)
-	args := []string{"-t", string(table)}
 	glog.V(4).Infof("running %s %v", iptablesSaveCmd, args)
 	cmd := runner.exec.Command(iptablesSaveCmd, args...)
 	// Since CombinedOutput() doesn't support redirecting it to a buffer,
@@ -994,6 +994,79 @@ func TestSaveIntoIPv6(t *testing.T) {
 	testSaveInto(t, ProtocolIpv6)
 }
 
+func testSaveCountersInto(t *testing.T, protocol Protocol) {
+	version := " v1.9.22"
+	iptablesCmd := iptablesCommand(protocol)
+	iptablesSaveCmd := iptablesSaveCommand(protocol)
+	iptablesRestoreCmd := iptablesRestoreCommand(protocol)
+	protoStr := protocolStr(protocol)
+
+	output := fmt.Sprintf(`# Generated by %s on Thu Jan 19 11:38:09 2017
+*filter
+:INPUT ACCEPT [15079:38410730]
+:FORWARD ACCEPT [0:0]
+:OUTPUT ACCEPT [11045:521562]
+[10:600] -A FORWARD -j ACCEPT
+COMMIT
+# Completed on Thu Jan 19 11:38:09 2017`, iptablesSaveCmd+version)
+
+	fcmd := fakeexec.FakeCmd{
+		CombinedOutputScript: []fakeexec.FakeCombinedOutputAction{
+			// iptables version check
+			func() ([]byte, error) { return []byte(iptablesCmd + version), nil },
+			// iptables-restore version check
+			func() ([]byte, error) { return []byte(iptablesRestoreCmd + version), nil },
+		},
+		RunScript: []fakeexec.FakeRunAction{
+			func() ([]byte, []byte, error) { return []byte(output), nil, nil },
+			func() ([]byte, []byte, error) { return nil, nil, &fakeexec.FakeExitError{Status: 1} },
+		},
+	}
+	fexec := fakeexec.FakeExec{
+		CommandScript: []fakeexec.FakeCommandAction{
+			func(cmd string, args ...string) exec.Cmd { return fakeexec.InitFakeCmd(&fcmd, cmd, args...) },
+			func(cmd string, args ...string) exec.Cmd { return fakeexec.InitFakeCmd(&fcmd, cmd, args...) },
+			func(cmd string, args ...string) exec.Cmd { return fakeexec.InitFakeCmd(&fcmd, cmd, args...) },
+			func(cmd string, args ...string) exec.Cmd { return fakeexec.InitFakeCmd(&fcmd, cmd, args...) },
+		},
+	}
+	runner := New(&fexec, dbus.NewFake(nil, nil), protocol)
+	defer runner.Destroy()
+	buffer := bytes.NewBuffer(nil)
+
+	// Success.
+	err := runner.SaveCountersInto(TableFilter, buffer)
+	if err != nil {
+		t.Fatalf("%s: Expected success, got %v", protoStr, err)
+	}
+
+	if string(buffer.Bytes()[:len(output)]) != output {
+		t.Errorf("%s: Expected output '%s', got '%v'", protoStr, output, buffer.Bytes())
+	}
+
+	if fcmd.RunCalls != 1 {
+		t.Errorf("%s: Expected 1 Run() call, got %d", protoStr, fcmd.RunCalls)
+	}
+	if !sets.NewString(fcmd.RunLog[0]...).HasAll(iptablesSaveCmd, "-c", "-t", "filter") {
+		t.Errorf("%s: Expected cmd containing '%s -c -t filter', got '%s'", protoStr, iptablesSaveCmd, fcmd.RunLog[0])
+	}
+
+	// Failure.
+	buffer.Reset()
+	err = runner.SaveCountersInto(TableFilter, buffer)
+	if err == nil {
+		t.Errorf("%s: Expected failure", protoStr)
+	}
+}
+
+func TestSaveCountersIntoIPv4(t *testing.T) {
+	testSaveCountersInto(t, ProtocolIpv4)
+}
+
+func TestSaveCountersIntoIPv6(t *testing.T) {
+	testSaveCountersInto(t, ProtocolIpv6)
+}
+
 func testRestore(t *testing.T, protocol Protocol) {
 	version := " v1.9.22"
 	iptablesCmd := iptablesCommand(protocol)
@@ -0,0 +1,149 @@
+package metrics
+
+import (
+	"github.com/golang/glog"
+
+	"bytes"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// GaugeVec is a gauge partitioned by labels, exported in prometheus text format,
+// enn-policy only needs a few metrics so it does not depend on the prometheus client
+// a GaugeVec created by NewCounterVec is exported as a counter and should only be changed by Add
+type GaugeVec struct {
+	mu          sync.Mutex
+	name        string
+	help        string
+	metricType  string
+	labelNames  []string
+	// values is keyed by label values joined with '\xff'
+	values      map[string]float64
+}
+
+func NewGaugeVec(name, help string, labelNames ...string) *GaugeVec{
+	return &GaugeVec{
+		name:       name,
+		help:       help,
+		metricType: "gauge",
+		labelNames: labelNames,
+		values:     make(map[string]float64),
+	}
+}
+
+// NewCounterVec returns a GaugeVec which is exported as a counter
+func NewCounterVec(name, help string, labelNames ...string) *GaugeVec{
+	counter := NewGaugeVec(name, help, labelNames...)
+	counter.metricType = "counter"
+	return counter
+}
+
+// Set sets the gauge of labelValues, labelValues must have the same length as labelNames
+func (g *GaugeVec) Set(value float64, labelValues ...string){
+	if len(labelValues) != len(g.labelNames){
+		glog.Errorf("metric %s expects %d label values, get %v", g.name, len(g.labelNames), labelValues)
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.values[strings.Join(labelValues, "\xff")] = value
+}
+
+// Add adds delta to the gauge or counter of labelValues
+func (g *GaugeVec) Add(delta float64, labelValues ...string){
+	if len(labelValues) != len(g.labelNames){
+		glog.Errorf("metric %s expects %d label values, get %v", g.name, len(g.labelNames), labelValues)
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.values[strings.Join(labelValues, "\xff")] += delta
+}
+
+// Reset deletes all label values, e.g before setting all gauges again
+func (g *GaugeVec) Reset(){
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.values = make(map[string]float64)
+}
+
+func (g *GaugeVec) writeTo(buf *bytes.Buffer){
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	fmt.Fprintf(buf, "# HELP %s %s\n", g.name, g.help)
+	fmt.Fprintf(buf, "# TYPE %s %s\n", g.name, g.metricType)
+	keys := make([]string, 0, len(g.values))
+	for key := range g.values{
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys{
+		buf.WriteString(g.name)
+		if len(g.labelNames) > 0{
+			var labels []string
+			for i, labelValue := range strings.Split(key, "\xff"){
+				labels = append(labels, fmt.Sprintf("%s=%q", g.labelNames[i], labelValue))
+			}
+			buf.WriteString("{" + strings.Join(labels, ",") + "}")
+		}
+		fmt.Fprintf(buf, " %v\n", g.values[key])
+	}
+}
+
+// Registry holds metrics exported by Handler
+type Registry struct {
+	mu          sync.Mutex
+	gauges      []*GaugeVec
+}
+
+var DefaultRegistry = &Registry{}
+
+func (r *Registry) MustRegister(gauges ...*GaugeVec){
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, gauge := range gauges{
+		for _, registered := range r.gauges{
+			if registered.name == gauge.name{
+				panic(fmt.Sprintf("metric %s is already registered", gauge.name))
+			}
+		}
+		r.gauges = append(r.gauges, gauge)
+	}
+}
+
+// Gather returns all registered metrics in prometheus text format
+func (r *Registry) Gather() []byte{
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	buf := bytes.NewBuffer(nil)
+	for _, gauge := range r.gauges{
+		gauge.writeTo(buf)
+	}
+	return buf.Bytes()
+}
+
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request){
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	w.Write(r.Gather())
+}
+
+func MustRegister(gauges ...*GaugeVec){
+	DefaultRegistry.MustRegister(gauges...)
+}
+
+// ListenAndServe serves /metrics of DefaultRegistry on bindAddress in background
+func ListenAndServe(bindAddress string){
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", DefaultRegistry)
+	go func(){
+		glog.V(0).Infof("serve metrics on %s/metrics", bindAddress)
+		if err := http.ListenAndServe(bindAddress, mux); err != nil{
+			glog.Errorf("serve metrics on %s error %v", bindAddress, err)
+		}
+	}()
+}
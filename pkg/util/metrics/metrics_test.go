@@ -0,0 +1,62 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRegistryGather(t *testing.T){
+
+	registry := &Registry{}
+	policies := NewGaugeVec("test_network_policies", "Number of NetworkPolicies", "support", "mode")
+	syncs := NewGaugeVec("test_last_sync", "Time of last sync")
+	hits := NewCounterVec("test_hits_total", "Number of hits", "policy")
+	registry.MustRegister(policies, syncs, hits)
+
+	policies.Set(2, "partial", "best-effort")
+	policies.Set(1, "full", "best-effort")
+	policies.Set(3, "full", "best-effort")
+	// wrong number of label values is ignored
+	policies.Set(1, "full")
+	syncs.Set(1.5)
+	hits.Add(1, "np1")
+	hits.Add(2, "np1")
+
+	expected := `# HELP test_network_policies Number of NetworkPolicies
+# TYPE test_network_policies gauge
+test_network_policies{support="full",mode="best-effort"} 3
+test_network_policies{support="partial",mode="best-effort"} 2
+# HELP test_last_sync Time of last sync
+# TYPE test_last_sync gauge
+test_last_sync 1.5
+# HELP test_hits_total Number of hits
+# TYPE test_hits_total counter
+test_hits_total{policy="np1"} 3
+`
+	if output := string(registry.Gather()); output != expected{
+		t.Errorf("expected metrics:\n%s\nget:\n%s", expected, output)
+	}
+
+	policies.Reset()
+	hits.Reset()
+	recorder := httptest.NewRecorder()
+	registry.ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	expected = `# HELP test_network_policies Number of NetworkPolicies
+# TYPE test_network_policies gauge
+# HELP test_last_sync Time of last sync
+# TYPE test_last_sync gauge
+test_last_sync 1.5
+# HELP test_hits_total Number of hits
+# TYPE test_hits_total counter
+`
+	if output := recorder.Body.String(); output != expected{
+		t.Errorf("expected metrics after reset:\n%s\nget:\n%s", expected, output)
+	}
+
+	defer func(){
+		if recover() == nil{
+			t.Errorf("expected panic when a metric is registered twice")
+		}
+	}()
+	registry.MustRegister(NewGaugeVec("test_last_sync", "duplicated"))
+}
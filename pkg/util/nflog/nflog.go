@@ -0,0 +1,185 @@
+package nflog
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"time"
+	"unsafe"
+)
+
+// netlink constants of nfnetlink_log, see linux/netfilter/nfnetlink_log.h
+const (
+	nfnlSubsysULOG  = 4
+	nfulnlMsgPacket = 0
+	nfulnlMsgConfig = 1
+
+	nfulaPacketHdr  = 1
+	nfulaTimestamp  = 4
+	nfulaPayload    = 9
+	nfulaPrefix     = 10
+
+	nfulaCfgCmd     = 1
+	nfulaCfgMode    = 2
+
+	nfulnlCfgCmdBind   = 1
+	nfulnlCfgCmdPFBind = 3
+	nfulnlCopyPacket   = 2
+
+	nlaTypeMask  = 0x3fff
+	nlaHeaderLen = 4
+
+	nfgenmsgLen  = 4
+	afUnspec     = 0
+	afInet       = 2
+
+	// copyRange is enough for the ipv4 header with options and ports of tcp, udp and sctp
+	copyRange    = 128
+)
+
+const (
+	ProtocolICMP = 1
+	ProtocolTCP  = 6
+	ProtocolUDP  = 17
+	ProtocolSCTP = 132
+)
+
+// Packet is an ipv4 packet logged by an iptables NFLOG rule
+type Packet struct {
+	// Prefix is --nflog-prefix of the rule which logs the packet
+	Prefix    string
+	Protocol  uint8
+	Src       net.IP
+	Dst       net.IP
+	// SrcPort and DstPort are 0 if Protocol is not tcp, udp or sctp
+	SrcPort   uint16
+	DstPort   uint16
+	// Timestamp is zero if the kernel does not report it, e.g the packet is logged in OUTPUT
+	Timestamp time.Time
+}
+
+// Interface is an injectable interface for NFLOG groups of the node
+type Interface interface {
+	// Listen binds group and calls handle for each logged packet until stopCh is closed
+	Listen(group uint16, stopCh <-chan struct{}, handle func(*Packet)) error
+}
+
+var nativeEndian binary.ByteOrder
+
+func init(){
+	i := uint16(1)
+	if *(*byte)(unsafe.Pointer(&i)) == 1{
+		nativeEndian = binary.LittleEndian
+	} else {
+		nativeEndian = binary.BigEndian
+	}
+}
+
+func align(length int) int{
+	return (length + 3) &^ 3
+}
+
+func encodeAttribute(attrType uint16, value []byte) []byte{
+	length := nlaHeaderLen + len(value)
+	buf := make([]byte, align(length))
+	nativeEndian.PutUint16(buf[0:2], uint16(length))
+	nativeEndian.PutUint16(buf[2:4], attrType)
+	copy(buf[nlaHeaderLen:], value)
+	return buf
+}
+
+// parseAttributes returns attributes in data by type, nested flag is removed from the type
+func parseAttributes(data []byte) (map[uint16][]byte, error){
+	attrs := make(map[uint16][]byte)
+	for len(data) >= nlaHeaderLen{
+		length := int(nativeEndian.Uint16(data[0:2]))
+		attrType := nativeEndian.Uint16(data[2:4]) & nlaTypeMask
+		if length < nlaHeaderLen || length > len(data){
+			return nil, fmt.Errorf("invalid netlink attribute length %d", length)
+		}
+		attrs[attrType] = data[nlaHeaderLen:length]
+		if align(length) >= len(data){
+			break
+		}
+		data = data[align(length):]
+	}
+	return attrs, nil
+}
+
+// nfgenmsg is the header of nfnetlink messages: family, version and resource id in network byte order
+func nfgenmsg(family uint8, resID uint16) []byte{
+	buf := []byte{family, 0, 0, 0}
+	binary.BigEndian.PutUint16(buf[2:4], resID)
+	return buf
+}
+
+// encodeCmdRequest builds the payload of NFULNL_MSG_CONFIG with command cmd
+func encodeCmdRequest(family uint8, group uint16, cmd uint8) []byte{
+	return append(nfgenmsg(family, group), encodeAttribute(nfulaCfgCmd, []byte{cmd})...)
+}
+
+// encodeModeRequest builds the payload of NFULNL_MSG_CONFIG which copies the first copyRange bytes of packets
+func encodeModeRequest(group uint16) []byte{
+	mode := make([]byte, 6)
+	binary.BigEndian.PutUint32(mode[0:4], copyRange)
+	mode[4] = nfulnlCopyPacket
+	return append(nfgenmsg(afUnspec, group), encodeAttribute(nfulaCfgMode, mode)...)
+}
+
+// decodePacket parses the payload of a NFULNL_MSG_PACKET message, ok is false if the packet is not ipv4
+func decodePacket(data []byte) (packet *Packet, ok bool, err error){
+	if len(data) < nfgenmsgLen{
+		return nil, false, fmt.Errorf("nflog message is too short")
+	}
+	if data[0] != afInet{
+		return nil, false, nil
+	}
+	attrs, err := parseAttributes(data[nfgenmsgLen:])
+	if err != nil{
+		return nil, false, err
+	}
+	packet = &Packet{}
+	if prefix, ok := attrs[nfulaPrefix]; ok{
+		// the prefix is null terminated
+		for i, c := range prefix{
+			if c == 0{
+				prefix = prefix[:i]
+				break
+			}
+		}
+		packet.Prefix = string(prefix)
+	}
+	if timestamp, ok := attrs[nfulaTimestamp]; ok && len(timestamp) >= 16{
+		sec := int64(binary.BigEndian.Uint64(timestamp[0:8]))
+		usec := int64(binary.BigEndian.Uint64(timestamp[8:16]))
+		packet.Timestamp = time.Unix(sec, usec * int64(time.Microsecond))
+	}
+	if err := decodeIPv4(attrs[nfulaPayload], packet); err != nil{
+		return nil, false, err
+	}
+	return packet, true, nil
+}
+
+// decodeIPv4 reads protocol, addresses and ports of the ipv4 header and the transport header in payload
+func decodeIPv4(payload []byte, packet *Packet) error{
+	if len(payload) < 20 || payload[0]>>4 != 4{
+		return fmt.Errorf("invalid ipv4 payload of length %d", len(payload))
+	}
+	headerLen := int(payload[0]&0x0f) * 4
+	if headerLen < 20 || headerLen > len(payload){
+		return fmt.Errorf("invalid ipv4 header length %d", headerLen)
+	}
+	packet.Protocol = payload[9]
+	packet.Src = net.IP(append([]byte{}, payload[12:16]...))
+	packet.Dst = net.IP(append([]byte{}, payload[16:20]...))
+	// ports are only in the first fragment
+	fragmentOffset := binary.BigEndian.Uint16(payload[6:8]) & 0x1fff
+	switch packet.Protocol{
+	case ProtocolTCP, ProtocolUDP, ProtocolSCTP:
+		if fragmentOffset == 0 && len(payload) >= headerLen + 4{
+			packet.SrcPort = binary.BigEndian.Uint16(payload[headerLen:headerLen+2])
+			packet.DstPort = binary.BigEndian.Uint16(payload[headerLen+2:headerLen+4])
+		}
+	}
+	return nil
+}
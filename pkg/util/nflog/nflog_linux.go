@@ -0,0 +1,126 @@
+// +build linux
+
+package nflog
+
+import (
+	"github.com/golang/glog"
+
+	"fmt"
+	"sync/atomic"
+	"syscall"
+)
+
+// EnnNFLog reads NFLOG groups through nfnetlink_log of the kernel, so ulogd is not needed
+type EnnNFLog struct {
+	seq uint32
+}
+
+func NewEnnNFLog() Interface{
+	return &EnnNFLog{}
+}
+
+func (n *EnnNFLog) Listen(group uint16, stopCh <-chan struct{}, handle func(*Packet)) error{
+
+	fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_RAW|syscall.SOCK_CLOEXEC, syscall.NETLINK_NETFILTER)
+	if err != nil{
+		return fmt.Errorf("open nfnetlink socket error %v", err)
+	}
+	defer syscall.Close(fd)
+	if err := syscall.Bind(fd, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK}); err != nil{
+		return fmt.Errorf("bind nfnetlink socket error %v", err)
+	}
+	// the socket is read with a timeout so that stopCh is checked
+	timeout := syscall.NsecToTimeval(int64(1e9))
+	if err := syscall.SetsockoptTimeval(fd, syscall.SOL_SOCKET, syscall.SO_RCVTIMEO, &timeout); err != nil{
+		return fmt.Errorf("set timeout of nfnetlink socket error %v", err)
+	}
+
+	// kernels before 3.17 need nfnetlink_log to be bound to AF_INET, newer kernels ignore it
+	if err := n.config(fd, encodeCmdRequest(afInet, 0, nfulnlCfgCmdPFBind)); err != nil{
+		glog.V(4).Infof("bind nflog to AF_INET: %v", err)
+	}
+	if err := n.config(fd, encodeCmdRequest(afUnspec, group, nfulnlCfgCmdBind)); err != nil{
+		return fmt.Errorf("bind nflog group %d error %v, is it used by another program?", group, err)
+	}
+	if err := n.config(fd, encodeModeRequest(group)); err != nil{
+		return fmt.Errorf("set copy mode of nflog group %d error %v", group, err)
+	}
+
+	buf := make([]byte, 1<<16)
+	for {
+		select {
+		case <-stopCh:
+			return nil
+		default:
+		}
+		length, _, err := syscall.Recvfrom(fd, buf, 0)
+		if err == syscall.EAGAIN || err == syscall.EINTR{
+			continue
+		}
+		if err == syscall.ENOBUFS{
+			glog.V(2).Infof("nflog group %d is overrun, some packets are not logged", group)
+			continue
+		}
+		if err != nil{
+			return fmt.Errorf("read nflog group %d error %v", group, err)
+		}
+		messages, err := syscall.ParseNetlinkMessage(buf[:length])
+		if err != nil{
+			glog.V(4).Infof("skip invalid nflog message: %v", err)
+			continue
+		}
+		for _, message := range messages{
+			if message.Header.Type != nfnlSubsysULOG<<8|nfulnlMsgPacket{
+				continue
+			}
+			packet, ok, err := decodePacket(message.Data)
+			if err != nil{
+				glog.V(4).Infof("skip nflog packet: %v", err)
+				continue
+			}
+			if ok{
+				handle(packet)
+			}
+		}
+	}
+}
+
+// config sends a NFULNL_MSG_CONFIG request and waits for its ack
+func (n *EnnNFLog) config(fd int, payload []byte) error{
+
+	seq := atomic.AddUint32(&n.seq, 1)
+	length := syscall.NLMSG_HDRLEN + len(payload)
+	buf := make([]byte, length)
+	nativeEndian.PutUint32(buf[0:4], uint32(length))
+	nativeEndian.PutUint16(buf[4:6], nfnlSubsysULOG<<8|nfulnlMsgConfig)
+	nativeEndian.PutUint16(buf[6:8], syscall.NLM_F_REQUEST|syscall.NLM_F_ACK)
+	nativeEndian.PutUint32(buf[8:12], seq)
+	copy(buf[syscall.NLMSG_HDRLEN:], payload)
+	if err := syscall.Sendto(fd, buf, 0, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK}); err != nil{
+		return err
+	}
+
+	recvBuf := make([]byte, 1<<12)
+	for {
+		n, _, err := syscall.Recvfrom(fd, recvBuf, 0)
+		if err != nil{
+			return err
+		}
+		messages, err := syscall.ParseNetlinkMessage(recvBuf[:n])
+		if err != nil{
+			return err
+		}
+		for _, message := range messages{
+			if message.Header.Seq != seq || message.Header.Type != syscall.NLMSG_ERROR{
+				continue
+			}
+			if len(message.Data) < 4{
+				return fmt.Errorf("invalid netlink error message")
+			}
+			if errno := int32(nativeEndian.Uint32(message.Data[0:4])); errno != 0{
+				return syscall.Errno(-errno)
+			}
+			return nil
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package nflog
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+)
+
+func ipv4Payload(protocol uint8, src, dst string, sport, dport uint16) []byte{
+	payload := make([]byte, 24)
+	payload[0] = 0x45
+	payload[9] = protocol
+	copy(payload[12:16], net.ParseIP(src).To4())
+	copy(payload[16:20], net.ParseIP(dst).To4())
+	binary.BigEndian.PutUint16(payload[20:22], sport)
+	binary.BigEndian.PutUint16(payload[22:24], dport)
+	return payload
+}
+
+func TestDecodePacket(t *testing.T){
+
+	timestamp := make([]byte, 16)
+	binary.BigEndian.PutUint64(timestamp[0:8], 1500000000)
+	binary.BigEndian.PutUint64(timestamp[8:16], 500)
+
+	data := nfgenmsg(afInet, 100)
+	data = append(data, encodeAttribute(nfulaPacketHdr, []byte{0x08, 0x00, 3, 0})...)
+	data = append(data, encodeAttribute(nfulaPrefix, append([]byte("ENN:I:ns1/*"), 0))...)
+	data = append(data, encodeAttribute(nfulaTimestamp, timestamp)...)
+	data = append(data, encodeAttribute(nfulaPayload, ipv4Payload(ProtocolTCP, "10.244.1.11", "10.244.1.10", 40000, 80))...)
+
+	packet, ok, err := decodePacket(data)
+	if err != nil || !ok{
+		t.Fatalf("expected packet, get ok %v err %v", ok, err)
+	}
+	if packet.Prefix != "ENN:I:ns1/*" || packet.Protocol != ProtocolTCP ||
+		!packet.Src.Equal(net.ParseIP("10.244.1.11")) || !packet.Dst.Equal(net.ParseIP("10.244.1.10")) ||
+		packet.SrcPort != 40000 || packet.DstPort != 80{
+		t.Errorf("unexpected packet %+v", packet)
+	}
+	if packet.Timestamp.Unix() != 1500000000 || packet.Timestamp.Nanosecond() != 500000{
+		t.Errorf("unexpected timestamp %v", packet.Timestamp)
+	}
+
+	icmp := nfgenmsg(afInet, 100)
+	icmp = append(icmp, encodeAttribute(nfulaPayload, ipv4Payload(ProtocolICMP, "10.244.1.11", "10.244.1.10", 0x0800, 0))...)
+	packet, ok, err = decodePacket(icmp)
+	if err != nil || !ok || packet.SrcPort != 0 || packet.DstPort != 0{
+		t.Errorf("expected icmp packet without ports, get %+v ok %v err %v", packet, ok, err)
+	}
+
+	if _, ok, err := decodePacket(nfgenmsg(10, 100)); ok || err != nil{
+		t.Errorf("expected ipv6 packet to be skipped, get ok %v err %v", ok, err)
+	}
+	short := append(nfgenmsg(afInet, 100), encodeAttribute(nfulaPayload, []byte{0x45, 0})...)
+	if _, _, err := decodePacket(short); err == nil{
+		t.Errorf("expected error of short payload")
+	}
+}
+
+func TestEncodeConfigRequest(t *testing.T){
+
+	data := encodeModeRequest(100)
+	if binary.BigEndian.Uint16(data[2:4]) != 100{
+		t.Errorf("expected group 100 in resource id, get %v", data[0:4])
+	}
+	attrs, err := parseAttributes(data[nfgenmsgLen:])
+	if err != nil{
+		t.Fatalf("parse request error %v", err)
+	}
+	mode := attrs[nfulaCfgMode]
+	if len(mode) != 6 || binary.BigEndian.Uint32(mode[0:4]) != copyRange || mode[4] != nfulnlCopyPacket{
+		t.Errorf("unexpected copy mode %v", mode)
+	}
+
+	data = encodeCmdRequest(afUnspec, 100, nfulnlCfgCmdBind)
+	attrs, err = parseAttributes(data[nfgenmsgLen:])
+	if err != nil{
+		t.Fatalf("parse request error %v", err)
+	}
+	if cmd := attrs[nfulaCfgCmd]; len(cmd) != 1 || cmd[0] != nfulnlCfgCmdBind{
+		t.Errorf("unexpected command %v", cmd)
+	}
+}
@@ -0,0 +1,17 @@
+// +build !linux
+
+package nflog
+
+import (
+	"fmt"
+)
+
+type EnnNFLog struct{}
+
+func NewEnnNFLog() Interface{
+	return &EnnNFLog{}
+}
+
+func (n *EnnNFLog) Listen(group uint16, stopCh <-chan struct{}, handle func(*Packet)) error{
+	return fmt.Errorf("nflog unsupported on this platform")
+}
@@ -0,0 +1,40 @@
+package testing
+
+import (
+	utilnflog "enn-policy/pkg/util/nflog"
+	"net"
+)
+
+// Faker hands Packets to the handler of Listen in order, then waits for stopCh
+type Faker struct {
+	Packets []*utilnflog.Packet
+	// Group is the group of the last Listen
+	Group   uint16
+}
+
+func NewFaker(packets ...*utilnflog.Packet) *Faker{
+	return &Faker{
+		Packets: packets,
+	}
+}
+
+func (f *Faker) Listen(group uint16, stopCh <-chan struct{}, handle func(*utilnflog.Packet)) error{
+	f.Group = group
+	for _, packet := range f.Packets{
+		handle(packet)
+	}
+	<-stopCh
+	return nil
+}
+
+// PacketFrom returns a packet logged with prefix
+func PacketFrom(prefix string, protocol uint8, src string, sport uint16, dst string, dport uint16) *utilnflog.Packet{
+	return &utilnflog.Packet{
+		Prefix:   prefix,
+		Protocol: protocol,
+		Src:      net.ParseIP(src).To4(),
+		Dst:      net.ParseIP(dst).To4(),
+		SrcPort:  sport,
+		DstPort:  dport,
+	}
+}